@@ -0,0 +1,369 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package archive implements client side archive extraction
+SSSP - Golang SSSP protocol implementation
+
+It is intended for use with servers that have archive unpacking
+disabled, the members of zip, tar, gzip and bzip2 archives are
+extracted locally and each member is submitted via SCANDATA.
+*/
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	defaultMaxDepth     = 5
+	defaultMaxFiles     = 1000
+	defaultMaxSize      = 100 * 1024 * 1024
+	defaultMaxTotalSize = 500 * 1024 * 1024
+	dirScanErr          = "Scanning directories is not supported"
+)
+
+var (
+	// ErrTooManyFiles is returned when an archive contains more
+	// members than the configured limit
+	ErrTooManyFiles = errors.New("Archive file count limit exceeded")
+	// ErrTooLarge is returned when an archive member or the total
+	// extracted size exceeds the configured limit
+	ErrTooLarge = errors.New("Archive size limit exceeded")
+)
+
+// A Format represents an archive format
+type Format int
+
+const (
+	// Unknown represents data that is not a supported archive
+	Unknown Format = iota
+	// Zip represents the zip format
+	Zip
+	// Tar represents the tar format
+	Tar
+	// Gzip represents the gzip format
+	Gzip
+	// Bzip2 represents the bzip2 format
+	Bzip2
+)
+
+func (f Format) String() (s string) {
+	n := [...]string{
+		"",
+		"Zip",
+		"Tar",
+		"Gzip",
+		"Bzip2",
+	}
+	if f < Zip || f > Bzip2 {
+		s = ""
+		return
+	}
+	s = n[f]
+	return
+}
+
+// Scanner is the interface used to scan the extracted members
+type Scanner interface {
+	ScanReader(io.Reader) (*sssp.Response, error)
+}
+
+// An Extractor extracts archives and scans their members
+type Extractor struct {
+	scanner      Scanner
+	maxDepth     int
+	maxFiles     int
+	maxSize      int64
+	maxTotalSize int64
+}
+
+type state struct {
+	root  string
+	files int
+	total int64
+	r     []*sssp.Response
+}
+
+// SetMaxDepth sets the maximum archive nesting depth, archives
+// nested deeper than this are submitted to the server as is
+func (e *Extractor) SetMaxDepth(n int) {
+	if n > 0 {
+		e.maxDepth = n
+	}
+}
+
+// SetMaxFiles sets the maximum number of members that will be
+// extracted from a single archive including nested archives
+func (e *Extractor) SetMaxFiles(n int) {
+	if n > 0 {
+		e.maxFiles = n
+	}
+}
+
+// SetMaxSize sets the maximum size of a single extracted member
+func (e *Extractor) SetMaxSize(n int64) {
+	if n > 0 {
+		e.maxSize = n
+	}
+}
+
+// SetMaxTotalSize sets the maximum total size of all the
+// members extracted from a single archive
+func (e *Extractor) SetMaxTotalSize(n int64) {
+	if n > 0 {
+		e.maxTotalSize = n
+	}
+}
+
+// ScanFile extracts the archive at p and scans each member,
+// files that are not archives are scanned as is
+func (e *Extractor) ScanFile(p string) (r []*sssp.Response, err error) {
+	var f *os.File
+	var stat os.FileInfo
+
+	if stat, err = os.Stat(p); err != nil {
+		return
+	}
+
+	if stat.IsDir() {
+		err = fmt.Errorf(dirScanErr)
+		return
+	}
+
+	if f, err = os.Open(p); err != nil {
+		return
+	}
+	defer f.Close()
+
+	r, err = e.ScanReader(p, f)
+
+	return
+}
+
+// ScanReader extracts the archive read from i and scans each
+// member, name is used as the Filename of the responses
+func (e *Extractor) ScanReader(name string, i io.Reader) (r []*sssp.Response, err error) {
+	var b []byte
+
+	s := &state{root: name}
+
+	if b, err = e.readAll(s, i); err != nil {
+		return
+	}
+
+	err = e.process(s, "", b, 0)
+	r = s.r
+
+	return
+}
+
+func (e *Extractor) readAll(s *state, i io.Reader) (b []byte, err error) {
+	if b, err = ioutil.ReadAll(io.LimitReader(i, e.maxSize+1)); err != nil {
+		return
+	}
+
+	if int64(len(b)) > e.maxSize {
+		err = ErrTooLarge
+		return
+	}
+
+	s.total += int64(len(b))
+	if s.total > e.maxTotalSize {
+		err = ErrTooLarge
+		return
+	}
+
+	return
+}
+
+func (e *Extractor) process(s *state, item string, b []byte, depth int) (err error) {
+	f := Detect(b)
+	if f == Unknown || depth >= e.maxDepth {
+		err = e.scan(s, item, b)
+		return
+	}
+
+	prefix := item + "/" + f.String()
+
+	switch f {
+	case Zip:
+		err = e.processZip(s, prefix, b, depth)
+	case Tar:
+		err = e.processTar(s, prefix, b, depth)
+	case Gzip:
+		err = e.processGzip(s, item, prefix, b, depth)
+	case Bzip2:
+		err = e.processBzip2(s, item, prefix, b, depth)
+	}
+
+	return
+}
+
+func (e *Extractor) member(s *state, prefix, name string, i io.Reader, depth int) (err error) {
+	var b []byte
+
+	s.files++
+	if s.files > e.maxFiles {
+		err = ErrTooManyFiles
+		return
+	}
+
+	if b, err = e.readAll(s, i); err != nil {
+		return
+	}
+
+	err = e.process(s, prefix+"/"+strings.TrimLeft(name, "/"), b, depth+1)
+
+	return
+}
+
+func (e *Extractor) processZip(s *state, prefix string, b []byte, depth int) (err error) {
+	var zr *zip.Reader
+	var rc io.ReadCloser
+
+	if zr, err = zip.NewReader(bytes.NewReader(b), int64(len(b))); err != nil {
+		return
+	}
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		if rc, err = zf.Open(); err != nil {
+			return
+		}
+		err = e.member(s, prefix, zf.Name, rc, depth)
+		rc.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (e *Extractor) processTar(s *state, prefix string, b []byte, depth int) (err error) {
+	var hdr *tar.Header
+
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		if hdr, err = tr.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err = e.member(s, prefix, hdr.Name, tr, depth); err != nil {
+			return
+		}
+	}
+}
+
+func (e *Extractor) processGzip(s *state, item, prefix string, b []byte, depth int) (err error) {
+	var gr *gzip.Reader
+
+	if gr, err = gzip.NewReader(bytes.NewReader(b)); err != nil {
+		return
+	}
+	defer gr.Close()
+
+	name := gr.Name
+	if name == "" {
+		name = stripExt(item, s.root)
+	}
+
+	err = e.member(s, prefix, name, gr, depth)
+
+	return
+}
+
+func (e *Extractor) processBzip2(s *state, item, prefix string, b []byte, depth int) (err error) {
+	br := bzip2.NewReader(bytes.NewReader(b))
+	err = e.member(s, prefix, stripExt(item, s.root), br, depth)
+
+	return
+}
+
+func (e *Extractor) scan(s *state, item string, b []byte) (err error) {
+	var rs *sssp.Response
+
+	if rs, err = e.scanner.ScanReader(bytes.NewReader(b)); err != nil {
+		if rs == nil {
+			return
+		}
+		rs.ErrorOccured = true
+		err = nil
+	}
+
+	rs.Filename = s.root
+	if item != "" {
+		rs.ArchiveItem = item
+	}
+	s.r = append(s.r, rs)
+
+	return
+}
+
+// Detect returns the archive format of b
+func Detect(b []byte) (f Format) {
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		f = Zip
+	case bytes.HasPrefix(b, []byte("\x1f\x8b")):
+		f = Gzip
+	case bytes.HasPrefix(b, []byte("BZh")):
+		f = Bzip2
+	case len(b) > 262 && bytes.HasPrefix(b[257:], []byte("ustar")):
+		f = Tar
+	default:
+		f = Unknown
+	}
+
+	return
+}
+
+func stripExt(item, root string) (s string) {
+	s = item
+	if s == "" {
+		s = root
+	}
+	s = path.Base(s)
+	if ext := path.Ext(s); ext != "" && ext != s {
+		s = strings.TrimSuffix(s, ext)
+	}
+
+	return
+}
+
+// NewExtractor creates and returns a new Extractor that uses s
+// to scan the extracted members
+func NewExtractor(s Scanner) (e *Extractor) {
+	e = &Extractor{
+		scanner:      s,
+		maxDepth:     defaultMaxDepth,
+		maxFiles:     defaultMaxFiles,
+		maxSize:      defaultMaxSize,
+		maxTotalSize: defaultMaxTotalSize,
+	}
+
+	return
+}
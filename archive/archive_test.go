@@ -0,0 +1,211 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package archive implements client side archive extraction
+SSSP - Golang SSSP protocol implementation
+*/
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+type fakeScanner struct {
+	calls int
+}
+
+func (f *fakeScanner) ScanReader(i io.Reader) (r *sssp.Response, err error) {
+	var b []byte
+
+	f.calls++
+	if b, err = ioutil.ReadAll(i); err != nil {
+		return
+	}
+	r = &sssp.Response{Filename: "stream"}
+	if bytes.Contains(b, []byte("EICAR")) {
+		r.Infected = true
+		r.Signature = "EICAR-AV-Test"
+	}
+
+	return
+}
+
+type FormatTestKey struct {
+	in  Format
+	out string
+}
+
+var TestFormats = []FormatTestKey{
+	{Zip, "Zip"},
+	{Tar, "Tar"},
+	{Gzip, "Gzip"},
+	{Bzip2, "Bzip2"},
+	{Unknown, ""},
+	{Format(100), ""},
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range TestFormats {
+		if s := tt.in.String(); s != tt.out {
+			t.Errorf("%q.String() = %q, want %q", tt.in, s, tt.out)
+		}
+	}
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for n, c := range files {
+		w, e := zw.Create(n)
+		if e != nil {
+			t.Fatalf("zw.Create(%q) failed: %s", n, e)
+		}
+		w.Write([]byte(c))
+	}
+	zw.Close()
+	return b.Bytes()
+}
+
+func makeTarGz(t *testing.T, name, content string) []byte {
+	var tb, gb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(content))
+	tw.Close()
+	gw := gzip.NewWriter(&gb)
+	gw.Write(tb.Bytes())
+	gw.Close()
+	return gb.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	if f := Detect(makeZip(t, map[string]string{"a.txt": "a"})); f != Zip {
+		t.Errorf("Detect() = %s, want %s", f, Zip)
+	}
+	if f := Detect(makeTarGz(t, "a.txt", "a")); f != Gzip {
+		t.Errorf("Detect() = %s, want %s", f, Gzip)
+	}
+	if f := Detect([]byte("BZh91AY")); f != Bzip2 {
+		t.Errorf("Detect() = %s, want %s", f, Bzip2)
+	}
+	if f := Detect([]byte(eicarVirus)); f != Unknown {
+		t.Errorf("Detect() = %s, want %s", f, Unknown)
+	}
+}
+
+func TestScanZip(t *testing.T) {
+	s := &fakeScanner{}
+	e := NewExtractor(s)
+	b := makeZip(t, map[string]string{"clean.txt": "hello", "eicar.txt": eicarVirus})
+	r, err := e.ScanReader("test.zip", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 2 {
+		t.Fatalf("len(r) = %d, want %d", len(r), 2)
+	}
+	found := false
+	for _, rs := range r {
+		if rs.Filename != "test.zip" {
+			t.Errorf("rs.Filename = %q, want %q", rs.Filename, "test.zip")
+		}
+		if rs.Infected {
+			found = true
+			if rs.ArchiveItem != "/Zip/eicar.txt" {
+				t.Errorf("rs.ArchiveItem = %q, want %q", rs.ArchiveItem, "/Zip/eicar.txt")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("The infected member was not found")
+	}
+}
+
+func TestScanNested(t *testing.T) {
+	s := &fakeScanner{}
+	e := NewExtractor(s)
+	b := makeZip(t, map[string]string{"inner.tar.gz": string(makeTarGz(t, "eicar.txt", eicarVirus))})
+	r, err := e.ScanReader("test.zip", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("len(r) = %d, want %d", len(r), 1)
+	}
+	exp := "/Zip/inner.tar.gz/Gzip/inner.tar/Tar/eicar.txt"
+	if r[0].ArchiveItem != exp {
+		t.Errorf("r[0].ArchiveItem = %q, want %q", r[0].ArchiveItem, exp)
+	}
+	if !r[0].Infected {
+		t.Errorf("r[0].Infected = %t, want %t", r[0].Infected, true)
+	}
+	e.SetMaxDepth(1)
+	if r, err = e.ScanReader("test.zip", bytes.NewReader(b)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 1 || r[0].ArchiveItem != "/Zip/inner.tar.gz" {
+		t.Errorf("The nested archive should be scanned as is: %v", r)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := &fakeScanner{}
+	e := NewExtractor(s)
+	e.SetMaxFiles(1)
+	b := makeZip(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	if _, err := e.ScanReader("test.zip", bytes.NewReader(b)); err != ErrTooManyFiles {
+		t.Errorf("Expected %v got %v", ErrTooManyFiles, err)
+	}
+	e = NewExtractor(s)
+	e.SetMaxTotalSize(int64(len(b) + 1))
+	if _, err := e.ScanReader("test.zip", bytes.NewReader(b)); err != ErrTooLarge {
+		t.Errorf("Expected %v got %v", ErrTooLarge, err)
+	}
+	e = NewExtractor(s)
+	e.SetMaxSize(4)
+	if _, err := e.ScanReader("test.zip", bytes.NewReader(b)); err != ErrTooLarge {
+		t.Errorf("Expected %v got %v", ErrTooLarge, err)
+	}
+}
+
+func TestScanFile(t *testing.T) {
+	s := &fakeScanner{}
+	e := NewExtractor(s)
+	fn := path.Join("..", "examples", "data", "eicar.tar.bz2")
+	r, err := e.ScanFile(fn)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("len(r) = %d, want %d", len(r), 1)
+	}
+	if !r[0].Infected {
+		t.Errorf("r[0].Infected = %t, want %t", r[0].Infected, true)
+	}
+	if r[0].Filename != fn {
+		t.Errorf("r[0].Filename = %q, want %q", r[0].Filename, fn)
+	}
+	if _, err = e.ScanFile(path.Join("..", "examples", "data")); err == nil || err.Error() != dirScanErr {
+		t.Errorf("Expected %q got %v", dirScanErr, err)
+	}
+	if _, err = e.ScanFile(path.Join("..", "examples", "data", "xxxx.pdf")); !os.IsNotExist(err) {
+		t.Errorf("Expected a os.IsNotExist error got %v", err)
+	}
+}
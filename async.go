@@ -0,0 +1,131 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// A Future holds the result of a scan running in the background,
+// Done is closed once the result is available
+type Future struct {
+	done chan struct{}
+	r    *Response
+	err  error
+}
+
+// Done returns a channel closed when the scan completes, it can be
+// used in a select along with other events
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the scan to complete and returns its response
+// and error
+func (f *Future) Result() (r *Response, err error) {
+	<-f.done
+	r, err = f.r, f.err
+
+	return
+}
+
+type asyncJob struct {
+	f  *Future
+	fn func() (*Response, error)
+}
+
+// An asyncRunner completes futures from a bounded set of goroutines,
+// the scans started while all of them are busy wait in a queue
+type asyncRunner struct {
+	m       sync.Mutex
+	queue   []asyncJob
+	running int
+}
+
+// ScanFileAsync starts a ScanFileContext in the background and
+// returns its future. The futures of a Client are completed by up to
+// its SetPipeline window of goroutines, the others wait in a queue
+// that holds the future but no goroutine.
+func (c *Client) ScanFileAsync(ctx context.Context, f string) *Future {
+	return c.futures.run(c.walkers(), func() (*Response, error) {
+		return c.ScanFileContext(ctx, f)
+	})
+}
+
+// ScanReaderAsync starts a ScanReaderContext in the background and
+// returns its future, i must not be used until the scan completes
+func (c *Client) ScanReaderAsync(ctx context.Context, i io.Reader) *Future {
+	return c.futures.run(c.walkers(), func() (*Response, error) {
+		return c.ScanReaderContext(ctx, i)
+	})
+}
+
+// ScanFileAsync starts a ScanFileContext in the background and
+// returns its future, ctx also bounds the wait for a connection. The
+// futures of a Pool are completed by up to its size of goroutines,
+// the others wait in a queue.
+func (p *Pool) ScanFileAsync(ctx context.Context, f string) *Future {
+	return p.futures.run(p.size, func() (*Response, error) {
+		return p.ScanFileContext(ctx, f)
+	})
+}
+
+// ScanReaderAsync starts a ScanReaderContext in the background and
+// returns its future, i must not be used until the scan completes
+func (p *Pool) ScanReaderAsync(ctx context.Context, i io.Reader) *Future {
+	return p.futures.run(p.size, func() (*Response, error) {
+		return p.ScanReaderContext(ctx, i)
+	})
+}
+
+// run queues fn and returns the future of its result, a goroutine
+// is started when fewer than n are running. The goroutines exit once
+// the queue is empty.
+func (a *asyncRunner) run(n int, fn func() (*Response, error)) (f *Future) {
+	f = newFuture()
+
+	if n < 1 {
+		n = 1
+	}
+
+	a.m.Lock()
+	a.queue = append(a.queue, asyncJob{f, fn})
+	if a.running < n {
+		a.running++
+		go a.work()
+	}
+	a.m.Unlock()
+
+	return
+}
+
+func (a *asyncRunner) work() {
+	for {
+		a.m.Lock()
+		if len(a.queue) == 0 {
+			a.running--
+			a.m.Unlock()
+			return
+		}
+		j := a.queue[0]
+		a.queue[0] = asyncJob{}
+		a.queue = a.queue[1:]
+		a.m.Unlock()
+
+		j.f.r, j.f.err = j.fn()
+		close(j.f.done)
+	}
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestScanAsync(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	fn := filepath.Join(t.TempDir(), "eicar.txt")
+	if err := ioutil.WriteFile(fn, []byte(eicarVirus), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	futures := []*Future{
+		p.ScanFileAsync(ctx, fn),
+		p.ScanReaderAsync(ctx, strings.NewReader("clean")),
+	}
+	for i, f := range futures {
+		select {
+		case <-f.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Future %d did not complete", i)
+		}
+		r, err := f.Result()
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if r.Infected != (i == 0) {
+			t.Errorf("Future %d: r.Infected = %t", i, r.Infected)
+		}
+	}
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Put(c, nil)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = c.ScanReaderAsync(canceled, strings.NewReader("clean")).Result(); err != context.Canceled {
+		t.Errorf("f.Result() error = %v, want %v", err, context.Canceled)
+	}
+	r, err := c.ScanFileAsync(ctx, fn).Result()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("The file should be infected: %+v", r)
+	}
+}
+
+func TestScanAsyncBounded(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+	ts.Delay = 50 * time.Millisecond
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	var futures []*Future
+	for i := 0; i < 8; i++ {
+		futures = append(futures, p.ScanReaderAsync(ctx, strings.NewReader("clean")))
+	}
+	p.futures.m.Lock()
+	running, queued := p.futures.running, len(p.futures.queue)
+	p.futures.m.Unlock()
+	if running != 2 || queued < 5 {
+		t.Errorf("Expected 2 goroutines and at least 5 queued futures, got %d and %d", running, queued)
+	}
+
+	for i, f := range futures {
+		select {
+		case <-f.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Future %d did not complete", i)
+		}
+		if _, err = f.Result(); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	// the goroutines exit once the queue is drained
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.futures.m.Lock()
+		running = p.futures.running
+		p.futures.m.Unlock()
+		if running == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running != 0 {
+		t.Errorf("p.futures.running = %d, want 0", running)
+	}
+}
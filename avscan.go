@@ -0,0 +1,84 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/baruwa-enterprise/sssp/avscan"
+	"github.com/baruwa-enterprise/sssp/protocol"
+)
+
+const (
+	engineName = "sophos"
+)
+
+var _ avscan.Scanner = (*AVScanner)(nil)
+
+// An AVScanner adapts a Client to the avscan.Scanner interface
+type AVScanner struct {
+	c *Client
+}
+
+// Engine returns the name of the engine
+func (a *AVScanner) Engine() string {
+	return engineName
+}
+
+// ScanFile submits a single file for scanning
+func (a *AVScanner) ScanFile(ctx context.Context, p string) (r *avscan.Result, err error) {
+	var rs *Response
+
+	rs, err = a.c.ScanFileContext(ctx, p)
+	r = result(rs, err)
+
+	return
+}
+
+// ScanReader submits an io reader via a stream for scanning
+func (a *AVScanner) ScanReader(ctx context.Context, i io.Reader) (r *avscan.Result, err error) {
+	var rs *Response
+
+	rs, err = a.c.ScanReaderContext(ctx, i)
+	r = result(rs, err)
+
+	return
+}
+
+// result converts the response of the server, a response whose item
+// could not be scanned carries the DONE line as its error
+func result(rs *Response, err error) (r *avscan.Result) {
+	r = &avscan.Result{
+		Engine: engineName,
+		Err:    err,
+	}
+	if rs == nil {
+		return
+	}
+
+	r.Filename = rs.Filename
+	r.ArchiveItem = rs.ArchiveItem
+	r.Signature = rs.Signature
+	r.Infected = rs.Infected
+	if r.Err == nil && rs.ErrorOccured {
+		r.Err = &protocol.DoneError{Code: fmt.Sprintf("%04x", rs.Code), Text: rs.StatusText}
+	}
+
+	return
+}
+
+// NewAVScanner creates and returns a new AVScanner using c
+func NewAVScanner(c *Client) (a *AVScanner) {
+	a = &AVScanner{c: c}
+
+	return
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package avscan implements a common anti virus scanner abstraction
+SSSP - Golang SSSP protocol implementation
+
+It allows applications to scan with different engines, such as
+Sophos, ClamAV and F-Prot, interchangeably or in parallel and to
+merge their verdicts.
+*/
+package avscan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+const (
+	noScannersErr = "No scanners were supplied"
+)
+
+// A Result represents the result of a scan by a single engine
+type Result struct {
+	Engine      string
+	Filename    string
+	ArchiveItem string
+	Signature   string
+	Infected    bool
+	Err         error
+}
+
+// Scanner is the interface implemented by the engine clients
+type Scanner interface {
+	Engine() string
+	ScanFile(context.Context, string) (*Result, error)
+	ScanReader(context.Context, io.Reader) (*Result, error)
+}
+
+// A Verdict represents the merged results of several engines
+type Verdict struct {
+	Infected   bool
+	Signatures []string
+	Results    []*Result
+	Errors     int
+}
+
+// Merge merges the results of several engines into a single
+// verdict, the item is infected if any engine reports it as such
+func Merge(rs ...*Result) (v *Verdict) {
+	seen := make(map[string]bool)
+	v = &Verdict{}
+
+	for _, r := range rs {
+		if r == nil {
+			continue
+		}
+		v.Results = append(v.Results, r)
+		if r.Err != nil {
+			v.Errors++
+		}
+		if r.Infected {
+			v.Infected = true
+			if r.Signature != "" && !seen[r.Signature] {
+				seen[r.Signature] = true
+				v.Signatures = append(v.Signatures, r.Signature)
+			}
+		}
+	}
+
+	return
+}
+
+// ScanFile scans the file p with all the scanners in parallel
+// and returns the merged verdict
+func ScanFile(ctx context.Context, p string, s ...Scanner) (v *Verdict, err error) {
+	v, err = scanAll(s, func(sc Scanner) (*Result, error) {
+		return sc.ScanFile(ctx, p)
+	})
+
+	return
+}
+
+// ScanReader scans the data read from i with all the scanners
+// in parallel and returns the merged verdict, the data is read
+// into memory so that each scanner receives its own copy
+func ScanReader(ctx context.Context, i io.Reader, s ...Scanner) (v *Verdict, err error) {
+	var b []byte
+
+	if b, err = ioutil.ReadAll(i); err != nil {
+		return
+	}
+
+	v, err = scanAll(s, func(sc Scanner) (*Result, error) {
+		return sc.ScanReader(ctx, bytes.NewReader(b))
+	})
+
+	return
+}
+
+func scanAll(s []Scanner, fn func(Scanner) (*Result, error)) (v *Verdict, err error) {
+	var wg sync.WaitGroup
+
+	if len(s) == 0 {
+		err = fmt.Errorf(noScannersErr)
+		return
+	}
+
+	rs := make([]*Result, len(s))
+	for i, sc := range s {
+		wg.Add(1)
+		go func(i int, sc Scanner) {
+			defer wg.Done()
+			r, e := fn(sc)
+			if r == nil {
+				r = &Result{}
+			}
+			if r.Engine == "" {
+				r.Engine = sc.Engine()
+			}
+			if e != nil && r.Err == nil {
+				r.Err = e
+			}
+			rs[i] = r
+		}(i, sc)
+	}
+	wg.Wait()
+
+	v = Merge(rs...)
+
+	return
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package avscan implements a common anti virus scanner abstraction
+SSSP - Golang SSSP protocol implementation
+*/
+package avscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+type fakeScanner struct {
+	name string
+	sig  string
+	err  error
+}
+
+func (f *fakeScanner) Engine() string {
+	return f.name
+}
+
+func (f *fakeScanner) ScanFile(ctx context.Context, p string) (r *Result, err error) {
+	if f.err != nil {
+		err = f.err
+		return
+	}
+	r = &Result{Filename: p, Infected: strings.Contains(p, "eicar"), Signature: f.sig}
+	return
+}
+
+func (f *fakeScanner) ScanReader(ctx context.Context, i io.Reader) (r *Result, err error) {
+	var b []byte
+	if f.err != nil {
+		err = f.err
+		return
+	}
+	if b, err = ioutil.ReadAll(i); err != nil {
+		return
+	}
+	r = &Result{Filename: "stream", Infected: bytes.Contains(b, []byte("EICAR")), Signature: f.sig}
+	return
+}
+
+func TestMerge(t *testing.T) {
+	v := Merge(
+		&Result{Engine: "a", Infected: true, Signature: "EICAR-AV-Test"},
+		&Result{Engine: "b", Infected: true, Signature: "Eicar-Test-Signature"},
+		&Result{Engine: "c", Infected: true, Signature: "EICAR-AV-Test"},
+		&Result{Engine: "d", Err: errors.New("failed")},
+		nil,
+	)
+	if !v.Infected {
+		t.Errorf("v.Infected = %t, want %t", v.Infected, true)
+	}
+	if len(v.Signatures) != 2 {
+		t.Errorf("len(v.Signatures) = %d, want %d", len(v.Signatures), 2)
+	}
+	if len(v.Results) != 4 {
+		t.Errorf("len(v.Results) = %d, want %d", len(v.Results), 4)
+	}
+	if v.Errors != 1 {
+		t.Errorf("v.Errors = %d, want %d", v.Errors, 1)
+	}
+	if v = Merge(&Result{Engine: "a"}); v.Infected {
+		t.Errorf("v.Infected = %t, want %t", v.Infected, false)
+	}
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	s := []Scanner{
+		&fakeScanner{name: "sophos", sig: "EICAR-AV-Test"},
+		&fakeScanner{name: "clamd", sig: "Eicar-Test-Signature"},
+		&fakeScanner{name: "fprot", err: errors.New("connection refused")},
+	}
+	v, e := ScanReader(ctx, strings.NewReader(eicarVirus), s...)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if !v.Infected {
+		t.Errorf("v.Infected = %t, want %t", v.Infected, true)
+	}
+	if v.Errors != 1 {
+		t.Errorf("v.Errors = %d, want %d", v.Errors, 1)
+	}
+	for i, r := range v.Results {
+		if r.Engine != s[i].Engine() {
+			t.Errorf("r.Engine = %q, want %q", r.Engine, s[i].Engine())
+		}
+	}
+	if v, e = ScanFile(ctx, "/tmp/clean.txt", s[:2]...); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if v.Infected {
+		t.Errorf("v.Infected = %t, want %t", v.Infected, false)
+	}
+	if _, e = ScanFile(ctx, "/tmp/clean.txt"); e == nil {
+		t.Errorf("An error should be returned when no scanners are supplied")
+	}
+}
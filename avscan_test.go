@@ -0,0 +1,71 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestAVScanner(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if string(r.Data) == "unscannable" {
+			return sssptest.Fail("0211", "Unable to scan", "/tmp/file")
+		}
+		return sssptest.DefaultHandler(r)
+	})
+	defer ts.Close()
+
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	a := NewAVScanner(c)
+	if a.Engine() != engineName {
+		t.Errorf("a.Engine() = %q, want %q", a.Engine(), engineName)
+	}
+
+	r, err := a.ScanReader(context.Background(), strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected || r.Signature != sssptest.EicarSignature || r.Err != nil {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+
+	r, _ = a.ScanReader(context.Background(), strings.NewReader("unscannable"))
+	var de *protocol.DoneError
+	if r.Infected || !errors.As(r.Err, &de) || de.Code != "0211" {
+		t.Errorf("A failed scan should set the error: %+v", r)
+	}
+
+	// a cancelled scan does not read from the reader
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	i := strings.NewReader("clean")
+	if _, err = a.ScanReader(ctx, i); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if i.Len() != len("clean") {
+		t.Errorf("The reader should not be read after the context is cancelled")
+	}
+
+	if r, err = a.ScanReader(context.Background(), strings.NewReader("clean")); err != nil || r.Infected || r.Err != nil {
+		t.Errorf("Unexpected result: %+v %v", r, err)
+	}
+}
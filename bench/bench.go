@@ -0,0 +1,329 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package bench implements load generation against an SSSP server
+SSSP - Golang SSSP protocol implementation
+
+Each connection issues SCANDATA or SCANFILE requests back to back
+until the duration elapses or the request budget is used up, the
+latency of every request is recorded and summarised in a Report.
+*/
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	defaultConnections = 4
+	defaultDuration    = 10 * time.Second
+	defaultPayloadSize = 64 * 1024
+	eicarVirus         = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+	noFilesErr         = "ScanFile mode requires at least one file"
+	invalidModeErr     = "Invalid mode: %s"
+)
+
+const (
+	// ScanData sends generated payloads using SCANDATA
+	ScanData Mode = iota
+	// ScanFile scans the configured files using SCANFILE
+	ScanFile
+)
+
+// A Mode represents the type of requests generated
+type Mode int
+
+func (m Mode) String() string {
+	switch m {
+	case ScanData:
+		return "scandata"
+	case ScanFile:
+		return "scanfile"
+	}
+	return ""
+}
+
+// ParseMode returns the Mode named by s
+func ParseMode(s string) (m Mode, err error) {
+	switch s {
+	case "scandata", "data":
+		m = ScanData
+	case "scanfile", "file":
+		m = ScanFile
+	default:
+		err = fmt.Errorf(invalidModeErr, s)
+	}
+	return
+}
+
+// Config holds the benchmark configuration
+type Config struct {
+	Network     string
+	Address     string
+	ConnTimeout time.Duration
+	IOTimeout   time.Duration
+	// Connections is the number of concurrent connections
+	Connections int
+	// Duration is how long to run for, ignored if Requests is set
+	Duration time.Duration
+	// Requests is the total number of requests to send
+	Requests int
+	Mode     Mode
+	// PayloadSize is the size of the generated SCANDATA payloads
+	PayloadSize int64
+	// Infected prefixes the payloads with the EICAR test string
+	Infected bool
+	// Files are scanned in turn in ScanFile mode
+	Files []string
+	// TLSConfig connects using TLS when set
+	TLSConfig *tls.Config
+}
+
+// A Report summarises a benchmark run
+type Report struct {
+	Requests    int
+	Errors      int
+	Infected    int
+	Bytes       int64
+	Elapsed     time.Duration
+	Min         time.Duration
+	Max         time.Duration
+	Mean        time.Duration
+	P50         time.Duration
+	P90         time.Duration
+	P95         time.Duration
+	P99         time.Duration
+	FirstErr    error
+	latencies   []time.Duration
+	connections int
+}
+
+// Throughput returns the number of requests per second
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// BytesPerSecond returns the SCANDATA payload bytes sent per second
+func (r *Report) BytesPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// WriteTo writes a human readable summary of the report to w
+func (r *Report) WriteTo(w io.Writer) (n int64, err error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "Connections:\t%d\n", r.connections)
+	fmt.Fprintf(&b, "Requests:\t%d\n", r.Requests)
+	fmt.Fprintf(&b, "Errors:\t\t%d\n", r.Errors)
+	fmt.Fprintf(&b, "Infected:\t%d\n", r.Infected)
+	fmt.Fprintf(&b, "Elapsed:\t%s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Throughput:\t%.2f req/s\n", r.Throughput())
+	if r.Bytes > 0 {
+		fmt.Fprintf(&b, "Transfer:\t%.2f MiB/s\n", r.BytesPerSecond()/(1024*1024))
+	}
+	fmt.Fprintf(&b, "Latency:\tmin %s, mean %s, max %s\n", r.Min, r.Mean, r.Max)
+	fmt.Fprintf(&b, "Percentiles:\tp50 %s, p90 %s, p95 %s, p99 %s\n", r.P50, r.P90, r.P95, r.P99)
+	if r.FirstErr != nil {
+		fmt.Fprintf(&b, "First error:\t%s\n", r.FirstErr)
+	}
+
+	n, err = b.WriteTo(w)
+
+	return
+}
+
+func (r *Report) summarise() {
+	if len(r.latencies) == 0 {
+		return
+	}
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	var total time.Duration
+	for _, l := range r.latencies {
+		total += l
+	}
+	r.Min = r.latencies[0]
+	r.Max = r.latencies[len(r.latencies)-1]
+	r.Mean = total / time.Duration(len(r.latencies))
+	r.P50 = Percentile(r.latencies, 50)
+	r.P90 = Percentile(r.latencies, 90)
+	r.P95 = Percentile(r.latencies, 95)
+	r.P99 = Percentile(r.latencies, 99)
+}
+
+// Percentile returns the pth percentile of the sorted latencies
+// using the nearest rank method
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(p/100*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+// Payload returns a payload of n random bytes, prefixed with
+// the EICAR test string when infected is set
+func Payload(n int64, infected bool) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(b)
+	if infected {
+		copy(b, eicarVirus)
+		if n < int64(len(eicarVirus)) {
+			b = []byte(eicarVirus)
+		}
+	}
+
+	return b
+}
+
+// Run runs the benchmark described by cfg until it completes
+// or ctx is cancelled
+func Run(ctx context.Context, cfg Config) (r *Report, err error) {
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var payload []byte
+	var sent int
+
+	if cfg.Connections <= 0 {
+		cfg.Connections = defaultConnections
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = defaultDuration
+	}
+	if cfg.PayloadSize <= 0 {
+		cfg.PayloadSize = defaultPayloadSize
+	}
+
+	switch cfg.Mode {
+	case ScanData:
+		payload = Payload(cfg.PayloadSize, cfg.Infected)
+	case ScanFile:
+		if len(cfg.Files) == 0 {
+			err = errors.New(noFilesErr)
+			return
+		}
+	default:
+		err = fmt.Errorf(invalidModeErr, cfg.Mode)
+		return
+	}
+
+	if cfg.Requests <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	// take returns false once the request budget is used up
+	take := func() bool {
+		m.Lock()
+		defer m.Unlock()
+		if cfg.Requests > 0 && sent >= cfg.Requests {
+			return false
+		}
+		sent++
+		return true
+	}
+
+	r = &Report{connections: cfg.Connections}
+	record := func(d time.Duration, rs *sssp.Response, n int64, e error) {
+		m.Lock()
+		defer m.Unlock()
+		r.Requests++
+		if e != nil {
+			r.Errors++
+			if r.FirstErr == nil {
+				r.FirstErr = e
+			}
+			return
+		}
+		r.Bytes += n
+		r.latencies = append(r.latencies, d)
+		if rs != nil && rs.Infected {
+			r.Infected++
+		}
+	}
+
+	start := time.Now()
+	for i := 0; i < cfg.Connections; i++ {
+		wg.Add(1)
+		go func(i int) {
+			var c *sssp.Client
+			var e error
+
+			defer wg.Done()
+			defer func() {
+				if c != nil {
+					c.Close()
+				}
+			}()
+
+			for n := i; ctx.Err() == nil && take(); n++ {
+				if c == nil {
+					if cfg.TLSConfig != nil {
+						c, e = sssp.NewTLSClient(ctx, cfg.Network, cfg.Address, cfg.TLSConfig, cfg.ConnTimeout, cfg.IOTimeout, 0)
+					} else {
+						c, e = sssp.NewClient(ctx, cfg.Network, cfg.Address, cfg.ConnTimeout, cfg.IOTimeout, 0)
+					}
+					if e != nil {
+						c = nil
+						record(0, nil, 0, e)
+						continue
+					}
+				}
+
+				var rs *sssp.Response
+				var size int64
+				t := time.Now()
+				switch cfg.Mode {
+				case ScanData:
+					size = int64(len(payload))
+					rs, e = c.ScanSizedReader(bytes.NewReader(payload), size)
+				case ScanFile:
+					rs, e = c.ScanFile(cfg.Files[n%len(cfg.Files)])
+				}
+				record(time.Since(t), rs, size, e)
+
+				if e != nil && rs == nil {
+					// the connection state is unknown
+					c.Close()
+					c = nil
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	r.Elapsed = time.Since(start)
+	r.summarise()
+
+	return
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package bench implements load generation against an SSSP server
+SSSP - Golang SSSP protocol implementation
+*/
+package bench
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestPercentile(t *testing.T) {
+	var l []time.Duration
+	for i := 1; i <= 100; i++ {
+		l = append(l, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := Percentile(l, tt.p); got != tt.want {
+			t.Errorf("Percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := Percentile(nil, 50); got != 0 {
+		t.Errorf("Percentile(nil) = %s, want 0", got)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := map[string]Mode{
+		"scandata": ScanData,
+		"data":     ScanData,
+		"scanfile": ScanFile,
+		"file":     ScanFile,
+	}
+	for s, want := range tests {
+		m, err := ParseMode(s)
+		if err != nil {
+			t.Errorf("ParseMode(%q) returned error: %s", s, err)
+		}
+		if m != want {
+			t.Errorf("ParseMode(%q) = %s, want %s", s, m, want)
+		}
+	}
+	if _, err := ParseMode("invalid"); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestRun(t *testing.T) {
+	var b bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	r, err := Run(context.Background(), Config{
+		Network:     ts.Network,
+		Address:     ts.Addr,
+		Connections: 3,
+		Requests:    30,
+		PayloadSize: 1024,
+		Infected:    true,
+	})
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if r.Requests != 30 || r.Errors != 0 || r.Infected != 30 {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+	if r.Bytes != 30*1024 {
+		t.Errorf("r.Bytes = %d, want %d", r.Bytes, 30*1024)
+	}
+	if r.Min > r.P50 || r.P50 > r.P99 || r.P99 > r.Max {
+		t.Errorf("The percentiles should be ordered: %+v", r)
+	}
+	r.WriteTo(&b)
+	if !strings.Contains(b.String(), "Requests:\t30") {
+		t.Errorf("Unexpected summary: %s", b.String())
+	}
+
+	dir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "clean.txt")
+	ioutil.WriteFile(fn, []byte("clean"), 0644)
+
+	r, err = Run(context.Background(), Config{
+		Network:     ts.Network,
+		Address:     ts.Addr,
+		Connections: 2,
+		Duration:    200 * time.Millisecond,
+		Mode:        ScanFile,
+		Files:       []string{fn},
+	})
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if r.Requests == 0 || r.Infected != 0 || r.Errors != 0 {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+
+	if _, err = Run(context.Background(), Config{Mode: ScanFile}); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
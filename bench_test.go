@@ -0,0 +1,144 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const benchDirItems = 1000
+
+func benchClient(b *testing.B, ts *sssptest.Server) *Client {
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 30*time.Second, 0)
+	if err != nil {
+		b.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return c
+}
+
+func benchScanReader(b *testing.B, size int) {
+	ts := sssptest.NewServer(nil)
+	defer ts.Close()
+
+	c := benchClient(b, ts)
+	defer c.Close()
+
+	data := bytes.Repeat([]byte("x"), size)
+	r := bytes.NewReader(data)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if _, err := c.ScanReader(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkScanSmall measures the latency of a typical message part
+func BenchmarkScanSmall(b *testing.B) {
+	benchScanReader(b, 4<<10)
+}
+
+// BenchmarkScanLarge measures the upload throughput of a large
+// attachment
+func BenchmarkScanLarge(b *testing.B) {
+	benchScanReader(b, 8<<20)
+}
+
+// BenchmarkScanDir measures parsing a large SCANDIRR response
+func BenchmarkScanDir(b *testing.B) {
+	lines := make([]string, 0, benchDirItems*2+1)
+	for n := 0; n < benchDirItems; n++ {
+		p := fmt.Sprintf("/srv/mail/%04d/message.eml", n)
+		lines = append(lines, "VIRUS EICAR-AV-Test "+p, "OK 0203 "+p)
+	}
+	lines = append(lines, "DONE OK 0203 Virus found during virus scan")
+
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		return sssptest.Lines(lines...)
+	})
+	defer ts.Close()
+
+	c := benchClient(b, ts)
+	defer c.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rs, err := c.ScanDir("/srv/mail", true)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(rs) != benchDirItems {
+			b.Fatalf("len(rs) = %d, want %d", len(rs), benchDirItems)
+		}
+	}
+}
+
+// BenchmarkPoolParallel measures concurrent clients sharing a Pool
+func BenchmarkPoolParallel(b *testing.B) {
+	ts := sssptest.NewServer(nil)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 30*time.Second, 0, 8)
+	if err != nil {
+		b.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	data := bytes.Repeat([]byte("x"), 4<<10)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := p.ScanReader(bytes.NewReader(data)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkPipelineParallel measures concurrent goroutines sharing
+// one pipelined Client
+func BenchmarkPipelineParallel(b *testing.B) {
+	ts := sssptest.NewServer(nil)
+	defer ts.Close()
+
+	c := benchClient(b, ts)
+	defer c.Close()
+	c.SetPipeline(8)
+
+	data := bytes.Repeat([]byte("x"), 4<<10)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := c.ScanReader(bytes.NewReader(data)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
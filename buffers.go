@@ -0,0 +1,78 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	copyBufSize  = 32 * 1024
+	linesBufSize = 16
+	// responses with more lines, such as large SCANDIRR results,
+	// are not returned to the pool
+	maxPooledLines = 1024
+)
+
+var (
+	copyBufPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, copyBufSize)
+			return &b
+		},
+	}
+	linesPool = sync.Pool{
+		New: func() interface{} {
+			l := make([]string, 0, linesBufSize)
+			return &l
+		},
+	}
+)
+
+// writerOnly hides the ReaderFrom implementation of the wrapped
+// writer so that io.CopyBuffer uses the buffer it is given
+type writerOnly struct {
+	io.Writer
+}
+
+// copyN copies n bytes from src to dst through a pooled buffer,
+// io.EOF is returned if src holds fewer than n bytes
+func copyN(dst io.Writer, src io.Reader, n int64) (written int64, err error) {
+	b := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(b)
+
+	written, err = io.CopyBuffer(writerOnly{dst}, io.LimitReader(src, n), *b)
+	if written < n && err == nil {
+		err = io.EOF
+	}
+
+	return
+}
+
+// getLines returns an empty slice from the pool to read the lines
+// of a response into
+func getLines() *[]string {
+	l := linesPool.Get().(*[]string)
+	*l = (*l)[:0]
+
+	return l
+}
+
+// putLines returns l to the pool, the lines must no longer be used
+func putLines(l *[]string) {
+	if cap(*l) > maxPooledLines {
+		return
+	}
+	for i := range *l {
+		(*l)[i] = ""
+	}
+	linesPool.Put(l)
+}
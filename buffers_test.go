@@ -0,0 +1,65 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCopyN(t *testing.T) {
+	var buf bytes.Buffer
+
+	data := strings.Repeat("x", copyBufSize*2+10)
+	n, err := copyN(&buf, strings.NewReader(data+"trailing"), int64(len(data)))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if n != int64(len(data)) || buf.String() != data {
+		t.Errorf("copyN() copied %d bytes, want %d", n, len(data))
+	}
+
+	buf.Reset()
+	if n, err = copyN(&buf, strings.NewReader("short"), 10); err != io.EOF || n != 5 {
+		t.Errorf("copyN() = %d, %v, want %d, %v", n, err, 5, io.EOF)
+	}
+}
+
+func TestLinesPool(t *testing.T) {
+	l := getLines()
+	*l = append(*l, "ACC 1/1", "")
+	putLines(l)
+
+	l = getLines()
+	if len(*l) != 0 {
+		t.Errorf("len(*l) = %d, want %d", len(*l), 0)
+	}
+	putLines(l)
+
+	big := make([]string, 0, maxPooledLines+1)
+	putLines(&big)
+}
+
+func BenchmarkCopyN(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 1<<20)
+	r := bytes.NewReader(data)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if _, err := copyN(ioutil.Discard, r, int64(len(data))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"strings"
+)
+
+// Categories of detections
+const (
+	// CategoryUnknown is the category of detections that were not
+	// classified
+	CategoryUnknown Category = ""
+	// CategoryVirus is the category of viruses and worms
+	CategoryVirus Category = "virus"
+	// CategoryTrojan is the category of trojans, backdoors and
+	// generic malware
+	CategoryTrojan Category = "trojan"
+	// CategoryPUA is the category of potentially unwanted
+	// applications and adware
+	CategoryPUA Category = "pua"
+	// CategoryTest is the category of test files such as EICAR
+	CategoryTest Category = "test"
+)
+
+var (
+	trojanPrefixes = []string{"TROJ/", "MAL/", "BCK/", "EXP/", "ICLDR/"}
+	puaPrefixes    = []string{"PUA/", "ADWARE/", "APP/"}
+)
+
+// A Category is the kind of threat a detection is
+type Category string
+
+// A Classifier returns the category of a signature name
+type Classifier func(signature string) Category
+
+// SetClassifier sets the function used to set the Category of the
+// detections, nil leaves them unclassified which is the default.
+// ClassifySignature handles the Sophos signature names.
+func (c *Client) SetClassifier(f Classifier) {
+	c.m.Lock()
+	c.classifier = f
+	c.m.Unlock()
+}
+
+// SetClassifier sets the classifier used by connections established
+// after the call, see Client.SetClassifier
+func (p *Pool) SetClassifier(f Classifier) {
+	p.m.Lock()
+	p.classifier = f
+	p.m.Unlock()
+}
+
+// ClassifySignature returns the category of a Sophos signature name.
+// Names such as EICAR-AV-Test are tests, names with a (PUA) suffix or
+// a PUA/, Adware/ or App/ prefix are PUAs, Troj/, Mal/, Bck/, Exp/ and
+// ICLdr/ names are trojans and the other names, such as the W32/ and
+// VBS/ families, are viruses.
+func ClassifySignature(signature string) (c Category) {
+	s := strings.ToUpper(strings.TrimSpace(signature))
+	if s == "" {
+		return
+	}
+
+	if strings.HasPrefix(s, "EICAR") || strings.HasSuffix(s, "-TEST") {
+		c = CategoryTest
+		return
+	}
+
+	if strings.HasSuffix(s, "(PUA)") || strings.Contains(s, "ADWARE") || hasAnyPrefix(s, puaPrefixes) {
+		c = CategoryPUA
+		return
+	}
+
+	if hasAnyPrefix(s, trojanPrefixes) {
+		c = CategoryTrojan
+		return
+	}
+
+	c = CategoryVirus
+
+	return
+}
+
+// categorize sets the Category of the detections in r
+func (c *Client) categorize(r ...*Response) {
+	c.m.Lock()
+	f := c.classifier
+	c.m.Unlock()
+
+	if f == nil {
+		return
+	}
+
+	for _, rs := range r {
+		if rs == nil {
+			continue
+		}
+		for i := range rs.Detections {
+			rs.Detections[i].Category = f(rs.Detections[i].Signature)
+		}
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestClassifySignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		want      Category
+	}{
+		{"", CategoryUnknown},
+		{"EICAR-AV-Test", CategoryTest},
+		{"Sophos-AV-Test", CategoryTest},
+		{"Generic PUA JB (PUA)", CategoryPUA},
+		{"PUA/InstallCore", CategoryPUA},
+		{"AdWare/Ezula", CategoryPUA},
+		{"OutBrowse Adware", CategoryPUA},
+		{"App/Mimikatz-A", CategoryPUA},
+		{"Troj/Agent-X", CategoryTrojan},
+		{"Mal/Generic-S", CategoryTrojan},
+		{"Bck/Qbot-A", CategoryTrojan},
+		{"W32/Sality-AA", CategoryVirus},
+		{"VBS/LoveLet-A", CategoryVirus},
+	}
+	for _, tt := range tests {
+		if got := ClassifySignature(tt.signature); got != tt.want {
+			t.Errorf("ClassifySignature(%q) = %q, want %q", tt.signature, got, tt.want)
+		}
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if r.Command == ScanDirr.String() {
+			return sssptest.Lines(
+				"VIRUS W32/Sality-AA /srv/mail/a.exe",
+				"OK 0203 /srv/mail/a.exe",
+				"VIRUS PUA/InstallCore /srv/mail/b.exe",
+				"OK 0203 /srv/mail/b.exe",
+				"DONE OK 0203 Virus found during virus scan",
+			)
+		}
+		return sssptest.Lines(
+			"VIRUS Troj/Agent-X /srv/a.zip/payload.exe",
+			"VIRUS EICAR-AV-Test /srv/a.zip/eicar.com",
+			"OK 0203 /srv/a.zip",
+			"DONE OK 0203 Virus found during virus scan",
+		)
+	})
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	r, err := p.ScanFile("/srv/a.zip")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	for _, d := range r.Detections {
+		if d.Category != CategoryUnknown {
+			t.Errorf("Detections should not be classified by default: %+v", d)
+		}
+	}
+
+	p.SetClassifier(ClassifySignature)
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	// the idle connection predates the classifier
+	c.SetClassifier(ClassifySignature)
+	p.Put(c, nil)
+
+	if r, err = p.ScanFile("/srv/a.zip"); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r.Detections) != 2 || r.Detections[0].Category != CategoryTrojan || r.Detections[1].Category != CategoryTest {
+		t.Errorf("r.Detections = %+v, want a trojan and a test", r.Detections)
+	}
+
+	rs, err := p.ScanDir("/srv/mail", true)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(rs) != 2 || rs[0].Detections[0].Category != CategoryVirus || rs[1].Detections[0].Category != CategoryPUA {
+		t.Errorf("Expected a virus and a PUA: %+v", rs)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang SSSP load testing tool
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/bench"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	cfg     bench.Config
+	mode    string
+	cmdName string
+)
+
+func init() {
+	cmdName = path.Base(os.Args[0])
+	flag.StringVarP(&cfg.Network, "network", "n", "unix",
+		`Network used to connect to the SSSP server (unix, tcp, tcp4, tcp6).`)
+	flag.StringVarP(&cfg.Address, "address", "a", "/var/lib/savdid/sssp.sock",
+		`Address of the SSSP server.`)
+	flag.IntVarP(&cfg.Connections, "connections", "c", 4,
+		`Number of concurrent connections.`)
+	flag.DurationVarP(&cfg.Duration, "duration", "d", 10*time.Second,
+		`Duration of the test, ignored if --requests is set.`)
+	flag.IntVarP(&cfg.Requests, "requests", "r", 0,
+		`Total number of requests to send.`)
+	flag.StringVarP(&mode, "mode", "m", "scandata",
+		`Request type (scandata, scanfile).`)
+	flag.Int64VarP(&cfg.PayloadSize, "payload-size", "s", 64*1024,
+		`Size in bytes of the generated SCANDATA payloads.`)
+	flag.BoolVar(&cfg.Infected, "infected", false,
+		`Include the EICAR test string in the payloads.`)
+	flag.DurationVar(&cfg.ConnTimeout, "conn-timeout", 15*time.Second,
+		`Connection timeout.`)
+	flag.DurationVar(&cfg.IOTimeout, "io-timeout", 1*time.Minute,
+		`Command timeout.`)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] [files...]\n", cmdName)
+	fmt.Fprint(os.Stderr, "\nFiles are scanned in turn in scanfile mode, the paths\n")
+	fmt.Fprint(os.Stderr, "must be accessible to the server.\n")
+	fmt.Fprint(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var err error
+
+	flag.Usage = usage
+	flag.ErrHelp = errors.New("")
+	flag.CommandLine.SortFlags = false
+	flag.Parse()
+
+	if cfg.Mode, err = bench.ParseMode(mode); err != nil {
+		usage()
+		log.Fatalln("ERROR:=>", err)
+	}
+	cfg.Files = flag.Args()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	r, err := bench.Run(ctx, cfg)
+	if err != nil {
+		log.Fatalln("ERROR:=>", err)
+	}
+
+	r.WriteTo(os.Stdout)
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang SSSP REST gateway daemon
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/httpapi"
+	"github.com/baruwa-enterprise/sssp/icap"
+	"github.com/baruwa-enterprise/sssp/notify"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	cfg     *Config
+	cmdName string
+)
+
+// Config holds the configuration
+type Config struct {
+	Listen        string
+	ICAPListen    string
+	ICAPService   string
+	Network       string
+	Address       string
+	PoolSize      int
+	PoolWarm      int
+	ConnTimeout   time.Duration
+	IOTimeout     time.Duration
+	ConnRetries   int
+	MaxBodySize   int64
+	Webhooks      []string
+	WebhookSecret string
+}
+
+func init() {
+	cfg = &Config{}
+	cmdName = path.Base(os.Args[0])
+	flag.StringVarP(&cfg.Listen, "listen", "l", ":8080",
+		`Address to listen on for HTTP requests.`)
+	flag.StringVar(&cfg.ICAPListen, "icap-listen", "",
+		`Address to listen on for ICAP requests, disabled if empty.`)
+	flag.StringVar(&cfg.ICAPService, "icap-service", "avscan",
+		`Name of the ICAP service.`)
+	flag.StringVarP(&cfg.Network, "network", "n", "unix",
+		`Network used to connect to the SSSP server (unix, tcp, tcp4, tcp6).`)
+	flag.StringVarP(&cfg.Address, "address", "a", "/var/lib/savdid/sssp.sock",
+		`Address of the SSSP server.`)
+	flag.IntVarP(&cfg.PoolSize, "pool-size", "s", 4,
+		`Maximum number of connections to the SSSP server.`)
+	flag.IntVar(&cfg.PoolWarm, "pool-warm", 0,
+		`Number of connections to establish at startup.`)
+	flag.DurationVar(&cfg.ConnTimeout, "conn-timeout", 15*time.Second,
+		`Connection timeout.`)
+	flag.DurationVar(&cfg.IOTimeout, "io-timeout", 1*time.Minute,
+		`Command timeout.`)
+	flag.IntVar(&cfg.ConnRetries, "conn-retries", 1,
+		`Number of connection retries.`)
+	flag.Int64Var(&cfg.MaxBodySize, "max-body-size", 100*1024*1024,
+		`Maximum size of a request body that will be scanned.`)
+	flag.StringArrayVar(&cfg.Webhooks, "webhook", nil,
+		`URL a JSON notification is POSTed to when an infection is found, may be repeated.`)
+	flag.StringVar(&cfg.WebhookSecret, "webhook-secret", "",
+		`Secret used to sign the webhook notifications with HMAC-SHA256.`)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", cmdName)
+	fmt.Fprint(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.ErrHelp = errors.New("")
+	flag.CommandLine.SortFlags = false
+	flag.Parse()
+
+	p, err := sssp.NewPool(cfg.Network, cfg.Address, cfg.ConnTimeout, cfg.IOTimeout, cfg.ConnRetries, cfg.PoolSize)
+	if err != nil {
+		log.Fatalln("ERROR:=>", err)
+	}
+	defer p.Close()
+
+	if len(cfg.Webhooks) > 0 {
+		n := notify.NewNotifier(cfg.Webhooks...)
+		n.SetSecret(cfg.WebhookSecret)
+		p.SetHooks(&sssp.Hooks{OnScanEnd: n.ScanEnd()})
+	}
+
+	if cfg.PoolWarm > 0 {
+		wctx, cancel := context.WithTimeout(context.Background(), cfg.ConnTimeout)
+		if err = p.Warm(wctx, cfg.PoolWarm); err != nil {
+			log.Println("WARNING:=> pool warm up failed:", err)
+		}
+		cancel()
+	}
+
+	h := httpapi.NewHandler(p)
+	h.SetMaxBodySize(cfg.MaxBodySize)
+
+	srv := &http.Server{
+		Addr:    cfg.Listen,
+		Handler: h,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var is *icap.Server
+	if cfg.ICAPListen != "" {
+		is = icap.NewServer(p)
+		is.SetService(cfg.ICAPService)
+		is.SetMaxBodySize(cfg.MaxBodySize)
+		go func() {
+			log.Printf("%s listening for ICAP on %s", cmdName, cfg.ICAPListen)
+			if err := is.ListenAndServe(cfg.ICAPListen); err != nil && err != icap.ErrServerClosed {
+				log.Fatalln("ERROR:=>", err)
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), cfg.IOTimeout)
+		defer cancel()
+		if is != nil {
+			is.Close()
+		}
+		srv.Shutdown(sctx)
+	}()
+
+	log.Printf("%s listening on %s", cmdName, cfg.Listen)
+	if err = srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalln("ERROR:=>", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang SSSP metrics exporter
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+// Prober is the interface used to probe the server, it is
+// implemented by sssp.Pool
+type Prober interface {
+	QueryServer() (sssp.Info, error)
+	QuerySAVI() (sssp.Info, error)
+	ScanReader(io.Reader) (*sssp.Response, error)
+}
+
+// A Collector periodically probes the server and renders
+// the results as Prometheus metrics
+type Collector struct {
+	prober        Prober
+	m             sync.Mutex
+	up            bool
+	detected      bool
+	serverVersion string
+	saviVersion   string
+	engineVersion string
+	dataVersion   string
+	dataDate      time.Time
+	scanDuration  time.Duration
+	lastProbe     time.Time
+	probes        uint64
+	failures      uint64
+}
+
+// Probe queries the server and scans the EICAR test string
+func (c *Collector) Probe() (err error) {
+	var srv, savi sssp.Info
+	var rs *sssp.Response
+
+	if srv, err = c.prober.QueryServer(); err == nil {
+		if savi, err = c.prober.QuerySAVI(); err == nil {
+			start := time.Now()
+			rs, err = c.prober.ScanReader(strings.NewReader(eicarVirus))
+			c.m.Lock()
+			c.scanDuration = time.Since(start)
+			c.m.Unlock()
+		}
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.probes++
+	c.lastProbe = time.Now()
+	c.up = err == nil
+	c.detected = rs != nil && rs.Infected
+	if err != nil {
+		c.failures++
+		return
+	}
+
+	c.serverVersion = srv.Get("version")
+	c.saviVersion = savi.Get("version")
+	c.engineVersion = savi.Get("virusengine")
+	c.dataVersion = savi.Get("virusdataname")
+	c.dataDate, _ = savi.Time("virusdatadate")
+
+	return
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (c *Collector) WriteTo(w io.Writer) (n int64, err error) {
+	var b strings.Builder
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	gauge(&b, "sssp_up", "Whether the last probe of the SSSP server succeeded.", boolValue(c.up))
+	fmt.Fprintf(&b, "# HELP sssp_info Versions reported by the SSSP server.\n# TYPE sssp_info gauge\n")
+	fmt.Fprintf(&b, "sssp_info{server_version=%q,savi_version=%q,engine_version=%q,virus_data=%q} 1\n",
+		c.serverVersion, c.saviVersion, c.engineVersion, c.dataVersion)
+	if !c.dataDate.IsZero() {
+		gauge(&b, "sssp_virus_data_timestamp_seconds", "Date of the virus data as a unix timestamp.", float64(c.dataDate.Unix()))
+	}
+	gauge(&b, "sssp_eicar_detected", "Whether the EICAR test string was detected by the last probe.", boolValue(c.detected))
+	gauge(&b, "sssp_scan_duration_seconds", "Duration of the last EICAR test scan.", c.scanDuration.Seconds())
+	if !c.lastProbe.IsZero() {
+		gauge(&b, "sssp_last_probe_timestamp_seconds", "Time of the last probe as a unix timestamp.", float64(c.lastProbe.Unix()))
+	}
+	counter(&b, "sssp_probes_total", "Total number of probes.", c.probes)
+	counter(&b, "sssp_probe_failures_total", "Total number of failed probes.", c.failures)
+
+	var i int
+	i, err = io.WriteString(w, b.String())
+	n = int64(i)
+
+	return
+}
+
+func gauge(b *strings.Builder, name, help string, v float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, v)
+}
+
+func counter(b *strings.Builder, name, help string, v uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// NewCollector creates and returns a new Collector
+func NewCollector(p Prober) *Collector {
+	return &Collector{prober: p}
+}
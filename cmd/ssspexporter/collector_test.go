@@ -0,0 +1,63 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang SSSP metrics exporter
+*/
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestCollector(t *testing.T) {
+	var b strings.Builder
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+
+	p, err := sssp.NewPool(ts.Network, ts.Addr, time.Second, 2*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	c := NewCollector(p)
+	if err = c.Probe(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c.WriteTo(&b)
+	out := b.String()
+	for _, want := range []string{
+		"sssp_up 1\n",
+		"sssp_eicar_detected 1\n",
+		`server_version="SAV Dynamic Interface 2.6.0"`,
+		"sssp_virus_data_timestamp_seconds ",
+		"sssp_probes_total 1\n",
+		"sssp_probe_failures_total 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("The output should contain %q:\n%s", want, out)
+		}
+	}
+
+	ts.Close()
+	if err = c.Probe(); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	b.Reset()
+	c.WriteTo(&b)
+	out = b.String()
+	for _, want := range []string{"sssp_up 0\n", "sssp_probe_failures_total 1\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("The output should contain %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang SSSP metrics exporter
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	cfg     *Config
+	cmdName string
+)
+
+// Config holds the configuration
+type Config struct {
+	Listen      string
+	Network     string
+	Address     string
+	Interval    time.Duration
+	ConnTimeout time.Duration
+	IOTimeout   time.Duration
+}
+
+func init() {
+	cfg = &Config{}
+	cmdName = path.Base(os.Args[0])
+	flag.StringVarP(&cfg.Listen, "listen", "l", ":9344",
+		`Address to listen on for metrics requests.`)
+	flag.StringVarP(&cfg.Network, "network", "n", "unix",
+		`Network used to connect to the SSSP server (unix, tcp, tcp4, tcp6).`)
+	flag.StringVarP(&cfg.Address, "address", "a", "/var/lib/savdid/sssp.sock",
+		`Address of the SSSP server.`)
+	flag.DurationVarP(&cfg.Interval, "interval", "i", 1*time.Minute,
+		`Interval between probes.`)
+	flag.DurationVar(&cfg.ConnTimeout, "conn-timeout", 15*time.Second,
+		`Connection timeout.`)
+	flag.DurationVar(&cfg.IOTimeout, "io-timeout", 30*time.Second,
+		`Command timeout.`)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", cmdName)
+	fmt.Fprint(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.ErrHelp = errors.New("")
+	flag.CommandLine.SortFlags = false
+	flag.Parse()
+
+	p, err := sssp.NewPool(cfg.Network, cfg.Address, cfg.ConnTimeout, cfg.IOTimeout, 0, 1)
+	if err != nil {
+		log.Fatalln("ERROR:=>", err)
+	}
+	defer p.Close()
+
+	col := NewCollector(p)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		t := time.NewTicker(cfg.Interval)
+		defer t.Stop()
+		for {
+			if err := col.Probe(); err != nil {
+				log.Println("WARNING:=> probe failed:", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		col.WriteTo(w)
+	})
+	srv := &http.Server{
+		Addr:    cfg.Listen,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+
+	log.Printf("%s listening on %s", cmdName, cfg.Listen)
+	if err = srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalln("ERROR:=>", err)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang SSSP load balancing proxy
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/proxy"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	cfg     *Config
+	cmdName string
+)
+
+// Config holds the configuration
+type Config struct {
+	Network        string
+	Listen         string
+	Upstreams      []string
+	DialTimeout    time.Duration
+	HealthInterval time.Duration
+}
+
+func init() {
+	cfg = &Config{}
+	cmdName = path.Base(os.Args[0])
+	flag.StringVarP(&cfg.Network, "network", "n", "tcp",
+		`Network to listen on (unix, tcp, tcp4, tcp6).`)
+	flag.StringVarP(&cfg.Listen, "listen", "l", "127.0.0.1:4010",
+		`Address or unix socket path to listen on.`)
+	flag.StringSliceVarP(&cfg.Upstreams, "upstream", "u", nil,
+		`Upstream SSSP server, either network:address, host:port or a unix socket path.
+Can be repeated or comma separated.`)
+	flag.DurationVar(&cfg.DialTimeout, "dial-timeout", 5*time.Second,
+		`Upstream connection timeout.`)
+	flag.DurationVar(&cfg.HealthInterval, "health-interval", 10*time.Second,
+		`Interval between upstream health checks.`)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", cmdName)
+	fmt.Fprint(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var ups []*proxy.Upstream
+
+	flag.Usage = usage
+	flag.ErrHelp = errors.New("")
+	flag.CommandLine.SortFlags = false
+	flag.Parse()
+
+	for _, s := range cfg.Upstreams {
+		u, err := proxy.ParseUpstream(s)
+		if err != nil {
+			log.Fatalln("ERROR:=>", err)
+		}
+		ups = append(ups, u)
+	}
+
+	p, err := proxy.NewProxy(ups...)
+	if err != nil {
+		usage()
+		log.Fatalln("ERROR:=>", err)
+	}
+	p.SetDialTimeout(cfg.DialTimeout)
+	p.SetHealthInterval(cfg.HealthInterval)
+
+	if cfg.Network == "unix" {
+		os.Remove(cfg.Listen)
+	}
+	l, err := net.Listen(cfg.Network, cfg.Listen)
+	if err != nil {
+		log.Fatalln("ERROR:=>", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		p.Close()
+	}()
+
+	log.Printf("%s listening on %s:%s", cmdName, cfg.Network, cfg.Listen)
+	if err = p.Serve(l); err != nil && err != proxy.ErrServerClosed {
+		log.Fatalln("ERROR:=>", err)
+	}
+}
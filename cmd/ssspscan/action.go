@@ -0,0 +1,99 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/quarantine"
+)
+
+const (
+	exclusiveErr = "%s and %s are mutually exclusive"
+)
+
+// An action is applied to infected files once the verdict has been
+// reported, it returns a message describing what was done
+type action func(path string, r *sssp.Response) (msg string, err error)
+
+// relPath returns the path of p relative to the parent of the root it
+// was found under, so that files found under /srv/uploads are stored
+// as uploads/..., paths outside the roots are made relative to /
+func relPath(roots []string, p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		abs = p
+	}
+
+	for _, root := range roots {
+		r, err := filepath.Abs(root)
+		if err != nil || (r != abs && !strings.HasPrefix(abs, r+string(filepath.Separator))) {
+			continue
+		}
+		if rel, err := filepath.Rel(filepath.Dir(r), abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+
+	return filepath.ToSlash(strings.TrimPrefix(abs, filepath.VolumeName(abs)+string(filepath.Separator)))
+}
+
+// newMoveAction returns an action that moves infected files into the
+// quarantine directory dir preserving their path relative to the
+// roots, a metadata sidecar is written alongside each file
+func newMoveAction(dir string, roots []string, dryRun bool) (a action, err error) {
+	var m *quarantine.Manager
+
+	if dryRun {
+		a = func(p string, r *sssp.Response) (string, error) {
+			return fmt.Sprintf("Would move %s to %s", p, filepath.Join(dir, filepath.FromSlash(relPath(roots, p)))), nil
+		}
+		return
+	}
+
+	if m, err = quarantine.NewManager(dir); err != nil {
+		return
+	}
+
+	a = func(p string, r *sssp.Response) (msg string, err error) {
+		var md *quarantine.Metadata
+
+		res := *r
+		res.Filename = p
+		if md, err = m.QuarantineAs(&res, relPath(roots, p)); err != nil {
+			return
+		}
+		msg = fmt.Sprintf("Moved %s to %s", p, filepath.Join(dir, filepath.FromSlash(md.ID)))
+
+		return
+	}
+
+	return
+}
+
+// newRemoveAction returns an action that deletes infected files
+func newRemoveAction(dryRun bool) action {
+	return func(p string, r *sssp.Response) (msg string, err error) {
+		if dryRun {
+			msg = fmt.Sprintf("Would remove %s", p)
+			return
+		}
+		if err = os.Remove(p); err != nil {
+			return
+		}
+		msg = fmt.Sprintf("Removed %s", p)
+
+		return
+	}
+}
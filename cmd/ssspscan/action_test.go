@@ -0,0 +1,104 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestRelPath(t *testing.T) {
+	tests := []struct {
+		roots []string
+		p     string
+		rel   string
+	}{
+		{[]string{"/srv/uploads"}, "/srv/uploads/a/b.exe", "uploads/a/b.exe"},
+		{[]string{"/srv/uploads/"}, "/srv/uploads/b.exe", "uploads/b.exe"},
+		{[]string{"/srv/up", "/srv/uploads"}, "/srv/uploads/b.exe", "uploads/b.exe"},
+		{[]string{"/tmp/eicar.com"}, "/tmp/eicar.com", "eicar.com"},
+		{[]string{"/srv/uploads"}, "/var/spool/x", "var/spool/x"},
+	}
+	for _, tt := range tests {
+		if rel := relPath(tt.roots, tt.p); rel != tt.rel {
+			t.Errorf("relPath(%v, %q) = %q, want %q", tt.roots, tt.p, rel, tt.rel)
+		}
+	}
+}
+
+func TestMoveAction(t *testing.T) {
+	dir := writeTree(t)
+	qdir := filepath.Join(t.TempDir(), "quarantine")
+
+	fn := filepath.Join(dir, "sub", "eicar.com")
+
+	a, err := newMoveAction(qdir, []string{dir}, true)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = a(fn, &sssp.Response{Infected: true}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = os.Stat(qdir); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be moved in a dry run")
+	}
+
+	if a, err = newMoveAction(qdir, []string{dir}, false); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = a(fn, &sssp.Response{Infected: true, Signature: "EICAR-AV-Test"}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("The infected file should be moved")
+	}
+
+	dest := filepath.Join(qdir, filepath.Base(dir), "sub", "eicar.com")
+	if b, err := ioutil.ReadFile(dest); err != nil || string(b) != eicarVirus {
+		t.Errorf("The file should be moved to %s: %v", dest, err)
+	}
+
+	var md map[string]interface{}
+	b, err := ioutil.ReadFile(dest + ".json")
+	if err != nil {
+		t.Fatalf("The metadata sidecar should be written: %s", err)
+	}
+	if err = json.Unmarshal(b, &md); err != nil || md["signature"] != "EICAR-AV-Test" || md["original_path"] != fn {
+		t.Errorf("Unexpected metadata: %s", b)
+	}
+}
+
+func TestRemoveAction(t *testing.T) {
+	dir := writeTree(t)
+	fn := filepath.Join(dir, "sub", "eicar.com")
+	r := &sssp.Response{Infected: true, Signature: "EICAR-AV-Test"}
+
+	if _, err := newRemoveAction(true)(fn, r); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err := os.Stat(fn); err != nil {
+		t.Errorf("Nothing should be removed in a dry run: %s", err)
+	}
+
+	if _, err := newRemoveAction(false)(fn, r); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("The infected file should be removed")
+	}
+	if _, err := newRemoveAction(false)(fn, r); err == nil {
+		t.Errorf("An error should be returned for a missing file")
+	}
+}
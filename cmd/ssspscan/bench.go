@@ -0,0 +1,80 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/bench"
+	flag "github.com/spf13/pflag"
+)
+
+func benchFlags(fs *flag.FlagSet, c *Config) {
+	c.BenchPayloadSize = 64 << 10
+	fs.IntVarP(&c.Concurrency, "concurrency", "j", 4,
+		`Number of concurrent connections.`)
+	fs.IntVarP(&c.BenchRequests, "requests", "r", 100,
+		`Total number of requests to send, 0 runs for --duration.`)
+	fs.DurationVarP(&c.BenchDuration, "duration", "d", 10*time.Second,
+		`Duration of the test when --requests is 0.`)
+	fs.Var(&c.BenchPayloadSize, "payload-size",
+		`Size of the generated payloads, the size may have a K or M suffix.`)
+	fs.BoolVar(&c.BenchInfected, "infected", false,
+		`Include the EICAR test string in the payloads.`)
+}
+
+func runBench(c *Config, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return benchmark(ctx, c)
+}
+
+func benchmark(ctx context.Context, c *Config) int {
+	t, err := c.tlsConfig()
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	network, address := c.dialAddress()
+	r, err := bench.Run(ctx, bench.Config{
+		Network:     network,
+		Address:     address,
+		ConnTimeout: c.ConnTimeout,
+		IOTimeout:   c.IOTimeout,
+		Connections: c.Concurrency,
+		Duration:    c.BenchDuration,
+		Requests:    c.BenchRequests,
+		Mode:        bench.ScanData,
+		PayloadSize: int64(c.BenchPayloadSize),
+		Infected:    c.BenchInfected,
+		TLSConfig:   t,
+	})
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	if _, err = r.WriteTo(stdout); err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+	if r.Errors > 0 {
+		return exitError
+	}
+
+	return exitClean
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestBenchmark(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+
+	conf := testConfig(t, ts)
+	conf.Concurrency = 2
+	conf.BenchRequests = 10
+	conf.BenchPayloadSize = 1024
+	conf.BenchInfected = true
+	if code := benchmark(context.Background(), conf); code != exitClean {
+		t.Errorf("benchmark() = %d, want %d", code, exitClean)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "Requests:\t10\n") || !strings.Contains(out, "Infected:\t10\n") {
+		t.Errorf("Unexpected report:\n%s", out)
+	}
+	if n := len(ts.Requests()); n != 10 {
+		t.Errorf("len(ts.Requests()) = %d, want %d", n, 10)
+	}
+
+	ts.Close()
+	if code := benchmark(context.Background(), conf); code != exitError {
+		t.Errorf("benchmark() = %d, want %d", code, exitError)
+	}
+}
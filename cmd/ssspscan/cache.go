@@ -0,0 +1,115 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/store"
+)
+
+const (
+	cachedMsg      = "unchanged since the clean scan of %s"
+	noEngineErr    = "The server did not report the virus engine and data versions"
+	cacheTimestamp = "2006-01-02 15:04:05"
+)
+
+// A scanCache records the hashes of the files found clean by the
+// current engine and virus data so that unchanged files are not
+// scanned again
+type scanCache struct {
+	store store.Store
+	// engine identifies the engine and virus data, the cached
+	// results of other versions are ignored
+	engine string
+}
+
+// lookup hashes the file p, it returns the reason for skipping the
+// file when its content was found clean by the current engine
+func (c *scanCache) lookup(p string) (sum, reason string, err error) {
+	var rc *store.Record
+
+	if sum, err = hashFile(p, sha256.New); err != nil {
+		return
+	}
+
+	if rc, err = c.store.LastByHash(sum); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+		return
+	}
+	if rc.EngineVersion == c.engine && !rc.Infected && !rc.ErrorOccured {
+		reason = fmt.Sprintf(cachedMsg, rc.ScannedAt.Local().Format(cacheTimestamp))
+	}
+
+	return
+}
+
+// add records the outcome of a scan, only clean results are kept
+func (c *scanCache) add(sum string, r *sssp.Response, d time.Duration) error {
+	if r == nil || r.Infected || r.ErrorOccured {
+		return nil
+	}
+
+	return c.store.Put(store.NewRecord(r, sum, c.engine, d))
+}
+
+// Close closes the store
+func (c *scanCache) Close() error {
+	return c.store.Close()
+}
+
+// engineVersion returns the version of the engine and virus data
+// reported by QUERY SAVI
+func engineVersion(c checker) (v string, err error) {
+	var info sssp.Info
+
+	if info, err = c.QuerySAVI(); err != nil {
+		return
+	}
+
+	engine, data := info.Get("virusengine"), info.Get("virusdatachecksum")
+	if engine == "" || data == "" {
+		err = fmt.Errorf(noEngineErr)
+		return
+	}
+	v = engine + "/" + data + "/" + info.Get("virusdatadate")
+
+	return
+}
+
+// openCache opens the cache database at p, the engine version is
+// queried using a dedicated connection
+func openCache(cfg *Config, p string) (c *scanCache, err error) {
+	var engine string
+	var st *store.BoltStore
+
+	q, err := newClient(cfg)
+	if err != nil {
+		return
+	}
+	engine, err = engineVersion(q)
+	q.Close()
+	if err != nil {
+		return
+	}
+
+	if st, err = store.OpenBolt(p); err != nil {
+		return
+	}
+	c = &scanCache{store: st, engine: engine}
+
+	return
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+	"github.com/baruwa-enterprise/sssp/store"
+)
+
+func TestScanCache(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+
+	conf := testConfig(t, ts)
+	conf.Format = "json"
+	conf.Cache = filepath.Join(t.TempDir(), "cache.db")
+	dir := writeTree(t)
+
+	if code := run(conf, []string{dir}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+
+	conf.LocalRecursive = true
+	scans := func() (n int) {
+		for _, r := range ts.Requests() {
+			if r.Command == "SCANDATA" {
+				n++
+			}
+		}
+		return
+	}
+
+	if code := run(conf, []string{dir}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+	if n := scans(); n != 3 {
+		t.Errorf("scans() = %d, want %d", n, 3)
+	}
+
+	buf.Reset()
+	if code := run(conf, []string{dir}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+	if n := scans(); n != 4 {
+		t.Errorf("Only the infected file should be scanned again, scans() = %d, want %d", n, 4)
+	}
+	if !strings.Contains(buf.String(), `"skipped": 2`) {
+		t.Errorf("The cached files should be skipped:\n%s", buf.String())
+	}
+
+	st, err := store.OpenBolt(conf.Cache)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c := &scanCache{store: st, engine: "other"}
+	defer c.Close()
+	_, reason, err := c.lookup(filepath.Join(dir, "clean.txt"))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if reason != "" {
+		t.Errorf("Results of other engine versions should be ignored")
+	}
+	if _, _, err = c.lookup(filepath.Join(dir, "nonexistent")); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+// Nagios plugin states
+const (
+	stateOK = iota
+	stateWarning
+	stateCritical
+	stateUnknown
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+	day        = 24 * time.Hour
+)
+
+var (
+	stateNames = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+	// severity orders the states, a critical result is not masked
+	// by a later unknown one
+	severity = [...]int{0, 2, 3, 1}
+)
+
+// checker is the interface used by the check, it is implemented
+// by sssp.Client
+type checker interface {
+	QueryServer() (sssp.Info, error)
+	QuerySAVI() (sssp.Info, error)
+	ScanReader(io.Reader) (*sssp.Response, error)
+}
+
+func runCheck(cfg *Config) int {
+	c, err := newClient(cfg)
+	if err != nil {
+		_, address := cfg.dialAddress()
+		fmt.Printf("SSSP CRITICAL - connection to %s failed: %s\n", address, err)
+		return stateCritical
+	}
+	defer c.Close()
+
+	return check(c, os.Stdout, cfg.WarningAge, cfg.CriticalAge, time.Now())
+}
+
+// check queries the server, verifies the age of the virus data and
+// scans the EICAR test string, it writes a single line of Nagios
+// plugin output with perfdata to w and returns the plugin state
+func check(c checker, w io.Writer, warnAge, critAge int, now time.Time) (state int) {
+	var msgs []string
+	var perf []string
+
+	raise := func(s int, m string) {
+		if severity[s] > severity[state] {
+			state = s
+		}
+		msgs = append(msgs, m)
+	}
+
+	defer func() {
+		fmt.Fprintf(w, "SSSP %s - %s", stateNames[state], strings.Join(msgs, ", "))
+		if len(perf) > 0 {
+			fmt.Fprintf(w, " | %s", strings.Join(perf, " "))
+		}
+		fmt.Fprintln(w)
+	}()
+
+	srv, err := c.QueryServer()
+	if err != nil {
+		raise(stateCritical, fmt.Sprintf("QUERY SERVER failed: %s", err))
+		return
+	}
+	savi, err := c.QuerySAVI()
+	if err != nil {
+		raise(stateCritical, fmt.Sprintf("QUERY SAVI failed: %s", err))
+		return
+	}
+
+	msgs = append(msgs, fmt.Sprintf("%s, engine %s", srv.Get("version"), savi.Get("virusengine")))
+
+	if d, err := savi.Time("virusdatadate"); err != nil {
+		raise(stateUnknown, fmt.Sprintf("virus data date unknown: %s", err))
+	} else {
+		age := int(now.Sub(d) / day)
+		m := fmt.Sprintf("virus data %s (%d days old)", d.Format("2006-01-02"), age)
+		switch {
+		case critAge > 0 && age >= critAge:
+			raise(stateCritical, m)
+		case warnAge > 0 && age >= warnAge:
+			raise(stateWarning, m)
+		default:
+			msgs = append(msgs, m)
+		}
+		perf = append(perf, fmt.Sprintf("data_age=%d;%d;%d;0", age, warnAge, critAge))
+	}
+
+	start := time.Now()
+	r, err := c.ScanReader(strings.NewReader(eicarVirus))
+	elapsed := time.Since(start)
+	switch {
+	case err != nil:
+		raise(stateCritical, fmt.Sprintf("EICAR self-test failed: %s", err))
+	case !r.Infected:
+		raise(stateCritical, "EICAR self-test not detected")
+	default:
+		msgs = append(msgs, fmt.Sprintf("EICAR detected in %.3fs", elapsed.Seconds()))
+		perf = append(perf, fmt.Sprintf("scan_time=%.6fs;;;0", elapsed.Seconds()))
+	}
+
+	return
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func savi(date string) sssptest.Handler {
+	return func(r *sssptest.Request) *sssptest.Reply {
+		if r.Command == "QUERY" && r.Arg == "SAVI" {
+			return sssptest.Lines(
+				"version: 5.80",
+				"virusengine: 3.80.1",
+				"virusdatadate: "+date,
+			)
+		}
+		return sssptest.DefaultHandler(r)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name  string
+		h     sssptest.Handler
+		state int
+		out   string
+	}{
+		{"ok", sssptest.DefaultHandler, stateOK, "data_age=0;2;7;0 scan_time="},
+		{"warning", savi(now.AddDate(0, 0, -3).Format("20060102")), stateWarning, "data_age=3;2;7;0"},
+		{"critical", savi(now.AddDate(0, 0, -10).Format("20060102")), stateCritical, "data_age=10;2;7;0"},
+		{"unknown", savi("never"), stateUnknown, "virus data date unknown"},
+		{"eicar", func(r *sssptest.Request) *sssptest.Reply {
+			if r.Command == "SCANDATA" {
+				return sssptest.Clean()
+			}
+			return sssptest.DefaultHandler(r)
+		}, stateCritical, "EICAR self-test not detected"},
+		{"query", func(r *sssptest.Request) *sssptest.Reply {
+			if r.Command == "QUERY" {
+				return sssptest.Lines("REJ 2 QUERY")
+			}
+			return sssptest.DefaultHandler(r)
+		}, stateCritical, "QUERY SERVER failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			ts := sssptest.NewServer(tt.h)
+			defer ts.Close()
+
+			c, err := sssp.NewClient(context.Background(), ts.Network, ts.Addr, time.Second, 2*time.Second, 0)
+			if err != nil {
+				t.Fatalf("An error should not be returned: %s", err)
+			}
+			defer c.Close()
+
+			state := check(c, &buf, 2, 7, now)
+			out := buf.String()
+			if state != tt.state {
+				t.Errorf("check() = %d, want %d: %s", state, tt.state, out)
+			}
+			if !strings.HasPrefix(out, "SSSP "+stateNames[tt.state]+" - ") || !strings.Contains(out, tt.out) {
+				t.Errorf("Unexpected output: %q", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// A command is a subcommand of ssspscan, the first argument selects
+// the command and the remaining ones are passed to run, a path with
+// the same name as a command can be scanned using ./name
+type command struct {
+	name    string
+	summary string
+	// args describes the positional arguments in the usage
+	args string
+	// local commands do not connect to the server so the
+	// connection flags are not defined
+	local bool
+	// flags defines the command specific flags
+	flags func(fs *flag.FlagSet, c *Config)
+	// run is called with the parsed configuration and the
+	// positional arguments
+	run func(c *Config, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "bench",
+			summary: "Benchmark the server using synthetic payloads",
+			flags:   benchFlags,
+			run:     runBench,
+		},
+		{
+			name:    "serve",
+			summary: "Serve an HTTP scanning API backed by a pool of connections",
+			flags:   serveFlags,
+			run:     runServe,
+		},
+		{
+			name:    "query",
+			summary: "Print the server, SAVI and engine information",
+			args:    "[" + strings.Join(queryItems, "|") + "]",
+			flags:   queryFlags,
+			run:     runQuery,
+		},
+		{
+			name:    "ping",
+			summary: "Check that the server is alive and report the round-trip time",
+			flags:   pingFlags,
+			run:     runPing,
+		},
+		{
+			name:    "diff",
+			summary: "Compare two JSON reports and list the files whose verdict changed",
+			args:    "old.json new.json",
+			local:   true,
+			run:     runDiff,
+		},
+		{
+			name:    "completion",
+			summary: "Generate the shell completion script",
+			args:    strings.Join(shellNames(), "|"),
+			local:   true,
+			run:     runCompletion,
+		},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// flagSet returns the flag set of the command with the connection
+// flags and the command specific flags defined on c
+func (cmd *command) flagSet(c *Config) *flag.FlagSet {
+	name := cmdName + " " + cmd.name
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SortFlags = false
+	if cmd.flags != nil {
+		cmd.flags(fs, c)
+	}
+	if !cmd.local {
+		connFlags(fs, c)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s\n", strings.TrimSpace(name+" [options] "+cmd.args))
+		fmt.Fprintf(os.Stderr, "\n%s.\n", cmd.summary)
+		fmt.Fprint(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// execute parses the arguments of the command applying the
+// environment and the configuration file and runs it
+func (cmd *command) execute(args []string) int {
+	c := &Config{}
+	fs := cmd.flagSet(c)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitClean
+		}
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return exitError
+	}
+
+	if err := loadEnv(fs); err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+	if err := loadConfig(fs, c.Config, false); err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	return cmd.run(c, fs.Args())
+}
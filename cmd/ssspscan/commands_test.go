@@ -0,0 +1,48 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	if lookupCommand("unknown") != nil {
+		t.Errorf("lookupCommand() should return nil for an unknown command")
+	}
+
+	var called bool
+	cmd := &command{
+		name:    "test",
+		summary: "Test command",
+		run: func(c *Config, args []string) int {
+			called = true
+			if c.Port != 4020 || len(args) != 1 || args[0] != "arg" {
+				t.Errorf("Unexpected config %+v and args %v", c, args)
+			}
+			return exitInfected
+		},
+	}
+
+	if code := cmd.execute([]string{"--port", "4020", "arg"}); code != exitInfected || !called {
+		t.Errorf("execute() = %d, want %d", code, exitInfected)
+	}
+
+	called = false
+	if code := cmd.execute([]string{"--no-such-flag"}); code != exitError || called {
+		t.Errorf("execute() = %d, want %d", code, exitError)
+	}
+
+	for _, c := range commands {
+		if lookupCommand(c.name) != c || c.summary == "" || c.run == nil {
+			t.Errorf("The command %s is not registered properly", c.name)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	invalidShellErr = "Invalid shell: %s, supported shells are %s"
+)
+
+var (
+	completions = map[string]func(w io.Writer, cs []compCommand) error{
+		"bash": writeBash,
+		"zsh":  writeZsh,
+		"fish": writeFish,
+	}
+	funcNameRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// A compCommand describes a command for the completion scripts, the
+// options of the scan mode have an empty name
+type compCommand struct {
+	name    string
+	summary string
+	flags   []*flag.Flag
+}
+
+func shellNames() (n []string) {
+	for k := range completions {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+
+	return
+}
+
+func runCompletion(c *Config, args []string) int {
+	if err := completion(stdout, args); err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	return exitClean
+}
+
+// completion writes the completion script for the shell named in
+// args, the scripts are generated from the commands and their flags
+func completion(w io.Writer, args []string) error {
+	var shell string
+
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	fn, ok := completions[shell]
+	if len(args) != 1 || !ok {
+		return fmt.Errorf(invalidShellErr, shell, strings.Join(shellNames(), ", "))
+	}
+
+	cs := []compCommand{{flags: visibleFlags(flag.CommandLine)}}
+	for _, cmd := range commands {
+		cs = append(cs, compCommand{
+			name:    cmd.name,
+			summary: cmd.summary,
+			flags:   visibleFlags(cmd.flagSet(&Config{})),
+		})
+	}
+
+	return fn(w, cs)
+}
+
+func visibleFlags(fs *flag.FlagSet) (fl []*flag.Flag) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if !f.Hidden && f.Deprecated == "" {
+			fl = append(fl, f)
+		}
+	})
+
+	return
+}
+
+// takesValue reports whether the flag requires an argument
+func takesValue(f *flag.Flag) bool {
+	return f.NoOptDefVal == "" && f.Value.Type() != "bool"
+}
+
+// takesFile reports whether the argument of the flag is a path
+func takesFile(f *flag.Flag) bool {
+	t := f.Value.Type()
+
+	return takesValue(f) && (t == "string" || t == "stringArray")
+}
+
+// summaryLine returns the first sentence of the usage of a flag
+func summaryLine(f *flag.Flag) string {
+	u := strings.Join(strings.Fields(f.Usage), " ")
+	if i := strings.Index(u, ". "); i != -1 {
+		u = u[:i]
+	}
+
+	return strings.TrimSuffix(u, ".")
+}
+
+func funcName() string {
+	return "_" + funcNameRe.ReplaceAllString(cmdName, "_")
+}
+
+func commandNames(cs []compCommand) (n []string) {
+	for _, c := range cs[1:] {
+		n = append(n, c.name)
+	}
+
+	return
+}
+
+func writeBash(w io.Writer, cs []compCommand) error {
+	var b strings.Builder
+
+	opts := func(c compCommand) string {
+		var o []string
+		for _, f := range c.flags {
+			o = append(o, "--"+f.Name)
+			if f.Shorthand != "" {
+				o = append(o, "-"+f.Shorthand)
+			}
+		}
+		return strings.Join(o, " ")
+	}
+	values := func(c compCommand) string {
+		var o []string
+		for _, f := range c.flags {
+			if takesValue(f) && !takesFile(f) {
+				o = append(o, "--"+f.Name)
+				if f.Shorthand != "" {
+					o = append(o, "-"+f.Shorthand)
+				}
+			}
+		}
+		return strings.Join(o, "|")
+	}
+
+	fn := funcName()
+	fmt.Fprintf(&b, "# bash completion for %s\n", cmdName)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	fmt.Fprintf(&b, "    local cur prev cmd opts values\n")
+	fmt.Fprintf(&b, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(&b, "    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(&b, "    [[ $COMP_CWORD -gt 1 ]] && cmd=\"${COMP_WORDS[1]}\"\n\n")
+	fmt.Fprintf(&b, "    case \"$cmd\" in\n")
+	for _, c := range cs[1:] {
+		fmt.Fprintf(&b, "    %s)\n        opts=%q\n        values=%q\n        ;;\n", c.name, opts(c), values(c))
+	}
+	fmt.Fprintf(&b, "    *)\n        opts=%q\n        values=%q\n        ;;\n    esac\n\n", opts(cs[0]), values(cs[0]))
+	fmt.Fprintf(&b, "    if [[ -n \"$values\" && \"|$values|\" == *\"|$prev|\"* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=()\n")
+	fmt.Fprintf(&b, "    elif [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"$opts\" -- \"$cur\"))\n")
+	fmt.Fprintf(&b, "    elif [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(commandNames(cs), " "))
+	fmt.Fprintf(&b, "    else\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(&b, "    fi\n}\n\n")
+	fmt.Fprintf(&b, "complete -o filenames -F %s %s\n", fn, cmdName)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func writeZsh(w io.Writer, cs []compCommand) error {
+	var b strings.Builder
+
+	esc := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]", ":", "\\:")
+	specs := func(c compCommand) {
+		for _, f := range c.flags {
+			arg := ""
+			if takesValue(f) {
+				arg = ":" + f.Name + ":"
+				if takesFile(f) {
+					arg += "_files"
+				}
+			}
+			desc := esc.Replace(summaryLine(f))
+			fmt.Fprintf(&b, "        '--%s=[%s]%s' \\\n", f.Name, desc, arg)
+			if f.Shorthand != "" {
+				fmt.Fprintf(&b, "        '-%s+[%s]%s' \\\n", f.Shorthand, desc, arg)
+			}
+		}
+		fmt.Fprintf(&b, "        '*:file:_files'\n")
+	}
+
+	fn := funcName()
+	fmt.Fprintf(&b, "#compdef %s\n\n", cmdName)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	fmt.Fprintf(&b, "    local -a commands\n")
+	fmt.Fprintf(&b, "    commands=(\n")
+	for _, c := range cs[1:] {
+		fmt.Fprintf(&b, "        '%s:%s'\n", c.name, esc.Replace(c.summary))
+	}
+	fmt.Fprintf(&b, "    )\n\n")
+	fmt.Fprintf(&b, "    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n")
+	fmt.Fprintf(&b, "        _describe 'command' commands\n")
+	fmt.Fprintf(&b, "        _files\n")
+	fmt.Fprintf(&b, "        return\n")
+	fmt.Fprintf(&b, "    fi\n\n")
+	fmt.Fprintf(&b, "    case $words[2] in\n")
+	for _, c := range cs[1:] {
+		fmt.Fprintf(&b, "    %s)\n        shift words\n        (( CURRENT-- ))\n        _arguments -s \\\n", c.name)
+		specs(c)
+		fmt.Fprintf(&b, "        ;;\n")
+	}
+	fmt.Fprintf(&b, "    *)\n        _arguments -s \\\n")
+	specs(cs[0])
+	fmt.Fprintf(&b, "        ;;\n    esac\n}\n\n")
+	fmt.Fprintf(&b, "%s \"$@\"\n", fn)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func writeFish(w io.Writer, cs []compCommand) error {
+	var b strings.Builder
+
+	esc := strings.NewReplacer("\\", "\\\\", "'", "\\'")
+	names := strings.Join(commandNames(cs), " ")
+	specs := func(cond string, c compCommand) {
+		for _, f := range c.flags {
+			fmt.Fprintf(&b, "complete -c %s -n '%s' -l %s", cmdName, cond, f.Name)
+			if f.Shorthand != "" {
+				fmt.Fprintf(&b, " -s %s", f.Shorthand)
+			}
+			switch {
+			case takesFile(f):
+				fmt.Fprintf(&b, " -r -F")
+			case takesValue(f):
+				fmt.Fprintf(&b, " -r -f")
+			}
+			fmt.Fprintf(&b, " -d '%s'\n", esc.Replace(summaryLine(f)))
+		}
+	}
+
+	fmt.Fprintf(&b, "# fish completion for %s\n", cmdName)
+	for _, c := range cs[1:] {
+		fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand' -a %s -d '%s'\n", cmdName, c.name, esc.Replace(c.summary))
+	}
+	specs("not __fish_seen_subcommand_from "+names, cs[0])
+	for _, c := range cs[1:] {
+		specs("__fish_seen_subcommand_from "+c.name, c)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
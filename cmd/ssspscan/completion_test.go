@@ -0,0 +1,45 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{"bash", []string{"complete -o filenames -F " + funcName() + " " + cmdName, "bench)", "--payload-size", "--format", "-j"}},
+		{"zsh", []string{"#compdef " + cmdName, "'bench:", "'--payload-size=[", "'--format=[", "'-j+["}},
+		{"fish", []string{"-a bench", "__fish_seen_subcommand_from bench", "-l payload-size", "-l format -r -F", "-l quiet -s q -d"}},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := completion(&b, []string{tt.shell}); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(b.String(), w) {
+				t.Errorf("The %s completion should contain %q", tt.shell, w)
+			}
+		}
+	}
+
+	if err := completion(&bytes.Buffer{}, []string{"tcsh"}); err == nil {
+		t.Errorf("An error should be returned")
+	}
+	if err := completion(&bytes.Buffer{}, nil); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
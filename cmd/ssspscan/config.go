@@ -0,0 +1,103 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFlag       = "config"
+	unknownOptionErr = "Unknown option %q in %s"
+	invalidOptionErr = "Invalid value for option %q in %s: %s"
+)
+
+// configPaths returns the locations searched for a configuration
+// file when --config is not given, the first one found is used
+func configPaths() (p []string) {
+	if d, err := os.UserConfigDir(); err == nil {
+		p = append(p, filepath.Join(d, "ssspscan", "config.yaml"))
+	}
+	p = append(p, "/etc/ssspscan/config.yaml")
+
+	return
+}
+
+// loadConfig reads a YAML configuration file and applies it to the
+// flags that were not set on the command line. The keys are the long
+// flag names and lists may be used for flags that can be repeated.
+// A missing file is an error only when the path is given explicitly,
+// unknown keys are an error when strict is set and ignored otherwise
+// so that subcommands can share the file.
+func loadConfig(fs *flag.FlagSet, path string, strict bool) (err error) {
+	var b []byte
+
+	if path == "" {
+		for _, p := range configPaths() {
+			if _, serr := os.Stat(p); serr == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return
+		}
+	}
+
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+
+	opts := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &opts); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+		return
+	}
+
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f := fs.Lookup(k)
+		if f == nil && !strict {
+			continue
+		}
+		if f == nil || k == configFlag {
+			err = fmt.Errorf(unknownOptionErr, k, path)
+			return
+		}
+		if f.Changed {
+			continue
+		}
+
+		vals, ok := opts[k].([]interface{})
+		if !ok {
+			vals = []interface{}{opts[k]}
+		}
+		for _, v := range vals {
+			if err = fs.Set(k, fmt.Sprint(v)); err != nil {
+				err = fmt.Errorf(invalidOptionErr, k, path, err)
+				return
+			}
+		}
+	}
+
+	return
+}
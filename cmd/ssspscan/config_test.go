@@ -0,0 +1,98 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestLoadConfig(t *testing.T) {
+	var host, format string
+	var port int
+	var timeout time.Duration
+	var local bool
+	var tags []string
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVarP(&host, "host", "H", "127.0.0.1", "")
+	fs.IntVarP(&port, "port", "p", 4010, "")
+	fs.StringVar(&format, "format", "text", "")
+	fs.DurationVar(&timeout, "io-timeout", time.Minute, "")
+	fs.BoolVar(&local, "local-recursive", false, "")
+	fs.StringSliceVar(&tags, "tag", nil, "")
+	fs.String(configFlag, "", "")
+
+	if err := fs.Parse([]string{"--port", "4020"}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "config.yaml")
+	conf := `host: savdi.example.com
+port: 4030
+format: json
+io-timeout: 30s
+local-recursive: true
+tag:
+  - one
+  - two
+`
+	if err := ioutil.WriteFile(p, []byte(conf), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if err := loadConfig(fs, p, true); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if host != "savdi.example.com" || format != "json" || timeout != 30*time.Second || !local {
+		t.Errorf("The configuration should be applied: %s %s %s %t", host, format, timeout, local)
+	}
+	if port != 4020 {
+		t.Errorf("Command line flags should take precedence, port = %d", port)
+	}
+	if len(tags) != 2 || tags[0] != "one" || tags[1] != "two" {
+		t.Errorf("Lists should set repeated flags: %v", tags)
+	}
+
+	if err := ioutil.WriteFile(p, []byte("unknown: value\n"), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if err := loadConfig(fs, p, false); err != nil {
+		t.Errorf("Unknown options should be ignored when not strict: %s", err)
+	}
+
+	tests := []string{
+		"unknown: value\n",
+		"config: /etc/other.yaml\n",
+		"io-timeout: forever\n",
+		"host: [\n",
+	}
+	for _, c := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("host", "", "")
+		fs.Duration("io-timeout", time.Minute, "")
+		fs.String(configFlag, "", "")
+		if err := ioutil.WriteFile(p, []byte(c), 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if err := loadConfig(fs, p, true); err == nil {
+			t.Errorf("An error should be returned for %q", c)
+		}
+	}
+
+	if err := loadConfig(fs, filepath.Join(dir, "missing.yaml"), false); err == nil {
+		t.Errorf("An error should be returned for a missing file")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+const (
+	diffArgsErr   = "Two JSON reports are required"
+	invalidRepErr = "Invalid JSON report %s: %s"
+)
+
+const (
+	verdictClean = iota
+	verdictInfected
+	verdictError
+	verdictSkipped
+)
+
+// A reportChange is a file whose verdict differs between two reports
+type reportChange struct {
+	path   string
+	change string
+	// detail is the signature of infected files or the error
+	detail string
+}
+
+func runDiff(c *Config, args []string) int {
+	if len(args) != 2 {
+		log.Println("ERROR:=>", fmt.Errorf(diffArgsErr))
+		return exitError
+	}
+
+	old, err := loadReport(args[0])
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+	cur, err := loadReport(args[1])
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	changes := diffReports(old, cur)
+	code := exitClean
+	for _, ch := range changes {
+		if ch.detail != "" {
+			fmt.Fprintf(stdout, "%s %s: %s\n", ch.change, ch.path, ch.detail)
+		} else {
+			fmt.Fprintf(stdout, "%s %s\n", ch.change, ch.path)
+		}
+		if ch.change == "INFECTED" {
+			code = exitInfected
+		}
+	}
+
+	return code
+}
+
+// diffReports lists the files of cur that became infected, clean or
+// failed since old, files missing from old are compared with a clean
+// verdict and files skipped by either run are ignored
+func diffReports(old, cur *jsonReport) (changes []reportChange) {
+	prev := make(map[string]int, len(old.Results))
+	for _, r := range old.Results {
+		prev[r.Path] = verdictOf(r)
+	}
+
+	for _, r := range cur.Results {
+		v := verdictOf(r)
+		p, ok := prev[r.Path]
+		if v == p || v == verdictSkipped || p == verdictSkipped {
+			continue
+		}
+
+		ch := reportChange{path: r.Path}
+		switch v {
+		case verdictInfected:
+			ch.change, ch.detail = "INFECTED", r.Response.Signature
+		case verdictError:
+			ch.change, ch.detail = "ERROR", r.Error
+			if ch.detail == "" && r.Response != nil {
+				ch.detail = r.Response.Raw
+			}
+		case verdictClean:
+			if !ok {
+				continue
+			}
+			ch.change = "CLEAN"
+		}
+		changes = append(changes, ch)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+
+	return
+}
+
+func verdictOf(r jsonResult) int {
+	switch {
+	case r.Skipped != "":
+		return verdictSkipped
+	case r.Error != "" || r.Response == nil || r.Response.ErrorOccured:
+		return verdictError
+	case r.Response.Infected:
+		return verdictInfected
+	}
+
+	return verdictClean
+}
+
+func loadReport(name string) (r *jsonReport, err error) {
+	var f *os.File
+
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer f.Close()
+
+	r = &jsonReport{}
+	if err = json.NewDecoder(f).Decode(r); err != nil {
+		err = fmt.Errorf(invalidRepErr, name, err)
+	}
+
+	return
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func writeReport(t *testing.T, name string, results map[string]*sssp.Response, errs map[string]error) string {
+	var buf bytes.Buffer
+
+	r := newJSONReporter(&buf)
+	for p, res := range results {
+		r.Result(p, res, nil)
+	}
+	for p, err := range errs {
+		r.Result(p, nil, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	p := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return p
+}
+
+func TestDiff(t *testing.T) {
+	var buf bytes.Buffer
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+
+	eicar := func(p string) *sssp.Response {
+		return &sssp.Response{Filename: p, Signature: "EICAR-AV-Test", Infected: true}
+	}
+	clean := func(p string) *sssp.Response {
+		return &sssp.Response{Filename: p}
+	}
+
+	old := writeReport(t, "old.json", map[string]*sssp.Response{
+		"/a": clean("/a"),
+		"/b": eicar("/b"),
+		"/c": clean("/c"),
+		"/d": eicar("/d"),
+	}, map[string]error{
+		"/e":   errTest,
+		"/big": &skipError{"too large"},
+	})
+	cur := writeReport(t, "new.json", map[string]*sssp.Response{
+		"/a":   eicar("/a"),
+		"/b":   clean("/b"),
+		"/d":   eicar("/d"),
+		"/e":   clean("/e"),
+		"/new": clean("/new"),
+		"/big": eicar("/big"),
+	}, map[string]error{
+		"/c": errTest,
+	})
+
+	if code := runDiff(&Config{}, []string{old, cur}); code != exitInfected {
+		t.Errorf("runDiff() = %d, want %d", code, exitInfected)
+	}
+	expected := "INFECTED /a: EICAR-AV-Test\nCLEAN /b\nERROR /c: " + errTest.Error() + "\nCLEAN /e\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if code := runDiff(&Config{}, []string{cur, cur}); code != exitClean || buf.Len() != 0 {
+		t.Errorf("runDiff() = %d, want %d: %q", code, exitClean, buf.String())
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	ioutil.WriteFile(bad, []byte("<xml/>"), 0644)
+	for _, args := range [][]string{{old}, {old, bad}, {old, "/nonexistent"}} {
+		if code := runDiff(&Config{}, args); code != exitError {
+			t.Errorf("runDiff(%v) = %d, want %d", args, code, exitError)
+		}
+	}
+}
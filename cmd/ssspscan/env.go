@@ -0,0 +1,83 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/baruwa-enterprise/sssp"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	envPrefix = "SSSP_"
+)
+
+// envName returns the environment variable for a flag, --io-timeout
+// is read from SSSP_IO_TIMEOUT
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadEnv applies the SSSP_* environment variables to the flags that
+// were not set on the command line. Besides the variable named after
+// each flag, SSSP_ADDRESS and SSSP_TIMEOUT which are understood by
+// sssp.NewClientFromEnv are honoured, an SSSP_ADDRESS that is a path
+// sets the unix socket.
+func loadEnv(fs *flag.FlagSet) (err error) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Changed || f.Name == "version" {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("%s: %w", envName(f.Name), serr)
+			}
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	if v, ok := os.LookupEnv(sssp.EnvTimeout); ok && !fs.Changed("io-timeout") {
+		if err = fs.Set("io-timeout", v); err != nil {
+			err = fmt.Errorf("%s: %w", sssp.EnvTimeout, err)
+			return
+		}
+	}
+
+	if v, ok := os.LookupEnv(sssp.EnvAddress); ok && strings.HasPrefix(v, "/") {
+		if !fs.Changed("unix") {
+			err = fs.Set("unix", v)
+		}
+		return
+	}
+
+	if v, ok := os.LookupEnv(sssp.EnvAddress); ok && !fs.Changed("host") && !fs.Changed("port") {
+		host, port, serr := net.SplitHostPort(v)
+		if serr != nil {
+			host, port = v, ""
+		}
+		if err = fs.Set("host", host); err != nil {
+			return
+		}
+		if port != "" {
+			if err = fs.Set("port", port); err != nil {
+				err = fmt.Errorf("%s: %w", sssp.EnvAddress, err)
+				return
+			}
+		}
+	}
+
+	return
+}
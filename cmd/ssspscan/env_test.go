@@ -0,0 +1,78 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestLoadEnv(t *testing.T) {
+	var host, format, unix string
+	var port int
+	var timeout time.Duration
+
+	newFlagSet := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.StringVarP(&host, "host", "H", "127.0.0.1", "")
+		fs.IntVarP(&port, "port", "p", 4010, "")
+		fs.StringVar(&format, "format", "text", "")
+		fs.StringVar(&unix, "unix", "", "")
+		fs.DurationVar(&timeout, "io-timeout", time.Minute, "")
+		return fs
+	}
+
+	if n := envName("io-timeout"); n != "SSSP_IO_TIMEOUT" {
+		t.Errorf("envName() = %s, want %s", n, "SSSP_IO_TIMEOUT")
+	}
+
+	t.Setenv("SSSP_ADDRESS", "savdi.example.com:4020")
+	t.Setenv("SSSP_TIMEOUT", "30s")
+	t.Setenv("SSSP_FORMAT", "json")
+
+	fs := newFlagSet()
+	if err := fs.Parse([]string{"--format", "xml"}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if err := loadEnv(fs); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if host != "savdi.example.com" || port != 4020 || timeout != 30*time.Second {
+		t.Errorf("The environment should be applied: %s %d %s", host, port, timeout)
+	}
+	if format != "xml" {
+		t.Errorf("Command line flags should take precedence, format = %s", format)
+	}
+
+	t.Setenv("SSSP_IO_TIMEOUT", "10s")
+	t.Setenv("SSSP_HOST", "other.example.com")
+	fs = newFlagSet()
+	if err := loadEnv(fs); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if timeout != 10*time.Second || host != "other.example.com" {
+		t.Errorf("Variables named after flags should take precedence: %s %s", host, timeout)
+	}
+
+	t.Setenv("SSSP_ADDRESS", "/var/lib/savdid/sssp.sock")
+	if err := loadEnv(newFlagSet()); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if unix != "/var/lib/savdid/sssp.sock" {
+		t.Errorf("A path should set the unix socket: %q", unix)
+	}
+
+	t.Setenv("SSSP_PORT", "invalid")
+	if err := loadEnv(newFlagSet()); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
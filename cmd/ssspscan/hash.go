@@ -0,0 +1,113 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	invalidHashErr = "Invalid hash algorithm: %s, supported algorithms are %s"
+	hashFormatErr  = "The %s format does not support --hashes"
+	notRegularErr  = "%s is not a regular file"
+)
+
+var hashAlgos = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// digestReporter is implemented by the reporters that can include
+// the digest of each file in the results
+type digestReporter interface {
+	setHasher(h *hasher)
+}
+
+// A hasher computes the digests of the files reported, the digests
+// are written as algorithm:hex
+type hasher struct {
+	name string
+	new  func() hash.Hash
+}
+
+// digest returns the digest of the file at path, an empty string is
+// returned when h is nil, the scan failed or the file cannot be read
+// locally such as the standard input or a path on the server
+func (h *hasher) digest(path string, err error) string {
+	if h == nil || err != nil || path == stdinPath {
+		return ""
+	}
+
+	sum, err := hashFile(path, h.new)
+	if err != nil {
+		return ""
+	}
+
+	return h.name + ":" + sum
+}
+
+func hashNames() (n []string) {
+	for k := range hashAlgos {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+
+	return
+}
+
+// hashFile returns the hex encoded digest of the file p
+func hashFile(p string, newHash func() hash.Hash) (sum string, err error) {
+	var f *os.File
+
+	if f, err = os.Open(p); err != nil {
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		err = fmt.Errorf(notRegularErr, p)
+		return
+	}
+
+	h := newHash()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	return
+}
+
+func newHasher(name string) (h *hasher, err error) {
+	fn, ok := hashAlgos[strings.ToLower(name)]
+	if !ok {
+		err = fmt.Errorf(invalidHashErr, name, strings.Join(hashNames(), ", "))
+		return
+	}
+	h = &hasher{name: strings.ToLower(name), new: fn}
+
+	return
+}
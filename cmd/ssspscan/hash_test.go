@@ -0,0 +1,104 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestHasher(t *testing.T) {
+	dir := writeTree(t)
+	p := filepath.Join(dir, "clean.txt")
+
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{"md5", "md5:123402c04dcfb6625f688f771a5fc05d"},
+		{"SHA1", "sha1:6a1cec45eaf37b34e1b1d89130d7746fe4006346"},
+		{"sha256", "sha256:3b066804f6d1d077173cfe4d06002e6a61e6f21c2b2e648417962115f1afcd8e"},
+	}
+	for _, tt := range tests {
+		h, err := newHasher(tt.algo)
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if d := h.digest(p, nil); d != tt.want {
+			t.Errorf("digest() = %q, want %q", d, tt.want)
+		}
+	}
+
+	h, _ := newHasher("sha256")
+	for _, tt := range []struct {
+		path string
+		err  error
+	}{
+		{p, errTest},
+		{stdinPath, nil},
+		{dir, nil},
+		{filepath.Join(dir, "nonexistent"), nil},
+	} {
+		if d := h.digest(tt.path, tt.err); d != "" {
+			t.Errorf("digest(%q, %v) = %q, want an empty digest", tt.path, tt.err, d)
+		}
+	}
+	if d := (*hasher)(nil).digest(p, nil); d != "" {
+		t.Errorf("A nil hasher should return an empty digest got %q", d)
+	}
+
+	if _, err := newHasher("crc32"); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestRunHashes(t *testing.T) {
+	var buf bytes.Buffer
+	var doc jsonReport
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+
+	conf := testConfig(t, ts)
+	conf.LocalRecursive = true
+	conf.Format = "json"
+	conf.Hashes = "sha256"
+	dir := writeTree(t)
+	if code := run(conf, []string{dir}); code != exitInfected {
+		t.Fatalf("run() = %d, want %d", code, exitInfected)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	for _, r := range doc.Results {
+		want, _ := hashFile(r.Path, hashAlgos["sha256"])
+		if r.Digest != "sha256:"+want {
+			t.Errorf("Unexpected digest %q for %s", r.Digest, r.Path)
+		}
+	}
+
+	conf.Format = "sarif"
+	if code := run(conf, []string{dir}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+	conf.Format = "json"
+	conf.Hashes = "crc32"
+	if code := run(conf, []string{dir}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+}
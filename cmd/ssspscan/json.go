@@ -0,0 +1,79 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+type jsonResult struct {
+	Path     string         `json:"path"`
+	Response *sssp.Response `json:"response,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Skipped  string         `json:"skipped,omitempty"`
+	Digest   string         `json:"digest,omitempty"`
+}
+
+type jsonReport struct {
+	Results []jsonResult `json:"results"`
+	Summary summary      `json:"summary"`
+}
+
+// jsonReporter writes a single JSON document containing the
+// response for each path and a summary of the run on Close
+type jsonReporter struct {
+	w      io.Writer
+	doc    jsonReport
+	hasher *hasher
+}
+
+func (j *jsonReporter) Result(path string, r *sssp.Response, err error) error {
+	j.doc.Summary.add(r, err)
+	res := newJSONResult(path, r, err)
+	res.Digest = j.hasher.digest(path, err)
+	j.doc.Results = append(j.doc.Results, res)
+
+	return nil
+}
+
+func (j *jsonReporter) setHasher(h *hasher) {
+	j.hasher = h
+}
+
+func (j *jsonReporter) Stats(bytes int64, elapsed time.Duration) {
+	j.doc.Summary.stats(bytes, elapsed)
+}
+
+func (j *jsonReporter) Close() error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(&j.doc)
+}
+
+func newJSONResult(path string, r *sssp.Response, err error) (j jsonResult) {
+	j.Path = path
+	j.Response = r
+	if reason, ok := skipReason(err); ok {
+		j.Skipped = reason
+	} else if err != nil {
+		j.Error = err.Error()
+	}
+
+	return
+}
+
+func newJSONReporter(w io.Writer) reporter {
+	return &jsonReporter{w: w, doc: jsonReport{Results: []jsonResult{}}}
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	var doc jsonReport
+
+	r := newJSONReporter(&buf)
+	r.Result("/tmp/eicar.com", &sssp.Response{Filename: "/tmp/eicar.com", Signature: "EICAR-AV-Test", Infected: true}, nil)
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	r.Stats(1<<20, time.Second)
+	if err := r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(doc.Results) != 3 {
+		t.Fatalf("len(doc.Results) = %d, want %d", len(doc.Results), 3)
+	}
+	if r := doc.Results[0].Response; r == nil || !r.Infected || r.Signature != "EICAR-AV-Test" {
+		t.Errorf("Unexpected result: %+v", doc.Results[0])
+	}
+	if doc.Results[2].Response != nil || doc.Results[2].Error != errTest.Error() {
+		t.Errorf("Unexpected result: %+v", doc.Results[2])
+	}
+	rs := doc.Summary.Report
+	if rs == nil || rs.Infected != 1 || rs.Errors != 1 || len(rs.Signatures) != 1 || rs.Signatures[0].Signature != "EICAR-AV-Test" {
+		t.Errorf("Unexpected report: %+v", rs)
+	}
+	doc.Summary.Report = nil
+	if doc.Summary != (summary{Files: 3, Infected: 1, Errors: 1, Bytes: 1 << 20, Elapsed: 1, Throughput: 1 << 20}) {
+		t.Errorf("Unexpected summary: %+v", doc.Summary)
+	}
+}
@@ -9,5 +9,657 @@ SSSP - Golang cmdline SSSP client
 */
 package main
 
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	flag "github.com/spf13/pflag"
+)
+
+// Exit codes of a scan, these match the clamdscan conventions
+const (
+	exitClean    = 0
+	exitInfected = 1
+	exitError    = 2
+)
+
+var (
+	stdout  io.Writer = os.Stdout
+	cfg     *Config
+	cmdName string
+)
+
+// Config holds the configuration
+type Config struct {
+	Config           string
+	Network          string
+	Unix             string
+	Address          string
+	Port             int
+	Postfix          bool
+	Sendmail         string
+	Sender           string
+	PostfixAction    string
+	ConnTimeout      time.Duration
+	IOTimeout        time.Duration
+	ConnRetries      int
+	ConnBackoff      time.Duration
+	KeepAlive        time.Duration
+	Bind             string
+	Retries          int
+	RetryBackoff     time.Duration
+	TLS              bool
+	TLSCA            string
+	TLSCert          string
+	TLSKey           string
+	TLSSkipVerify    bool
+	ShowVersion      bool
+	Format           string
+	Output           string
+	Template         string
+	TemplateFile     string
+	LocalRecursive   bool
+	FilesFrom        string
+	Null             bool
+	Concurrency      int
+	Exclude          []string
+	ExcludeDirs      []string
+	FollowSymlinks   bool
+	Cache            string
+	MaxDepth         int
+	Hashes           string
+	Unpack           bool
+	UnpackMaxSize    byteSize
+	UnpackMaxFiles   int
+	MaxFileSize      byteSize
+	Watch            bool
+	MoveInfected     string
+	Remove           bool
+	DryRun           bool
+	Quiet            bool
+	All              bool
+	Syslog           bool
+	SyslogFacility   string
+	SyslogTag        string
+	Verbose          int
+	Check            bool
+	WarningAge       int
+	CriticalAge      int
+	BenchRequests    int
+	BenchDuration    time.Duration
+	BenchPayloadSize byteSize
+	BenchInfected    bool
+	ServeListen      string
+	ServeMaxBodySize byteSize
+	Webhooks         []string
+	WebhookSecret    string
+	QueryJSON        bool
+	PingCount        int
+	PingInterval     time.Duration
+	PingEICAR        bool
+}
+
+func init() {
+	cfg = &Config{}
+	cmdName = path.Base(os.Args[0])
+	connFlags(flag.CommandLine, cfg)
+	flag.StringVar(&cfg.Format, "format", "text",
+		fmt.Sprintf(`Output format (%s).`, strings.Join(formatNames(), ", ")))
+	flag.StringVar(&cfg.Template, "template", "",
+		`Go template executed for each result with --format template, the
+response fields such as {{.Filename}} and {{.Signature}} as well as
+{{.Path}}, {{.Error}} and {{.Skipped}} are available.`)
+	flag.StringVar(&cfg.TemplateFile, "template-file", "",
+		`Go template file executed once the run is complete with
+--format template, {{.Results}} holds the data available to
+--template for every result and {{.Summary}} the counts of the run.
+Files ending in .html or .htm are escaped using html/template.`)
+	flag.StringVar(&cfg.Hashes, "hashes", "",
+		fmt.Sprintf(`Include the digest of each file computed with the given
+algorithm (%s) in the results, only files readable locally have a
+digest. The manifest format uses sha256 by default.`, strings.Join(hashNames(), ", ")))
+	flag.StringVarP(&cfg.Output, "output", "o", "",
+		`Write the report to the given file, it is replaced once the scan
+completes, progress and errors are still logged to stderr.`)
+	flag.BoolVar(&cfg.LocalRecursive, "local-recursive", false,
+		`Walk directories locally and send each file using SCANDATA,
+use when the paths are not shared with the server.`)
+	flag.StringVar(&cfg.FilesFrom, "files-from", "",
+		`Scan the paths listed one per line in the given file, - reads
+the list from stdin.`)
+	flag.BoolVarP(&cfg.Null, "null", "0", false,
+		`The paths in the list are separated by NUL characters as written
+by find -print0, the list is read from stdin unless --files-from is set.`)
+	flag.IntVarP(&cfg.Concurrency, "concurrency", "j", 1,
+		`Number of paths scanned in parallel, each uses its own connection.`)
+	flag.StringArrayVar(&cfg.Exclude, "exclude", nil,
+		`Skip files matching the glob pattern in local walks, patterns
+containing a separator are matched against the whole path, repeatable.`)
+	flag.StringArrayVar(&cfg.ExcludeDirs, "exclude-dir", nil,
+		`Skip directories matching the glob pattern in local walks,
+repeatable.`)
+	flag.BoolVar(&cfg.FollowSymlinks, "follow-symlinks", false,
+		`Follow symbolic links in local walks, links to directories that
+were already walked or that contain the link are skipped.`)
+	flag.IntVar(&cfg.MaxDepth, "max-depth", 0,
+		`Descend at most the given number of directory levels below the
+paths in local walks, 1 scans the files directly in the directories,
+0 disables the limit.`)
+	flag.BoolVar(&cfg.Unpack, "unpack", false,
+		`Unpack zip, tar, gzip and bzip2 archives in local walks and scan each
+member using SCANDATA, for servers with archive scanning disabled.`)
+	cfg.UnpackMaxSize = 256 << 20
+	flag.Var(&cfg.UnpackMaxSize, "unpack-max-size",
+		`Maximum total size of the members unpacked from an archive, the
+members are held in memory.`)
+	flag.IntVar(&cfg.UnpackMaxFiles, "unpack-max-files", 10000,
+		`Maximum number of members unpacked from an archive, 0 disables
+the limit.`)
+	flag.StringVar(&cfg.Cache, "cache", "",
+		`Database recording the hashes of the files found clean in local
+walks, unchanged files are skipped until the virus data is updated.`)
+	flag.Var(&cfg.MaxFileSize, "max-filesize",
+		`Skip files larger than the given size in local walks, the size
+may have a K, M or G suffix, 0 disables the limit.`)
+	flag.IntVar(&cfg.Retries, "retries", 0,
+		`Number of times a scan that failed with a transient error such as
+a dropped connection is retried.`)
+	flag.DurationVar(&cfg.RetryBackoff, "retry-backoff", time.Second,
+		`Delay before the first scan retry, doubled after each attempt.`)
+	flag.BoolVar(&cfg.Watch, "watch", false,
+		`Monitor the directories and scan new and modified files until
+interrupted.`)
+	flag.StringVar(&cfg.MoveInfected, "move-infected", "",
+		`Move infected files into the given quarantine directory, their
+path relative to the scanned directory is preserved.`)
+	flag.BoolVar(&cfg.Remove, "remove", false,
+		`Remove infected files.`)
+	flag.BoolVar(&cfg.DryRun, "dry-run", false,
+		`Report what --move-infected or --remove would do without
+changing any files.`)
+	flag.BoolVarP(&cfg.Quiet, "quiet", "q", false,
+		`Only print infected files and errors, the summary and skipped
+files are not logged.`)
+	flag.BoolVarP(&cfg.All, "all", "a", false,
+		`Also print clean files in the text and template formats, by
+default only infected files and errors are printed.`)
+	flag.BoolVar(&cfg.Syslog, "syslog", false,
+		`Also log infected files and errors to syslog.`)
+	flag.StringVar(&cfg.SyslogFacility, "syslog-facility", "user",
+		`Syslog facility (user, daemon, mail, local0-local7...).`)
+	flag.StringVar(&cfg.SyslogTag, "syslog-tag", cmdName,
+		`Syslog tag.`)
+	flag.CountVarP(&cfg.Verbose, "verbose", "v",
+		`Log each request, repeat (-vv) to log the protocol exchange.`)
+	flag.BoolVar(&cfg.Postfix, "postfix", false,
+		`Run as a Postfix content filter, the message is read from stdin
+and reinjected via sendmail when clean, the arguments are the recipients.`)
+	flag.StringVar(&cfg.Sendmail, "sendmail", "/usr/sbin/sendmail",
+		`Path to the sendmail binary used to reinject clean messages.`)
+	flag.StringVarP(&cfg.Sender, "from", "f", "",
+		`Envelope sender of the message in Postfix mode.`)
+	flag.StringVar(&cfg.PostfixAction, "postfix-action", "bounce",
+		`Action taken on infected messages in Postfix mode (bounce, discard).`)
+	flag.BoolVar(&cfg.Check, "check", false,
+		`Run as a Nagios/Icinga plugin, checks the virus data age and
+performs an EICAR self-test.`)
+	flag.IntVar(&cfg.WarningAge, "warning-age", 2,
+		`Virus data age in days that raises a warning in check mode.`)
+	flag.IntVar(&cfg.CriticalAge, "critical-age", 7,
+		`Virus data age in days that raises a critical in check mode.`)
+	flag.BoolVarP(&cfg.ShowVersion, "version", "V", false,
+		`Print the version and exit.`)
+}
+
+// connFlags defines the flags used to connect to the server, they
+// are shared by the subcommands
+func connFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVarP(&c.Config, configFlag, "c", "",
+		fmt.Sprintf(`Configuration file, the default locations are
+%s.`, strings.Join(configPaths(), ", ")))
+	fs.StringVarP(&c.Network, "network", "n", "tcp",
+		`Network used to connect to the SSSP server (tcp, tcp4, tcp6, unix).`)
+	fs.StringVarP(&c.Unix, "unix", "U", "",
+		`Connect to the SSSP server listening on the given unix socket.`)
+	fs.StringVarP(&c.Address, "host", "H", "127.0.0.1",
+		`Specify SSSP host to connect to.`)
+	fs.IntVarP(&c.Port, "port", "p", 4010,
+		`In TCP/IP mode, connect to SSSP server listening on given port`)
+	fs.DurationVar(&c.ConnTimeout, "conn-timeout", 15*time.Second,
+		`Connection timeout.`)
+	fs.DurationVar(&c.IOTimeout, "io-timeout", 1*time.Minute,
+		`Command timeout.`)
+	fs.IntVar(&c.ConnRetries, "conn-retries", 0,
+		`Number of connection retries when connecting times out.`)
+	fs.DurationVar(&c.ConnBackoff, "conn-backoff", time.Second,
+		`Delay between connection retries.`)
+	fs.DurationVar(&c.KeepAlive, "keepalive", 0,
+		`Interval between TCP keepalive probes, 0 uses the system default
+and a negative value disables them.`)
+	fs.StringVar(&c.Bind, "bind", "",
+		`Local IP address TCP connections are made from.`)
+	fs.BoolVar(&c.TLS, "tls", false,
+		`Connect to the server using TLS, implied by the other --tls options.`)
+	fs.StringVar(&c.TLSCA, "tls-ca", "",
+		`PEM file with the certificates used to verify the server, the
+system roots are used by default.`)
+	fs.StringVar(&c.TLSCert, "tls-cert", "",
+		`PEM file with the client certificate.`)
+	fs.StringVar(&c.TLSKey, "tls-key", "",
+		`PEM file with the key of the client certificate.`)
+	fs.BoolVar(&c.TLSSkipVerify, "tls-skip-verify", false,
+		`Do not verify the certificate of the server.`)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] paths...\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       %s [options] - < file\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       %s [options] --files-from list\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       find ... -print0 | %s [options] -0\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       %s [options] --watch dirs...\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       %s [options] --postfix -f sender -- recipients...\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       %s [options] --check\n", cmdName)
+	fmt.Fprintf(os.Stderr, "       %s command [options] [args...]\n", cmdName)
+	fmt.Fprint(os.Stderr, "\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprint(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+// dialAddress returns the network and address of the server, a unix
+// socket takes precedence over the host and port
+func (c *Config) dialAddress() (network, address string) {
+	if c.Unix != "" {
+		return "unix", c.Unix
+	}
+	if c.Network == "unix" || c.Network == "unixpacket" {
+		return c.Network, c.Address
+	}
+
+	// an IPv6 host may be given in brackets, as in a URL
+	host := strings.TrimSuffix(strings.TrimPrefix(c.Address, "["), "]")
+
+	return c.Network, net.JoinHostPort(host, strconv.Itoa(c.Port))
+}
+
+func newClient(cfg *Config) (*sssp.Client, error) {
+	network, address := cfg.dialAddress()
+
+	if cfg.Verbose > 0 {
+		log.Printf("Connecting to %s %s", network, address)
+	}
+
+	conn, err := dial(cfg, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Verbose > 1 {
+		conn = newTraceConn(conn, os.Stderr)
+	}
+
+	return sssp.NewClientConn(conn, cfg.IOTimeout)
+}
+
+// dial connects to the server, like the library connections that
+// time out are retried up to ConnRetries times after ConnBackoff
+func dial(cfg *Config, network, address string) (conn net.Conn, err error) {
+	var t *tls.Config
+
+	if t, err = cfg.tlsConfig(); err != nil {
+		return
+	}
+
+	nd := &net.Dialer{Timeout: cfg.ConnTimeout, KeepAlive: cfg.KeepAlive}
+	if cfg.Bind != "" && strings.HasPrefix(network, "tcp") {
+		if nd.LocalAddr, err = net.ResolveTCPAddr(network, net.JoinHostPort(cfg.Bind, "0")); err != nil {
+			return
+		}
+	}
+	for i := 0; i <= cfg.ConnRetries; i++ {
+		if i > 0 {
+			time.Sleep(cfg.ConnBackoff)
+		}
+		if t != nil {
+			conn, err = tls.DialWithDialer(nd, network, address, t)
+		} else {
+			conn, err = nd.Dial(network, address)
+		}
+		if e, ok := err.(net.Error); !ok || !e.Timeout() {
+			break
+		}
+	}
+
+	return
+}
+
+// newScanClient returns a pool of connections when scanning
+// concurrently, watching or retrying and a single client otherwise,
+// the pool reconnects when a connection is dropped
+func newScanClient(cfg *Config) (c scanClient, err error) {
+	if cfg.Retries > 0 {
+		defer func() {
+			if err == nil {
+				c = newRetryClient(c, cfg.Retries, cfg.RetryBackoff)
+			}
+		}()
+	}
+
+	if cfg.Concurrency <= 1 && !cfg.Watch && cfg.Retries <= 0 {
+		return newClient(cfg)
+	}
+
+	size := cfg.Concurrency
+	if size < 1 {
+		size = 1
+	}
+	c, err = newPool(cfg, size)
+
+	return
+}
+
+// newPool returns a pool of up to size connections to the server
+func newPool(cfg *Config, size int) (p *sssp.Pool, err error) {
+	var t *tls.Config
+
+	if t, err = cfg.tlsConfig(); err != nil {
+		return
+	}
+
+	network, address := cfg.dialAddress()
+	if p, err = sssp.NewPool(network, address, cfg.ConnTimeout, cfg.IOTimeout, cfg.ConnRetries, size); err != nil {
+		return
+	}
+	p.SetConnSleep(cfg.ConnBackoff)
+	p.SetKeepAlive(cfg.KeepAlive)
+	if cfg.Verbose > 1 {
+		// the lines of each connection are tagged with its number
+		p.SetDebug(os.Stderr)
+	}
+	if err = p.SetLocalAddr(cfg.Bind); err != nil {
+		return
+	}
+	p.SetTLSConfig(t)
+
+	return
+}
+
+func version() string {
+	v := Version
+	if VersionPrerelease != "" {
+		v += "-" + VersionPrerelease
+	}
+	if GitCommit != "" {
+		v += " (" + GitCommit + ")"
+	}
+
+	return v
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if c := lookupCommand(os.Args[1]); c != nil {
+			os.Exit(c.execute(os.Args[2:]))
+		}
+	}
+
+	flag.Usage = usage
+	flag.ErrHelp = errors.New("")
+	flag.CommandLine.SortFlags = false
+	flag.Parse()
+
+	// the command line takes precedence over the environment which
+	// takes precedence over the configuration file
+	if err := loadEnv(flag.CommandLine); err != nil {
+		log.Println("ERROR:=>", err)
+		os.Exit(exitError)
+	}
+	if err := loadConfig(flag.CommandLine, cfg.Config, true); err != nil {
+		log.Println("ERROR:=>", err)
+		os.Exit(exitError)
+	}
+
+	if cfg.ShowVersion {
+		fmt.Printf("%s %s\n", cmdName, version())
+		return
+	}
+
+	if cfg.Check {
+		os.Exit(runCheck(cfg))
+	}
+
+	if cfg.Postfix {
+		os.Exit(runPostfix(cfg, flag.Args()))
+	}
+
+	if flag.NArg() == 0 && cfg.FilesFrom == "" && !cfg.Null {
+		usage()
+		os.Exit(exitError)
+	}
+
+	os.Exit(run(cfg, flag.Args()))
+}
+
+// run scans the paths and returns the exit code, errors take
+// precedence over infections so that a partial run is never
+// mistaken for a complete one
+func run(cfg *Config, paths []string) int {
+	var err error
+	var sum summary
+	var scanned int64
+	var out *atomicFile
+	var w io.Writer = stdout
+
+	if cfg.Output != "" && cfg.Output != stdinPath {
+		if out, err = newAtomicFile(cfg.Output); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+		defer out.Abort()
+		w = out
+	}
+
+	rep, err := newReporter(cfg.Format, w)
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	if t, ok := rep.(*templateReporter); ok {
+		switch {
+		case cfg.TemplateFile != "" && cfg.Template != "":
+			err = fmt.Errorf(tmplConflictErr)
+		case cfg.TemplateFile != "":
+			err = t.parseFile(cfg.TemplateFile)
+		default:
+			err = t.parse(cfg.Template)
+		}
+		if err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+		t.all = cfg.All && !cfg.Quiet
+	}
+
+	if cfg.Hashes != "" {
+		var h *hasher
+		if h, err = newHasher(cfg.Hashes); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+		d, ok := rep.(digestReporter)
+		if !ok {
+			log.Println("ERROR:=>", fmt.Errorf(hashFormatErr, cfg.Format))
+			return exitError
+		}
+		d.setHasher(h)
+	}
+
+	c, err := newScanClient(cfg)
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+	defer c.Close()
+
+	if t, ok := rep.(*textReporter); ok {
+		t.all = cfg.All && !cfg.Quiet
+		if !cfg.Quiet {
+			t.summary = os.Stderr
+		}
+	}
+
+	if cfg.Syslog {
+		var l sysLogger
+		if l, err = newSysLogger(cfg.SyslogFacility, cfg.SyslogTag); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+		rep = newSyslogReporter(rep, l)
+	}
+
+	for _, p := range [][]string{cfg.Exclude, cfg.ExcludeDirs} {
+		if err = checkPatterns(p); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+	}
+
+	var act action
+	switch {
+	case cfg.MoveInfected != "" && cfg.Remove:
+		log.Println("ERROR:=>", fmt.Errorf(exclusiveErr, "--move-infected", "--remove"))
+		return exitError
+	case cfg.MoveInfected != "":
+		if act, err = newMoveAction(cfg.MoveInfected, paths, cfg.DryRun); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+	case cfg.Remove:
+		act = newRemoveAction(cfg.DryRun)
+	}
+
+	if cfg.Unpack && (!cfg.LocalRecursive || cfg.Watch) {
+		log.Println("ERROR:=>", fmt.Errorf(localOnlyErr, "--unpack"))
+		return exitError
+	}
+
+	var cache *scanCache
+	if cfg.Cache != "" {
+		if cfg.Watch {
+			log.Println("ERROR:=>", fmt.Errorf(exclusiveErr, "--watch", "--cache"))
+			return exitError
+		}
+		if !cfg.LocalRecursive {
+			log.Println("ERROR:=>", fmt.Errorf(localOnlyErr, "--cache"))
+			return exitError
+		}
+		if cache, err = openCache(cfg, cfg.Cache); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+		defer cache.Close()
+	}
+
+	var list io.Reader
+	if cfg.FilesFrom != "" || cfg.Null {
+		if cfg.Watch {
+			log.Println("ERROR:=>", fmt.Errorf(exclusiveErr, "--watch", "--files-from"))
+			return exitError
+		}
+		if list, err = openList(cfg.FilesFrom); err != nil {
+			log.Println("ERROR:=>", err)
+			return exitError
+		}
+		if c, ok := list.(io.Closer); ok {
+			defer c.Close()
+		}
+	}
+
+	fn := func(p string, r *sssp.Response, err error) error {
+		if reason, ok := skipReason(err); ok {
+			if !cfg.Quiet {
+				log.Printf("SKIPPED:=> %s: %s", p, reason)
+			}
+		} else if err != nil {
+			log.Println("ERROR:=>", err)
+		} else if cfg.Verbose > 0 && r != nil {
+			log.Printf("Scanned %s: infected=%t signature=%q raw=%q", p, r.Infected, r.Signature, r.Raw)
+		}
+		sum.add(r, err)
+		if cfg.Watch && err == nil {
+			scanned += fileSize(p)
+		}
+		if rerr := rep.Result(p, r, err); rerr != nil {
+			return rerr
+		}
+
+		// only act on a confirmed verdict
+		if act != nil && err == nil && r != nil && r.Infected && !r.ErrorOccured && p != stdinPath {
+			msg, aerr := act(p, r)
+			if aerr != nil {
+				log.Println("ERROR:=>", aerr)
+				sum.Errors++
+			} else if msg != "" {
+				log.Println(msg)
+			}
+		}
+
+		return nil
+	}
+
+	start := time.Now()
+	if cfg.Watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = watchDirs(ctx, c, paths, fn)
+	} else {
+		s := newScanner(c, fn)
+		s.local = cfg.LocalRecursive
+		s.workers = cfg.Concurrency
+		s.exclude = cfg.Exclude
+		s.excludeDirs = cfg.ExcludeDirs
+		s.followSymlinks = cfg.FollowSymlinks
+		s.maxSize = int64(cfg.MaxFileSize)
+		s.maxDepth = cfg.MaxDepth
+		s.cache = cache
+		if cfg.Unpack {
+			s.unpack = newUnpacker(c, int64(cfg.UnpackMaxSize), cfg.UnpackMaxFiles)
+		}
+		if err = s.Scan(paths); err == nil && list != nil {
+			sep := byte('\n')
+			if cfg.Null {
+				sep = 0
+			}
+			err = s.ScanList(list, sep)
+		}
+		scanned = s.Bytes()
+	}
+	if err == nil {
+		rep.Stats(scanned, time.Since(start))
+		err = rep.Close()
+	}
+	if err == nil && out != nil {
+		err = out.Commit()
+	}
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	return sum.exitCode()
 }
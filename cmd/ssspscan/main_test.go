@@ -0,0 +1,223 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func testConfig(t *testing.T, ts *sssptest.Server) *Config {
+	host, port, err := net.SplitHostPort(ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	return &Config{
+		Network:     "tcp",
+		Address:     host,
+		Port:        p,
+		Format:      "text",
+		ConnTimeout: time.Second,
+		IOTimeout:   2 * time.Second,
+	}
+}
+
+func TestDialAddress(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		network string
+		address string
+	}{
+		{Config{Network: "tcp", Address: "127.0.0.1", Port: 4010}, "tcp", "127.0.0.1:4010"},
+		{Config{Network: "tcp6", Address: "::1", Port: 4010}, "tcp6", "[::1]:4010"},
+		{Config{Network: "tcp6", Address: "fe80::1%eth0", Port: 4010}, "tcp6", "[fe80::1%eth0]:4010"},
+		{Config{Network: "tcp6", Address: "[fe80::1%eth0]", Port: 4010}, "tcp6", "[fe80::1%eth0]:4010"},
+		{Config{Network: "tcp", Address: "127.0.0.1", Port: 4010, Unix: "/tmp/sssp.sock"}, "unix", "/tmp/sssp.sock"},
+		{Config{Network: "unix", Address: "/tmp/sssp.sock", Port: 4010}, "unix", "/tmp/sssp.sock"},
+	}
+	for _, tt := range tests {
+		if n, a := tt.cfg.dialAddress(); n != tt.network || a != tt.address {
+			t.Errorf("dialAddress() = %s %s, want %s %s", n, a, tt.network, tt.address)
+		}
+	}
+}
+
+func TestRunUnix(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewUnixServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer, r io.Reader) { stdout, stdin = w, r }(stdout, stdin)
+	stdout = &buf
+	stdin = strings.NewReader(eicarVirus)
+
+	conf := &Config{Network: "tcp", Unix: ts.Addr, Format: "text"}
+	if code := run(conf, []string{stdinPath}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+
+	stdin = strings.NewReader(eicarVirus)
+	conf.Verbose = 2
+	conf.Concurrency = 2
+	if code := run(conf, []string{stdinPath}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+
+	// tracing keeps the connections of -j
+	c, err := newScanClient(conf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	if _, ok := c.(*sssp.Pool); !ok {
+		t.Errorf("A pool should be used with -vv and -j 2, got %T", c)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer, r io.Reader) { stdout, stdin = w, r }(stdout, stdin)
+	stdout = &buf
+
+	conf := testConfig(t, ts)
+	dir := writeTree(t)
+
+	tests := []struct {
+		name  string
+		paths []string
+		in    string
+		local bool
+		code  int
+	}{
+		{"clean", []string{stdinPath}, "clean", false, exitClean},
+		{"infected", []string{stdinPath}, eicarVirus, false, exitInfected},
+		{"local", []string{dir}, "", true, exitInfected},
+		{"error", []string{"/nonexistent"}, "", true, exitError},
+	}
+	for _, tt := range tests {
+		stdin = strings.NewReader(tt.in)
+		conf.LocalRecursive = tt.local
+		if code := run(conf, tt.paths); code != tt.code {
+			t.Errorf("%s: run() = %d, want %d", tt.name, code, tt.code)
+		}
+	}
+
+	qdir := filepath.Join(t.TempDir(), "quarantine")
+	conf.MoveInfected = qdir
+	if code := run(conf, []string{dir}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+	if _, err := os.Stat(filepath.Join(qdir, filepath.Base(dir), "sub", "eicar.com")); err != nil {
+		t.Errorf("The infected file should be moved: %s", err)
+	}
+	if code := run(conf, []string{dir}); code != exitClean {
+		t.Errorf("run() = %d, want %d", code, exitClean)
+	}
+	conf.Remove = true
+	if code := run(conf, []string{dir}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+	conf.MoveInfected = ""
+	conf.Remove = false
+
+	conf.LocalRecursive = true
+	conf.Null = true
+	stdin = strings.NewReader(filepath.Join(dir, "clean.txt") + "\x00")
+	if code := run(conf, nil); code != exitClean {
+		t.Errorf("run() = %d, want %d", code, exitClean)
+	}
+	conf.Null = false
+	conf.FilesFrom = filepath.Join(dir, "missing.txt")
+	if code := run(conf, nil); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+	conf.FilesFrom = ""
+	conf.LocalRecursive = false
+
+	report := filepath.Join(t.TempDir(), "report.json")
+	conf.Format = "json"
+	conf.Output = report
+	buf.Reset()
+	stdin = strings.NewReader(eicarVirus)
+	if code := run(conf, []string{stdinPath}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+	if b, err := ioutil.ReadFile(report); err != nil || !strings.Contains(string(b), sssptest.EicarSignature) {
+		t.Errorf("The report should be written to the file: %q %v", b, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("The report should not be written to stdout: %q", buf.String())
+	}
+	conf.Output = filepath.Join(report, "report.json")
+	if code := run(conf, []string{stdinPath}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+	conf.Output = ""
+
+	conf.Format = "csv"
+	if code := run(conf, []string{stdinPath}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+
+	ts.Close()
+	conf.Format = "text"
+	if code := run(conf, []string{stdinPath}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+}
+
+func TestRunTemplateFile(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer, r io.Reader) { stdout, stdin = w, r }(stdout, stdin)
+	stdout = &buf
+	stdin = strings.NewReader(eicarVirus)
+
+	tmpl := filepath.Join(t.TempDir(), "report.tmpl")
+	if err := ioutil.WriteFile(tmpl, []byte(`{{len .Results}} {{.Summary.Infected}}`), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	conf := testConfig(t, ts)
+	conf.Format = "template"
+	conf.TemplateFile = tmpl
+	if code := run(conf, []string{stdinPath}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+	if buf.String() != "1 1" {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+
+	conf.Template = "{{.Path}}"
+	if code := run(conf, []string{stdinPath}); code != exitError {
+		t.Errorf("--template and --template-file should conflict: run() = %d", code)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	manifestEmpty = "-"
+)
+
+// manifestReporter writes a tab separated line with the digest, the
+// verdict, the signature and the path of each file, fields that are
+// not available are written as -. The digests are sha256 unless
+// --hashes selects another algorithm.
+type manifestReporter struct {
+	w      io.Writer
+	hasher *hasher
+}
+
+func (m *manifestReporter) Result(path string, r *sssp.Response, err error) (werr error) {
+	digest, sig := m.hasher.digest(path, err), ""
+	if r != nil {
+		sig = r.Signature
+	}
+	_, werr = fmt.Fprintf(m.w, "%s\t%s\t%s\t%s\n", orEmpty(digest), verdict(r, err), orEmpty(sig), path)
+
+	return
+}
+
+func (m *manifestReporter) setHasher(h *hasher) {
+	m.hasher = h
+}
+
+func (m *manifestReporter) Stats(bytes int64, elapsed time.Duration) {
+}
+
+func (m *manifestReporter) Close() error {
+	return nil
+}
+
+func orEmpty(s string) string {
+	if s == "" {
+		return manifestEmpty
+	}
+
+	return s
+}
+
+func newManifestReporter(w io.Writer) reporter {
+	h, _ := newHasher("sha256")
+
+	return &manifestReporter{w: w, hasher: h}
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestManifestReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	dir := writeTree(t)
+	clean := filepath.Join(dir, "clean.txt")
+	eicar := filepath.Join(dir, "sub", "eicar.com")
+
+	r, err := newReporter("manifest", &buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r.Result(clean, &sssp.Response{Filename: clean}, nil)
+	r.Result(eicar, &sssp.Response{Filename: eicar, Signature: "EICAR-AV-Test", Infected: true}, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	r.Result("/tmp/huge.iso", nil, &skipError{"too large"})
+	if err = r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected := "sha256:3b066804f6d1d077173cfe4d06002e6a61e6f21c2b2e648417962115f1afcd8e\tclean\t-\t" + clean + "\n" +
+		"sha256:275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f\tinfected\tEICAR-AV-Test\t" + eicar + "\n" +
+		"-\terror\t-\t/tmp/missing\n" +
+		"-\tskipped\t-\t/tmp/huge.iso\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	h, _ := newHasher("md5")
+	r.(digestReporter).setHasher(h)
+	r.Result(clean, &sssp.Response{Filename: clean}, nil)
+	if expected = "md5:123402c04dcfb6625f688f771a5fc05d\tclean\t-\t" + clean + "\n"; buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+}
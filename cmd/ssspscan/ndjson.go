@@ -0,0 +1,52 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+// ndjsonReporter writes each result as a JSON object on its own line
+// as soon as it is available, the summary is written as the last line
+type ndjsonReporter struct {
+	enc    *json.Encoder
+	sum    summary
+	hasher *hasher
+}
+
+func (n *ndjsonReporter) Result(path string, r *sssp.Response, err error) error {
+	n.sum.add(r, err)
+	res := newJSONResult(path, r, err)
+	res.Digest = n.hasher.digest(path, err)
+
+	return n.enc.Encode(&res)
+}
+
+func (n *ndjsonReporter) setHasher(h *hasher) {
+	n.hasher = h
+}
+
+func (n *ndjsonReporter) Stats(bytes int64, elapsed time.Duration) {
+	n.sum.stats(bytes, elapsed)
+}
+
+func (n *ndjsonReporter) Close() error {
+	return n.enc.Encode(&struct {
+		Summary summary `json:"summary"`
+	}{n.sum})
+}
+
+func newNDJSONReporter(w io.Writer) reporter {
+	return &ndjsonReporter{enc: json.NewEncoder(w)}
+}
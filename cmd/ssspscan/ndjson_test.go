@@ -0,0 +1,45 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestNDJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := newNDJSONReporter(&buf)
+	r.Result("/tmp/eicar.com", &sssp.Response{Filename: "/tmp/eicar.com", Signature: "EICAR-AV-Test", Infected: true}, nil)
+
+	expected := `{"path":"/tmp/eicar.com","response":{"filename":"/tmp/eicar.com","archive_item":"","signature":"EICAR-AV-Test","status":"","code":0,"status_text":"","infected":true,"error_occured":false,"raw":""}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Results should be written immediately, expected %q got %q", expected, buf.String())
+	}
+
+	r.Result("/tmp/missing", nil, errTest)
+	r.Result("/tmp/huge.iso", nil, &skipError{"too large"})
+	r.Stats(3000, 1500*time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected += `{"path":"/tmp/missing","error":"DONE FAIL 0D05 Could not open file"}` + "\n" +
+		`{"path":"/tmp/huge.iso","skipped":"too large"}` + "\n" +
+		`{"summary":{"files":3,"infected":1,"errors":1,"skipped":1,"bytes":3000,"elapsed":1.5,"throughput":2000,` +
+		`"report":{"scans":2,"responses":1,"infected":1,"errors":1,"signatures":[{"signature":"EICAR-AV-Test","count":1}]}}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+}
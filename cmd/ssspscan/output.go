@@ -0,0 +1,81 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	outputMode = 0644
+)
+
+// An atomicFile is written to a temporary file in the directory of
+// the destination which replaces the destination on Commit, readers
+// never see a partial report
+type atomicFile struct {
+	*os.File
+	dst  string
+	done bool
+}
+
+// Commit replaces the destination with the data written
+func (f *atomicFile) Commit() (err error) {
+	if f.done {
+		return
+	}
+	f.done = true
+
+	defer func() {
+		if err != nil {
+			f.File.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err = f.Sync(); err != nil {
+		return
+	}
+
+	if err = f.Chmod(outputMode); err != nil {
+		return
+	}
+
+	if err = f.File.Close(); err != nil {
+		return
+	}
+
+	err = os.Rename(f.Name(), f.dst)
+
+	return
+}
+
+// Abort discards the data written, it does nothing after Commit
+func (f *atomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+func newAtomicFile(dst string) (f *atomicFile, err error) {
+	var tmp *os.File
+
+	if tmp, err = ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)); err != nil {
+		return
+	}
+	f = &atomicFile{File: tmp, dst: dst}
+
+	return
+}
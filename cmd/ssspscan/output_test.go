@@ -0,0 +1,60 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "report.json")
+	if err := ioutil.WriteFile(dst, []byte("old"), 0600); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	f, err := newAtomicFile(dst)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	f.WriteString("new")
+	if b, _ := ioutil.ReadFile(dst); string(b) != "old" {
+		t.Errorf("The destination should not change before Commit: %q", b)
+	}
+	if err = f.Commit(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	f.Abort()
+	if b, _ := ioutil.ReadFile(dst); string(b) != "new" {
+		t.Errorf("Unexpected content %q", b)
+	}
+	if fi, err := os.Stat(dst); err != nil || fi.Mode().Perm() != outputMode {
+		t.Errorf("Unexpected mode %v %v", fi, err)
+	}
+
+	if f, err = newAtomicFile(dst); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	f.WriteString("partial")
+	f.Abort()
+	if b, _ := ioutil.ReadFile(dst); string(b) != "new" {
+		t.Errorf("Abort should keep the destination: %q", b)
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 1 {
+		t.Errorf("The temporary files should be removed: %d files", len(fs))
+	}
+
+	if _, err = newAtomicFile(filepath.Join(dir, "missing", "report.json")); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
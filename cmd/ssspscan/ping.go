@@ -0,0 +1,114 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	eicarMissedErr = "EICAR test string not detected"
+)
+
+func pingFlags(fs *flag.FlagSet, c *Config) {
+	fs.IntVar(&c.PingCount, "count", 1,
+		`Number of pings to send, 0 pings until interrupted.`)
+	fs.DurationVar(&c.PingInterval, "interval", time.Second,
+		`Delay between pings.`)
+	fs.BoolVar(&c.PingEICAR, "eicar", false,
+		`Scan the EICAR test string after the handshake.`)
+}
+
+func runPing(c *Config, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return ping(ctx, c, stdout)
+}
+
+// ping connects to the server completing the handshake, optionally
+// scans the EICAR test string and writes the round-trip times to w,
+// exitError is returned when a ping fails
+func ping(ctx context.Context, cfg *Config, w io.Writer) (code int) {
+	var sent, failed int
+
+	_, address := cfg.dialAddress()
+loop:
+	for seq := 1; cfg.PingCount <= 0 || seq <= cfg.PingCount; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-time.After(cfg.PingInterval):
+			}
+		}
+
+		sent++
+		connTime, scanTime, err := pingOnce(cfg)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "%s: seq=%d error: %s\n", address, seq, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: seq=%d connect=%s", address, seq, roundDuration(connTime))
+		if cfg.PingEICAR {
+			fmt.Fprintf(w, " scan=%s", roundDuration(scanTime))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if sent > 1 {
+		fmt.Fprintf(w, "%d pings sent, %d failed\n", sent, failed)
+	}
+	if failed > 0 {
+		code = exitError
+	}
+
+	return
+}
+
+func pingOnce(cfg *Config) (connTime, scanTime time.Duration, err error) {
+	start := time.Now()
+	c, err := newClient(cfg)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	connTime = time.Since(start)
+
+	if !cfg.PingEICAR {
+		return
+	}
+
+	start = time.Now()
+	r, err := c.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		return
+	}
+	scanTime = time.Since(start)
+	if !r.Infected {
+		err = fmt.Errorf(eicarMissedErr)
+	}
+
+	return
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
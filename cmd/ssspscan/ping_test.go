@@ -0,0 +1,69 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestPing(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	conf := testConfig(t, ts)
+	conf.PingCount = 2
+	conf.PingInterval = time.Millisecond
+	conf.PingEICAR = true
+	if code := ping(context.Background(), conf, &buf); code != exitClean {
+		t.Fatalf("ping() = %d, want %d:\n%s", code, exitClean, buf.String())
+	}
+	out := buf.String()
+	if !strings.Contains(out, "seq=1 connect=") || !strings.Contains(out, "seq=2 connect=") ||
+		!strings.Contains(out, " scan=") || !strings.Contains(out, "2 pings sent, 0 failed\n") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	if n := len(ts.Requests()); n != 2 {
+		t.Errorf("len(ts.Requests()) = %d, want %d", n, 2)
+	}
+
+	buf.Reset()
+	clean := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		return sssptest.Lines("DONE OK 0000 The scan has completed")
+	})
+	defer clean.Close()
+	conf = testConfig(t, clean)
+	conf.PingCount = 1
+	conf.PingEICAR = true
+	if code := ping(context.Background(), conf, &buf); code != exitError {
+		t.Errorf("ping() = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(buf.String(), eicarMissedErr) {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	ts.Close()
+	conf = testConfig(t, ts)
+	conf.PingCount = 1
+	if code := ping(context.Background(), conf, &buf); code != exitError {
+		t.Errorf("ping() = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(buf.String(), "seq=1 error: ") || strings.Contains(buf.String(), "pings sent") {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+}
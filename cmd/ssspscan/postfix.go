@@ -0,0 +1,118 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+// Exit codes from sysexits.h understood by the Postfix pipe daemon
+const (
+	exOK          = 0
+	exUsage       = 64
+	exUnavailable = 69
+	exTempFail    = 75
+)
+
+const (
+	actionBounce  = "bounce"
+	actionDiscard = "discard"
+)
+
+// runPostfix scans the message on stdin and reinjects it when clean,
+// temporary failures defer delivery so the message is never lost
+func runPostfix(cfg *Config, rcpts []string) int {
+	if len(rcpts) == 0 {
+		fmt.Fprintln(os.Stderr, "No recipients specified")
+		return exUsage
+	}
+
+	if cfg.PostfixAction != actionBounce && cfg.PostfixAction != actionDiscard {
+		fmt.Fprintf(os.Stderr, "Invalid postfix action: %s\n", cfg.PostfixAction)
+		return exUsage
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Virus scanner unavailable: %s\n", err)
+		return exTempFail
+	}
+	defer c.Close()
+
+	return postfixFilter(c, os.Stdin, cfg, rcpts)
+}
+
+func postfixFilter(c *sssp.Client, in io.Reader, cfg *Config, rcpts []string) int {
+	var err error
+	var f *os.File
+	var r *sssp.Response
+
+	// spool the message so it can be scanned and then reinjected
+	if f, err = ioutil.TempFile("", "ssspscan"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create spool file: %s\n", err)
+		return exTempFail
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err = io.Copy(f, in); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to spool message: %s\n", err)
+		return exTempFail
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to rewind spool file: %s\n", err)
+		return exTempFail
+	}
+
+	if r, err = c.ScanReader(f); err != nil {
+		fmt.Fprintf(os.Stderr, "Virus scan failed: %s\n", err)
+		return exTempFail
+	}
+
+	if r.Infected {
+		if cfg.PostfixAction == actionDiscard {
+			fmt.Fprintf(os.Stderr, "Discarded message infected with %s\n", r.Signature)
+			return exOK
+		}
+		// the Postfix pipe daemon includes this text in the bounce
+		fmt.Fprintf(os.Stdout, "Message rejected: infected with %s\n", r.Signature)
+		return exUnavailable
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to rewind spool file: %s\n", err)
+		return exTempFail
+	}
+
+	if err = reinject(cfg.Sendmail, cfg.Sender, rcpts, f); err != nil {
+		fmt.Fprintf(os.Stderr, "Reinjection failed: %s\n", err)
+		return exTempFail
+	}
+
+	return exOK
+}
+
+func reinject(sendmail, sender string, rcpts []string, msg io.Reader) (err error) {
+	args := []string{"-G", "-i", "-f", sender, "--"}
+	args = append(args, rcpts...)
+
+	cmd := exec.Command(sendmail, args...)
+	cmd.Stdin = msg
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+
+	return
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	message = "From: sender@example.com\r\nTo: rcpt@example.com\r\nSubject: test\r\n\r\n"
+)
+
+func fakeSendmail(t *testing.T) (bin, out string) {
+	dir, err := ioutil.TempDir("", "ssspscan")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	bin = filepath.Join(dir, "sendmail")
+	out = filepath.Join(dir, "out")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\ncat >> %s\n", out, out)
+	if err = ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return
+}
+
+func TestPostfixFilter(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	c, err := sssp.NewClient(context.Background(), ts.Network, ts.Addr, time.Second, 2*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	bin, out := fakeSendmail(t)
+	conf := &Config{Sendmail: bin, Sender: "sender@example.com", PostfixAction: actionBounce}
+	rcpts := []string{"rcpt@example.com"}
+
+	if code := postfixFilter(c, strings.NewReader(message+"clean\r\n"), conf, rcpts); code != exOK {
+		t.Errorf("code = %d, want %d", code, exOK)
+	}
+	b, _ := ioutil.ReadFile(out)
+	if !strings.HasPrefix(string(b), "-G -i -f sender@example.com -- rcpt@example.com\n") || !strings.Contains(string(b), "clean") {
+		t.Errorf("The message should be reinjected: %q", b)
+	}
+	os.Remove(out)
+
+	if code := postfixFilter(c, strings.NewReader(message+eicarVirus), conf, rcpts); code != exUnavailable {
+		t.Errorf("code = %d, want %d", code, exUnavailable)
+	}
+	if _, err = os.Stat(out); err == nil {
+		t.Errorf("Infected messages should not be reinjected")
+	}
+
+	conf.PostfixAction = actionDiscard
+	if code := postfixFilter(c, strings.NewReader(message+eicarVirus), conf, rcpts); code != exOK {
+		t.Errorf("code = %d, want %d", code, exOK)
+	}
+	if _, err = os.Stat(out); err == nil {
+		t.Errorf("Discarded messages should not be reinjected")
+	}
+
+	conf.Sendmail = "/nonexistent/sendmail"
+	if code := postfixFilter(c, strings.NewReader(message+"clean\r\n"), conf, rcpts); code != exTempFail {
+		t.Errorf("code = %d, want %d", code, exTempFail)
+	}
+}
+
+func TestRunPostfix(t *testing.T) {
+	conf := &Config{Address: "127.0.0.1", Port: 1, PostfixAction: actionBounce, ConnTimeout: time.Second}
+	if code := runPostfix(conf, nil); code != exUsage {
+		t.Errorf("code = %d, want %d", code, exUsage)
+	}
+	if code := runPostfix(conf, []string{"rcpt@example.com"}); code != exTempFail {
+		t.Errorf("code = %d, want %d", code, exTempFail)
+	}
+	conf.PostfixAction = "invalid"
+	if code := runPostfix(conf, []string{"rcpt@example.com"}); code != exUsage {
+		t.Errorf("code = %d, want %d", code, exUsage)
+	}
+}
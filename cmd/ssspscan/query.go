@@ -0,0 +1,136 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/baruwa-enterprise/sssp"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	invalidItemErr = "Invalid query item: %s, supported items are %s"
+)
+
+var (
+	queryItems = []string{"server", "savi", "engine"}
+)
+
+// querier is the interface used by the query command, it is
+// implemented by sssp.Client
+type querier interface {
+	QueryServer() (sssp.Info, error)
+	QuerySAVI() (sssp.Info, error)
+	QueryEngine() (sssp.Info, error)
+}
+
+func queryFlags(fs *flag.FlagSet, c *Config) {
+	fs.BoolVar(&c.QueryJSON, "json", false,
+		`Print the information as a JSON object keyed by item.`)
+}
+
+func runQuery(cfg *Config, args []string) int {
+	items := queryItems
+	if len(args) > 0 {
+		items = args
+	}
+	for _, item := range items {
+		if !isQueryItem(item) {
+			log.Println("ERROR:=>", fmt.Errorf(invalidItemErr, item, strings.Join(queryItems, ", ")))
+			return exitError
+		}
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+	defer c.Close()
+
+	if err = query(c, stdout, items, cfg.QueryJSON); err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	return exitClean
+}
+
+func isQueryItem(item string) bool {
+	for _, i := range queryItems {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// query sends a QUERY command for each item and writes the
+// information to w, keys are sorted and repeated keys are printed
+// once for each value
+func query(c querier, w io.Writer, items []string, asJSON bool) (err error) {
+	var info sssp.Info
+
+	res := make(map[string]sssp.Info, len(items))
+	for i, item := range items {
+		switch item {
+		case "server":
+			info, err = c.QueryServer()
+		case "savi":
+			info, err = c.QuerySAVI()
+		case "engine":
+			info, err = c.QueryEngine()
+		default:
+			err = fmt.Errorf(invalidItemErr, item, strings.Join(queryItems, ", "))
+		}
+		if err != nil {
+			return
+		}
+
+		if asJSON {
+			res[item] = info
+			continue
+		}
+
+		if len(items) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "[%s]\n", item)
+		}
+		keys := make([]string, 0, len(info))
+		for k := range info {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range info[k] {
+				if _, err = fmt.Fprintf(w, "%s: %s\n", k, v); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(res)
+	}
+
+	return
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestRunQuery(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+
+	conf := testConfig(t, ts)
+	if code := runQuery(conf, []string{"savi"}); code != exitClean {
+		t.Fatalf("runQuery() = %d, want %d", code, exitClean)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "version: 5.80\n") || !strings.Contains(out, "virusengine: 3.80.1\n") || strings.Contains(out, "[savi]") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+
+	buf.Reset()
+	if code := runQuery(conf, nil); code != exitClean {
+		t.Fatalf("runQuery() = %d, want %d", code, exitClean)
+	}
+	out = buf.String()
+	for _, w := range []string{"[server]\n", "\n[savi]\n", "\n[engine]\n", "method: SCANDATA\n", "MaxRecursionDepth: 16\n"} {
+		if !strings.Contains(out, w) {
+			t.Errorf("The output should contain %q:\n%s", w, out)
+		}
+	}
+
+	buf.Reset()
+	conf.QueryJSON = true
+	if code := runQuery(conf, []string{"server", "engine"}); code != exitClean {
+		t.Fatalf("runQuery() = %d, want %d", code, exitClean)
+	}
+	var res map[string]sssp.Info
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(res) != 2 || res["server"].Get("version") != "SAV Dynamic Interface 2.6.0" || len(res["server"]["method"]) != 7 {
+		t.Errorf("Unexpected result: %v", res)
+	}
+
+	if code := runQuery(conf, []string{"unknown"}); code != exitError {
+		t.Errorf("runQuery() = %d, want %d", code, exitError)
+	}
+
+	ts.Close()
+	if code := runQuery(conf, []string{"server"}); code != exitError {
+		t.Errorf("runQuery() = %d, want %d", code, exitError)
+	}
+}
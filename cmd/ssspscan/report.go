@@ -0,0 +1,242 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	invalidFormatErr = "Invalid output format: %s"
+)
+
+// A reporter writes the results of a run in a particular format,
+// Result is called for each path scanned, Stats with the amount of
+// data scanned and the duration of the run and Close once the run is
+// complete
+type reporter interface {
+	Result(path string, r *sssp.Response, err error) error
+	Stats(bytes int64, elapsed time.Duration)
+	Close() error
+}
+
+var formats = map[string]func(io.Writer) reporter{
+	"text":     newTextReporter,
+	"xml":      newXMLReporter,
+	"json":     newJSONReporter,
+	"ndjson":   newNDJSONReporter,
+	"sarif":    newSarifReporter,
+	"template": newTemplateReporter,
+	"manifest": newManifestReporter,
+}
+
+func formatNames() (n []string) {
+	for k := range formats {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+
+	return
+}
+
+func newReporter(format string, w io.Writer) (r reporter, err error) {
+	f, ok := formats[format]
+	if !ok {
+		err = fmt.Errorf(invalidFormatErr, format)
+		return
+	}
+	r = f(w)
+
+	return
+}
+
+// A skipError is passed to the reporters for files that were not
+// scanned, it is not counted as an error
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// skipReason returns the reason a file was skipped and whether err
+// is a skipError
+func skipReason(err error) (reason string, ok bool) {
+	var se *skipError
+	if ok = errors.As(err, &se); ok {
+		reason = se.reason
+	}
+
+	return
+}
+
+// summary counts the outcomes of a run, Elapsed is in seconds and
+// Throughput in bytes per second
+type summary struct {
+	Files      int     `json:"files"`
+	Infected   int     `json:"infected"`
+	Errors     int     `json:"errors"`
+	Skipped    int     `json:"skipped"`
+	Bytes      int64   `json:"bytes"`
+	Elapsed    float64 `json:"elapsed"`
+	Throughput int64   `json:"throughput"`
+	// Report breaks the results down by signature and error code,
+	// it is set by stats
+	Report *sssp.ReportSummary `json:"report,omitempty"`
+	report *sssp.Report
+}
+
+func (s *summary) add(r *sssp.Response, err error) {
+	s.Files++
+	if _, ok := skipReason(err); ok {
+		s.Skipped++
+		return
+	}
+	if s.report == nil {
+		s.report = sssp.NewReport()
+	}
+	s.report.Add(0, err, r)
+	switch {
+	case err != nil || (r != nil && r.ErrorOccured):
+		s.Errors++
+	case r != nil && r.Infected:
+		s.Infected++
+	}
+}
+
+// stats records the amount of data scanned and the duration of the run
+func (s *summary) stats(bytes int64, elapsed time.Duration) {
+	s.Bytes = bytes
+	s.Elapsed = math.Round(elapsed.Seconds()*1000) / 1000
+	s.Throughput = 0
+	if elapsed > 0 {
+		s.Throughput = int64(float64(bytes) / elapsed.Seconds())
+	}
+	if s.report != nil {
+		rs := s.report.Summary()
+		s.Report = &rs
+	}
+}
+
+// WriteTo writes the summary as a block of text
+func (s *summary) WriteTo(w io.Writer) (n int64, err error) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "\n----------- SCAN SUMMARY -----------\n")
+	fmt.Fprintf(&b, "Scanned files:\t%d\n", s.Files-s.Skipped)
+	fmt.Fprintf(&b, "Infected files:\t%d\n", s.Infected)
+	fmt.Fprintf(&b, "Errors:\t\t%d\n", s.Errors)
+	fmt.Fprintf(&b, "Skipped files:\t%d\n", s.Skipped)
+	fmt.Fprintf(&b, "Data scanned:\t%s\n", humanSize(s.Bytes))
+	fmt.Fprintf(&b, "Elapsed:\t%s\n", time.Duration(s.Elapsed*float64(time.Second)))
+	fmt.Fprintf(&b, "Throughput:\t%s/s\n", humanSize(s.Throughput))
+	if s.report != nil {
+		s.report.Summary().WriteDetails(&b)
+	}
+
+	m, err := io.WriteString(w, b.String())
+	n = int64(m)
+
+	return
+}
+
+// verdict returns the status of a result, one of clean, infected,
+// error or skipped
+func verdict(r *sssp.Response, err error) (v string) {
+	v = "clean"
+	if r != nil {
+		if r.Infected {
+			v = "infected"
+		}
+		if r.ErrorOccured {
+			v = "error"
+		}
+	}
+	if _, ok := skipReason(err); ok {
+		v = "skipped"
+	} else if err != nil {
+		v = "error"
+	}
+
+	return
+}
+
+// isClean reports whether the result is a clean verdict
+func isClean(r *sssp.Response, err error) bool {
+	return err == nil && r != nil && !r.Infected && !r.ErrorOccured
+}
+
+func (s *summary) exitCode() int {
+	switch {
+	case s.Errors > 0:
+		return exitError
+	case s.Infected > 0:
+		return exitInfected
+	}
+
+	return exitClean
+}
+
+type textReporter struct {
+	w io.Writer
+	// all includes clean results, they are omitted by default
+	all bool
+	// summary receives the summary of the run when set, it is kept
+	// apart from the results so that they remain easy to parse
+	summary io.Writer
+	sum     summary
+	hasher  *hasher
+}
+
+func (t *textReporter) Result(path string, r *sssp.Response, err error) (werr error) {
+	t.sum.add(r, err)
+	if !t.all && isClean(r, err) {
+		return
+	}
+	if r == nil {
+		return
+	}
+	if t.hasher != nil {
+		_, werr = fmt.Fprintf(t.w, "F=>%s; A=>%s; I=>%t; S=>%s; E=>%t; H=>%s\n", r.Filename, r.ArchiveItem, r.Infected, r.Signature, r.ErrorOccured, t.hasher.digest(path, err))
+		return
+	}
+	_, werr = fmt.Fprintf(t.w, "F=>%s; A=>%s; I=>%t; S=>%s; E=>%t\n", r.Filename, r.ArchiveItem, r.Infected, r.Signature, r.ErrorOccured)
+
+	return
+}
+
+func (t *textReporter) setHasher(h *hasher) {
+	t.hasher = h
+}
+
+func (t *textReporter) Stats(bytes int64, elapsed time.Duration) {
+	t.sum.stats(bytes, elapsed)
+}
+
+func (t *textReporter) Close() (err error) {
+	if t.summary != nil {
+		_, err = t.sum.WriteTo(t.summary)
+	}
+
+	return
+}
+
+func newTextReporter(w io.Writer) reporter {
+	return &textReporter{w: w}
+}
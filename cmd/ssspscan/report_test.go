@@ -0,0 +1,110 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+var errTest = errors.New("DONE FAIL 0D05 Could not open file")
+
+func TestNewReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	if _, err := newReporter("csv", &buf); err == nil {
+		t.Errorf("An error should be returned")
+	}
+
+	for _, f := range formatNames() {
+		if _, err := newReporter(f, &buf); err != nil {
+			t.Errorf("An error should not be returned: %s", err)
+		}
+	}
+}
+
+func TestTextReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r, err := newReporter("text", &buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r.Result("/tmp/eicar.zip", &sssp.Response{
+		Filename:    "/tmp/eicar.zip",
+		ArchiveItem: "eicar.com",
+		Signature:   "EICAR-AV-Test",
+		Infected:    true,
+	}, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	if err = r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected := "F=>/tmp/eicar.zip; A=>eicar.com; I=>true; S=>EICAR-AV-Test; E=>false\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	r.(*textReporter).all = true
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.(*textReporter).all = false
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/error", &sssp.Response{Filename: "/tmp/error", ErrorOccured: true}, nil)
+	expected = "F=>/tmp/clean; A=>; I=>false; S=>; E=>false\nF=>/tmp/error; A=>; I=>false; S=>; E=>true\n"
+	if buf.String() != expected {
+		t.Errorf("Clean results should be omitted without all, expected %q got %q", expected, buf.String())
+	}
+
+	var sum bytes.Buffer
+	buf.Reset()
+	r.(*textReporter).summary = &sum
+	r.Stats(3<<20, 2*time.Second)
+	if err = r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	for _, l := range []string{"Scanned files:\t5\n", "Infected files:\t1\n", "Errors:\t\t2\n", "Data scanned:\t3.00 MiB\n", "Elapsed:\t2s\n", "Throughput:\t1.50 MiB/s\n", "Top signatures:\n\t1\tEICAR-AV-Test\n"} {
+		if !strings.Contains(sum.String(), l) {
+			t.Errorf("The summary should contain %q got %q", l, sum.String())
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("The summary should not be written with the results: %q", buf.String())
+	}
+}
+
+func TestSummaryExitCode(t *testing.T) {
+	var s summary
+
+	if c := s.exitCode(); c != exitClean {
+		t.Errorf("exitCode() = %d, want %d", c, exitClean)
+	}
+	s.add(&sssp.Response{Infected: true}, nil)
+	if c := s.exitCode(); c != exitInfected {
+		t.Errorf("exitCode() = %d, want %d", c, exitInfected)
+	}
+	s.add(nil, errTest)
+	if c := s.exitCode(); c != exitError {
+		t.Errorf("exitCode() = %d, want %d", c, exitError)
+	}
+	s.add(nil, &skipError{"too large"})
+	if c := s.exitCode(); c != exitError {
+		t.Errorf("exitCode() = %d, want %d", c, exitError)
+	}
+	if s.Files != 3 || s.Infected != 1 || s.Errors != 1 || s.Skipped != 1 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+// A retryClient retries scans that fail with a transient error, it
+// relies on the wrapped client reconnecting after a failure
+type retryClient struct {
+	scanClient
+	retries int
+	backoff time.Duration
+	sleep   func(time.Duration)
+}
+
+func (c *retryClient) ScanFile(p string) (*sssp.Response, error) {
+	return c.retry(p, func() (*sssp.Response, error) { return c.scanClient.ScanFile(p) })
+}
+
+func (c *retryClient) ScanStream(p string) (*sssp.Response, error) {
+	return c.retry(p, func() (*sssp.Response, error) { return c.scanClient.ScanStream(p) })
+}
+
+// ScanReader only retries when i can be rewound
+func (c *retryClient) ScanReader(i io.Reader) (*sssp.Response, error) {
+	s, ok := i.(io.Seeker)
+	if !ok {
+		return c.scanClient.ScanReader(i)
+	}
+
+	return c.retry(stdinName, func() (*sssp.Response, error) {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return c.scanClient.ScanReader(i)
+	})
+}
+
+func (c *retryClient) retry(p string, fn func() (*sssp.Response, error)) (r *sssp.Response, err error) {
+	d := c.backoff
+	for i := 0; ; i++ {
+		if r, err = fn(); i >= c.retries || !transient(err) {
+			return
+		}
+		log.Printf("Retrying %s in %s:=> %s", p, d, err)
+		c.sleep(d)
+		d *= 2
+	}
+}
+
+// transient reports whether err is a temporary error, a network
+// error, a dropped connection or a desynchronised one that may
+// succeed when retried
+func transient(err error) bool {
+	var ne net.Error
+
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sssp.ErrTemporary) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, sssp.ErrServerClosed) ||
+		errors.Is(err, sssp.ErrProtocolDesync) {
+		return true
+	}
+
+	return errors.As(err, &ne)
+}
+
+func newRetryClient(c scanClient, retries int, backoff time.Duration) *retryClient {
+	return &retryClient{scanClient: c, retries: retries, backoff: backoff, sleep: time.Sleep}
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+type flakyClient struct {
+	errs  []error
+	calls int
+	data  []string
+}
+
+func (c *flakyClient) next() (r *sssp.Response, err error) {
+	c.calls++
+	if len(c.errs) > 0 {
+		err, c.errs = c.errs[0], c.errs[1:]
+		return
+	}
+	r = &sssp.Response{}
+
+	return
+}
+
+func (c *flakyClient) ScanFile(p string) (*sssp.Response, error)   { return c.next() }
+func (c *flakyClient) ScanStream(p string) (*sssp.Response, error) { return c.next() }
+func (c *flakyClient) Close() error                                { return nil }
+func (c *flakyClient) SetWalkOptions(o sssp.WalkOptions)           {}
+func (c *flakyClient) SetWalkLimits(l sssp.WalkLimits)             {}
+
+func (c *flakyClient) ScanLocalDir(p string, recurse bool) ([]*sssp.Response, error) {
+	return nil, nil
+}
+
+func (c *flakyClient) ScanReader(i io.Reader) (*sssp.Response, error) {
+	b, _ := ioutil.ReadAll(i)
+	c.data = append(c.data, string(b))
+	return c.next()
+}
+
+func TestRetryClient(t *testing.T) {
+	var delays []time.Duration
+
+	opErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	fc := &flakyClient{errs: []error{opErr, sssp.ErrServerClosed}}
+	c := newRetryClient(fc, 2, time.Second)
+	c.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	if _, err := c.ScanFile("/tmp/file"); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if fc.calls != 3 || len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Errorf("Unexpected retries %d %v", fc.calls, delays)
+	}
+
+	fc = &flakyClient{errs: []error{opErr, opErr, opErr}}
+	c.scanClient = fc
+	if _, err := c.ScanStream("/tmp/file"); err != opErr {
+		t.Errorf("The last error should be returned: %v", err)
+	}
+	if fc.calls != 3 {
+		t.Errorf("fc.calls = %d, want %d", fc.calls, 3)
+	}
+
+	fc = &flakyClient{errs: []error{errors.New("permanent")}}
+	c.scanClient = fc
+	if _, err := c.ScanFile("/tmp/file"); err == nil || fc.calls != 1 {
+		t.Errorf("Permanent errors should not be retried: %d %v", fc.calls, err)
+	}
+
+	fc = &flakyClient{errs: []error{io.ErrUnexpectedEOF}}
+	c.scanClient = fc
+	if _, err := c.ScanReader(strings.NewReader("data")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(fc.data) != 2 || fc.data[1] != "data" {
+		t.Errorf("The reader should be rewound before retrying: %q", fc.data)
+	}
+
+	fc = &flakyClient{errs: []error{io.EOF}}
+	c.scanClient = fc
+	if _, err := c.ScanReader(io.MultiReader(strings.NewReader("data"))); err != io.EOF || fc.calls != 1 {
+		t.Errorf("Readers that cannot be rewound should not be retried: %d %v", fc.calls, err)
+	}
+}
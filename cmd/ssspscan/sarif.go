@@ -0,0 +1,227 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifToolURI = "https://github.com/baruwa-enterprise/sssp"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+	Properties  *sarifProperties  `json:"properties,omitempty"`
+}
+
+// sarifProperties is the property bag of a run holding the summary
+type sarifProperties struct {
+	Summary summary `json:"summary"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool                `json:"executionSuccessful"`
+	Notifications       []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifReporter collects the findings of a run and writes them as a
+// single SARIF log on Close, each signature is a rule and archive
+// members are reported as logical locations within the file
+type sarifReporter struct {
+	w     io.Writer
+	rules map[string]int
+	run   sarifRun
+	inv   sarifInvocation
+	sum   summary
+}
+
+func (s *sarifReporter) Result(path string, r *sssp.Response, err error) error {
+	s.sum.add(r, err)
+	if r != nil && r.Filename != "" {
+		path = r.Filename
+	}
+	loc := sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: sarifURI(path)},
+		},
+	}
+
+	if reason, ok := skipReason(err); ok {
+		s.inv.Notifications = append(s.inv.Notifications, sarifNotification{
+			Level:     "note",
+			Message:   sarifMessage{Text: "Skipped: " + reason},
+			Locations: []sarifLocation{loc},
+		})
+		return nil
+	}
+
+	if err != nil || (r != nil && r.ErrorOccured) {
+		msg := "scan failed"
+		if err != nil {
+			msg = err.Error()
+		}
+		s.inv.ExecutionSuccessful = false
+		s.inv.Notifications = append(s.inv.Notifications, sarifNotification{
+			Level:     "error",
+			Message:   sarifMessage{Text: msg},
+			Locations: []sarifLocation{loc},
+		})
+		return nil
+	}
+
+	if r == nil || !r.Infected {
+		return nil
+	}
+
+	idx, ok := s.rules[r.Signature]
+	if !ok {
+		idx = len(s.run.Tool.Driver.Rules)
+		s.rules[r.Signature] = idx
+		s.run.Tool.Driver.Rules = append(s.run.Tool.Driver.Rules, sarifRule{
+			ID:               r.Signature,
+			ShortDescription: sarifMessage{Text: fmt.Sprintf("Malware detected: %s", r.Signature)},
+		})
+	}
+
+	msg := fmt.Sprintf("%s detected in %s", r.Signature, path)
+	if r.ArchiveItem != "" {
+		msg = fmt.Sprintf("%s detected in %s within %s", r.Signature, r.ArchiveItem, path)
+		loc.LogicalLocations = []sarifLogicalLocation{{
+			Name:               r.ArchiveItem,
+			FullyQualifiedName: path + "!" + r.ArchiveItem,
+			Kind:               "member",
+		}}
+	}
+	s.run.Results = append(s.run.Results, sarifResult{
+		RuleID:    r.Signature,
+		RuleIndex: idx,
+		Level:     "error",
+		Message:   sarifMessage{Text: msg},
+		Locations: []sarifLocation{loc},
+	})
+
+	return nil
+}
+
+func (s *sarifReporter) Stats(bytes int64, elapsed time.Duration) {
+	s.sum.stats(bytes, elapsed)
+}
+
+func (s *sarifReporter) Close() error {
+	s.run.Invocations = []sarifInvocation{s.inv}
+	s.run.Properties = &sarifProperties{Summary: s.sum}
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(&sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{s.run},
+	})
+}
+
+// sarifURI returns the artifact URI for a path, relative paths are
+// kept relative so they resolve against the repository root
+func sarifURI(p string) string {
+	if filepath.IsAbs(p) {
+		return "file://" + filepath.ToSlash(p)
+	}
+
+	return filepath.ToSlash(p)
+}
+
+func newSarifReporter(w io.Writer) reporter {
+	return &sarifReporter{
+		w:     w,
+		rules: make(map[string]int),
+		run: sarifRun{
+			Tool: sarifTool{
+				Driver: sarifDriver{
+					Name:           cmdName,
+					Version:        Version,
+					InformationURI: sarifToolURI,
+					Rules:          []sarifRule{},
+				},
+			},
+			Results: []sarifResult{},
+		},
+		inv: sarifInvocation{ExecutionSuccessful: true},
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestSarifReporter(t *testing.T) {
+	var buf bytes.Buffer
+	var l sarifLog
+
+	r := newSarifReporter(&buf)
+	r.Result("eicar.zip", &sssp.Response{ArchiveItem: "eicar.com", Signature: "EICAR-AV-Test", Infected: true}, nil)
+	r.Result("/tmp/eicar.com", &sssp.Response{Filename: "/tmp/eicar.com", Signature: "EICAR-AV-Test", Infected: true}, nil)
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	r.Result("/tmp/huge.iso", nil, &skipError{"too large"})
+	r.Stats(2048, time.Second)
+	if err := r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if l.Version != sarifVersion || len(l.Runs) != 1 {
+		t.Fatalf("Unexpected log: %s", buf.String())
+	}
+
+	run := l.Runs[0]
+	if len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].ID != "EICAR-AV-Test" {
+		t.Errorf("Unexpected rules: %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("len(run.Results) = %d, want %d", len(run.Results), 2)
+	}
+
+	res := run.Results[0]
+	if res.RuleID != "EICAR-AV-Test" || res.Locations[0].PhysicalLocation.ArtifactLocation.URI != "eicar.zip" {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if len(res.Locations[0].LogicalLocations) != 1 || res.Locations[0].LogicalLocations[0].FullyQualifiedName != "eicar.zip!eicar.com" {
+		t.Errorf("The archive member should be a logical location: %+v", res.Locations[0])
+	}
+	if uri := run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "file:///tmp/eicar.com" {
+		t.Errorf("Expected %q got %q", "file:///tmp/eicar.com", uri)
+	}
+
+	inv := run.Invocations[0]
+	if inv.ExecutionSuccessful || len(inv.Notifications) != 2 || inv.Notifications[0].Message.Text != errTest.Error() {
+		t.Errorf("Unexpected invocation: %+v", inv)
+	}
+	if n := inv.Notifications[1]; n.Level != "note" || n.Message.Text != "Skipped: too large" {
+		t.Errorf("Unexpected notification: %+v", n)
+	}
+	if p := run.Properties; p == nil || p.Summary.Files != 5 || p.Summary.Infected != 2 || p.Summary.Bytes != 2048 {
+		t.Errorf("Unexpected properties: %+v", p)
+	}
+}
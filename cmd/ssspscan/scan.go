@@ -0,0 +1,419 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/archive"
+)
+
+// fileScanner is the interface used to scan paths, it is implemented
+// by sssp.Client and sssp.Pool
+type fileScanner interface {
+	ScanFile(p string) (*sssp.Response, error)
+	ScanStream(p string) (*sssp.Response, error)
+	ScanReader(i io.Reader) (*sssp.Response, error)
+	ScanLocalDir(p string, recurse bool) ([]*sssp.Response, error)
+	SetWalkOptions(o sssp.WalkOptions)
+	SetWalkLimits(l sssp.WalkLimits)
+}
+
+// scanClient is a fileScanner that holds connections
+type scanClient interface {
+	fileScanner
+	Close() error
+}
+
+const (
+	invalidPatternErr = "Invalid exclude pattern: %s"
+	localOnlyErr      = "%s requires --local-recursive"
+	tooLargeMsg       = "file size %d exceeds the maximum of %d"
+	linkLoopMsg       = "symbolic link loop to %s"
+	linkSeenMsg       = "directory %s already scanned"
+	// stdinPath is the path used to scan the standard input
+	stdinPath = "-"
+	stdinName = "stdin"
+	// maxListEntry is the longest path accepted in a list
+	maxListEntry = 64 * 1024
+)
+
+var stdin io.Reader = os.Stdin
+
+// resultFunc is called with the outcome of scanning each path
+type resultFunc func(path string, r *sssp.Response, err error) error
+
+// A scanJob scans a path returning the response and the number of
+// bytes scanned
+type scanJob struct {
+	path string
+	scan func() (*sssp.Response, int64, error)
+}
+
+// A scanner scans paths and passes the outcome of each to fn, the
+// calls to fn are serialized so it need not be safe for concurrent use
+type scanner struct {
+	c fileScanner
+	// local walks directories locally using ScanLocalDir and sends
+	// each regular file using SCANDATA instead of having the server
+	// scan the paths
+	local bool
+	// workers is the number of paths scanned concurrently, local
+	// walks use the parallelism of c
+	workers int
+	// exclude and excludeDirs hold glob patterns for the files and
+	// directories skipped by local walks
+	exclude     []string
+	excludeDirs []string
+	// maxSize is the size above which local walks skip files
+	maxSize int64
+	// followSymlinks makes local walks follow symbolic links, links
+	// to directories that were already walked are skipped
+	followSymlinks bool
+	// maxDepth is the number of directory levels below the paths
+	// whose files are scanned by local walks, 0 disables the limit
+	maxDepth int
+	// unpack unpacks archives in local walks and scans the members
+	unpack *archive.Extractor
+	// cache skips the files found clean by earlier local walks
+	cache *scanCache
+	fn    resultFunc
+	m     sync.Mutex
+	err   error
+	bytes int64
+}
+
+// Scan scans the paths, it stops at the first error returned by fn
+func (s *scanner) Scan(paths []string) error {
+	return s.run(func(jobs chan<- scanJob) error {
+		s.queue(paths, jobs)
+		return nil
+	})
+}
+
+// ScanList scans the paths read from r, the paths are separated by
+// sep and empty ones are ignored, they are read as they are scanned
+// so that huge lists are not held in memory
+func (s *scanner) ScanList(r io.Reader, sep byte) error {
+	return s.run(func(jobs chan<- scanJob) error {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 4096), maxListEntry)
+		sc.Split(splitOn(sep))
+		for sc.Scan() {
+			p := sc.Text()
+			if sep == '\n' {
+				p = strings.TrimSuffix(p, "\r")
+			}
+			switch p {
+			case "":
+				continue
+			case stdinPath:
+				// the list may be the standard input
+				p = "." + string(filepath.Separator) + p
+			}
+			s.queue([]string{p}, jobs)
+			if s.failed() != nil {
+				return nil
+			}
+		}
+		return sc.Err()
+	})
+}
+
+// run starts the workers and scans the jobs sent by feed
+func (s *scanner) run(feed func(jobs chan<- scanJob) error) (err error) {
+	var wg sync.WaitGroup
+
+	workers := s.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan scanJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r, n, err := j.scan()
+				if err == nil {
+					s.count(n)
+				}
+				s.report(j.path, r, err)
+			}
+		}()
+	}
+
+	err = feed(jobs)
+	close(jobs)
+	wg.Wait()
+
+	if ferr := s.failed(); ferr != nil {
+		err = ferr
+	}
+
+	return
+}
+
+func (s *scanner) queue(paths []string, jobs chan<- scanJob) {
+	for _, p := range paths {
+		p := p
+		switch {
+		case p == stdinPath:
+			jobs <- scanJob{p, func() (*sssp.Response, int64, error) { return scanStdin(s.c) }}
+		case s.local:
+			s.walk(p, jobs)
+		default:
+			jobs <- scanJob{p, func() (r *sssp.Response, n int64, err error) {
+				r, err = s.c.ScanFile(p)
+				n = fileSize(p)
+				return
+			}}
+		}
+		if s.failed() != nil {
+			return
+		}
+	}
+}
+
+// walk scans root using ScanLocalDir when it is a directory, the
+// outcome of each file is reported as the walk progresses
+func (s *scanner) walk(root string, jobs chan<- scanJob) {
+	info, err := os.Stat(root)
+	if err != nil {
+		s.report(root, nil, err)
+		return
+	}
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return
+		}
+		jobs <- scanJob{root, func() (*sssp.Response, int64, error) {
+			return s.scanLocal(root, info)
+		}}
+		return
+	}
+
+	s.c.SetWalkOptions(sssp.WalkOptions{
+		Exclude:        s.exclude,
+		ExcludeDirs:    s.excludeDirs,
+		FollowSymlinks: s.followSymlinks,
+		Scan:           s.walkScan,
+		OnFile:         s.walked,
+	})
+	// the library counts the directory levels walked below root, a
+	// maximum depth of 1 only scans the files in root
+	var limits sssp.WalkLimits
+	if s.maxDepth > 1 {
+		limits.MaxDepth = s.maxDepth - 1
+	}
+	s.c.SetWalkLimits(limits)
+
+	_, err = s.c.ScanLocalDir(root, s.maxDepth != 1)
+	if err != nil && !errors.Is(err, sssp.ErrWalkLimit) && s.failed() == nil {
+		s.report(root, nil, err)
+	}
+}
+
+// walkScan scans a file found by a local walk
+func (s *scanner) walkScan(p string) (r *sssp.Response, err error) {
+	var info os.FileInfo
+	var n int64
+
+	if info, err = os.Stat(p); err != nil {
+		return
+	}
+	if r, n, err = s.scanLocal(p, info); err == nil {
+		s.count(n)
+	}
+
+	return
+}
+
+// walked reports the outcome of a file found by a local walk, the
+// links that are not followed are reported as skipped
+func (s *scanner) walked(p string, r *sssp.Response, err error) error {
+	var le *sssp.LinkError
+
+	if errors.As(err, &le) {
+		msg := linkSeenMsg
+		if le.Loop {
+			msg = linkLoopMsg
+		}
+		err = &skipError{fmt.Sprintf(msg, le.Target)}
+	}
+
+	return s.report(p, r, err)
+}
+
+// scanLocal scans the local file p unless it is too large or the
+// cache holds its result, archives are unpacked when enabled
+func (s *scanner) scanLocal(p string, info os.FileInfo) (r *sssp.Response, n int64, err error) {
+	var sum, reason string
+
+	if s.maxSize > 0 && info.Size() > s.maxSize {
+		err = &skipError{fmt.Sprintf(tooLargeMsg, info.Size(), s.maxSize)}
+		return
+	}
+
+	if s.cache != nil {
+		if sum, reason, err = s.cache.lookup(p); err != nil {
+			return
+		}
+		if reason != "" {
+			err = &skipError{reason}
+			return
+		}
+	}
+
+	start := time.Now()
+	if s.unpack != nil {
+		r, err = unpack(s.unpack, s.c, p)
+	} else {
+		r, err = s.c.ScanStream(p)
+	}
+	if r != nil {
+		r.Filename = p
+	}
+	n = info.Size()
+	if err == nil && s.cache != nil {
+		err = s.cache.add(sum, r, time.Since(start))
+	}
+
+	return
+}
+
+func (s *scanner) report(p string, r *sssp.Response, err error) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.err == nil {
+		s.err = s.fn(p, r, err)
+	}
+
+	return s.err
+}
+
+func (s *scanner) count(n int64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.bytes += n
+}
+
+// Bytes returns the number of bytes scanned
+func (s *scanner) Bytes() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.bytes
+}
+
+func (s *scanner) failed() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.err
+}
+
+// checkPatterns returns an error for the first malformed pattern
+func checkPatterns(patterns []string) (err error) {
+	for _, pat := range patterns {
+		if _, err = filepath.Match(pat, ""); err != nil {
+			err = fmt.Errorf(invalidPatternErr, pat)
+			return
+		}
+	}
+
+	return
+}
+
+// splitOn returns a bufio.SplitFunc that splits on sep
+func splitOn(sep byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+func newScanner(c fileScanner, fn resultFunc) *scanner {
+	return &scanner{c: c, workers: 1, fn: fn}
+}
+
+// openList opens the file listing the paths to scan, the standard
+// input is used when name is empty or -
+func openList(name string) (r io.Reader, err error) {
+	var f *os.File
+
+	if name == "" || name == stdinPath {
+		r = stdin
+		return
+	}
+
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	r = f
+
+	return
+}
+
+// fileSize returns the size of the file p or 0 when it cannot be
+// determined locally, such as when the server scans its own paths
+func fileSize(p string) int64 {
+	fi, err := os.Stat(p)
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0
+	}
+
+	return fi.Size()
+}
+
+// scanStdin spools the standard input to a temporary file as the
+// length of the data has to be sent before the data itself, the
+// number of bytes read is returned in n
+func scanStdin(c fileScanner) (r *sssp.Response, n int64, err error) {
+	var f *os.File
+
+	if f, err = ioutil.TempFile("", "ssspscan"); err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if n, err = io.Copy(f, stdin); err != nil {
+		return
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	if r, err = c.ScanReader(f); r != nil {
+		r.Filename = stdinName
+	}
+
+	return
+}
@@ -0,0 +1,409 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func newTestClient(t *testing.T) (*sssp.Client, *sssptest.Server) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	t.Cleanup(ts.Close)
+
+	c, err := sssp.NewClient(context.Background(), ts.Network, ts.Addr, time.Second, 2*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, ts
+}
+
+func writeTree(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"clean.txt":           "clean",
+		"sub/eicar.com":       eicarVirus,
+		"sub/deeper/note.txt": "note",
+	}
+	for n, d := range files {
+		p := filepath.Join(dir, n)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(d), 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	return dir
+}
+
+func TestScannerLocal(t *testing.T) {
+	c, ts := newTestClient(t)
+	dir := writeTree(t)
+
+	results := make(map[string]*sssp.Response)
+	s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+		if err != nil {
+			t.Errorf("An error should not be returned: %s", err)
+		}
+		results[p] = r
+		return nil
+	})
+	s.local = true
+	if err := s.Scan([]string{dir}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("len(results) = %d, want %d", len(results), 3)
+	}
+	if n := int64(len("clean") + len(eicarVirus) + len("note")); s.Bytes() != n {
+		t.Errorf("s.Bytes() = %d, want %d", s.Bytes(), n)
+	}
+	for p, r := range results {
+		if r.Filename != p {
+			t.Errorf("Filename = %q, want %q", r.Filename, p)
+		}
+		if infected := filepath.Base(p) == "eicar.com"; r.Infected != infected {
+			t.Errorf("%s: Infected = %t, want %t", p, r.Infected, infected)
+		}
+	}
+
+	var cmds []string
+	for _, r := range ts.Requests() {
+		cmds = append(cmds, r.Command)
+	}
+	sort.Strings(cmds)
+	if len(cmds) != 3 || cmds[0] != "SCANDATA" || cmds[2] != "SCANDATA" {
+		t.Errorf("Files should be sent using SCANDATA: %v", cmds)
+	}
+}
+
+func TestScannerRemote(t *testing.T) {
+	c, ts := newTestClient(t)
+
+	var n int
+	s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+		n++
+		return nil
+	})
+	if err := s.Scan([]string{"/tmp/a", "/tmp/b"}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if n != 2 || len(ts.Requests()) != 2 || ts.Requests()[0].Command != "SCANFILE" {
+		t.Errorf("Paths should be sent using SCANFILE: %+v", ts.Requests())
+	}
+}
+
+func TestScannerStdin(t *testing.T) {
+	c, ts := newTestClient(t)
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader(eicarVirus)
+
+	var res *sssp.Response
+	s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+		if err != nil {
+			t.Errorf("An error should not be returned: %s", err)
+		}
+		res = r
+		return nil
+	})
+	if err := s.Scan([]string{stdinPath}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if res == nil || !res.Infected || res.Filename != stdinName {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if reqs := ts.Requests(); len(reqs) != 1 || reqs[0].Command != "SCANDATA" || string(reqs[0].Data) != eicarVirus {
+		t.Errorf("Stdin should be sent using SCANDATA: %+v", reqs)
+	}
+}
+
+func TestScannerConcurrent(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := sssp.NewPool(ts.Network, ts.Addr, time.Second, 2*time.Second, 0, 4)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		if err = ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d", i)), []byte(eicarVirus), 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	var n int
+	s := newScanner(p, func(p string, r *sssp.Response, err error) error {
+		if err != nil || !r.Infected {
+			t.Errorf("Unexpected result for %s: %+v %v", p, r, err)
+		}
+		n++
+		return nil
+	})
+	s.local = true
+	s.workers = 4
+	if err = s.Scan([]string{dir}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if n != 20 {
+		t.Errorf("n = %d, want %d", n, 20)
+	}
+
+	errStop := errors.New("stop")
+	n = 0
+	s = newScanner(p, func(p string, r *sssp.Response, err error) error {
+		n++
+		return errStop
+	})
+	s.local = true
+	s.workers = 4
+	if err = s.Scan([]string{dir}); err != errStop {
+		t.Errorf("Expected %v got %v", errStop, err)
+	}
+	if n != 1 {
+		t.Errorf("The result function should not be called after an error, n = %d", n)
+	}
+}
+
+func TestScannerExclude(t *testing.T) {
+	c, _ := newTestClient(t)
+	dir := writeTree(t)
+	for _, n := range []string{".git/config", "cache/x.bin", "sub/cache/y.bin", "movie.iso"} {
+		p := filepath.Join(dir, filepath.FromSlash(n))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	var scanned []string
+	s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+		rel, _ := filepath.Rel(dir, p)
+		scanned = append(scanned, filepath.ToSlash(rel))
+		return nil
+	})
+	s.local = true
+	s.exclude = []string{"*.iso", filepath.Join(dir, "sub", "deeper", "*")}
+	s.excludeDirs = []string{".git", "cache"}
+	if err := s.Scan([]string{dir}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	sort.Strings(scanned)
+	if strings.Join(scanned, ",") != "clean.txt,sub/eicar.com" {
+		t.Errorf("Unexpected files scanned: %v", scanned)
+	}
+
+	if err := checkPatterns([]string{"*.iso", "[a-"}); err == nil {
+		t.Errorf("An error should be returned for a malformed pattern")
+	}
+}
+
+func TestScannerMaxSize(t *testing.T) {
+	c, ts := newTestClient(t)
+	dir := writeTree(t)
+
+	skipped := make(map[string]string)
+	s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+		if reason, ok := skipReason(err); ok {
+			skipped[filepath.Base(p)] = reason
+		} else if err != nil {
+			t.Errorf("An error should not be returned: %s", err)
+		}
+		return nil
+	})
+	s.local = true
+	s.maxSize = 5
+	if err := s.Scan([]string{dir}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if len(skipped) != 1 || skipped["eicar.com"] == "" {
+		t.Errorf("Files above the limit should be skipped: %v", skipped)
+	}
+	if n := len(ts.Requests()); n != 2 {
+		t.Errorf("len(ts.Requests()) = %d, want %d", n, 2)
+	}
+}
+
+func TestScannerList(t *testing.T) {
+	c, ts := newTestClient(t)
+	dir := writeTree(t)
+
+	clean, eicar := filepath.Join(dir, "clean.txt"), filepath.Join(dir, "sub", "eicar.com")
+	tests := []struct {
+		name string
+		list string
+		sep  byte
+	}{
+		{"lines", clean + "\r\n\n" + eicar + "\n", '\n'},
+		{"nul", clean + "\x00" + eicar, 0},
+	}
+	for _, tt := range tests {
+		var paths []string
+		s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+			if err != nil {
+				t.Errorf("%s: an error should not be returned: %s", tt.name, err)
+			}
+			paths = append(paths, p)
+			return nil
+		})
+		s.local = true
+		if err := s.ScanList(strings.NewReader(tt.list), tt.sep); err != nil {
+			t.Fatalf("%s: an error should not be returned: %s", tt.name, err)
+		}
+		sort.Strings(paths)
+		if len(paths) != 2 || paths[0] != clean || paths[1] != eicar {
+			t.Errorf("%s: unexpected paths %v", tt.name, paths)
+		}
+	}
+	if n := len(ts.Requests()); n != 4 {
+		t.Errorf("len(ts.Requests()) = %d, want %d", n, 4)
+	}
+
+	s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+		return errors.New("stop")
+	})
+	s.local = true
+	if err := s.ScanList(strings.NewReader(clean+"\n"+eicar), '\n'); err == nil || err.Error() != "stop" {
+		t.Errorf("The callback error should be returned: %v", err)
+	}
+
+	if _, err := openList(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestScannerFollowSymlinks(t *testing.T) {
+	c, _ := newTestClient(t)
+	dir := writeTree(t)
+	other := writeTree(t)
+	links := map[string]string{
+		"loop":          dir,
+		"sub/up":        filepath.Join(dir, "sub"),
+		"other":         other,
+		"other-again":   other,
+		"sub/file-link": filepath.Join(dir, "clean.txt"),
+		"dangling":      filepath.Join(dir, "nonexistent"),
+	}
+	for n, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(n))); err != nil {
+			t.Skipf("Symbolic links are not supported: %s", err)
+		}
+	}
+
+	for _, follow := range []bool{false, true} {
+		var scanned []string
+		skipped := make(map[string]string)
+		var failed []string
+		s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+			rel, _ := filepath.Rel(dir, p)
+			rel = filepath.ToSlash(rel)
+			if reason, ok := skipReason(err); ok {
+				skipped[rel] = reason
+			} else if err != nil {
+				failed = append(failed, rel)
+			} else {
+				scanned = append(scanned, rel)
+			}
+			return nil
+		})
+		s.local = true
+		s.followSymlinks = follow
+		if err := s.Scan([]string{dir}); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		sort.Strings(scanned)
+
+		if !follow {
+			if strings.Join(scanned, ",") != "clean.txt,sub/deeper/note.txt,sub/eicar.com" || len(skipped) != 0 || len(failed) != 0 {
+				t.Errorf("Symbolic links should be ignored: %v %v %v", scanned, skipped, failed)
+			}
+			continue
+		}
+
+		want := "clean.txt,other/clean.txt,other/sub/deeper/note.txt,other/sub/eicar.com," +
+			"sub/deeper/note.txt,sub/eicar.com,sub/file-link"
+		if strings.Join(scanned, ",") != want {
+			t.Errorf("Unexpected files scanned: %v", scanned)
+		}
+		if len(skipped) != 3 || skipped["loop"] == "" || skipped["sub/up"] == "" || skipped["other-again"] == "" {
+			t.Errorf("Unexpected files skipped: %v", skipped)
+		}
+		if len(failed) != 1 || failed[0] != "dangling" {
+			t.Errorf("Unexpected errors: %v", failed)
+		}
+	}
+}
+
+func TestScannerMaxDepth(t *testing.T) {
+	c, _ := newTestClient(t)
+	dir := writeTree(t)
+	other := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(other, "linked.txt"), []byte("linked"), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if err := os.Symlink(other, filepath.Join(dir, "sub", "deeper", "link")); err != nil {
+		t.Skipf("Symbolic links are not supported: %s", err)
+	}
+
+	tests := []struct {
+		depth  int
+		follow bool
+		want   string
+	}{
+		{0, false, "clean.txt,sub/deeper/note.txt,sub/eicar.com"},
+		{1, false, "clean.txt"},
+		{2, false, "clean.txt,sub/eicar.com"},
+		{3, false, "clean.txt,sub/deeper/note.txt,sub/eicar.com"},
+		{3, true, "clean.txt,sub/deeper/note.txt,sub/eicar.com"},
+		{4, true, "clean.txt,sub/deeper/link/linked.txt,sub/deeper/note.txt,sub/eicar.com"},
+	}
+	for _, tt := range tests {
+		var scanned []string
+		s := newScanner(c, func(p string, r *sssp.Response, err error) error {
+			if err == nil {
+				rel, _ := filepath.Rel(dir, p)
+				scanned = append(scanned, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		s.local = true
+		s.maxDepth = tt.depth
+		s.followSymlinks = tt.follow
+		if err := s.Scan([]string{dir}); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		sort.Strings(scanned)
+		if got := strings.Join(scanned, ","); got != tt.want {
+			t.Errorf("maxDepth %d: scanned %s, want %s", tt.depth, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/httpapi"
+	"github.com/baruwa-enterprise/sssp/notify"
+	flag "github.com/spf13/pflag"
+)
+
+func serveFlags(fs *flag.FlagSet, c *Config) {
+	c.ServeMaxBodySize = 100 << 20
+	fs.StringVarP(&c.ServeListen, "listen", "l", ":8080",
+		`Address to listen on for HTTP requests.`)
+	fs.IntVarP(&c.Concurrency, "concurrency", "j", 4,
+		`Maximum number of connections to the server.`)
+	fs.Var(&c.ServeMaxBodySize, "max-body-size",
+		`Maximum size of a request body that will be scanned, the size may have a K, M or G suffix.`)
+	fs.StringArrayVar(&c.Webhooks, "webhook", nil,
+		`URL a JSON notification is POSTed to when an infection is found, may be repeated.`)
+	fs.StringVar(&c.WebhookSecret, "webhook-secret", "",
+		`Secret used to sign the webhook notifications with HMAC-SHA256.`)
+}
+
+func runServe(c *Config, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l, err := net.Listen("tcp", c.ServeListen)
+	if err != nil {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	return serve(ctx, c, l)
+}
+
+// serve serves the HTTP API on l until ctx is cancelled
+func serve(ctx context.Context, c *Config, l net.Listener) int {
+	p, err := newPool(c, c.Concurrency)
+	if err != nil {
+		l.Close()
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+	defer p.Close()
+
+	if len(c.Webhooks) > 0 {
+		n := notify.NewNotifier(c.Webhooks...)
+		n.SetSecret(c.WebhookSecret)
+		p.SetHooks(&sssp.Hooks{OnScanEnd: n.ScanEnd()})
+	}
+
+	if err = warmPool(ctx, p); err != nil {
+		// the pool connects on demand and /healthz reports
+		// the state of the server so this is not fatal
+		log.Println("WARNING:=>", err)
+	}
+
+	h := httpapi.NewHandler(p)
+	h.SetMaxBodySize(int64(c.ServeMaxBodySize))
+	srv := &http.Server{Handler: h}
+
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), c.IOTimeout)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+
+	if c.Verbose > 0 {
+		log.Printf("%s listening on %s", cmdName, l.Addr())
+	}
+	if err = srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.Println("ERROR:=>", err)
+		return exitError
+	}
+
+	return exitClean
+}
+
+// warmPool establishes all the connections of the pool so that
+// the first requests do not pay for the protocol negotiation
+func warmPool(ctx context.Context, p *sssp.Pool) (err error) {
+	var cl *sssp.Client
+
+	cs := make([]*sssp.Client, 0, p.Size())
+	for i := 0; i < p.Size(); i++ {
+		if cl, err = p.Get(ctx); err != nil {
+			break
+		}
+		cs = append(cs, cl)
+	}
+	for _, cl = range cs {
+		p.Put(cl, nil)
+	}
+
+	return
+}
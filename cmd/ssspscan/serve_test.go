@@ -0,0 +1,93 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/httpapi"
+	"github.com/baruwa-enterprise/sssp/notify"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestServe(t *testing.T) {
+	var res httpapi.ScanResult
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	hooked := make(chan notify.Payload, 1)
+	wh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p notify.Payload
+		if r.Header.Get(notify.SignatureHeader) == "" {
+			t.Errorf("The notification should be signed")
+		}
+		json.NewDecoder(r.Body).Decode(&p)
+		hooked <- p
+	}))
+	defer wh.Close()
+
+	conf := testConfig(t, ts)
+	conf.Concurrency = 2
+	conf.ServeMaxBodySize = 1024
+	conf.Webhooks = []string{wh.URL}
+	conf.WebhookSecret = "s3cr3t"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int, 1)
+	go func() { done <- serve(ctx, conf, l) }()
+
+	url := "http://" + l.Addr().String()
+	resp, err := http.Post(url+"/scan", "application/octet-stream", strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !res.Infected || res.Signature != sssptest.EicarSignature {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	select {
+	case p := <-hooked:
+		if p.Signature != sssptest.EicarSignature {
+			t.Errorf("Unexpected notification: %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("The infection should be sent to the webhook")
+	}
+
+	resp, err = http.Get(url + "/healthz")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("resp.StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	if code := <-done; code != exitClean {
+		t.Errorf("serve() = %d, want %d", code, exitClean)
+	}
+}
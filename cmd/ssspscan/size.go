@@ -0,0 +1,85 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	invalidSizeErr = "Invalid size: %s"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+}
+
+// A byteSize is a flag value holding a number of bytes, the value may
+// have a K, M, G or T suffix which are powers of 1024
+type byteSize int64
+
+func (b *byteSize) String() string {
+	v := int64(*b)
+	for i := len(sizeUnits) - 1; i >= 0; i-- {
+		u := sizeUnits[i]
+		if v != 0 && v%u.mult == 0 {
+			return strconv.FormatInt(v/u.mult, 10) + u.suffix
+		}
+	}
+
+	return strconv.FormatInt(v, 10)
+}
+
+func (b *byteSize) Set(s string) (err error) {
+	var n int64
+
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			mult = u.mult
+			v = strings.TrimSuffix(v, u.suffix)
+			break
+		}
+	}
+
+	if n, err = strconv.ParseInt(v, 10, 64); err != nil || n < 0 {
+		err = fmt.Errorf(invalidSizeErr, s)
+		return
+	}
+	*b = byteSize(n * mult)
+
+	return
+}
+
+func (b *byteSize) Type() string {
+	return "size"
+}
+
+// humanSize formats n using the largest binary unit it exceeds
+func humanSize(n int64) string {
+	for i := len(sizeUnits) - 1; i >= 0; i-- {
+		u := sizeUnits[i]
+		if n >= u.mult {
+			return fmt.Sprintf("%.2f %siB", float64(n)/float64(u.mult), u.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"testing"
+)
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		in  string
+		n   int64
+		out string
+		err bool
+	}{
+		{"0", 0, "0", false},
+		{"1000", 1000, "1000", false},
+		{"512K", 512 << 10, "512K", false},
+		{"25M", 25 << 20, "25M", false},
+		{"25mb", 25 << 20, "25M", false},
+		{"2GiB", 2 << 30, "2G", false},
+		{"1T", 1 << 40, "1T", false},
+		{"1536K", 1536 << 10, "1536K", false},
+		{"-1", 0, "", true},
+		{"lots", 0, "", true},
+		{"", 0, "", true},
+	}
+	for _, tt := range tests {
+		var b byteSize
+		err := b.Set(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Set(%q) should return an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) returned error: %s", tt.in, err)
+			continue
+		}
+		if int64(b) != tt.n || b.String() != tt.out {
+			t.Errorf("Set(%q) = %d (%s), want %d (%s)", tt.in, b, b.String(), tt.n, tt.out)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.50 KiB",
+		5 << 30:         "5.00 GiB",
+		3<<40 + 512<<30: "3.50 TiB",
+	}
+	for n, expected := range tests {
+		if s := humanSize(n); s != expected {
+			t.Errorf("humanSize(%d) = %q, want %q", n, s, expected)
+		}
+	}
+}
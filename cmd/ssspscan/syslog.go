@@ -0,0 +1,63 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+// sysLogger is the subset of syslog.Writer used to log results
+type sysLogger interface {
+	Warning(m string) error
+	Err(m string) error
+	Close() error
+}
+
+// syslogReporter logs infections and errors to syslog and passes
+// every result on to the wrapped reporter
+type syslogReporter struct {
+	reporter
+	l sysLogger
+}
+
+func (s *syslogReporter) Result(path string, r *sssp.Response, err error) error {
+	if _, ok := skipReason(err); !ok {
+		switch {
+		case err != nil:
+			s.l.Err(fmt.Sprintf("ERROR %s: %s", path, err))
+		case r != nil && r.ErrorOccured:
+			s.l.Err(fmt.Sprintf("ERROR %s: %s", path, r.Raw))
+		case r != nil && r.Infected:
+			s.l.Warning(fmt.Sprintf("INFECTED %s: %s", path, r.Signature))
+		}
+	}
+
+	return s.reporter.Result(path, r, err)
+}
+
+func (s *syslogReporter) Stats(bytes int64, elapsed time.Duration) {
+	s.reporter.Stats(bytes, elapsed)
+}
+
+func (s *syslogReporter) Close() (err error) {
+	err = s.reporter.Close()
+	if cerr := s.l.Close(); err == nil {
+		err = cerr
+	}
+
+	return
+}
+
+func newSyslogReporter(r reporter, l sysLogger) reporter {
+	return &syslogReporter{reporter: r, l: l}
+}
@@ -0,0 +1,24 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build windows || plan9
+// +build windows plan9
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"errors"
+)
+
+// newSysLogger is not supported as there is no syslog daemon
+func newSysLogger(facility, tag string) (l sysLogger, err error) {
+	err = errors.New("Syslog is not supported on this platform")
+
+	return
+}
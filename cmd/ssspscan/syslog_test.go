@@ -0,0 +1,72 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+type testSysLogger struct {
+	msgs   []string
+	closed bool
+}
+
+func (l *testSysLogger) Warning(m string) error {
+	l.msgs = append(l.msgs, "warning: "+m)
+	return nil
+}
+
+func (l *testSysLogger) Err(m string) error {
+	l.msgs = append(l.msgs, "err: "+m)
+	return nil
+}
+
+func (l *testSysLogger) Close() error {
+	l.closed = true
+	return nil
+}
+
+func TestSyslogReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := &testSysLogger{}
+	tr := newTextReporter(&buf)
+	tr.(*textReporter).all = true
+	r := newSyslogReporter(tr, l)
+	r.Result("/tmp/eicar.com", &sssp.Response{Filename: "/tmp/eicar.com", Signature: "EICAR-AV-Test", Infected: true}, nil)
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	r.Result("/tmp/huge.iso", nil, &skipError{"too large"})
+	if err := r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected := []string{
+		"warning: INFECTED /tmp/eicar.com: EICAR-AV-Test",
+		"err: ERROR /tmp/missing: " + errTest.Error(),
+	}
+	if len(l.msgs) != len(expected) {
+		t.Fatalf("Unexpected messages: %q", l.msgs)
+	}
+	for i, m := range expected {
+		if l.msgs[i] != m {
+			t.Errorf("Expected %q got %q", m, l.msgs[i])
+		}
+	}
+	if !l.closed {
+		t.Errorf("The logger should be closed")
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 2 {
+		t.Errorf("The results should be passed to the wrapped reporter: %q", buf.String())
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+const (
+	invalidFacilityErr = "Invalid syslog facility: %s"
+)
+
+var facilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+func parseFacility(name string) (p syslog.Priority, err error) {
+	var ok bool
+
+	if p, ok = facilities[strings.ToLower(name)]; !ok {
+		err = fmt.Errorf(invalidFacilityErr, name)
+	}
+
+	return
+}
+
+// newSysLogger connects to the local syslog daemon
+func newSysLogger(facility, tag string) (l sysLogger, err error) {
+	var p syslog.Priority
+	var w *syslog.Writer
+
+	if p, err = parseFacility(facility); err != nil {
+		return
+	}
+
+	if w, err = syslog.New(p|syslog.LOG_WARNING, tag); err != nil {
+		return
+	}
+	l = w
+
+	return
+}
@@ -0,0 +1,30 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"log/syslog"
+	"testing"
+)
+
+func TestParseFacility(t *testing.T) {
+	if p, err := parseFacility("LOCAL3"); err != nil || p != syslog.LOG_LOCAL3 {
+		t.Errorf("parseFacility() = %v, %v", p, err)
+	}
+	if _, err := parseFacility("bogus"); err == nil {
+		t.Errorf("An error should be returned")
+	}
+	if _, err := newSysLogger("bogus", "ssspscan"); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
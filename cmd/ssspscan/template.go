@@ -0,0 +1,176 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	defaultTemplate = `F=>{{.Filename}}; A=>{{.ArchiveItem}}; I=>{{.Infected}}; S=>{{.Signature}}; E=>{{.ErrorOccured}}`
+	invalidTmplErr  = "Invalid template: %s"
+	tmplConflictErr = "Only one of --template and --template-file may be given"
+)
+
+// A templateResult is the data passed to the template for each
+// result, the fields of the response are promoted so that they can
+// be used as {{.Filename}} and friends
+type templateResult struct {
+	*sssp.Response
+	Path    string
+	Error   string
+	Skipped string
+	// Digest is set with --hashes
+	Digest string
+}
+
+// A templateReport is the data passed to a template file, it is
+// executed once the run is complete
+type templateReport struct {
+	Results []templateResult
+	Summary summary
+}
+
+// executor is implemented by text/template and html/template
+type executor interface {
+	Execute(io.Writer, interface{}) error
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// templateReporter executes a text/template for each result, a
+// newline is written after each non empty output so that templates
+// can filter the results
+type templateReporter struct {
+	w    io.Writer
+	tmpl *template.Template
+	// all includes clean results, they are omitted by default
+	all    bool
+	hasher *hasher
+	// report is the template file executed on Close, the results
+	// are collected rather than written when it is set
+	report executor
+	doc    templateReport
+}
+
+// parse sets the template executed for each result, the default
+// template produces the same lines as the text format
+func (t *templateReporter) parse(text string) (err error) {
+	var tmpl *template.Template
+
+	if text == "" {
+		text = defaultTemplate
+	}
+	if tmpl, err = template.New("result").Funcs(templateFuncs).Parse(text); err != nil {
+		err = fmt.Errorf(invalidTmplErr, err)
+		return
+	}
+	t.tmpl = tmpl
+
+	return
+}
+
+// parseFile sets the template file executed once the run is
+// complete with every result and the summary, files with an .html or
+// .htm extension are parsed with html/template so that the results
+// are escaped
+func (t *templateReporter) parseFile(path string) (err error) {
+	var b []byte
+
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		t.report, err = htmltemplate.New(name).Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(string(b))
+	default:
+		t.report, err = template.New(name).Funcs(templateFuncs).Parse(string(b))
+	}
+	if err != nil {
+		t.report = nil
+		err = fmt.Errorf(invalidTmplErr, err)
+	}
+
+	return
+}
+
+func (t *templateReporter) Result(path string, r *sssp.Response, err error) (werr error) {
+	res := templateResult{Response: r, Path: path, Digest: t.hasher.digest(path, err)}
+	if res.Response == nil {
+		res.Response = &sssp.Response{}
+	}
+	if reason, ok := skipReason(err); ok {
+		res.Skipped = reason
+	} else if err != nil {
+		res.Error = err.Error()
+	}
+
+	if t.report != nil {
+		t.doc.Summary.add(r, err)
+		t.doc.Results = append(t.doc.Results, res)
+		return
+	}
+
+	if !t.all && isClean(r, err) {
+		return
+	}
+
+	var b bytes.Buffer
+	if werr = t.tmpl.Execute(&b, &res); werr != nil || b.Len() == 0 {
+		return
+	}
+	b.WriteByte('\n')
+	_, werr = b.WriteTo(t.w)
+
+	return
+}
+
+func (t *templateReporter) setHasher(h *hasher) {
+	t.hasher = h
+}
+
+func (t *templateReporter) Stats(bytes int64, elapsed time.Duration) {
+	t.doc.Summary.stats(bytes, elapsed)
+}
+
+func (t *templateReporter) Close() error {
+	if t.report == nil {
+		return nil
+	}
+
+	return t.report.Execute(t.w, &t.doc)
+}
+
+func newTemplateReporter(w io.Writer) reporter {
+	t := &templateReporter{w: w}
+	t.parse("")
+
+	return t
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestTemplateReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r, err := newReporter("template", &buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	eicar := &sssp.Response{Filename: "/tmp/eicar.com", Signature: "EICAR-AV-Test", Infected: true}
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/eicar.com", eicar, nil)
+	expected := "F=>/tmp/eicar.com; A=>; I=>true; S=>EICAR-AV-Test; E=>false\n"
+	if buf.String() != expected {
+		t.Errorf("The default template should match the text format, expected %q got %q", expected, buf.String())
+	}
+
+	tr := r.(*templateReporter)
+	tr.all = true
+	if err = tr.parse(`{{.Path}} {{upper .Signature}}{{with .Error}}error={{.}}{{end}}{{with .Skipped}}skipped={{.}}{{end}}`); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	buf.Reset()
+	r.Result("/tmp/eicar.com", eicar, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	r.Result("/tmp/huge.iso", nil, &skipError{"too large"})
+	if err = r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	expected = "/tmp/eicar.com EICAR-AV-TEST\n/tmp/missing error=" + errTest.Error() + "\n/tmp/huge.iso skipped=too large\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+
+	if err = tr.parse(`{{json .Response}}`); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	buf.Reset()
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	if !bytes.HasPrefix(buf.Bytes(), []byte(`{"filename":"/tmp/clean"`)) {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+
+	if err = tr.parse(`{{if .Infected}}{{.Path}}{{end}}`); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	buf.Reset()
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/eicar.com", eicar, nil)
+	if buf.String() != "/tmp/eicar.com\n" {
+		t.Errorf("Empty output should be omitted got %q", buf.String())
+	}
+
+	if err = tr.parse(`{{.Filename`); err == nil {
+		t.Errorf("An error should be returned")
+	}
+	if err = tr.parse(`{{.NoSuchField}}`); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if err = r.Result("/tmp/clean", &sssp.Response{}, nil); err == nil {
+		t.Errorf("An error should be returned for an unknown field")
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	var buf bytes.Buffer
+
+	dir := t.TempDir()
+	text := filepath.Join(dir, "report.tmpl")
+	if err := ioutil.WriteFile(text, []byte(`{{range .Results}}{{.Path}} {{.Infected}}{{with .Error}} {{.}}{{end}}
+{{end}}{{with .Summary}}files={{.Files}} infected={{.Infected}} errors={{.Errors}} bytes={{.Bytes}}{{end}}
+`), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	r, err := newReporter("template", &buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	tr := r.(*templateReporter)
+	if err = tr.parseFile(text); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/eicar.com", &sssp.Response{Filename: "/tmp/eicar.com", Infected: true}, nil)
+	r.Result("/tmp/missing", nil, errTest)
+	if buf.Len() != 0 {
+		t.Errorf("Nothing should be written before Close: %q", buf.String())
+	}
+	r.Stats(2048, time.Second)
+	if err = r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	expected := "/tmp/clean false\n/tmp/eicar.com true\n/tmp/missing false " + errTest.Error() +
+		"\nfiles=3 infected=1 errors=1 bytes=2048\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+
+	html := filepath.Join(dir, "report.html")
+	if err = ioutil.WriteFile(html, []byte(`<ul>{{range .Results}}<li>{{.Path}}</li>{{end}}</ul>`), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	buf.Reset()
+	r = newTemplateReporter(&buf)
+	if err = r.(*templateReporter).parseFile(html); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r.Result("/tmp/<b>.txt", nil, nil)
+	r.Close()
+	if buf.String() != "<ul><li>/tmp/&lt;b&gt;.txt</li></ul>" {
+		t.Errorf("HTML templates should be escaped got %q", buf.String())
+	}
+
+	bad := filepath.Join(dir, "bad.tmpl")
+	ioutil.WriteFile(bad, []byte(`{{.Results`), 0644)
+	if err = tr.parseFile(bad); err == nil || !strings.HasPrefix(err.Error(), "Invalid template") {
+		t.Errorf("An error should be returned: %v", err)
+	}
+	if err = tr.parseFile(filepath.Join(dir, "missing.tmpl")); !os.IsNotExist(err) {
+		t.Errorf("tr.parseFile() error = %v, want a missing file", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	tlsKeyPairErr = "--tls-cert and --tls-key must be used together"
+	tlsCAErr      = "No certificates found in %s"
+)
+
+// tlsEnabled reports whether the server is reached using TLS, the
+// --tls-* options imply --tls
+func (c *Config) tlsEnabled() bool {
+	return c.TLS || c.TLSCA != "" || c.TLSCert != "" || c.TLSKey != "" || c.TLSSkipVerify
+}
+
+// tlsConfig returns the TLS configuration or nil when TLS is not
+// enabled
+func (c *Config) tlsConfig() (t *tls.Config, err error) {
+	if !c.tlsEnabled() {
+		return
+	}
+
+	t = &tls.Config{InsecureSkipVerify: c.TLSSkipVerify}
+
+	if c.TLSCA != "" {
+		var b []byte
+		if b, err = ioutil.ReadFile(c.TLSCA); err != nil {
+			return
+		}
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(b) {
+			err = fmt.Errorf(tlsCAErr, c.TLSCA)
+			return
+		}
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		err = fmt.Errorf(tlsKeyPairErr)
+		return
+	}
+	if c.TLSCert != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+			return
+		}
+		t.Certificates = []tls.Certificate{cert}
+	}
+
+	return
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	if tc, err := (&Config{}).tlsConfig(); err != nil || tc != nil {
+		t.Errorf("TLS should be disabled by default: %v %v", tc, err)
+	}
+	if tc, err := (&Config{TLSSkipVerify: true}).tlsConfig(); err != nil || tc == nil || !tc.InsecureSkipVerify {
+		t.Errorf("--tls-skip-verify should imply --tls: %v %v", tc, err)
+	}
+
+	bad := filepath.Join(dir, "bad.pem")
+	if err := ioutil.WriteFile(bad, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	tests := []Config{
+		{TLSCA: filepath.Join(dir, "missing.pem")},
+		{TLSCA: bad},
+		{TLSCert: bad},
+		{TLSCert: bad, TLSKey: bad},
+	}
+	for _, c := range tests {
+		if _, err := c.tlsConfig(); err == nil {
+			t.Errorf("An error should be returned for %+v", c)
+		}
+	}
+}
+
+func TestRunTLS(t *testing.T) {
+	ts := sssptest.NewTLSServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, b, 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	defer func(w io.Writer, r io.Reader) { stdout, stdin = w, r }(stdout, stdin)
+	stdout = ioutil.Discard
+
+	conf := testConfig(t, ts)
+	conf.TLSCA = ca
+	for _, j := range []int{1, 2} {
+		conf.Concurrency = j
+		stdin = strings.NewReader(eicarVirus)
+		if code := run(conf, []string{stdinPath}); code != exitInfected {
+			t.Errorf("run() with -j %d = %d, want %d", j, code, exitInfected)
+		}
+	}
+
+	// the certificate of the server is not trusted
+	conf.TLSCA = ""
+	conf.TLS = true
+	conf.Concurrency = 1
+	stdin = strings.NewReader(eicarVirus)
+	if code := run(conf, []string{stdinPath}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	traceSent     = ">"
+	traceReceived = "<"
+	// maxTraceLine limits the length of traced lines so that
+	// SCANDATA payloads do not flood the output
+	maxTraceLine = 120
+)
+
+// A traceConn is a net.Conn that writes the protocol exchange to w,
+// one line per protocol line prefixed by its direction
+type traceConn struct {
+	net.Conn
+	m sync.Mutex
+	w io.Writer
+}
+
+func (c *traceConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	c.trace(traceReceived, b[:n])
+
+	return
+}
+
+func (c *traceConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	c.trace(traceSent, b[:n])
+
+	return
+}
+
+func (c *traceConn) trace(dir string, b []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > maxTraceLine {
+			fmt.Fprintf(c.w, "%s %q... (%d bytes)\n", dir, line[:maxTraceLine], len(line))
+			continue
+		}
+		if !utf8.Valid(line) {
+			fmt.Fprintf(c.w, "%s %q\n", dir, line)
+			continue
+		}
+		fmt.Fprintf(c.w, "%s %s\n", dir, line)
+	}
+}
+
+func newTraceConn(conn net.Conn, w io.Writer) net.Conn {
+	return &traceConn{Conn: conn, w: w}
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestTraceConn(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	conn, err := net.Dial(ts.Network, ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c, err := sssp.NewClientConn(newTraceConn(conn, &buf), 2*time.Second)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = c.ScanReader(strings.NewReader(strings.Repeat("x", 200))); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c.Close()
+
+	out := buf.String()
+	for _, l := range []string{"< OK SSSP/1.0\n", "> SSSP/1.0\n", "> SCANDATA 200\n", "(200 bytes)\n", "< DONE OK 0000"} {
+		if !strings.Contains(out, l) {
+			t.Errorf("The trace should contain %q:\n%s", l, out)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/archive"
+)
+
+const (
+	// archiveHeadSize is the number of leading bytes needed to
+	// detect every archive format, the tar magic is at offset 257
+	archiveHeadSize = 512
+)
+
+// unpack scans the file p, archives are extracted by e and the result
+// of the first infected member is returned with its path in
+// ArchiveItem, other files are streamed as they are
+func unpack(e *archive.Extractor, c fileScanner, p string) (r *sssp.Response, err error) {
+	var f *os.File
+	var rs []*sssp.Response
+
+	if f, err = os.Open(p); err != nil {
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, archiveHeadSize)
+	n, _ := io.ReadFull(f, head)
+	if archive.Detect(head[:n]) == archive.Unknown {
+		// files that are not archives are not held in memory
+		return c.ScanStream(p)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	rs, err = e.ScanReader(p, f)
+	r = &sssp.Response{Filename: p}
+	for _, m := range rs {
+		if m.Infected {
+			r = m
+			break
+		}
+		if m.ErrorOccured && !r.ErrorOccured {
+			r = m
+		}
+	}
+	if err != nil && r.Infected {
+		// the infection takes precedence over the limits
+		err = nil
+	}
+
+	return
+}
+
+// newUnpacker returns an extractor that scans the members with c,
+// maxSize bounds the total size of the members of an archive and
+// maxFiles their number, 0 disables the file limit
+func newUnpacker(c fileScanner, maxSize int64, maxFiles int) (e *archive.Extractor) {
+	if maxFiles == 0 {
+		maxFiles = math.MaxInt32
+	}
+
+	e = archive.NewExtractor(c)
+	e.SetMaxSize(maxSize)
+	e.SetMaxTotalSize(maxSize)
+	e.SetMaxFiles(maxFiles)
+
+	return
+}
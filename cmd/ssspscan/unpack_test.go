@@ -0,0 +1,154 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+// zipData returns a zip archive of the name and data pairs in files
+func zipData(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// tgzData returns a compressed tar archive of the name and data
+// pairs in files
+func tgzData(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for i := 0; i < len(files); i += 2 {
+		hdr := &tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		tw.Write([]byte(files[i+1]))
+	}
+	tw.Close()
+	if err := gw.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestUnpack(t *testing.T) {
+	c, ts := newTestClient(t)
+	dir := t.TempDir()
+
+	nested := zipData(t, "docs/eicar.com", eicarVirus)
+	files := map[string][]byte{
+		"clean.zip":  zipData(t, "a.txt", "a", "b/c.txt", "c"),
+		"eicar.zip":  zipData(t, "sub/eicar.com", eicarVirus, "readme.txt", "readme"),
+		"nested.tgz": tgzData(t, "clean.txt", "clean", "inner.zip", string(nested)),
+		"plain.txt":  []byte("plain"),
+	}
+	for n, d := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, n), d, 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	e := newUnpacker(c, 1<<20, 0)
+	tests := []struct {
+		name     string
+		infected bool
+		item     string
+		scans    int
+	}{
+		{"clean.zip", false, "", 2},
+		{"eicar.zip", true, "/Zip/sub/eicar.com", 2},
+		{"nested.tgz", true, "/Gzip/nested/Tar/inner.zip/Zip/docs/eicar.com", 2},
+		{"plain.txt", false, "", 1},
+	}
+	for _, tt := range tests {
+		before := len(ts.Requests())
+		p := filepath.Join(dir, tt.name)
+		r, err := unpack(e, c, p)
+		if err != nil {
+			t.Fatalf("%s: An error should not be returned: %s", tt.name, err)
+		}
+		if r.Infected != tt.infected || r.ArchiveItem != tt.item || (tt.infected && r.Signature != sssptest.EicarSignature) {
+			t.Errorf("%s: unexpected result %+v", tt.name, r)
+		}
+		if n := len(ts.Requests()) - before; n != tt.scans {
+			t.Errorf("%s: %d scans, want %d", tt.name, n, tt.scans)
+		}
+	}
+
+	if _, err := unpack(newUnpacker(c, 1<<20, 1), c, filepath.Join(dir, "clean.zip")); err == nil {
+		t.Errorf("An error should be returned when the member limit is exceeded")
+	}
+	if _, err := unpack(newUnpacker(c, 64, 100), c, filepath.Join(dir, "clean.zip")); err == nil {
+		t.Errorf("An error should be returned when the size limit is exceeded")
+	}
+	r, err := unpack(newUnpacker(c, 1<<20, 1), c, filepath.Join(dir, "eicar.zip"))
+	if err != nil || !r.Infected {
+		t.Errorf("An infection should take precedence over the limits: %+v %v", r, err)
+	}
+	if _, err = unpack(e, c, filepath.Join(dir, "nonexistent")); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestRunUnpack(t *testing.T) {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "eicar.zip"), zipData(t, "eicar.com", eicarVirus), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	conf := testConfig(t, ts)
+	conf.Unpack = true
+	conf.UnpackMaxSize = 1 << 20
+	if code := run(conf, []string{dir}); code != exitError {
+		t.Errorf("run() = %d, want %d", code, exitError)
+	}
+
+	conf.LocalRecursive = true
+	if code := run(conf, []string{dir}); code != exitInfected {
+		t.Errorf("run() = %d, want %d", code, exitInfected)
+	}
+	expected := "F=>" + filepath.Join(dir, "eicar.zip") + "; A=>/Zip/eicar.com; I=>true; S=>" + sssptest.EicarSignature + "; E=>false\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+}
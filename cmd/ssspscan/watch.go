@@ -0,0 +1,54 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+
+	"github.com/baruwa-enterprise/sssp/watcher"
+)
+
+// watchDirs monitors the directories and their sub directories and
+// passes the outcome of scanning each new or modified file to fn, it
+// returns when the context is cancelled or fn returns an error
+func watchDirs(ctx context.Context, c fileScanner, dirs []string, fn resultFunc) (err error) {
+	var w *watcher.Watcher
+
+	if w, err = watcher.NewWatcher(c); err != nil {
+		return
+	}
+	w.SetRecursive(true)
+
+	for _, d := range dirs {
+		if err = w.Add(d); err != nil {
+			w.Close()
+			return
+		}
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	for r := range w.Results() {
+		if err == nil {
+			if err = fn(r.Path, r.Response, r.Err); err != nil {
+				w.Close()
+			}
+		}
+	}
+
+	if werr := <-errc; err == nil && werr != context.Canceled {
+		err = werr
+	}
+
+	return
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestWatchDirs(t *testing.T) {
+	c, _ := newTestClient(t)
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results := make(chan *sssp.Response, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- watchDirs(ctx, c, []string{dir}, func(p string, r *sssp.Response, err error) error {
+			if err != nil {
+				t.Errorf("An error should not be returned: %s", err)
+			}
+			results <- r
+			return nil
+		})
+	}()
+
+	// give the watcher time to start monitoring
+	time.Sleep(100 * time.Millisecond)
+	sub := filepath.Join(dir, "uploads")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	fn := filepath.Join(sub, "eicar.com")
+	if err := ioutil.WriteFile(fn, []byte(eicarVirus), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	select {
+	case r := <-results:
+		if r == nil || !r.Infected || r.Filename != fn {
+			t.Errorf("Unexpected result: %+v", r)
+		}
+	case <-ctx.Done():
+		t.Fatalf("The new file should be scanned")
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+
+	if err := watchDirs(context.Background(), c, []string{filepath.Join(dir, "missing")}, nil); err == nil {
+		t.Errorf("An error should be returned for a missing directory")
+	}
+}
+
+func TestWatchDirsStop(t *testing.T) {
+	c, _ := newTestClient(t)
+	dir := t.TempDir()
+
+	errStop := errors.New("stop")
+	errc := make(chan error, 1)
+	go func() {
+		errc <- watchDirs(context.Background(), c, []string{dir}, func(p string, r *sssp.Response, err error) error {
+			return errStop
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("clean"), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != errStop {
+			t.Errorf("Expected %v got %v", errStop, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("The watch should stop when the result function fails")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	xmlReportVersion = "1.0"
+)
+
+type xmlResult struct {
+	XMLName     xml.Name `xml:"result"`
+	Path        string   `xml:"path,attr"`
+	Status      string   `xml:"status,attr"`
+	Filename    string   `xml:"filename,omitempty"`
+	ArchiveItem string   `xml:"archive-item,omitempty"`
+	Signature   string   `xml:"signature,omitempty"`
+	Error       string   `xml:"error,omitempty"`
+	Reason      string   `xml:"reason,omitempty"`
+	Digest      string   `xml:"digest,omitempty"`
+}
+
+type xmlSummary struct {
+	Files      int     `xml:"files,attr"`
+	Infected   int     `xml:"infected,attr"`
+	Errors     int     `xml:"errors,attr"`
+	Skipped    int     `xml:"skipped,attr"`
+	Bytes      int64   `xml:"bytes,attr"`
+	Elapsed    float64 `xml:"elapsed,attr"`
+	Throughput int64   `xml:"throughput,attr"`
+}
+
+type xmlReport struct {
+	XMLName xml.Name    `xml:"ssspscan"`
+	Version string      `xml:"version,attr"`
+	Results []xmlResult `xml:"results>result"`
+	Summary xmlSummary  `xml:"summary"`
+}
+
+// xmlReporter writes a single XML document on Close, the element
+// and attribute names are stable so that consumers can rely on them,
+// the status attribute of each result is one of clean, infected,
+// error or skipped
+type xmlReporter struct {
+	w      io.Writer
+	doc    xmlReport
+	sum    summary
+	hasher *hasher
+}
+
+func (x *xmlReporter) Result(path string, r *sssp.Response, err error) error {
+	x.sum.add(r, err)
+
+	res := xmlResult{Path: path, Status: verdict(r, err), Digest: x.hasher.digest(path, err)}
+	if r != nil {
+		res.Filename = r.Filename
+		res.ArchiveItem = r.ArchiveItem
+		res.Signature = r.Signature
+	}
+	if reason, ok := skipReason(err); ok {
+		res.Reason = reason
+	} else if err != nil {
+		res.Error = err.Error()
+	}
+	x.doc.Results = append(x.doc.Results, res)
+
+	return nil
+}
+
+func (x *xmlReporter) setHasher(h *hasher) {
+	x.hasher = h
+}
+
+func (x *xmlReporter) Stats(bytes int64, elapsed time.Duration) {
+	x.sum.stats(bytes, elapsed)
+}
+
+func (x *xmlReporter) Close() (err error) {
+	s := x.sum
+	x.doc.Summary = xmlSummary{
+		Files:      s.Files,
+		Infected:   s.Infected,
+		Errors:     s.Errors,
+		Skipped:    s.Skipped,
+		Bytes:      s.Bytes,
+		Elapsed:    s.Elapsed,
+		Throughput: s.Throughput,
+	}
+
+	if _, err = io.WriteString(x.w, xml.Header); err != nil {
+		return
+	}
+	enc := xml.NewEncoder(x.w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(&x.doc); err != nil {
+		return
+	}
+	_, err = io.WriteString(x.w, "\n")
+
+	return
+}
+
+func newXMLReporter(w io.Writer) reporter {
+	return &xmlReporter{w: w, doc: xmlReport{Version: xmlReportVersion}}
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package main
+SSSP - Golang cmdline SSSP client
+*/
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestXMLReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := newXMLReporter(&buf)
+	r.Result("/tmp/eicar.zip", &sssp.Response{
+		Filename:    "/tmp/eicar.zip",
+		ArchiveItem: "eicar.com",
+		Signature:   "EICAR-AV-Test",
+		Infected:    true,
+	}, nil)
+	r.Result("/tmp/clean", &sssp.Response{Filename: "/tmp/clean"}, nil)
+	r.Result("/tmp/a&b", nil, errTest)
+	r.Result("/tmp/huge.iso", nil, &skipError{"too large"})
+	r.Stats(4096, 2*time.Second)
+	if err := r.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<ssspscan version="1.0">
+  <results>
+    <result path="/tmp/eicar.zip" status="infected">
+      <filename>/tmp/eicar.zip</filename>
+      <archive-item>eicar.com</archive-item>
+      <signature>EICAR-AV-Test</signature>
+    </result>
+    <result path="/tmp/clean" status="clean">
+      <filename>/tmp/clean</filename>
+    </result>
+    <result path="/tmp/a&amp;b" status="error">
+      <error>DONE FAIL 0D05 Could not open file</error>
+    </result>
+    <result path="/tmp/huge.iso" status="skipped">
+      <reason>too large</reason>
+    </result>
+  </results>
+  <summary files="4" infected="1" errors="1" skipped="1" bytes="4096" elapsed="2" throughput="2048"></summary>
+</ssspscan>
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
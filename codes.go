@@ -0,0 +1,162 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"fmt"
+)
+
+// Result codes reported by SAVDI in the OK, FAIL and DONE lines, the
+// codes are the SAVI error codes and are written in hexadecimal
+const (
+	// CodeOK is returned when the request succeeded
+	CodeOK ResultCode = 0x0000
+	// CodeInitialising is returned while SAVI is initialising
+	CodeInitialising ResultCode = 0x0201
+	// CodeTerminating is returned while SAVI is terminating
+	CodeTerminating ResultCode = 0x0202
+	// CodeVirusPresent is returned when a virus was found
+	CodeVirusPresent ResultCode = 0x0203
+	// CodeNotInitialised is returned when SAVI is not initialised
+	CodeNotInitialised ResultCode = 0x0206
+	// CodeScanFailed is returned when the scan failed
+	CodeScanFailed ResultCode = 0x020D
+	// CodeCouldNotOpen is returned when the item could not be opened
+	CodeCouldNotOpen ResultCode = 0x0210
+	// CodeCompressed is returned for items compressed using an
+	// unsupported method
+	CodeCompressed ResultCode = 0x0211
+	// CodeEncrypted is returned for encrypted items such as password
+	// protected archives
+	CodeEncrypted ResultCode = 0x0212
+	// CodeCorrupt is returned for corrupt items
+	CodeCorrupt ResultCode = 0x021E
+	// CodeRecursionLimit is returned when archives are nested beyond
+	// the configured depth
+	CodeRecursionLimit ResultCode = 0x021F
+	// CodeScanTimeout is returned when the scan took too long
+	CodeScanTimeout ResultCode = 0x0220
+	// CodeSizeLimit is returned for items larger than the configured
+	// limits
+	CodeSizeLimit ResultCode = 0x0224
+)
+
+const (
+	// ClassUnknown is the class of the codes not in the table
+	ClassUnknown CodeClass = iota
+	// ClassSuccess is the class of successful scans
+	ClassSuccess
+	// ClassInfected is the class of scans that found a virus
+	ClassInfected
+	// ClassAccess is the class of items that could not be read
+	ClassAccess
+	// ClassEncrypted is the class of encrypted items
+	ClassEncrypted
+	// ClassCorrupt is the class of corrupt items
+	ClassCorrupt
+	// ClassLimit is the class of items that exceeded a limit
+	ClassLimit
+	// ClassUnsupported is the class of items that use formats or
+	// methods not supported by the engine
+	ClassUnsupported
+	// ClassServer is the class of failures of the server itself
+	ClassServer
+)
+
+// A ResultCode represents an SSSP result code
+type ResultCode int
+
+// A CodeClass groups result codes that callers usually handle in
+// the same way
+type CodeClass int
+
+type codeInfo struct {
+	name        string
+	description string
+	class       CodeClass
+}
+
+var resultCodes = map[ResultCode]codeInfo{
+	CodeOK:             {"OK", "The function call succeeded", ClassSuccess},
+	CodeInitialising:   {"INITIALISING", "SAVI is initialising", ClassServer},
+	CodeTerminating:    {"TERMINATING", "SAVI is terminating", ClassServer},
+	CodeVirusPresent:   {"VIRUSPRESENT", "Virus found during virus scan", ClassInfected},
+	CodeNotInitialised: {"NOT_INITIALISED", "SAVI has not been initialised", ClassServer},
+	CodeScanFailed:     {"SWEEPFAILURE", "The virus scan failed", ClassServer},
+	CodeCouldNotOpen:   {"COULD_NOT_OPEN", "Could not open item passed to SAVI for scanning", ClassAccess},
+	CodeCompressed:     {"FILE_COMPRESSED", "The item is compressed using an unsupported method", ClassUnsupported},
+	CodeEncrypted:      {"FILE_ENCRYPTED", "The item is encrypted", ClassEncrypted},
+	CodeCorrupt:        {"CORRUPT", "The item is corrupt", ClassCorrupt},
+	CodeRecursionLimit: {"REC_LIMIT_EXCEEDED", "The archive recursion limit was exceeded", ClassLimit},
+	CodeScanTimeout:    {"SCAN_TIMEOUT", "The scan time limit was exceeded", ClassLimit},
+	CodeSizeLimit:      {"SIZE_LIMIT_EXCEEDED", "The item exceeds the configured size limits", ClassLimit},
+}
+
+// String returns the code as written by the server
+func (c ResultCode) String() string {
+	return fmt.Sprintf("%04X", int(c))
+}
+
+// Name returns the SAVI name of the code, an empty string is
+// returned for unknown codes
+func (c ResultCode) Name() string {
+	return resultCodes[c].name
+}
+
+// Description returns the description of the code, an empty string
+// is returned for unknown codes
+func (c ResultCode) Description() string {
+	return resultCodes[c].description
+}
+
+// Class returns the class of the code
+func (c ResultCode) Class() CodeClass {
+	return resultCodes[c].class
+}
+
+// Known reports whether the code is in the table
+func (c ResultCode) Known() bool {
+	_, ok := resultCodes[c]
+
+	return ok
+}
+
+func (c CodeClass) String() (s string) {
+	n := [...]string{
+		"unknown",
+		"success",
+		"infected",
+		"access",
+		"encrypted",
+		"corrupt",
+		"limit",
+		"unsupported",
+		"server",
+	}
+	if c < ClassUnknown || c > ClassServer {
+		return
+	}
+	s = n[c]
+	return
+}
+
+// LookupCode returns the result code for the code reported by the
+// server, ok is false when the code is not in the table
+func LookupCode(code int) (c ResultCode, ok bool) {
+	c = ResultCode(code)
+	ok = c.Known()
+
+	return
+}
+
+// ResultCode returns the result code reported by the DONE line
+func (r *Response) ResultCode() ResultCode {
+	return ResultCode(r.Code)
+}
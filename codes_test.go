@@ -0,0 +1,55 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"testing"
+)
+
+func TestResultCodes(t *testing.T) {
+	tests := []struct {
+		code  int
+		str   string
+		name  string
+		class CodeClass
+		known bool
+	}{
+		{0x0000, "0000", "OK", ClassSuccess, true},
+		{0x0203, "0203", "VIRUSPRESENT", ClassInfected, true},
+		{0x0210, "0210", "COULD_NOT_OPEN", ClassAccess, true},
+		{0x0212, "0212", "FILE_ENCRYPTED", ClassEncrypted, true},
+		{0x021E, "021E", "CORRUPT", ClassCorrupt, true},
+		{0x0D05, "0D05", "", ClassUnknown, false},
+	}
+	for _, tt := range tests {
+		c, ok := LookupCode(tt.code)
+		if ok != tt.known || c.String() != tt.str || c.Name() != tt.name || c.Class() != tt.class {
+			t.Errorf("LookupCode(%#x) = %s %s %s %t, want %s %s %s %t",
+				tt.code, c, c.Name(), c.Class(), ok, tt.str, tt.name, tt.class, tt.known)
+		}
+		if tt.known && c.Description() == "" {
+			t.Errorf("%s should have a description", c)
+		}
+	}
+
+	for c, info := range resultCodes {
+		if info.class == ClassUnknown || info.class.String() == "" {
+			t.Errorf("%s has no class", c)
+		}
+	}
+	if s := CodeClass(100).String(); s != "" {
+		t.Errorf("CodeClass(100).String() = %q, want %q", s, "")
+	}
+
+	r := &Response{Code: 0x0212}
+	if r.ResultCode() != CodeEncrypted || r.ResultCode().Class() != ClassEncrypted {
+		t.Errorf("r.ResultCode() = %s, want %s", r.ResultCode(), CodeEncrypted)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+
+The conformance tests run against a real SAVDI server and are skipped
+unless SSSP_CONFORMANCE_ADDRESS is set to the server address in the
+form unix:/path/to/sssp.sock or tcp:host:port. SCANFILE and SCANDIR
+are only exercised when SSSP_CONFORMANCE_LOCAL is set, which indicates
+that the server can read files created by the tests.
+*/
+package sssp
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+)
+
+const (
+	conformanceAddrEnv  = "SSSP_CONFORMANCE_ADDRESS"
+	conformanceLocalEnv = "SSSP_CONFORMANCE_LOCAL"
+)
+
+var codeRe = regexp.MustCompile(`^[0-9A-Fa-f]{4}$`)
+
+type fixture struct {
+	name     string
+	data     []byte
+	infected bool
+	// either means the server may detect the content or report
+	// that it could not be scanned, eg encrypted archives
+	either bool
+}
+
+func conformanceServer(t *testing.T) (network, address string) {
+	v := os.Getenv(conformanceAddrEnv)
+	if v == "" {
+		t.Skipf("%s is not set", conformanceAddrEnv)
+	}
+
+	pts := strings.SplitN(v, ":", 2)
+	if len(pts) != 2 {
+		t.Fatalf("Invalid %s: %s", conformanceAddrEnv, v)
+	}
+
+	network, address = pts[0], pts[1]
+
+	return
+}
+
+func conformanceClient(t *testing.T) *Client {
+	network, address := conformanceServer(t)
+	c, err := NewClient(context.Background(), network, address, 5*time.Second, 30*time.Second, 0)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s:%s: %s", network, address, err)
+	}
+
+	return c
+}
+
+// rawCmd sends a command and returns the raw response lines
+func rawCmd(t *testing.T, cmd string, data []byte) (lines []string) {
+	network, address := conformanceServer(t)
+	conn, err := net.DialTimeout(network, address, 5*time.Second)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	tc := textproto.NewConn(conn)
+	if _, err = tc.ReadLine(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	tc.PrintfLine("%s", protocolVersion)
+	if _, err = tc.ReadLine(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	tc.PrintfLine("%s", cmd)
+	if data != nil {
+		tc.W.Write(data)
+		tc.W.Flush()
+	}
+
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		lines = append(lines, line)
+		if line == "" || strings.HasPrefix(line, rejResp) {
+			break
+		}
+	}
+	tc.PrintfLine("BYE")
+
+	return
+}
+
+// checkLines asserts that every line of a response is understood
+func checkLines(t *testing.T, name string, lines []string) (r *protocol.Response) {
+	var err error
+
+	r, err = protocol.ParseResponse(lines)
+	if _, ok := err.(*protocol.DoneError); err != nil && !ok {
+		t.Errorf("%s: unexpected parse error: %s\n%s", name, err, strings.Join(lines, "\n"))
+	}
+
+	for _, e := range r.Events {
+		switch e.Type {
+		case protocol.Unknown:
+			t.Errorf("%s: unrecognised line: %q", name, e.Raw)
+		case protocol.Ok, protocol.Fail, protocol.Done:
+			if !codeRe.MatchString(e.Code) {
+				t.Errorf("%s: invalid result code %q in %q", name, e.Code, e.Raw)
+			}
+		}
+	}
+
+	if r.Done == nil {
+		t.Errorf("%s: the response has no DONE line", name)
+		return
+	}
+	if r.Done.Status == "OK" && r.Done.Code != "0000" && r.Done.Code != "0203" {
+		t.Errorf("%s: unexpected DONE OK code %s", name, r.Done.Code)
+	}
+	if r.Done.Status == "FAIL" && r.Done.Code == "0000" {
+		t.Errorf("%s: DONE FAIL with a success code", name)
+	}
+
+	return
+}
+
+func zipBytes(t *testing.T, name string, data []byte, password string) []byte {
+	var b bytes.Buffer
+
+	w := zip.NewWriter(&b)
+	if password == "" {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		f.Write(data)
+	} else {
+		crc := crc32.ChecksumIEEE(data)
+		fh := &zip.FileHeader{
+			Name:               name,
+			Method:             zip.Store,
+			Flags:              0x1,
+			CRC32:              crc,
+			CompressedSize64:   uint64(len(data) + 12),
+			UncompressedSize64: uint64(len(data)),
+		}
+		f, err := w.CreateRaw(fh)
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		f.Write(zipCrypto(password, data, crc))
+	}
+	w.Close()
+
+	return b.Bytes()
+}
+
+// zipCrypto encrypts data using the traditional PKWARE encryption
+func zipCrypto(password string, data []byte, crc uint32) []byte {
+	keys := [3]uint32{0x12345678, 0x23456789, 0x34567890}
+	update := func(c byte) {
+		keys[0] = crc32.IEEETable[byte(keys[0])^c] ^ (keys[0] >> 8)
+		keys[1] = (keys[1]+(keys[0]&0xff))*134775813 + 1
+		keys[2] = crc32.IEEETable[byte(keys[2])^byte(keys[1]>>24)] ^ (keys[2] >> 8)
+	}
+	stream := func() byte {
+		t := uint16(keys[2] | 2)
+		return byte((uint32(t) * uint32(t^1)) >> 8)
+	}
+
+	for i := 0; i < len(password); i++ {
+		update(password[i])
+	}
+
+	hdr := []byte("0123456789A")
+	hdr = append(hdr, byte(crc>>24))
+	out := make([]byte, 0, len(hdr)+len(data))
+	for _, p := range append(hdr, data...) {
+		out = append(out, p^stream())
+		update(p)
+	}
+
+	return out
+}
+
+func mbox(data []byte) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("From sender@example.com Mon Mar  1 10:00:00 2021\n")
+	b.WriteString("From: sender@example.com\nTo: rcpt@example.com\nSubject: test\n")
+	b.WriteString("MIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=\"b1\"\n\n")
+	b.WriteString("--b1\nContent-Type: text/plain\n\nSee attached\n")
+	b.WriteString("--b1\nContent-Type: application/octet-stream; name=\"eicar.com\"\n")
+	b.WriteString("Content-Transfer-Encoding: base64\n\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(data))
+	b.WriteString("\n--b1--\n\n")
+
+	return b.Bytes()
+}
+
+func fixtures(t *testing.T) (f []fixture) {
+	eicar := []byte(eicarVirus)
+
+	nested := eicar
+	for i := 0; i < 8; i++ {
+		nested = zipBytes(t, fmt.Sprintf("level%d.zip", i), nested, "")
+	}
+
+	f = []fixture{
+		{name: "clean", data: []byte("clean content\n")},
+		{name: "empty", data: []byte{}},
+		{name: "eicar", data: eicar, infected: true},
+		{name: "zip", data: zipBytes(t, "eicar.com", eicar, ""), infected: true},
+		{name: "encrypted-zip", data: zipBytes(t, "eicar.com", eicar, "infected"), either: true},
+		{name: "mbox", data: mbox(eicar), infected: true},
+		{name: "deep-nesting", data: nested, either: true},
+	}
+
+	return
+}
+
+func TestConformanceHandshake(t *testing.T) {
+	c := conformanceClient(t)
+	if err := c.Close(); err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+}
+
+func TestConformanceQuery(t *testing.T) {
+	c := conformanceClient(t)
+	defer c.Close()
+
+	i, err := c.QueryServer()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if i.Get("version") == "" {
+		t.Errorf("QUERY SERVER should return the version: %v", i)
+	}
+
+	if i, err = c.QuerySAVI(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if i.Get("virusdatadate") == "" {
+		t.Errorf("QUERY SAVI should return the virus data date: %v", i)
+	}
+
+	if _, err = c.QueryEngine(); err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+
+	for _, q := range []string{"QUERY SERVER", "QUERY SAVI", "QUERY ENGINE"} {
+		lines := rawCmd(t, q, nil)
+		r, _ := protocol.ParseResponse(lines)
+		if len(r.Info) == 0 {
+			t.Errorf("%s: no information returned:\n%s", q, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestConformanceScanData(t *testing.T) {
+	c := conformanceClient(t)
+	defer c.Close()
+
+	for _, f := range fixtures(t) {
+		r, err := c.ScanReader(bytes.NewReader(f.data))
+		if r == nil {
+			t.Errorf("%s: no response, error: %v", f.name, err)
+			continue
+		}
+		switch {
+		case f.either:
+			if !r.Infected && err == nil {
+				t.Logf("%s: reported as clean", f.name)
+			}
+		case f.infected:
+			if !r.Infected || r.Signature == "" {
+				t.Errorf("%s: should be infected: %+v %v", f.name, r, err)
+			}
+		default:
+			if r.Infected || err != nil {
+				t.Errorf("%s: should be clean: %+v %v", f.name, r, err)
+			}
+		}
+
+		checkLines(t, f.name, rawCmd(t, fmt.Sprintf("SCANDATA %d", len(f.data)), f.data))
+	}
+}
+
+func TestConformanceScanFile(t *testing.T) {
+	if os.Getenv(conformanceLocalEnv) == "" {
+		t.Skipf("%s is not set", conformanceLocalEnv)
+	}
+
+	c := conformanceClient(t)
+	defer c.Close()
+
+	dir, err := ioutil.TempDir("", "conformance")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, 0755)
+
+	for _, f := range fixtures(t) {
+		fn := filepath.Join(dir, f.name)
+		if err = ioutil.WriteFile(fn, f.data, 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+
+		r, err := c.ScanFile(fn)
+		if r == nil {
+			t.Errorf("%s: no response, error: %v", f.name, err)
+			continue
+		}
+		if !f.either && r.Infected != f.infected {
+			t.Errorf("%s: r.Infected = %t, want %t (%v)", f.name, r.Infected, f.infected, err)
+		}
+		checkLines(t, f.name, rawCmd(t, "SCANFILE "+fn, nil))
+	}
+
+	missing := filepath.Join(dir, "missing")
+	if _, err = c.ScanFile(missing); err == nil {
+		t.Errorf("Scanning a missing file should return an error")
+	}
+	checkLines(t, "missing", rawCmd(t, "SCANFILE "+missing, nil))
+
+	for _, recurse := range []bool{false, true} {
+		rs, err := c.ScanDir(dir, recurse)
+		if err != nil {
+			t.Logf("ScanDir(%t) returned: %s", recurse, err)
+		}
+		found := false
+		for _, r := range rs {
+			if r.Infected && r.Filename == filepath.Join(dir, "eicar") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("ScanDir(%t) did not report %s: %+v", recurse, filepath.Join(dir, "eicar"), rs)
+		}
+	}
+	checkLines(t, "SCANDIRR", rawCmd(t, "SCANDIRR "+dir, nil))
+}
+
+func TestConformanceReject(t *testing.T) {
+	lines := rawCmd(t, "NOSUCHCOMMAND", nil)
+	if len(lines) == 0 {
+		t.Fatalf("No response returned")
+	}
+	r, err := protocol.ParseResponse(lines)
+	if err == nil && (r.Done == nil || r.Done.Status != "FAIL") {
+		t.Errorf("Unknown commands should be rejected:\n%s", strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	debugSent       = ">"
+	debugReceived   = "<"
+	debugTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+	debugPayloadFmt = "[%d bytes]"
+)
+
+// connIDs numbers the connections shown in the debug log
+var connIDs uint64
+
+// A debugLog writes the protocol lines of one or more connections,
+// each line is written with a single call to the writer
+type debugLog struct {
+	m sync.Mutex
+	w io.Writer
+}
+
+// printf writes a line sent or received on connection conn for the
+// request seq, seq is 0 for the handshake and otherwise matches the
+// number in the server ACC line
+func (d *debugLog) printf(conn uint64, seq uint, dir, format string, args ...interface{}) {
+	line := fmt.Sprintf("%s conn=%d req=%d %s %s\n",
+		time.Now().UTC().Format(debugTimeLayout), conn, seq, dir, fmt.Sprintf(format, args...))
+
+	d.m.Lock()
+	io.WriteString(d.w, line)
+	d.m.Unlock()
+}
+
+// SetDebug writes each command and response line sent on the
+// connection to w, prefixed with a timestamp, the connection number
+// and the request number. SCANDATA payloads are replaced by their
+// length. Unlike the record package nothing is kept but the lines,
+// nil disables it.
+func (c *Client) SetDebug(w io.Writer) {
+	c.m.Lock()
+	c.debug = newDebugLog(w)
+	c.m.Unlock()
+}
+
+// SetDebug sets the writer used by connections established after
+// the call, see Client.SetDebug
+func (p *Pool) SetDebug(w io.Writer) {
+	p.m.Lock()
+	p.debug = newDebugLog(w)
+	p.m.Unlock()
+}
+
+// printfLine sends a protocol line for request id
+func (c *Client) printfLine(id uint, format string, args ...interface{}) error {
+	if c.debug != nil {
+		c.debug.printf(c.connID, id+1, debugSent, format, args...)
+	}
+
+	return c.tc.PrintfLine(format, args...)
+}
+
+// readLine reads a protocol line for request id
+func (c *Client) readLine(id uint) (line string, err error) {
+	if line, err = c.tc.ReadLine(); err == nil && c.debug != nil {
+		c.debug.printf(c.connID, id+1, debugReceived, "%s", line)
+	}
+
+	return
+}
+
+// debugPayload records the length of a SCANDATA payload
+func (c *Client) debugPayload(id uint, n int64) {
+	if c.debug != nil {
+		c.debug.printf(c.connID, id+1, debugSent, debugPayloadFmt, n)
+	}
+}
+
+// debugHandshake records a handshake line
+func (c *Client) debugHandshake(dir, line string) {
+	if c.debug != nil {
+		c.debug.printf(c.connID, 0, dir, "%s", line)
+	}
+}
+
+func nextConnID() uint64 {
+	return atomic.AddUint64(&connIDs, 1)
+}
+
+func newDebugLog(w io.Writer) *debugLog {
+	if w == nil {
+		return nil
+	}
+
+	return &debugLog{w: w}
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+var debugLineRe = regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z conn=(\d+) req=(\d+) ([<>]) (.*)$`)
+
+func TestSetDebug(t *testing.T) {
+	var b bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetDebug(&b)
+
+	if _, err = p.ScanReader(strings.NewReader(eicarVirus)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = p.QueryServer(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if strings.Contains(b.String(), eicarVirus) {
+		t.Errorf("The payload should not be logged")
+	}
+
+	var got []string
+	var conn string
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		m := debugLineRe.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("Unexpected debug line %q", line)
+		}
+		if conn == "" {
+			conn = m[1]
+		} else if m[1] != conn {
+			t.Errorf("The lines should be logged for connection %s: %q", conn, line)
+		}
+		got = append(got, fmt.Sprintf("%s %s %s", m[2], m[3], m[4]))
+	}
+
+	expected := []string{
+		"0 < OK SSSP/1.0",
+		"0 > " + protocolVersion,
+		"0 < ACC ",
+		"1 > SCANDATA " + fmt.Sprint(len(eicarVirus)),
+		"1 > " + fmt.Sprintf(debugPayloadFmt, len(eicarVirus)),
+		"1 < ACC ",
+		"1 < VIRUS " + sssptest.EicarSignature,
+		"1 < OK 0203",
+		"1 < DONE OK 0203",
+		"1 < ",
+		"2 > QUERY SERVER",
+		"2 < ACC ",
+	}
+	if len(got) < len(expected) {
+		t.Fatalf("Expected at least %d lines got %q", len(expected), got)
+	}
+	for i, e := range expected {
+		if !strings.HasPrefix(got[i], e) {
+			t.Errorf("line %d = %q, want %q", i, got[i], e)
+		}
+	}
+
+	b.Reset()
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	c.SetDebug(&b)
+	c.SetDebug(nil)
+	if _, err = c.QueryServer(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Nothing should be logged once disabled: %s", b.String())
+	}
+}
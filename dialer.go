@@ -0,0 +1,226 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	localAddrErr = "Invalid local address: %q"
+)
+
+// SocketOptions holds the socket settings of TCP connections, the
+// zero value keeps the defaults. Small commands favour latency while
+// large streams favour throughput, so the defaults may not suit every
+// workload.
+type SocketOptions struct {
+	// Nagle enables Nagle's algorithm, connections set TCP_NODELAY
+	// by default so that commands are sent at once
+	Nagle bool
+	// ReadBuffer and WriteBuffer set the size of the receive and
+	// send buffers of the socket, 0 keeps the system size
+	ReadBuffer  int
+	WriteBuffer int
+	// Control is called after the socket is created and before it
+	// connects, see net.Dialer.Control, to set other options
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+// SetKeepAlive sets the interval between the TCP keepalive probes
+// of connections established after the call, they keep NAT and
+// firewall idle timeouts between the client and the server from
+// dropping idle connections. A negative interval disables them and
+// 0, the default, uses the system interval of 15 seconds.
+func (c *Client) SetKeepAlive(d time.Duration) {
+	c.m.Lock()
+	c.keepAlive = d
+	c.m.Unlock()
+}
+
+// SetKeepAlive sets the TCP keepalive interval used by connections
+// established after the call, see Client.SetKeepAlive
+func (p *Pool) SetKeepAlive(d time.Duration) {
+	p.m.Lock()
+	p.keepAlive = d
+	p.m.Unlock()
+}
+
+// SetSocketOptions sets the socket options of the TCP connections
+// established after the call
+func (c *Client) SetSocketOptions(o SocketOptions) {
+	c.m.Lock()
+	c.sockOpts = o
+	c.m.Unlock()
+}
+
+// SetSocketOptions sets the socket options used by connections
+// established after the call, see Client.SetSocketOptions
+func (p *Pool) SetSocketOptions(o SocketOptions) {
+	p.m.Lock()
+	p.sockOpts = o
+	p.m.Unlock()
+}
+
+// SetLocalAddr sets the source address of the TCP connections
+// established after the call, for hosts with several addresses where
+// the server only accepts some of them. addr is an IP address with
+// an optional port, such as 192.0.2.10 or [2001:db8::10]:0, and an
+// empty addr restores the address chosen by the system.
+func (c *Client) SetLocalAddr(addr string) (err error) {
+	var a *net.TCPAddr
+
+	if a, err = parseLocalAddr(addr); err != nil {
+		return
+	}
+
+	c.m.Lock()
+	c.localAddr = a
+	c.m.Unlock()
+
+	return
+}
+
+// SetLocalAddr sets the source address used by connections
+// established after the call, see Client.SetLocalAddr
+func (p *Pool) SetLocalAddr(addr string) (err error) {
+	var a *net.TCPAddr
+
+	if a, err = parseLocalAddr(addr); err != nil {
+		return
+	}
+
+	p.m.Lock()
+	p.localAddr = a
+	p.m.Unlock()
+
+	return
+}
+
+// netDialer returns the dialer used to connect to the server, it is
+// called with c.m held
+func (c *Client) netDialer() (d *net.Dialer) {
+	d = &net.Dialer{
+		Timeout:   c.connTimeout,
+		KeepAlive: c.keepAlive,
+		Control:   c.sockOpts.Control,
+	}
+	// a TCP source address cannot be used with unix sockets
+	if c.localAddr != nil && strings.HasPrefix(c.network, "tcp") {
+		d.LocalAddr = c.localAddr
+	}
+
+	return
+}
+
+// dialConn establishes a connection using d, sets its socket options
+// and completes the TLS handshake when a TLS config is set. The
+// connection timeout covers both the dial and the handshake.
+func (c *Client) dialConn(ctx context.Context, d *net.Dialer) (conn net.Conn, err error) {
+	if c.connTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.connTimeout)
+		defer cancel()
+	}
+
+	if conn, err = c.dialAddress(ctx, d); err != nil {
+		return
+	}
+
+	if tc, ok := conn.(*net.TCPConn); ok {
+		if err = c.sockOpts.apply(tc); err != nil {
+			conn.Close()
+			conn = nil
+			return
+		}
+	}
+
+	if c.tlsConfig == nil {
+		return
+	}
+
+	config := c.tlsConfig
+	if config.ServerName == "" {
+		host, _, serr := net.SplitHostPort(c.address)
+		if serr != nil {
+			host = c.address
+		}
+		config = config.Clone()
+		// the zone of an IPv6 literal is not part of its name
+		config.ServerName, _ = splitZone(host)
+	}
+
+	tc := tls.Client(conn, config)
+	if err = tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		conn = nil
+		return
+	}
+	conn = tc
+
+	return
+}
+
+// apply sets the options that can only be set once connected
+func (o SocketOptions) apply(tc *net.TCPConn) (err error) {
+	if o.Nagle {
+		if err = tc.SetNoDelay(false); err != nil {
+			return
+		}
+	}
+
+	if o.ReadBuffer > 0 {
+		if err = tc.SetReadBuffer(o.ReadBuffer); err != nil {
+			return
+		}
+	}
+
+	if o.WriteBuffer > 0 {
+		err = tc.SetWriteBuffer(o.WriteBuffer)
+	}
+
+	return
+}
+
+// parseLocalAddr parses an IP address with an optional port, host
+// names are not resolved
+func parseLocalAddr(addr string) (a *net.TCPAddr, err error) {
+	var port int
+
+	if addr == "" {
+		return
+	}
+
+	host, p, serr := net.SplitHostPort(addr)
+	if serr != nil {
+		host, p = strings.Trim(addr, "[]"), "0"
+	}
+
+	a = &net.TCPAddr{}
+	host, a.Zone = splitZone(host)
+	if a.IP = net.ParseIP(host); a.IP == nil {
+		a, err = nil, fmt.Errorf(localAddrErr, addr)
+		return
+	}
+	if port, err = strconv.Atoi(p); err != nil || port < 0 || port > 65535 {
+		a, err = nil, fmt.Errorf(localAddrErr, addr)
+		return
+	}
+	a.Port = port
+
+	return
+}
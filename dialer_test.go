@@ -0,0 +1,154 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestKeepAlive(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	p.SetKeepAlive(30 * time.Second)
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Put(c, nil)
+
+	if d := c.netDialer(); d.KeepAlive != 30*time.Second || d.Timeout != 2*time.Second {
+		t.Errorf("Unexpected dialer settings: %s %s", d.KeepAlive, d.Timeout)
+	}
+	if _, err = c.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	c.SetKeepAlive(-1)
+	if err = c.Dial(context.Background()); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if d := c.netDialer(); d.KeepAlive != -1 {
+		t.Errorf("d.KeepAlive = %s, want -1ns", d.KeepAlive)
+	}
+	if _, err = c.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+}
+
+func TestSocketOptions(t *testing.T) {
+	var calls int32
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	p.SetSocketOptions(SocketOptions{
+		Nagle:       true,
+		ReadBuffer:  256 * 1024,
+		WriteBuffer: 256 * 1024,
+		Control: func(network, address string, c syscall.RawConn) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		},
+	})
+	r, err := p.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("The file should be infected: %+v", r)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("The control function was called %d times, want 1", n)
+	}
+
+	// a failing control function aborts the dial
+	c := &Client{network: ts.Network, address: ts.Addr, connTimeout: time.Second}
+	c.SetSocketOptions(SocketOptions{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return syscall.EPERM
+		},
+	})
+	if _, _, err = c.dial(context.Background()); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	for addr, want := range map[string]string{
+		"":                "<nil>",
+		"127.0.0.1":       "127.0.0.1:0",
+		"127.0.0.1:4000":  "127.0.0.1:4000",
+		"::1":             "[::1]:0",
+		"[::1]:4000":      "[::1]:4000",
+		"fe80::1%eth0":    "[fe80::1%eth0]:0",
+		"localhost":       "",
+		"127.0.0.1:99999": "",
+	} {
+		a, err := parseLocalAddr(addr)
+		if want == "" {
+			if err == nil {
+				t.Errorf("parseLocalAddr(%q) should return an error", addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("An error should not be returned: %s", err)
+			continue
+		}
+		if got := a.String(); got != want {
+			t.Errorf("parseLocalAddr(%q) = %s, want %s", addr, got, want)
+		}
+	}
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	if err = p.SetLocalAddr("localhost"); err == nil {
+		t.Errorf("An error should be returned for a host name")
+	}
+	if err = p.SetLocalAddr("127.0.0.1"); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Put(c, nil)
+	if a, ok := c.conn.LocalAddr().(*net.TCPAddr); !ok || !a.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("The connection should be made from 127.0.0.1: %s", c.conn.LocalAddr())
+	}
+}
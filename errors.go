@@ -0,0 +1,85 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+)
+
+var (
+	// ErrTemporary matches errors that may not recur when the
+	// request is retried, such as timeouts, dropped connections and
+	// a server that is initialising, using errors.Is. Other errors,
+	// such as missing files or encrypted archives, are permanent.
+	ErrTemporary = errors.New("Temporary failure")
+)
+
+// A temporaryError wraps an error that may succeed when retried
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *temporaryError) Unwrap() error {
+	return e.err
+}
+
+func (e *temporaryError) Is(target error) bool {
+	return target == ErrTemporary
+}
+
+// classify wraps err so that it matches ErrTemporary when it is
+// retryable, permanent errors are returned as is
+func classify(err error) error {
+	if err == nil || errors.Is(err, ErrTemporary) || !isTemporary(err) {
+		return err
+	}
+
+	return &temporaryError{err}
+}
+
+// isTemporary reports whether err is a timeout, a dropped or
+// refused connection, a broken session or a DONE FAIL whose code
+// is a failure of the server itself
+func isTemporary(err error) bool {
+	var ne net.Error
+	var de *protocol.DoneError
+
+	for _, e := range []error{
+		io.EOF,
+		io.ErrUnexpectedEOF,
+		ErrServerClosed,
+		ErrProtocolDesync,
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.EPIPE,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	if errors.As(err, &de) {
+		n, perr := strconv.ParseInt(de.Code, 16, 32)
+		return perr == nil && ResultCode(n).Class() == ClassServer
+	}
+
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err       error
+		temporary bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{ErrServerClosed, true},
+		{ErrProtocolDesync, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&protocol.DoneError{Code: "0201", Text: "SAVI is initialising"}, true},
+		{&protocol.DoneError{Code: "0210", Text: "Could not open item passed to SAVI for scanning"}, false},
+		{&protocol.DoneError{Code: "0212", Text: "The item is encrypted"}, false},
+		{&protocol.DoneError{Code: "ZZZZ"}, false},
+		{os.ErrNotExist, false},
+		{ErrNoResult, false},
+		{ErrPoolClosed, false},
+	}
+	for _, tt := range tests {
+		err := classify(tt.err)
+		if got := errors.Is(err, ErrTemporary); got != tt.temporary {
+			t.Errorf("errors.Is(classify(%v), ErrTemporary) = %t, want %t", tt.err, got, tt.temporary)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("classify(%v) should wrap the error", tt.err)
+		}
+		if tt.err != nil && err.Error() != tt.err.Error() {
+			t.Errorf("classify(%v).Error() = %q", tt.err, err.Error())
+		}
+		if again := classify(err); again != err {
+			t.Errorf("classify(%v) should not wrap the error twice", tt.err)
+		}
+	}
+	if err := classify(fmt.Errorf("scan: %w", io.EOF)); !errors.Is(err, ErrTemporary) {
+		t.Errorf("Wrapped errors should be classified: %v", err)
+	}
+}
+
+func TestMockTemporary(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		switch r.Arg {
+		case "/srv/starting":
+			return sssptest.Fail("0201", "SAVI is initialising", r.Arg)
+		case "/srv/locked.zip":
+			return sssptest.Fail("0212", "The item is encrypted", r.Arg)
+		}
+		return sssptest.Bye()
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	var de *protocol.DoneError
+	if _, e = c.ScanFile("/srv/starting"); !errors.Is(e, ErrTemporary) || !errors.As(e, &de) {
+		t.Errorf("A server that is initialising should be temporary: %v", e)
+	}
+	if _, e = c.ScanFile("/srv/locked.zip"); e == nil || errors.Is(e, ErrTemporary) {
+		t.Errorf("An encrypted archive should be permanent: %v", e)
+	}
+	if _, e = c.ScanFile("/srv/bye"); !errors.Is(e, ErrTemporary) || !errors.Is(e, ErrServerClosed) {
+		t.Errorf("A closed session should be temporary: %v", e)
+	}
+	if _, e = c.ScanStream("/nonexistent/file"); e == nil || errors.Is(e, ErrTemporary) {
+		t.Errorf("A missing file should be permanent: %v", e)
+	}
+
+	// Dial returns the network error as is, the commands that fail
+	// with it classify it
+	ts.Close()
+	if e = c.Dial(ctx); e == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if _, ok := e.(*net.OpError); !ok {
+		t.Errorf("Expected *net.OpError got %T: %v", e, e)
+	}
+	if _, e = c.ScanFile("/srv/clean"); !errors.Is(e, ErrTemporary) {
+		t.Errorf("A refused connection should be temporary: %v", e)
+	}
+}
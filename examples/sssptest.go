@@ -14,8 +14,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path"
+	"strconv"
 	"sync"
 	"time"
 
@@ -34,8 +36,10 @@ var (
 
 // Config holds the configuration
 type Config struct {
-	Address string
-	Port    int
+	Address     string
+	Port        int
+	ConnTimeout time.Duration
+	IOTimeout   time.Duration
 }
 
 func init() {
@@ -45,6 +49,10 @@ func init() {
 		`Specify Fprot host to connect to.`)
 	flag.IntVarP(&cfg.Port, "port", "p", 4020,
 		`In TCP/IP mode, connect to Fprot server listening on given port`)
+	flag.DurationVar(&cfg.ConnTimeout, "conn-timeout", 2*time.Second,
+		`Connection timeout.`)
+	flag.DurationVar(&cfg.IOTimeout, "io-timeout", 30*time.Second,
+		`Command timeout.`)
 }
 
 func usage() {
@@ -74,9 +82,9 @@ func main() {
 	flag.ErrHelp = errors.New("")
 	flag.CommandLine.SortFlags = false
 	flag.Parse()
-	address := fmt.Sprintf("%s:%d", cfg.Address, cfg.Port)
+	address := net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port))
 	ctx := context.Background()
-	c, e := sssp.NewClient(ctx, "tcp", address, 2*time.Second, 30*time.Second, 0)
+	c, e := sssp.NewClient(ctx, "tcp", address, cfg.ConnTimeout, cfg.IOTimeout, 0)
 	if e != nil {
 		log.Println(e)
 		return
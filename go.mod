@@ -1,5 +1,12 @@
 module github.com/baruwa-enterprise/sssp
 
-go 1.10
+go 1.17
 
-require github.com/spf13/pflag v1.0.5
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/spf13/pflag v1.0.5
+	go.etcd.io/bbolt v1.3.8
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,119 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"time"
+)
+
+// Hooks holds callbacks invoked on Client lifecycle events, nil
+// callbacks are skipped. The callbacks run on the goroutine that
+// triggered the event, outside the Client lock, so they must be safe
+// for concurrent use and should return quickly.
+type Hooks struct {
+	// OnConnect is called once the connection is established and
+	// the handshake has completed
+	OnConnect func(network, address string)
+	// OnDisconnect is called when the connection is closed by Close
+	// or discarded by a Pool, err is the error that broke it and nil
+	// for a graceful close
+	OnDisconnect func(network, address string, err error)
+	// OnScanStart is called before a scan request is sent, item is
+	// the path scanned or empty for readers and labels those of the
+	// context of the scan, see WithLabels
+	OnScanStart func(cmd Command, item string, labels Labels)
+	// OnScanEnd is called with the outcome of a scan request
+	OnScanEnd func(cmd Command, item string, labels Labels, r []*Response, d time.Duration, err error)
+	// OnRetry is called when a failed connection attempt or, with
+	// Pool.SetScanRetry, a failed request is retried, attempt counts
+	// from 1. The retried connection attempts are reported once Dial
+	// has released the lock.
+	OnRetry func(attempt int, err error)
+}
+
+// A retryEvent is a failed connection attempt that was retried
+type retryEvent struct {
+	attempt int
+	err     error
+}
+
+// SetHooks sets the callbacks invoked on the events of connections
+// established after the call and of requests, nil removes them
+func (c *Client) SetHooks(h *Hooks) {
+	c.m.Lock()
+	c.hooks = h
+	c.m.Unlock()
+}
+
+// SetHooks sets the callbacks used by connections established after
+// the call, see Client.SetHooks
+func (p *Pool) SetHooks(h *Hooks) {
+	p.m.Lock()
+	p.hooks = h
+	p.m.Unlock()
+}
+
+// startScan records the start of a scan request labeled l
+func (c *Client) startScan(cmd Command, item string, l Labels) (start time.Time) {
+	start = time.Now()
+	if c.hooks != nil && c.hooks.OnScanStart != nil {
+		c.hooks.OnScanStart(cmd, item, l)
+	}
+
+	return
+}
+
+// endScan records the outcome of a scan request started at start
+func (c *Client) endScan(cmd Command, item string, l Labels, start time.Time, err error, r ...*Response) {
+	label(l, r...)
+	c.scanned(start, l, err, r...)
+	c.logScan(cmd, item, l, err, r...)
+	if c.hooks != nil && c.hooks.OnScanEnd != nil {
+		c.hooks.OnScanEnd(cmd, item, l, r, time.Since(start), err)
+	}
+}
+
+// connected calls the OnConnect hook if the handshake succeeded
+func (c *Client) connected(err *error) {
+	if *err == nil && c.hooks != nil && c.hooks.OnConnect != nil {
+		c.hooks.OnConnect(c.network, c.address)
+	}
+}
+
+// retrying calls the OnRetry hook
+func (c *Client) retrying(attempt int, err error) {
+	if c.hooks != nil && c.hooks.OnRetry != nil {
+		c.hooks.OnRetry(attempt, err)
+	}
+}
+
+// retried calls the OnRetry hook for the connection attempts that
+// were retried
+func (c *Client) retried(retries *[]retryEvent) {
+	for _, r := range *retries {
+		c.retrying(r.attempt, r.err)
+	}
+}
+
+// closeConn closes the connection and calls the OnDisconnect hook
+// the first time, cause is the error that broke the connection
+func (c *Client) closeConn(cause error) (err error) {
+	c.m.Lock()
+	closed := c.closed
+	c.closed = true
+	c.m.Unlock()
+
+	err = c.tc.Close()
+	if !closed && c.hooks != nil && c.hooks.OnDisconnect != nil {
+		c.hooks.OnDisconnect(c.network, c.address, cause)
+	}
+
+	return
+}
@@ -0,0 +1,148 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+type hookRecorder struct {
+	m      sync.Mutex
+	events []string
+}
+
+func (h *hookRecorder) add(format string, args ...interface{}) {
+	h.m.Lock()
+	h.events = append(h.events, fmt.Sprintf(format, args...))
+	h.m.Unlock()
+}
+
+func (h *hookRecorder) hooks() *Hooks {
+	return &Hooks{
+		OnConnect: func(network, address string) {
+			h.add("connect")
+		},
+		OnDisconnect: func(network, address string, err error) {
+			h.add("disconnect %v", err)
+		},
+		OnScanStart: func(cmd Command, item string, labels Labels) {
+			h.add("start %s %s", cmd, item)
+		},
+		OnScanEnd: func(cmd Command, item string, labels Labels, r []*Response, d time.Duration, err error) {
+			infected := len(r) == 1 && r[0] != nil && r[0].Infected
+			h.add("end %s %s %t %v", cmd, item, infected, err)
+		},
+		OnRetry: func(attempt int, err error) {
+			h.add("retry %d", attempt)
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	h := &hookRecorder{}
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.SetHooks(h.hooks())
+
+	if _, err = p.ScanReader(strings.NewReader(eicarVirus)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.Put(c, io.EOF)
+	if _, err = p.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.Close()
+
+	expected := []string{
+		"connect",
+		"start SCANDATA ",
+		"end SCANDATA  true <nil>",
+		"disconnect EOF",
+		"connect",
+		"start SCANDATA ",
+		"end SCANDATA  false <nil>",
+		"disconnect <nil>",
+	}
+	if strings.Join(h.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("events = %q, want %q", h.events, expected)
+	}
+
+	h.events = nil
+	nc, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	nc.SetHooks(h.hooks())
+	nc.SetHooks(nil)
+	if _, err = nc.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	nc.Close()
+	if len(h.events) != 0 {
+		t.Errorf("Removed hooks should not be called: %q", h.events)
+	}
+}
+
+func TestHooksRetry(t *testing.T) {
+	h := &hookRecorder{}
+
+	ts := sssptest.NewServer(nil)
+	defer ts.Close()
+
+	var ne net.Error
+
+	c := &Client{
+		network:     ts.Network,
+		address:     ts.Addr,
+		connTimeout: time.Second,
+		connRetries: 2,
+		clientOptions: clientOptions{
+			connSleep: time.Millisecond,
+		},
+	}
+	hooks := h.hooks()
+	onRetry := hooks.OnRetry
+	// the hook may use the client, it runs outside the lock
+	hooks.OnRetry = func(attempt int, err error) {
+		c.SetKeepAlive(0)
+		onRetry(attempt, err)
+	}
+	c.SetHooks(hooks)
+	// every attempt times out as the deadline has passed
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	err := c.Dial(ctx)
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("A timeout should be returned: %v", err)
+	}
+	if strings.Join(h.events, ",") != "retry 1,retry 2" {
+		t.Errorf("events = %q, want two retries", h.events)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package httpapi implements a REST gateway to an SSSP server
+SSSP - Golang SSSP protocol implementation
+
+POST /scan streams the request body to the server via SCANDATA
+and returns the JSON verdict, GET /info returns the server and
+virus data information and GET /healthz reports whether the server
+can be reached.
+*/
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	defaultMaxBodySize = 100 * 1024 * 1024
+	tooLargeErr        = "The request body is too large"
+)
+
+// Scanner is the interface used by the gateway, it is
+// implemented by sssp.Pool
+type Scanner interface {
+	ScanSizedReader(io.Reader, int64) (*sssp.Response, error)
+	QueryServer() (sssp.Info, error)
+	QuerySAVI() (sssp.Info, error)
+}
+
+// A ScanResult represents the JSON returned by the scan endpoint
+type ScanResult struct {
+	*sssp.Response
+	Error string `json:"error,omitempty"`
+}
+
+// An InfoResult represents the JSON returned by the info endpoint
+type InfoResult struct {
+	Server sssp.Info `json:"server"`
+	SAVI   sssp.Info `json:"savi"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// A HealthResult represents the JSON returned by the health endpoint
+type HealthResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// A Handler is an http.Handler serving the gateway endpoints
+type Handler struct {
+	scanner     Scanner
+	maxBodySize int64
+	mux         *http.ServeMux
+}
+
+// SetMaxBodySize sets the maximum size of a request body
+// that will be accepted for scanning
+func (h *Handler) SetMaxBodySize(n int64) {
+	if n > 0 {
+		h.maxBodySize = n
+	}
+}
+
+// ServeHTTP dispatches the request to the endpoints
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) scan(w http.ResponseWriter, r *http.Request) {
+	var b []byte
+	var err error
+	var rs *sssp.Response
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, &ScanResult{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+	defer r.Body.Close()
+
+	if r.ContentLength > h.maxBodySize {
+		writeJSON(w, http.StatusRequestEntityTooLarge, &ScanResult{Error: tooLargeErr})
+		return
+	}
+
+	if r.ContentLength >= 0 {
+		rs, err = h.scanner.ScanSizedReader(r.Body, r.ContentLength)
+	} else {
+		// the length is unknown so the body has to be spooled
+		if b, err = ioutil.ReadAll(io.LimitReader(r.Body, h.maxBodySize+1)); err != nil {
+			writeJSON(w, http.StatusBadRequest, &ScanResult{Error: err.Error()})
+			return
+		}
+		if int64(len(b)) > h.maxBodySize {
+			writeJSON(w, http.StatusRequestEntityTooLarge, &ScanResult{Error: tooLargeErr})
+			return
+		}
+		rs, err = h.scanner.ScanSizedReader(bytes.NewReader(b), int64(len(b)))
+	}
+
+	res := &ScanResult{Response: rs}
+	status := http.StatusOK
+	if err != nil {
+		// the verdict is incomplete even when a response came back
+		res.Error = err.Error()
+		status = http.StatusBadGateway
+	}
+
+	writeJSON(w, status, res)
+}
+
+func (h *Handler) info(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, &InfoResult{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	res := &InfoResult{}
+	if res.Server, err = h.scanner.QueryServer(); err == nil {
+		res.SAVI, err = h.scanner.QuerySAVI()
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		res.Error = err.Error()
+		status = http.StatusBadGateway
+	}
+
+	writeJSON(w, status, res)
+}
+
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, &HealthResult{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	res := &HealthResult{Status: "ok"}
+	status := http.StatusOK
+	if _, err := h.scanner.QueryServer(); err != nil {
+		res.Status = "unavailable"
+		res.Error = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, res)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// NewHandler creates and returns a new Handler that uses s
+func NewHandler(s Scanner) (h *Handler) {
+	h = &Handler{
+		scanner:     s,
+		maxBodySize: defaultMaxBodySize,
+		mux:         http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/scan", h.scan)
+	h.mux.HandleFunc("/info", h.info)
+	h.mux.HandleFunc("/healthz", h.healthz)
+
+	return
+}
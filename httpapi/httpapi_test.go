@@ -0,0 +1,185 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package httpapi implements a REST gateway to an SSSP server
+SSSP - Golang SSSP protocol implementation
+*/
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+func setup(t *testing.T) (ts *sssptest.Server, p *sssp.Pool, hs *httptest.Server) {
+	var err error
+
+	ts = sssptest.NewServer(sssptest.DefaultHandler)
+	if p, err = sssp.NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	h := NewHandler(p)
+	h.SetMaxBodySize(1024)
+	hs = httptest.NewServer(h)
+
+	return
+}
+
+func TestScan(t *testing.T) {
+	var res ScanResult
+
+	ts, p, hs := setup(t)
+	defer ts.Close()
+	defer p.Close()
+	defer hs.Close()
+
+	resp, err := http.Post(hs.URL+"/scan", "application/octet-stream", strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("resp.StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !res.Infected || res.Signature != sssptest.EicarSignature {
+		t.Errorf("Unexpected result: %+v", res.Response)
+	}
+
+	resp, err = http.Post(hs.URL+"/scan", "application/octet-stream", strings.NewReader(strings.Repeat("x", 2048)))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("resp.StatusCode = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("clean"))
+		pw.Close()
+	}()
+	resp, err = http.Post(hs.URL+"/scan", "application/octet-stream", pr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	res = ScanResult{}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if res.Response == nil || res.Infected {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+
+	resp, err = http.Get(hs.URL + "/scan")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("resp.StatusCode = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	var res ScanResult
+
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		return sssptest.Fail("0212", "The item is encrypted", "")
+	})
+	defer ts.Close()
+	p, err := sssp.NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	hs := httptest.NewServer(NewHandler(p))
+	defer hs.Close()
+
+	resp, err := http.Post(hs.URL+"/scan", "application/octet-stream", strings.NewReader("locked"))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("resp.StatusCode = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if res.Error == "" {
+		t.Errorf("The scan error should be returned: %+v", res)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	var res InfoResult
+
+	ts, p, hs := setup(t)
+	defer ts.Close()
+	defer p.Close()
+	defer hs.Close()
+
+	resp, err := http.Get(hs.URL + "/info")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if res.Server.Get("version") == "" || res.SAVI.Get("virusdatadate") == "" {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	var res HealthResult
+
+	ts, p, hs := setup(t)
+	defer ts.Close()
+	defer p.Close()
+	defer hs.Close()
+
+	resp, err := http.Get(hs.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || res.Status != "ok" {
+		t.Errorf("Unexpected result: %d %+v", resp.StatusCode, res)
+	}
+
+	ts.Close()
+	p.Close()
+	resp, err = http.Get(hs.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("resp.StatusCode = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
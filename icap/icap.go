@@ -0,0 +1,562 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package icap implements an ICAP server that scans message bodies via SSSP
+SSSP - Golang SSSP protocol implementation
+
+The server supports the OPTIONS, REQMOD and RESPMOD methods (RFC 3507)
+including previews, clean messages are returned unmodified or with a
+204 when permitted, infected messages are replaced with a 403 response.
+*/
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	icapVersion        = "ICAP/1.0"
+	defaultService     = "avscan"
+	defaultISTag       = "SSSP-1"
+	defaultMaxBodySize = 100 * 1024 * 1024
+	defaultIdleTimeout = 5 * time.Minute
+	blockedBody        = "The requested content was blocked because it contains the virus: %s\n"
+	invalidReqErr      = "Invalid ICAP request: %s"
+	invalidEncapErr    = "Invalid Encapsulated header: %s"
+	invalidChunkErr    = "Invalid chunk size: %s"
+	maxHeaderSize      = 64 * 1024
+)
+
+var (
+	// ErrServerClosed is returned by Serve after Close is called
+	ErrServerClosed = errors.New("icap: Server closed")
+	// ErrTooLarge is returned when a body exceeds the maximum size
+	ErrTooLarge = errors.New("icap: The message body is too large")
+)
+
+// Scanner is the interface used by the server, it is
+// implemented by sssp.Client and sssp.Pool
+type Scanner interface {
+	ScanSizedReader(io.Reader, int64) (*sssp.Response, error)
+}
+
+// A Server is an ICAP server
+type Server struct {
+	scanner     Scanner
+	service     string
+	istag       string
+	maxBodySize int64
+	idleTimeout time.Duration
+	m           sync.Mutex
+	wg          sync.WaitGroup
+	listeners   map[net.Listener]bool
+	conns       map[net.Conn]bool
+	closed      bool
+}
+
+type section struct {
+	name   string
+	offset int
+}
+
+type request struct {
+	method  string
+	uri     *url.URL
+	header  textproto.MIMEHeader
+	encap   []section
+	hdrs    []byte
+	body    []byte
+	hasBody bool
+	allow   bool
+}
+
+// SetService sets the name of the service, requests are
+// accepted on icap://host/<service>
+func (s *Server) SetService(n string) {
+	if n != "" {
+		s.service = strings.Trim(n, "/")
+	}
+}
+
+// SetISTag sets the service tag returned to clients, it
+// should be changed whenever the virus data is updated
+func (s *Server) SetISTag(t string) {
+	if t != "" {
+		s.istag = t
+	}
+}
+
+// SetMaxBodySize sets the maximum size of a message body
+// that will be accepted for scanning
+func (s *Server) SetMaxBodySize(n int64) {
+	if n > 0 {
+		s.maxBodySize = n
+	}
+}
+
+// SetIdleTimeout sets the time an idle connection is kept open
+func (s *Server) SetIdleTimeout(t time.Duration) {
+	if t > 0 {
+		s.idleTimeout = t
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves
+// ICAP requests
+func (s *Server) ListenAndServe(addr string) (err error) {
+	var l net.Listener
+
+	if addr == "" {
+		addr = ":1344"
+	}
+
+	if l, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	err = s.Serve(l)
+
+	return
+}
+
+// Serve accepts connections on l and serves ICAP requests,
+// it always returns a non nil error
+func (s *Server) Serve(l net.Listener) (err error) {
+	var c net.Conn
+
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		l.Close()
+		err = ErrServerClosed
+		return
+	}
+	s.listeners[l] = true
+	s.m.Unlock()
+
+	defer func() {
+		s.m.Lock()
+		delete(s.listeners, l)
+		s.m.Unlock()
+		l.Close()
+	}()
+
+	for {
+		if c, err = l.Accept(); err != nil {
+			s.m.Lock()
+			if s.closed {
+				err = ErrServerClosed
+			}
+			s.m.Unlock()
+			return
+		}
+
+		s.m.Lock()
+		if s.closed {
+			s.m.Unlock()
+			c.Close()
+			err = ErrServerClosed
+			return
+		}
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.m.Unlock()
+
+		go s.handle(c)
+	}
+}
+
+// Close stops the listeners, closes the open connections
+// and waits for the handlers to return
+func (s *Server) Close() (err error) {
+	s.m.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.m.Unlock()
+
+	s.wg.Wait()
+
+	return
+}
+
+func (s *Server) handle(c net.Conn) {
+	var err error
+	var req *request
+
+	defer func() {
+		c.Close()
+		s.m.Lock()
+		delete(s.conns, c)
+		s.m.Unlock()
+		s.wg.Done()
+	}()
+
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+
+	for {
+		c.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		if req, err = s.readRequest(br, bw); err != nil {
+			if err != io.EOF {
+				status := 400
+				if err == ErrTooLarge {
+					status = 413
+				}
+				s.writeStatus(bw, status, nil)
+				bw.Flush()
+			}
+			return
+		}
+		c.SetReadDeadline(time.Time{})
+
+		if err = s.serveRequest(bw, req); err != nil {
+			return
+		}
+		if err = bw.Flush(); err != nil {
+			return
+		}
+
+		if strings.EqualFold(req.header.Get("Connection"), "close") {
+			return
+		}
+	}
+}
+
+func (s *Server) readRequest(br *bufio.Reader, bw *bufio.Writer) (req *request, err error) {
+	var line string
+	var ieof bool
+
+	tr := textproto.NewReader(br)
+	if line, err = tr.ReadLine(); err != nil {
+		return
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[2] != icapVersion {
+		err = fmt.Errorf(invalidReqErr, line)
+		return
+	}
+
+	req = &request{method: parts[0]}
+	if req.uri, err = url.Parse(parts[1]); err != nil {
+		return
+	}
+
+	if req.header, err = tr.ReadMIMEHeader(); err != nil {
+		return
+	}
+
+	for _, v := range strings.Split(req.header.Get("Allow"), ",") {
+		if strings.TrimSpace(v) == "204" {
+			req.allow = true
+		}
+	}
+
+	if req.encap, err = parseEncapsulated(req.header.Get("Encapsulated")); err != nil {
+		return
+	}
+
+	if len(req.encap) == 0 {
+		return
+	}
+
+	last := req.encap[len(req.encap)-1]
+	if last.offset > maxHeaderSize {
+		err = ErrTooLarge
+		return
+	}
+	req.hdrs = make([]byte, last.offset)
+	if _, err = io.ReadFull(br, req.hdrs); err != nil {
+		return
+	}
+
+	if !strings.HasSuffix(last.name, "-body") || last.name == "null-body" {
+		return
+	}
+
+	req.hasBody = true
+	buf := &bytes.Buffer{}
+	if ieof, err = s.readChunks(br, buf); err != nil {
+		return
+	}
+
+	if req.header.Get("Preview") != "" {
+		// 204 is always permitted in response to a preview
+		req.allow = true
+		if !ieof {
+			if _, err = bw.WriteString(icapVersion + " 100 Continue\r\n\r\n"); err != nil {
+				return
+			}
+			if err = bw.Flush(); err != nil {
+				return
+			}
+			if _, err = s.readChunks(br, buf); err != nil {
+				return
+			}
+		}
+	}
+
+	req.body = buf.Bytes()
+
+	return
+}
+
+func (s *Server) readChunks(br *bufio.Reader, w *bytes.Buffer) (ieof bool, err error) {
+	var n int64
+	var line string
+
+	tr := textproto.NewReader(br)
+	for {
+		if line, err = tr.ReadLine(); err != nil {
+			return
+		}
+
+		size := line
+		if i := strings.IndexByte(line, ';'); i != -1 {
+			size = line[:i]
+			ieof = strings.TrimSpace(line[i+1:]) == "ieof"
+		}
+
+		if n, err = strconv.ParseInt(strings.TrimSpace(size), 16, 64); err != nil || n < 0 {
+			err = fmt.Errorf(invalidChunkErr, line)
+			return
+		}
+
+		if n == 0 {
+			// skip the trailer
+			for {
+				if line, err = tr.ReadLine(); err != nil || line == "" {
+					return
+				}
+			}
+		}
+
+		if int64(w.Len())+n > s.maxBodySize {
+			err = ErrTooLarge
+			return
+		}
+
+		if _, err = io.CopyN(w, br, n); err != nil {
+			return
+		}
+
+		if line, err = tr.ReadLine(); err != nil {
+			return
+		}
+		if line != "" {
+			err = fmt.Errorf(invalidChunkErr, line)
+			return
+		}
+	}
+}
+
+func (s *Server) serveRequest(bw *bufio.Writer, req *request) (err error) {
+	var rs *sssp.Response
+
+	if strings.Trim(req.uri.Path, "/") != s.service {
+		return s.writeStatus(bw, 404, nil)
+	}
+
+	switch req.method {
+	case "OPTIONS":
+		return s.writeStatus(bw, 200, [][2]string{
+			{"Methods", "REQMOD, RESPMOD"},
+			{"Service", "SSSP ICAP Service"},
+			{"Allow", "204"},
+			{"Preview", "0"},
+			{"Transfer-Preview", "*"},
+			{"Options-TTL", "3600"},
+			{"Encapsulated", "null-body=0"},
+		})
+	case "REQMOD", "RESPMOD":
+	default:
+		return s.writeStatus(bw, 405, nil)
+	}
+
+	if req.hasBody && len(req.body) > 0 {
+		if rs, err = s.scanner.ScanSizedReader(bytes.NewReader(req.body), int64(len(req.body))); err != nil || rs.ErrorOccured {
+			// a body that could not be scanned is never let through
+			return s.writeStatus(bw, 500, nil)
+		}
+	}
+
+	if rs != nil && rs.Infected {
+		return s.writeBlocked(bw, req, rs)
+	}
+
+	if req.allow {
+		return s.writeStatus(bw, 204, [][2]string{{"Encapsulated", "null-body=0"}})
+	}
+
+	return s.writeEcho(bw, req)
+}
+
+func (s *Server) writeStatus(bw *bufio.Writer, code int, hdrs [][2]string) (err error) {
+	fmt.Fprintf(bw, "%s %d %s\r\n", icapVersion, code, statusText(code))
+	fmt.Fprintf(bw, "ISTag: \"%s\"\r\n", s.istag)
+	for _, h := range hdrs {
+		fmt.Fprintf(bw, "%s: %s\r\n", h[0], h[1])
+	}
+	if code >= 400 {
+		fmt.Fprintf(bw, "Encapsulated: null-body=0\r\n")
+	}
+	_, err = bw.WriteString("\r\n")
+
+	return
+}
+
+func (s *Server) writeBlocked(bw *bufio.Writer, req *request, rs *sssp.Response) (err error) {
+	body := fmt.Sprintf(blockedBody, rs.Signature)
+	hdr := fmt.Sprintf("HTTP/1.1 403 Forbidden\r\nContent-Type: text/plain\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", len(body))
+
+	if err = s.writeStatus(bw, 200, [][2]string{
+		{"X-Infection-Found", fmt.Sprintf("Type=0; Resolution=2; Threat=%s;", rs.Signature)},
+		{"X-Virus-ID", rs.Signature},
+		{"Encapsulated", fmt.Sprintf("res-hdr=0, res-body=%d", len(hdr))},
+	}); err != nil {
+		return
+	}
+
+	bw.WriteString(hdr)
+	err = writeChunk(bw, []byte(body))
+
+	return
+}
+
+func (s *Server) writeEcho(bw *bufio.Writer, req *request) (err error) {
+	var hdrs []byte
+	var encap []string
+
+	want := "req-hdr"
+	if req.method == "RESPMOD" {
+		want = "res-hdr"
+	}
+
+	for i, sec := range req.encap {
+		if sec.name != want {
+			continue
+		}
+		end := len(req.hdrs)
+		if i+1 < len(req.encap) {
+			end = req.encap[i+1].offset
+		}
+		if sec.offset > end || end > len(req.hdrs) {
+			return s.writeStatus(bw, 400, nil)
+		}
+		encap = append(encap, fmt.Sprintf("%s=0", want))
+		hdrs = req.hdrs[sec.offset:end]
+	}
+
+	bodyName := "req-body"
+	if req.method == "RESPMOD" {
+		bodyName = "res-body"
+	}
+	if !req.hasBody {
+		bodyName = "null-body"
+	}
+	encap = append(encap, fmt.Sprintf("%s=%d", bodyName, len(hdrs)))
+
+	if err = s.writeStatus(bw, 200, [][2]string{{"Encapsulated", strings.Join(encap, ", ")}}); err != nil {
+		return
+	}
+
+	bw.Write(hdrs)
+	if req.hasBody {
+		err = writeChunk(bw, req.body)
+	}
+
+	return
+}
+
+func writeChunk(bw *bufio.Writer, b []byte) (err error) {
+	if len(b) > 0 {
+		fmt.Fprintf(bw, "%x\r\n", len(b))
+		bw.Write(b)
+		bw.WriteString("\r\n")
+	}
+	_, err = bw.WriteString("0\r\n\r\n")
+
+	return
+}
+
+func parseEncapsulated(v string) (s []section, err error) {
+	var n int
+
+	if v == "" {
+		return
+	}
+
+	for _, p := range strings.Split(v, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf(invalidEncapErr, v)
+			return
+		}
+		if n, err = strconv.Atoi(kv[1]); err != nil || n < 0 || (len(s) > 0 && n < s[len(s)-1].offset) {
+			err = fmt.Errorf(invalidEncapErr, v)
+			return
+		}
+		s = append(s, section{name: strings.ToLower(kv[0]), offset: n})
+	}
+
+	return
+}
+
+func statusText(code int) string {
+	switch code {
+	case 100:
+		return "Continue"
+	case 200:
+		return "OK"
+	case 204:
+		return "No Content"
+	case 400:
+		return "Bad Request"
+	case 404:
+		return "ICAP Service Not Found"
+	case 405:
+		return "Method Not Allowed"
+	case 413:
+		return "Request Entity Too Large"
+	case 500:
+		return "Server Error"
+	}
+
+	return "Unknown"
+}
+
+// NewServer creates and returns a new Server that uses s
+func NewServer(s Scanner) (srv *Server) {
+	srv = &Server{
+		scanner:     s,
+		service:     defaultService,
+		istag:       defaultISTag,
+		maxBodySize: defaultMaxBodySize,
+		idleTimeout: defaultIdleTimeout,
+		listeners:   make(map[net.Listener]bool),
+		conns:       make(map[net.Conn]bool),
+	}
+
+	return
+}
@@ -0,0 +1,295 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package icap implements an ICAP server that scans message bodies via SSSP
+SSSP - Golang SSSP protocol implementation
+*/
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+	reqHdr     = "GET /file HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	resHdr     = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n"
+)
+
+type icapResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   string
+}
+
+func setup(t *testing.T) (ts *sssptest.Server, p *sssp.Pool, srv *Server, addr string) {
+	var err error
+	var l net.Listener
+
+	ts = sssptest.NewServer(sssptest.DefaultHandler)
+	if p, err = sssp.NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	srv = NewServer(p)
+	srv.SetMaxBodySize(1024)
+	addr = l.Addr().String()
+	go srv.Serve(l)
+
+	return
+}
+
+func respmod(addr, hdrs, body string, allow bool) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "RESPMOD icap://%s/avscan ICAP/1.0\r\nHost: %s\r\n", addr, addr)
+	if allow {
+		b.WriteString("Allow: 204\r\n")
+	}
+	fmt.Fprintf(&b, "Encapsulated: req-hdr=0, res-hdr=%d, res-body=%d\r\n\r\n", len(reqHdr), len(reqHdr)+len(hdrs))
+	b.WriteString(reqHdr)
+	b.WriteString(hdrs)
+	fmt.Fprintf(&b, "%x\r\n%s\r\n0\r\n\r\n", len(body), body)
+
+	return b.String()
+}
+
+func readResponse(t *testing.T, br *bufio.Reader) (r *icapResponse) {
+	var line string
+	var err error
+
+	tr := textproto.NewReader(br)
+	if line, err = tr.ReadLine(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r = &icapResponse{}
+	if _, err = fmt.Sscanf(line, "ICAP/1.0 %d", &r.status); err != nil {
+		t.Fatalf("Invalid status line: %q", line)
+	}
+	if r.header, err = tr.ReadMIMEHeader(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	encap, err := parseEncapsulated(r.header.Get("Encapsulated"))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(encap) == 0 || encap[len(encap)-1].name == "null-body" {
+		if len(encap) > 0 && encap[len(encap)-1].offset > 0 {
+			io.CopyN(ioutil.Discard, br, int64(encap[len(encap)-1].offset))
+		}
+		return
+	}
+	hdrs := make([]byte, encap[len(encap)-1].offset)
+	if _, err = io.ReadFull(br, hdrs); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	srv := &Server{maxBodySize: defaultMaxBodySize}
+	buf := &bytes.Buffer{}
+	if _, err = srv.readChunks(br, buf); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r.body = string(hdrs) + buf.String()
+
+	return
+}
+
+func TestParseEncapsulated(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []section
+		err bool
+	}{
+		{"", nil, false},
+		{"null-body=0", []section{{"null-body", 0}}, false},
+		{"req-hdr=0, res-hdr=137, res-body=296", []section{{"req-hdr", 0}, {"res-hdr", 137}, {"res-body", 296}}, false},
+		{"req-hdr=10, res-body=5", nil, true},
+		{"req-hdr", nil, true},
+		{"req-hdr=x", nil, true},
+	}
+	for _, tt := range tests {
+		s, err := parseEncapsulated(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseEncapsulated(%q) should return an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEncapsulated(%q) returned error: %s", tt.in, err)
+			continue
+		}
+		if fmt.Sprint(s) != fmt.Sprint(tt.out) {
+			t.Errorf("parseEncapsulated(%q) = %v, want %v", tt.in, s, tt.out)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	ts, p, srv, addr := setup(t)
+	defer ts.Close()
+	defer p.Close()
+	defer srv.Close()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+
+	fmt.Fprintf(c, "OPTIONS icap://%s/avscan ICAP/1.0\r\nHost: %s\r\n\r\n", addr, addr)
+	r := readResponse(t, br)
+	if r.status != 200 {
+		t.Errorf("r.status = %d, want %d", r.status, 200)
+	}
+	if r.header.Get("Methods") != "REQMOD, RESPMOD" {
+		t.Errorf("Methods = %q", r.header.Get("Methods"))
+	}
+	if r.header.Get("ISTag") == "" {
+		t.Errorf("The ISTag header should be set")
+	}
+
+	fmt.Fprintf(c, "OPTIONS icap://%s/missing ICAP/1.0\r\nHost: %s\r\n\r\n", addr, addr)
+	if r = readResponse(t, br); r.status != 404 {
+		t.Errorf("r.status = %d, want %d", r.status, 404)
+	}
+}
+
+func TestRespmod(t *testing.T) {
+	ts, p, srv, addr := setup(t)
+	defer ts.Close()
+	defer p.Close()
+	defer srv.Close()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+
+	io.WriteString(c, respmod(addr, resHdr, "clean content", true))
+	r := readResponse(t, br)
+	if r.status != 204 {
+		t.Errorf("r.status = %d, want %d", r.status, 204)
+	}
+
+	io.WriteString(c, respmod(addr, resHdr, "clean content", false))
+	r = readResponse(t, br)
+	if r.status != 200 {
+		t.Errorf("r.status = %d, want %d", r.status, 200)
+	}
+	if r.body != resHdr+"clean content" {
+		t.Errorf("The message should be returned unmodified: %q", r.body)
+	}
+
+	io.WriteString(c, respmod(addr, resHdr, eicarVirus, true))
+	r = readResponse(t, br)
+	if r.status != 200 {
+		t.Errorf("r.status = %d, want %d", r.status, 200)
+	}
+	if r.header.Get("X-Virus-ID") != sssptest.EicarSignature {
+		t.Errorf("X-Virus-ID = %q, want %q", r.header.Get("X-Virus-ID"), sssptest.EicarSignature)
+	}
+	if !strings.HasPrefix(r.body, "HTTP/1.1 403 Forbidden") || !strings.Contains(r.body, sssptest.EicarSignature) {
+		t.Errorf("Unexpected body: %q", r.body)
+	}
+
+	io.WriteString(c, respmod(addr, resHdr, strings.Repeat("x", 2048), true))
+	if r = readResponse(t, br); r.status != 413 {
+		t.Errorf("r.status = %d, want %d", r.status, 413)
+	}
+}
+
+func TestReqmodPreview(t *testing.T) {
+	ts, p, srv, addr := setup(t)
+	defer ts.Close()
+	defer p.Close()
+	defer srv.Close()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	tr := textproto.NewReader(br)
+
+	hdr := "POST /upload HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	fmt.Fprintf(c, "REQMOD icap://%s/avscan ICAP/1.0\r\nHost: %s\r\nPreview: 4\r\nEncapsulated: req-hdr=0, req-body=%d\r\n\r\n%s", addr, addr, len(hdr), hdr)
+	fmt.Fprintf(c, "4\r\n%s\r\n0\r\n\r\n", eicarVirus[:4])
+
+	line, err := tr.ReadLine()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if line != "ICAP/1.0 100 Continue" {
+		t.Fatalf("Expected a 100 Continue got %q", line)
+	}
+	tr.ReadLine()
+
+	fmt.Fprintf(c, "%x\r\n%s\r\n0\r\n\r\n", len(eicarVirus)-4, eicarVirus[4:])
+	r := readResponse(t, br)
+	if r.status != 200 || r.header.Get("X-Virus-ID") != sssptest.EicarSignature {
+		t.Errorf("Unexpected response: %d %v", r.status, r.header)
+	}
+
+	fmt.Fprintf(c, "REQMOD icap://%s/avscan ICAP/1.0\r\nHost: %s\r\nPreview: 4\r\nEncapsulated: req-hdr=0, req-body=%d\r\n\r\n%s", addr, addr, len(hdr), hdr)
+	io.WriteString(c, "4\r\nokay\r\n0; ieof\r\n\r\n")
+	if r = readResponse(t, br); r.status != 204 {
+		t.Errorf("r.status = %d, want %d", r.status, 204)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if strings.Contains(string(r.Data), "slow") {
+			return &sssptest.Reply{Lines: []string{"DONE OK 0000 The scan made no errors"}, Delay: time.Second}
+		}
+		return sssptest.Fail("0211", "Unable to scan", "/tmp/file")
+	})
+	defer ts.Close()
+
+	p, err := sssp.NewPool(ts.Network, ts.Addr, 2*time.Second, 200*time.Millisecond, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	srv := NewServer(p)
+	defer srv.Close()
+	addr := l.Addr().String()
+	go srv.Serve(l)
+
+	for _, body := range []string{"failed content", "slow content"} {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		io.WriteString(c, respmod(addr, resHdr, body, true))
+		if r := readResponse(t, bufio.NewReader(c)); r.status != 500 {
+			t.Errorf("r.status = %d, want %d for %q", r.status, 500, body)
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"time"
+)
+
+// Labels are key/value pairs attached to a scan, such as the message
+// id, tenant or queue id of the mail being scanned, they are passed
+// to the hooks, logs and labeled metrics sinks and set on the
+// responses so that results can be correlated with their origin
+type Labels map[string]string
+
+// A LabeledMetricsSink is a MetricsSink that also receives the labels
+// of the scan the metrics belong to, the scan metrics of labeled scans
+// are passed to the labeled methods instead of the plain ones. Labels
+// such as message ids have a high cardinality so sinks usually keep
+// a subset of them.
+type LabeledMetricsSink interface {
+	MetricsSink
+	// IncCounterLabels adds delta to the counter name
+	IncCounterLabels(name string, delta int64, labels Labels)
+	// ObserveDurationLabels records a duration for name
+	ObserveDurationLabels(name string, d time.Duration, labels Labels)
+}
+
+type labelsKey struct{}
+
+// WithLabels returns a copy of ctx carrying l merged with the labels
+// already in ctx, the values in l take precedence. The scan methods
+// taking a context attach them to the scan.
+func WithLabels(ctx context.Context, l Labels) context.Context {
+	parent := LabelsFromContext(ctx)
+	merged := make(Labels, len(parent)+len(l))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range l {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, labelsKey{}, merged)
+}
+
+// LabelsFromContext returns the labels carried by ctx, nil is
+// returned when there are none, the labels must not be modified
+func LabelsFromContext(ctx context.Context) (l Labels) {
+	l, _ = ctx.Value(labelsKey{}).(Labels)
+
+	return
+}
+
+// countLabels adds n to the counter name of a scan labeled l
+func (c *Client) countLabels(name string, n int64, l Labels) {
+	if ls, ok := c.sink.(LabeledMetricsSink); ok && l != nil {
+		statVars[name].Add(n)
+		ls.IncCounterLabels(name, n, l)
+		return
+	}
+
+	c.count(name, n)
+}
+
+// observeLabels records the duration since start for name of a scan
+// labeled l
+func (c *Client) observeLabels(name string, start time.Time, l Labels) {
+	if ls, ok := c.sink.(LabeledMetricsSink); ok && l != nil {
+		ls.ObserveDurationLabels(name, time.Since(start), l)
+		return
+	}
+
+	c.observe(name, start)
+}
+
+// label sets the labels of the responses in r
+func label(l Labels, r ...*Response) {
+	if l == nil {
+		return
+	}
+
+	for _, rs := range r {
+		if rs != nil {
+			rs.Labels = l
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+type labeledSink struct {
+	recordingSink
+	labeled map[string]int64
+}
+
+func (s *labeledSink) IncCounterLabels(name string, delta int64, l Labels) {
+	s.m.Lock()
+	s.labeled[name+":"+l["tenant"]] += delta
+	s.m.Unlock()
+}
+
+func (s *labeledSink) ObserveDurationLabels(name string, d time.Duration, l Labels) {
+	s.m.Lock()
+	s.labeled[name+":"+l["tenant"]]++
+	s.m.Unlock()
+}
+
+func TestWithLabels(t *testing.T) {
+	ctx := context.Background()
+	if l := LabelsFromContext(ctx); l != nil {
+		t.Errorf("A context without labels should return nil: %v", l)
+	}
+
+	parent := WithLabels(ctx, Labels{"tenant": "acme", "queue-id": "4F2A"})
+	child := WithLabels(parent, Labels{"queue-id": "4F2B", "message-id": "<a@b>"})
+
+	l := LabelsFromContext(child)
+	if len(l) != 3 || l["tenant"] != "acme" || l["queue-id"] != "4F2B" || l["message-id"] != "<a@b>" {
+		t.Errorf("Unexpected labels: %v", l)
+	}
+	if pl := LabelsFromContext(parent); pl["queue-id"] != "4F2A" || len(pl) != 2 {
+		t.Errorf("The parent labels should not be modified: %v", pl)
+	}
+}
+
+func TestScanLabels(t *testing.T) {
+	h := &hookRecorder{}
+	sink := &labeledSink{
+		recordingSink: recordingSink{counters: make(map[string]int64), durations: make(map[string]int)},
+		labeled:       make(map[string]int64),
+	}
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	hooks := h.hooks()
+	hooks.OnScanStart = func(cmd Command, item string, l Labels) {
+		h.add("start %s %s", cmd, l["message-id"])
+	}
+	p.SetHooks(hooks)
+	p.SetMetricsSink(sink)
+
+	ctx := WithLabels(context.Background(), Labels{"tenant": "acme", "message-id": "<a@b>"})
+	r, err := p.ScanReaderContext(ctx, strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if r.Labels["message-id"] != "<a@b>" {
+		t.Errorf("The labels should be set on the response: %v", r.Labels)
+	}
+	if r, err = p.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if r.Labels != nil {
+		t.Errorf("Unlabeled scans should have no labels: %v", r.Labels)
+	}
+
+	if len(h.events) < 2 || h.events[1] != "start SCANDATA <a@b>" {
+		t.Errorf("The hooks should receive the labels: %q", h.events)
+	}
+	if sink.labeled["scans:acme"] != 1 || sink.labeled["infections:acme"] != 1 || sink.labeled["scan_duration:acme"] != 1 {
+		t.Errorf("Labeled scans should be passed to the labeled methods: %v", sink.labeled)
+	}
+	if sink.counters[MetricScans] != 1 || sink.counters[MetricInfections] != 0 {
+		t.Errorf("Unlabeled scans should be passed to the plain methods: %v", sink.counters)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Put(c, nil)
+	if _, err = c.ScanReaderContext(canceled, strings.NewReader("clean")); err != context.Canceled {
+		t.Errorf("c.ScanReaderContext() error = %v, want %v", err, context.Canceled)
+	}
+}
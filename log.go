@@ -0,0 +1,80 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+// Attribute keys used by the records emitted by a Client
+const (
+	LogKeyNetwork   = "network"
+	LogKeyAddress   = "address"
+	LogKeyAttempt   = "attempt"
+	LogKeyDuration  = "duration"
+	LogKeyError     = "error"
+	LogKeyRequestID = "request_id"
+	LogKeyCommand   = "command"
+	LogKeyFile      = "file"
+	LogKeyInfected  = "infected"
+	LogKeySignature = "signature"
+	LogKeyLine      = "line"
+	LogKeyLabels    = "labels"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// eventLogger receives the records emitted by a Client, args are
+// alternating attribute keys and values
+type eventLogger interface {
+	logEvent(level logLevel, msg string, args ...interface{})
+}
+
+// logEvent emits a record if a logger is set
+func (c *Client) logEvent(level logLevel, msg string, args ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+
+	c.logger.logEvent(level, msg, append(args, LogKeyNetwork, c.network, LogKeyAddress, c.address)...)
+}
+
+// logScan emits the result of a scan request, infected files are
+// logged at the info level and failed requests as warnings
+func (c *Client) logScan(cmd Command, p string, l Labels, err error, r ...*Response) {
+	if c.logger == nil {
+		return
+	}
+
+	var labels []interface{}
+	if l != nil {
+		labels = []interface{}{LogKeyLabels, l}
+	}
+
+	if err != nil {
+		c.logEvent(levelWarn, "scan failed", append([]interface{}{LogKeyCommand, cmd.String(), LogKeyFile, p, LogKeyError, err}, labels...)...)
+		return
+	}
+
+	for _, rs := range r {
+		if rs == nil {
+			continue
+		}
+		level := levelDebug
+		if rs.Infected || rs.ErrorOccured {
+			level = levelInfo
+		}
+		c.logEvent(level, "scan completed", append([]interface{}{LogKeyCommand, cmd.String(), LogKeyFile, rs.Filename,
+			LogKeyInfected, rs.Infected, LogKeySignature, rs.Signature}, labels...)...)
+	}
+}
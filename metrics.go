@@ -0,0 +1,138 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+const (
+	expvarPrefix = "sssp."
+)
+
+// Names of the metrics passed to a MetricsSink
+const (
+	// MetricScans counts scan requests
+	MetricScans = "scans"
+	// MetricInfections counts infected files
+	MetricInfections = "infections"
+	// MetricErrors counts failed requests and files that could
+	// not be scanned
+	MetricErrors = "errors"
+	// MetricReconnects counts connections replaced after a failure
+	MetricReconnects = "reconnects"
+	// MetricBytes counts the bytes uploaded by stream scans
+	MetricBytes = "bytes"
+	// MetricScanDuration observes the duration of scan requests
+	MetricScanDuration = "scan_duration"
+	// MetricDialDuration observes the time taken to connect and
+	// complete the handshake
+	MetricDialDuration = "dial_duration"
+)
+
+// A MetricsSink receives the metrics of a Client, adapters for
+// Prometheus and StatsD are in the metrics subpackages. It must be
+// safe for concurrent use.
+type MetricsSink interface {
+	// IncCounter adds delta to the counter name
+	IncCounter(name string, delta int64)
+	// ObserveDuration records a duration for name
+	ObserveDuration(name string, d time.Duration)
+}
+
+// counters holds the totals of every Client in the process
+type counters struct {
+	scans      expvar.Int
+	infections expvar.Int
+	errors     expvar.Int
+	reconnects expvar.Int
+	bytes      expvar.Int
+}
+
+var (
+	stats      counters
+	expvarOnce sync.Once
+	statVars   = map[string]*expvar.Int{
+		MetricScans:      &stats.scans,
+		MetricInfections: &stats.infections,
+		MetricErrors:     &stats.errors,
+		MetricReconnects: &stats.reconnects,
+		MetricBytes:      &stats.bytes,
+	}
+)
+
+// EnableExpvar publishes the client counters using expvar as
+// sssp.scans, sssp.infections, sssp.errors, sssp.reconnects and
+// sssp.bytes, they are then served on /debug/vars by the expvar
+// handler. The counters cover every Client and Pool in the process,
+// calling it more than once has no effect.
+func EnableExpvar() {
+	expvarOnce.Do(func() {
+		for _, name := range []string{MetricScans, MetricInfections, MetricErrors, MetricReconnects, MetricBytes} {
+			expvar.Publish(expvarPrefix+name, statVars[name])
+		}
+	})
+}
+
+// SetMetricsSink sets the sink that receives the metrics of the
+// Client in addition to the process wide expvar counters, nil
+// disables it
+func (c *Client) SetMetricsSink(s MetricsSink) {
+	c.m.Lock()
+	c.sink = s
+	c.m.Unlock()
+}
+
+// SetMetricsSink sets the sink used by connections established
+// after the call, see Client.SetMetricsSink
+func (p *Pool) SetMetricsSink(s MetricsSink) {
+	p.m.Lock()
+	p.sink = s
+	p.m.Unlock()
+}
+
+// count adds n to the counter name
+func (c *Client) count(name string, n int64) {
+	statVars[name].Add(n)
+	if c.sink != nil {
+		c.sink.IncCounter(name, n)
+	}
+}
+
+// observe records the duration since start for name
+func (c *Client) observe(name string, start time.Time) {
+	if c.sink != nil {
+		c.sink.ObserveDuration(name, time.Since(start))
+	}
+}
+
+// scanned records a scan request started at start, a failed request
+// counts as one error otherwise each response that could not be
+// scanned does
+func (c *Client) scanned(start time.Time, l Labels, err error, r ...*Response) {
+	c.countLabels(MetricScans, 1, l)
+	c.observeLabels(MetricScanDuration, start, l)
+	if err != nil {
+		c.countLabels(MetricErrors, 1, l)
+	}
+	for _, rs := range r {
+		if rs == nil {
+			continue
+		}
+		if rs.Infected {
+			c.countLabels(MetricInfections, 1, l)
+		}
+		if rs.ErrorOccured && err == nil {
+			c.countLabels(MetricErrors, 1, l)
+		}
+	}
+}
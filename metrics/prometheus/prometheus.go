@@ -0,0 +1,170 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package prometheus implements an sssp.MetricsSink exposing Prometheus metrics
+SSSP - Golang SSSP protocol implementation
+
+A Sink keeps the counters and duration histograms of the clients it
+is set on and serves them in the Prometheus text format, it does not
+depend on the Prometheus client library.
+
+	s := prometheus.NewSink("sssp")
+	p.SetMetricsSink(s)
+	http.Handle("/metrics", s)
+*/
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefaultBuckets are the upper bounds in seconds of the
+	// duration histogram buckets
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	help           = map[string]string{
+		sssp.MetricScans:        "Total number of scan requests.",
+		sssp.MetricInfections:   "Total number of infected files.",
+		sssp.MetricErrors:       "Total number of failed requests and files that could not be scanned.",
+		sssp.MetricReconnects:   "Total number of connections replaced after a failure.",
+		sssp.MetricBytes:        "Total number of bytes uploaded by stream scans.",
+		sssp.MetricScanDuration: "Duration of scan requests.",
+		sssp.MetricDialDuration: "Time taken to connect to the server.",
+	}
+)
+
+var _ sssp.MetricsSink = (*Sink)(nil)
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// A Sink is an sssp.MetricsSink that renders the metrics it receives
+// in the Prometheus text format, it is safe for concurrent use
+type Sink struct {
+	namespace  string
+	buckets    []float64
+	m          sync.Mutex
+	counters   map[string]int64
+	histograms map[string]*histogram
+}
+
+// IncCounter adds delta to the counter name, it is exposed as
+// namespace_name_total
+func (s *Sink) IncCounter(name string, delta int64) {
+	s.m.Lock()
+	s.counters[name] += delta
+	s.m.Unlock()
+}
+
+// ObserveDuration records d in the histogram name, it is exposed
+// as namespace_name_seconds
+func (s *Sink) ObserveDuration(name string, d time.Duration) {
+	v := d.Seconds()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	h, ok := s.histograms[name]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(s.buckets))}
+		s.histograms[name] = h
+	}
+	for i, b := range s.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (s *Sink) WriteTo(w io.Writer) (n int64, err error) {
+	var b strings.Builder
+
+	s.m.Lock()
+	counters := make([]string, 0, len(s.counters))
+	for name := range s.counters {
+		counters = append(counters, name)
+	}
+	sort.Strings(counters)
+	histograms := make([]string, 0, len(s.histograms))
+	for name := range s.histograms {
+		histograms = append(histograms, name)
+	}
+	sort.Strings(histograms)
+
+	for _, name := range counters {
+		fn := s.metricName(name) + "_total"
+		writeHeader(&b, fn, name, "counter")
+		fmt.Fprintf(&b, "%s %d\n", fn, s.counters[name])
+	}
+	for _, name := range histograms {
+		h := s.histograms[name]
+		fn := s.metricName(name) + "_seconds"
+		writeHeader(&b, fn, name, "histogram")
+		for i, le := range s.buckets {
+			fmt.Fprintf(&b, "%s_bucket{le=\"%g\"} %d\n", fn, le, h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", fn, h.count)
+		fmt.Fprintf(&b, "%s_sum %g\n%s_count %d\n", fn, h.sum, fn, h.count)
+	}
+	s.m.Unlock()
+
+	var i int
+	i, err = io.WriteString(w, b.String())
+	n = int64(i)
+
+	return
+}
+
+// ServeHTTP serves the metrics, it allows the Sink to be registered
+// as the /metrics handler
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	s.WriteTo(w)
+}
+
+func (s *Sink) metricName(name string) string {
+	if s.namespace == "" {
+		return name
+	}
+
+	return s.namespace + "_" + name
+}
+
+func writeHeader(b *strings.Builder, fn, name, kind string) {
+	if h, ok := help[name]; ok {
+		fmt.Fprintf(b, "# HELP %s %s\n", fn, h)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", fn, kind)
+}
+
+// NewSink creates and returns a new Sink whose metric names are
+// prefixed with namespace, the DefaultBuckets are used
+func NewSink(namespace string) *Sink {
+	return &Sink{
+		namespace:  namespace,
+		buckets:    DefaultBuckets,
+		counters:   make(map[string]int64),
+		histograms: make(map[string]*histogram),
+	}
+}
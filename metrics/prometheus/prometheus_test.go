@@ -0,0 +1,113 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package prometheus implements an sssp.MetricsSink exposing Prometheus metrics
+SSSP - Golang SSSP protocol implementation
+*/
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+func TestSink(t *testing.T) {
+	var b strings.Builder
+
+	s := NewSink("sssp")
+	s.IncCounter(sssp.MetricScans, 2)
+	s.IncCounter(sssp.MetricBytes, 100)
+	s.ObserveDuration(sssp.MetricScanDuration, 20*time.Millisecond)
+	s.ObserveDuration(sssp.MetricScanDuration, 3*time.Second)
+
+	if _, err := s.WriteTo(&b); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# HELP sssp_bytes_total Total number of bytes uploaded by stream scans.\n# TYPE sssp_bytes_total counter\nsssp_bytes_total 100\n",
+		"# TYPE sssp_scans_total counter\nsssp_scans_total 2\n",
+		"# TYPE sssp_scan_duration_seconds histogram\n",
+		"sssp_scan_duration_seconds_bucket{le=\"0.01\"} 0\n",
+		"sssp_scan_duration_seconds_bucket{le=\"0.025\"} 1\n",
+		"sssp_scan_duration_seconds_bucket{le=\"5\"} 2\n",
+		"sssp_scan_duration_seconds_bucket{le=\"+Inf\"} 2\n",
+		"sssp_scan_duration_seconds_sum 3.02\nsssp_scan_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("The output should contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "sssp_bytes_total") > strings.Index(out, "sssp_scans_total") {
+		t.Errorf("The metrics should be sorted:\n%s", out)
+	}
+
+	b.Reset()
+	NewSink("").WriteTo(&b)
+	if b.Len() != 0 {
+		t.Errorf("An empty sink should not write anything: %q", b.String())
+	}
+}
+
+func TestSinkClient(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	s := NewSink("av")
+	p, err := sssp.NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetMetricsSink(s)
+
+	if _, err = p.ScanReader(strings.NewReader(eicarVirus)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("Content-Type = %q, want %q", ct, contentType)
+	}
+	body, _ := ioutil.ReadAll(w.Body)
+	for _, want := range []string{
+		"av_scans_total 1\n",
+		"av_infections_total 1\n",
+		"av_dial_duration_seconds_count 1\n",
+		"av_scan_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("The output should contain %q:\n%s", want, body)
+		}
+	}
+
+	var c *sssp.Client
+	if c, err = sssp.NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	c.SetMetricsSink(s)
+	if _, err = c.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	var b strings.Builder
+	s.WriteTo(&b)
+	if !strings.Contains(b.String(), "av_scans_total 2\n") {
+		t.Errorf("Client scans should be counted:\n%s", b.String())
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package statsd implements an sssp.MetricsSink sending StatsD metrics
+SSSP - Golang SSSP protocol implementation
+
+A Sink sends each counter increment and duration to a StatsD server
+over UDP as it is recorded, counters use the c type and durations the
+ms type.
+
+	s, _ := statsd.NewSink("127.0.0.1:8125", "sssp")
+	defer s.Close()
+	p.SetMetricsSink(s)
+*/
+package statsd
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+var _ sssp.MetricsSink = (*Sink)(nil)
+
+// A Sink is an sssp.MetricsSink that sends the metrics it receives
+// to a StatsD server, it is safe for concurrent use. Send errors are
+// ignored as StatsD is best effort, Err returns the last one.
+type Sink struct {
+	prefix string
+	conn   net.Conn
+	m      sync.Mutex
+	err    error
+}
+
+// IncCounter sends delta for the counter name
+func (s *Sink) IncCounter(name string, delta int64) {
+	s.send(name, strconv.FormatInt(delta, 10), "c")
+}
+
+// ObserveDuration sends d in milliseconds for the timer name
+func (s *Sink) ObserveDuration(name string, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.send(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms")
+}
+
+// Err returns the last error encountered sending a metric
+func (s *Sink) Err() (err error) {
+	s.m.Lock()
+	err = s.err
+	s.m.Unlock()
+
+	return
+}
+
+// Close closes the connection to the server
+func (s *Sink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Sink) send(name, value, kind string) {
+	b := make([]byte, 0, len(s.prefix)+len(name)+len(value)+len(kind)+3)
+	b = append(b, s.prefix...)
+	b = append(b, name...)
+	b = append(b, ':')
+	b = append(b, value...)
+	b = append(b, '|')
+	b = append(b, kind...)
+
+	if _, err := s.conn.Write(b); err != nil {
+		s.m.Lock()
+		s.err = err
+		s.m.Unlock()
+	}
+}
+
+// NewSink creates and returns a new Sink sending to the StatsD server
+// at address over UDP, the metric names are prefixed with prefix and
+// a dot unless it is empty
+func NewSink(address, prefix string) (s *Sink, err error) {
+	var conn net.Conn
+
+	if conn, err = net.Dial("udp", address); err != nil {
+		return
+	}
+
+	if prefix != "" {
+		prefix += "."
+	}
+
+	s = &Sink{
+		prefix: prefix,
+		conn:   conn,
+	}
+
+	return
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package statsd implements an sssp.MetricsSink sending StatsD metrics
+SSSP - Golang SSSP protocol implementation
+*/
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer pc.Close()
+
+	s, err := NewSink(pc.LocalAddr().String(), "sssp")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer s.Close()
+
+	s.IncCounter(sssp.MetricScans, 1)
+	s.IncCounter(sssp.MetricBytes, 4096)
+	s.ObserveDuration(sssp.MetricScanDuration, 1500*time.Microsecond)
+
+	expected := []string{
+		"sssp.scans:1|c",
+		"sssp.bytes:4096|c",
+		"sssp.scan_duration:1.5|ms",
+	}
+	buf := make([]byte, 512)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range expected {
+		n, _, rerr := pc.ReadFrom(buf)
+		if rerr != nil {
+			t.Fatalf("An error should not be returned: %s", rerr)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if err = s.Err(); err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+
+	np, err := NewSink(pc.LocalAddr().String(), "")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer np.Close()
+	np.IncCounter(sssp.MetricErrors, 2)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if got := string(buf[:n]); got != "errors:2|c" {
+		t.Errorf("got %q, want %q", got, "errors:2|c")
+	}
+
+	if _, err = NewSink("invalid", "sssp"); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
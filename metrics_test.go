@@ -0,0 +1,163 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func expvarValue(t *testing.T, name string) int64 {
+	v, ok := expvar.Get(expvarPrefix + name).(*expvar.Int)
+	if !ok {
+		t.Fatalf("%s%s should be published", expvarPrefix, name)
+	}
+
+	return v.Value()
+}
+
+func TestExpvar(t *testing.T) {
+	EnableExpvar()
+	EnableExpvar()
+
+	names := []string{"scans", "infections", "errors", "reconnects", "bytes"}
+	before := make(map[string]int64)
+	for _, n := range names {
+		before[n] = expvarValue(t, n)
+	}
+
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if string(r.Data) == "fail" {
+			return sssptest.Fail("0212", "Corrupt", "stream")
+		}
+		return sssptest.DefaultHandler(r)
+	})
+	defer ts.Close()
+
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	for _, data := range []string{eicarVirus, "clean", "fail"} {
+		c.ScanReader(strings.NewReader(data))
+	}
+	if err = c.Dial(context.Background()); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	pc, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.Put(pc, io.EOF)
+	if _, err = p.QueryServer(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected := map[string]int64{
+		"scans":      3,
+		"infections": 1,
+		"errors":     1,
+		"reconnects": 2,
+		"bytes":      int64(len(eicarVirus) + len("clean") + len("fail")),
+	}
+	for _, n := range names {
+		if d := expvarValue(t, n) - before[n]; d != expected[n] {
+			t.Errorf("%s%s increased by %d, want %d", expvarPrefix, n, d, expected[n])
+		}
+	}
+}
+
+type recordingSink struct {
+	m         sync.Mutex
+	counters  map[string]int64
+	durations map[string]int
+}
+
+func (s *recordingSink) IncCounter(name string, delta int64) {
+	s.m.Lock()
+	s.counters[name] += delta
+	s.m.Unlock()
+}
+
+func (s *recordingSink) ObserveDuration(name string, d time.Duration) {
+	s.m.Lock()
+	s.durations[name]++
+	s.m.Unlock()
+}
+
+func TestMetricsSink(t *testing.T) {
+	s := &recordingSink{counters: make(map[string]int64), durations: make(map[string]int)}
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetMetricsSink(s)
+
+	for _, data := range []string{eicarVirus, "clean"} {
+		if _, err = p.ScanReader(strings.NewReader(data)); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+	pc, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.Put(pc, io.EOF)
+	if _, err = p.QueryServer(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	expected := map[string]int64{
+		MetricScans:      2,
+		MetricInfections: 1,
+		MetricReconnects: 1,
+		MetricBytes:      int64(len(eicarVirus) + len("clean")),
+	}
+	for name, v := range expected {
+		if s.counters[name] != v {
+			t.Errorf("%s = %d, want %d", name, s.counters[name], v)
+		}
+	}
+	if s.durations[MetricScanDuration] != 2 || s.durations[MetricDialDuration] != 2 {
+		t.Errorf("Unexpected durations: %v", s.durations)
+	}
+	// a failed reconnect leaves the discarded connection to replace
+	if pc, err = p.Get(context.Background()); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.Put(pc, io.EOF)
+	ts.Close()
+	if _, err = p.Get(context.Background()); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if p.discarded != 1 || s.counters[MetricReconnects] != 1 {
+		t.Errorf("Unexpected reconnects: %d %d", p.discarded, s.counters[MetricReconnects])
+	}
+}
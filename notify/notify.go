@@ -0,0 +1,241 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package notify implements webhook notifications of infections
+SSSP - Golang SSSP protocol implementation
+
+A JSON payload is POSTed to each configured webhook URL whenever
+a scan returns an infected result, payloads are optionally signed
+using HMAC-SHA256 and failed deliveries are retried.
+*/
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	// SignatureHeader is the header that carries the HMAC signature
+	SignatureHeader = "X-SSSP-Signature"
+	defaultRetries  = 3
+	defaultBackoff  = 1 * time.Second
+	defaultTimeout  = 10 * time.Second
+	statusErr       = "Webhook %s returned status: %s"
+	deliveryErr     = "Webhook delivery failed: %s"
+)
+
+// A Payload represents the JSON document sent to the webhooks
+type Payload struct {
+	File        string    `json:"file"`
+	ArchiveItem string    `json:"archive_item,omitempty"`
+	Signature   string    `json:"signature"`
+	Host        string    `json:"host"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// A Notifier delivers infection notifications to webhooks
+type Notifier struct {
+	urls    []string
+	secret  []byte
+	retries int
+	backoff time.Duration
+	host    string
+	client  *http.Client
+}
+
+// SetSecret sets the secret used to sign the payloads, the
+// signature is sent in the X-SSSP-Signature header
+func (n *Notifier) SetSecret(s string) {
+	n.secret = []byte(s)
+}
+
+// SetRetries sets the number of times a failed delivery
+// is retried
+func (n *Notifier) SetRetries(r int) {
+	if r >= 0 {
+		n.retries = r
+	}
+}
+
+// SetBackoff sets the initial delay between retries, the
+// delay is doubled after every attempt
+func (n *Notifier) SetBackoff(d time.Duration) {
+	if d > 0 {
+		n.backoff = d
+	}
+}
+
+// SetHost sets the host name reported in the payloads
+func (n *Notifier) SetHost(h string) {
+	n.host = h
+}
+
+// SetHTTPClient sets the http client used for delivery
+func (n *Notifier) SetHTTPClient(c *http.Client) {
+	if c != nil {
+		n.client = c
+	}
+}
+
+// Notify sends a notification to all the webhooks if r is
+// infected, clean responses are ignored
+func (n *Notifier) Notify(ctx context.Context, r *sssp.Response) (err error) {
+	var b []byte
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var errs []string
+
+	if r == nil || !r.Infected {
+		return
+	}
+
+	p := &Payload{
+		File:        r.Filename,
+		ArchiveItem: r.ArchiveItem,
+		Signature:   r.Signature,
+		Host:        n.host,
+		Timestamp:   time.Now().UTC(),
+	}
+
+	if b, err = json.Marshal(p); err != nil {
+		return
+	}
+
+	for _, u := range n.urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if e := n.deliver(ctx, u, b); e != nil {
+				m.Lock()
+				errs = append(errs, e.Error())
+				m.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		err = fmt.Errorf(deliveryErr, strings.Join(errs, "; "))
+	}
+
+	return
+}
+
+// Callback returns a function suitable for use as a scan
+// result callback, notifications are delivered in the background
+func (n *Notifier) Callback() func(*sssp.Response) {
+	return func(r *sssp.Response) {
+		if r == nil || !r.Infected {
+			return
+		}
+		go n.Notify(context.Background(), r)
+	}
+}
+
+// ScanEnd returns a function suitable for use as the OnScanEnd hook
+// of a Client or Pool, see sssp.Hooks, the infected responses of each
+// scan are delivered in the background
+func (n *Notifier) ScanEnd() func(sssp.Command, string, sssp.Labels, []*sssp.Response, time.Duration, error) {
+	cb := n.Callback()
+	return func(cmd sssp.Command, item string, l sssp.Labels, r []*sssp.Response, d time.Duration, err error) {
+		for _, rs := range r {
+			cb(rs)
+		}
+	}
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of b using secret
+func Sign(secret, b []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(b)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *Notifier) deliver(ctx context.Context, u string, b []byte) (err error) {
+	backoff := n.backoff
+
+	for i := 0; i <= n.retries; i++ {
+		if i > 0 {
+			t := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				err = ctx.Err()
+				return
+			case <-t.C:
+			}
+			backoff *= 2
+		}
+
+		var retry bool
+		if retry, err = n.post(ctx, u, b); err == nil || !retry {
+			return
+		}
+	}
+
+	return
+}
+
+func (n *Notifier) post(ctx context.Context, u string, b []byte) (retry bool, err error) {
+	var req *http.Request
+	var resp *http.Response
+
+	if req, err = http.NewRequest(http.MethodPost, u, bytes.NewReader(b)); err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(n.secret, b))
+	}
+
+	if resp, err = n.client.Do(req); err != nil {
+		retry = ctx.Err() == nil
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return
+	}
+
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	err = fmt.Errorf(statusErr, u, resp.Status)
+
+	return
+}
+
+// NewNotifier creates and returns a new Notifier that delivers
+// to the given webhook URLs
+func NewNotifier(urls ...string) (n *Notifier) {
+	host, _ := os.Hostname()
+
+	n = &Notifier{
+		urls:    urls,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		host:    host,
+		client:  &http.Client{Timeout: defaultTimeout},
+	}
+
+	return
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package notify implements webhook notifications of infections
+SSSP - Golang SSSP protocol implementation
+*/
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+func TestNotify(t *testing.T) {
+	var m sync.Mutex
+	var calls int
+	var got Payload
+
+	secret := "s3cr3t"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get(SignatureHeader); sig != Sign([]byte(secret), b) {
+			t.Errorf("Invalid signature: %s", sig)
+		}
+		json.Unmarshal(b, &got)
+	}))
+	defer ts.Close()
+
+	n := NewNotifier(ts.URL)
+	n.SetSecret(secret)
+	n.SetBackoff(time.Millisecond)
+	n.SetHost("mx1.example.com")
+
+	ctx := context.Background()
+	if e := n.Notify(ctx, &sssp.Response{Filename: "clean.txt"}); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	r := &sssp.Response{Filename: "eicar.txt", Infected: true, Signature: "EICAR-AV-Test"}
+	if e := n.Notify(ctx, r); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if calls != 2 {
+		t.Errorf("calls = %d, want %d", calls, 2)
+	}
+	if got.File != r.Filename || got.Signature != r.Signature || got.Host != "mx1.example.com" {
+		t.Errorf("Unexpected payload: %+v", got)
+	}
+}
+
+func TestNotifyFailure(t *testing.T) {
+	var m sync.Mutex
+	var calls int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		calls++
+		m.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	n := NewNotifier(ts.URL)
+	n.SetBackoff(time.Millisecond)
+	r := &sssp.Response{Filename: "eicar.txt", Infected: true, Signature: "EICAR-AV-Test"}
+	if e := n.Notify(context.Background(), r); e == nil {
+		t.Fatalf("An error should be returned")
+	}
+	m.Lock()
+	defer m.Unlock()
+	if calls != 1 {
+		t.Errorf("Client errors should not be retried: calls = %d, want %d", calls, 1)
+	}
+}
+
+func TestScanEnd(t *testing.T) {
+	got := make(chan Payload, 2)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		got <- p
+	}))
+	defer ts.Close()
+
+	hook := NewNotifier(ts.URL).ScanEnd()
+	hook(sssp.ScanDir, "/tmp", nil, []*sssp.Response{
+		{Filename: "/tmp/clean.txt"},
+		{Filename: "/tmp/eicar.txt", Infected: true, Signature: "EICAR-AV-Test"},
+	}, time.Millisecond, nil)
+
+	select {
+	case p := <-got:
+		if p.File != "/tmp/eicar.txt" || p.Signature != "EICAR-AV-Test" {
+			t.Errorf("Unexpected payload: %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The infected response should be delivered")
+	}
+	select {
+	case p := <-got:
+		t.Errorf("Clean responses should not be delivered: %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
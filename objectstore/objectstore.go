@@ -0,0 +1,193 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package objectstore implements scanning of objects held in S3
+compatible object stores
+SSSP - Golang SSSP protocol implementation
+
+Objects are streamed directly to the server using SCANDATA without
+being written to disk, large objects are fetched in ranged parts.
+*/
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	defaultPartSize = 64 * 1024 * 1024
+	noSizeErr       = "The object size could not be determined"
+	shortPartErr    = "Short read on part %d-%d of %s/%s"
+)
+
+// ErrInvalidRange is matched using errors.Is by the errors Getters
+// return when the store rejects a range as not satisfiable, as S3
+// does with a 416 for the first part of an empty object. The object
+// is then fetched whole.
+var ErrInvalidRange = errors.New("The requested range is not satisfiable")
+
+// A Range represents an inclusive byte range of an object
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// An Object represents an object or part of an object returned
+// by a Getter, Size is always the total size of the object
+type Object struct {
+	Body io.ReadCloser
+	Size int64
+}
+
+// Getter is the interface implemented by object store clients,
+// when r is nil the whole object should be returned. Ranges the
+// store rejects are reported with an error wrapping ErrInvalidRange.
+type Getter interface {
+	GetObject(ctx context.Context, bucket, key string, r *Range) (*Object, error)
+}
+
+// Scanner is the interface used to scan the object data
+type Scanner interface {
+	ScanSizedReader(io.Reader, int64) (*sssp.Response, error)
+}
+
+// An ObjectScanner streams objects from an object store to
+// the SSSP server
+type ObjectScanner struct {
+	getter   Getter
+	scanner  Scanner
+	partSize int64
+}
+
+type partReader struct {
+	ctx    context.Context
+	getter Getter
+	bucket string
+	key    string
+	size   int64
+	part   int64
+	offset int64
+	// start and end are the range of the current part
+	start int64
+	end   int64
+	body  io.ReadCloser
+}
+
+func (p *partReader) Read(b []byte) (n int, err error) {
+	var o *Object
+
+	for {
+		if p.body != nil {
+			n, err = p.body.Read(b)
+			p.offset += int64(n)
+			if err == io.EOF {
+				p.body.Close()
+				p.body = nil
+				if p.offset != p.end+1 {
+					err = fmt.Errorf(shortPartErr, p.start, p.end, p.bucket, p.key)
+					return
+				}
+				err = nil
+			}
+			if n > 0 || err != nil {
+				return
+			}
+		}
+
+		if p.offset >= p.size {
+			err = io.EOF
+			return
+		}
+
+		p.start, p.end = p.offset, p.offset+p.part-1
+		if p.end >= p.size {
+			p.end = p.size - 1
+		}
+
+		if o, err = p.getter.GetObject(p.ctx, p.bucket, p.key, &Range{Start: p.start, End: p.end}); err != nil {
+			return
+		}
+		p.body = o.Body
+	}
+}
+
+func (p *partReader) Close() (err error) {
+	if p.body != nil {
+		err = p.body.Close()
+		p.body = nil
+	}
+
+	return
+}
+
+// SetPartSize sets the size of the ranged parts used to fetch
+// large objects, objects smaller than this are fetched whole
+func (s *ObjectScanner) SetPartSize(n int64) {
+	if n > 0 {
+		s.partSize = n
+	}
+}
+
+// Scan streams the object identified by bucket and key to the
+// server for scanning
+func (s *ObjectScanner) Scan(ctx context.Context, bucket, key string) (r *sssp.Response, err error) {
+	var o *Object
+
+	end := s.partSize - 1
+	o, err = s.getter.GetObject(ctx, bucket, key, &Range{Start: 0, End: end})
+	if errors.Is(err, ErrInvalidRange) {
+		// empty objects have no first part
+		if o, err = s.getter.GetObject(ctx, bucket, key, nil); err == nil {
+			end = o.Size - 1
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	if o.Size < 0 {
+		o.Body.Close()
+		err = fmt.Errorf(noSizeErr)
+		return
+	}
+
+	p := &partReader{
+		ctx:    ctx,
+		getter: s.getter,
+		bucket: bucket,
+		key:    key,
+		size:   o.Size,
+		part:   s.partSize,
+		end:    end,
+		body:   o.Body,
+	}
+	if p.end >= p.size {
+		p.end = p.size - 1
+	}
+	defer p.Close()
+
+	if r, err = s.scanner.ScanSizedReader(p, o.Size); r != nil {
+		r.Filename = bucket + "/" + key
+	}
+
+	return
+}
+
+// NewObjectScanner creates and returns a new ObjectScanner
+func NewObjectScanner(g Getter, s Scanner) (o *ObjectScanner) {
+	o = &ObjectScanner{
+		getter:   g,
+		scanner:  s,
+		partSize: defaultPartSize,
+	}
+
+	return
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package objectstore implements scanning of objects held in S3
+compatible object stores
+SSSP - Golang SSSP protocol implementation
+*/
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+type fakeGetter struct {
+	data   []byte
+	ranges []Range
+	// short drops the last byte of each part
+	short bool
+}
+
+func (f *fakeGetter) GetObject(ctx context.Context, bucket, key string, r *Range) (o *Object, err error) {
+	o = &Object{Size: int64(len(f.data))}
+	if r == nil {
+		o.Body = ioutil.NopCloser(bytes.NewReader(f.data))
+		return
+	}
+	f.ranges = append(f.ranges, *r)
+	if r.Start >= int64(len(f.data)) {
+		// S3 answers 416 when no byte of the range exists
+		o, err = nil, fmt.Errorf("%w: status 416", ErrInvalidRange)
+		return
+	}
+	end := r.End + 1
+	if end > int64(len(f.data)) {
+		end = int64(len(f.data))
+	}
+	if f.short {
+		end--
+	}
+	o.Body = ioutil.NopCloser(bytes.NewReader(f.data[r.Start:end]))
+	return
+}
+
+type fakeScanner struct {
+	data []byte
+}
+
+func (f *fakeScanner) ScanSizedReader(i io.Reader, n int64) (r *sssp.Response, err error) {
+	if f.data, err = ioutil.ReadAll(io.LimitReader(i, n)); err != nil {
+		return
+	}
+	r = &sssp.Response{Filename: "stream"}
+	if bytes.Contains(f.data, []byte("EICAR")) {
+		r.Infected = true
+		r.Signature = "EICAR-AV-Test"
+	}
+	return
+}
+
+func TestScan(t *testing.T) {
+	g := &fakeGetter{data: []byte(eicarVirus)}
+	s := &fakeScanner{}
+	o := NewObjectScanner(g, s)
+	r, e := o.Scan(context.Background(), "bucket", "path/eicar.txt")
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if r.Filename != "bucket/path/eicar.txt" {
+		t.Errorf("r.Filename = %q, want %q", r.Filename, "bucket/path/eicar.txt")
+	}
+	if !r.Infected {
+		t.Errorf("r.Infected = %t, want %t", r.Infected, true)
+	}
+	if len(g.ranges) != 1 {
+		t.Errorf("len(g.ranges) = %d, want %d", len(g.ranges), 1)
+	}
+}
+
+func TestScanParts(t *testing.T) {
+	g := &fakeGetter{data: []byte(eicarVirus)}
+	s := &fakeScanner{}
+	o := NewObjectScanner(g, s)
+	o.SetPartSize(10)
+	if _, e := o.Scan(context.Background(), "bucket", "eicar.txt"); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if !bytes.Equal(s.data, g.data) {
+		t.Errorf("Scanned data = %q, want %q", s.data, g.data)
+	}
+	exp := (len(g.data) + 9) / 10
+	if len(g.ranges) != exp {
+		t.Errorf("len(g.ranges) = %d, want %d", len(g.ranges), exp)
+	}
+	last := g.ranges[len(g.ranges)-1]
+	if last.End != int64(len(g.data)-1) {
+		t.Errorf("last.End = %d, want %d", last.End, len(g.data)-1)
+	}
+}
+
+func TestScanEmpty(t *testing.T) {
+	g := &fakeGetter{}
+	s := &fakeScanner{}
+	o := NewObjectScanner(g, s)
+	r, e := o.Scan(context.Background(), "bucket", "empty.txt")
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if r.Infected || len(s.data) != 0 {
+		t.Errorf("Expected an empty clean scan, got infected=%t with %d bytes", r.Infected, len(s.data))
+	}
+}
+
+func TestScanShortPart(t *testing.T) {
+	g := &fakeGetter{data: []byte(eicarVirus), short: true}
+	s := &fakeScanner{}
+	o := NewObjectScanner(g, s)
+	o.SetPartSize(10)
+	_, e := o.Scan(context.Background(), "bucket", "eicar.txt")
+	if e == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if want := "Short read on part 0-9 of bucket/eicar.txt"; e.Error() != want {
+		t.Errorf("e = %q, want %q", e, want)
+	}
+}
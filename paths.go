@@ -0,0 +1,384 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+)
+
+const (
+	probePattern = ".sssp-probe-*"
+	probeData    = "SSSP reachability probe\n"
+	probeErr     = "The server could not open %s in %s: %s %s"
+)
+
+// A ProbeError is returned by ProbePath when the server could not
+// scan the sentinel file, usually as the directory is not mounted on
+// the server or is not readable by the user the server runs as
+type ProbeError struct {
+	// Dir is the local directory that was probed
+	Dir string
+	// Path is the sentinel file as seen by the server
+	Path string
+	// Code is the result code reported by the server
+	Code ResultCode
+	// Text is the text reported with the code
+	Text string
+	err  error
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf(probeErr, e.Path, e.Dir, e.Code, e.Text)
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.err
+}
+
+// A pathMapping maps a local directory to the directory the server
+// sees it at
+type pathMapping struct {
+	local  string
+	server string
+}
+
+// A pathMap holds the mappings sorted by the longest local directory
+// for rewriting requests and by the longest server directory for
+// rewriting responses
+type pathMap struct {
+	toServer []pathMapping
+	toLocal  []pathMapping
+}
+
+// SetSharedPrefixes sets the directories whose files are visible to
+// the server at the same path, ScanPath uses SCANFILE for the files
+// under them and streams the others. When no prefixes are set every
+// path is assumed to be visible over a unix socket, as the server is
+// on the same host, and none over other networks, calling it without
+// prefixes restores this default.
+func (c *Client) SetSharedPrefixes(prefixes ...string) {
+	c.m.Lock()
+	c.shared = cleanPrefixes(prefixes)
+	c.m.Unlock()
+}
+
+// SetSharedPrefixes sets the shared directories used by connections
+// established after the call, see Client.SetSharedPrefixes
+func (p *Pool) SetSharedPrefixes(prefixes ...string) {
+	p.m.Lock()
+	p.shared = cleanPrefixes(prefixes)
+	p.m.Unlock()
+}
+
+// SetPathMap sets the directories that the server mounts at a
+// different path, the keys are local directories and the values the
+// server directories. The paths given to ScanFile and ScanDir are
+// rewritten using the longest matching local directory and the paths
+// in the responses are rewritten back, ScanPath uses SCANFILE for the
+// files in mapped directories. A nil map removes the mappings.
+func (c *Client) SetPathMap(m map[string]string) {
+	c.m.Lock()
+	c.pathMap = newPathMap(m)
+	c.m.Unlock()
+}
+
+// SetPathMap sets the path mappings used by connections established
+// after the call, see Client.SetPathMap
+func (p *Pool) SetPathMap(m map[string]string) {
+	p.m.Lock()
+	p.pathMap = newPathMap(m)
+	p.m.Unlock()
+}
+
+// ScanPath submits the file p for scanning, SCANFILE is used when the
+// server can read the file itself and the file is streamed otherwise,
+// see SetSharedPrefixes
+func (c *Client) ScanPath(p string) (r *Response, err error) {
+	r, err = c.ScanPathContext(context.Background(), p)
+	return
+}
+
+// ScanPathContext submits the file p for scanning, the labels of ctx
+// are attached to the scan, see ScanPath
+func (c *Client) ScanPathContext(ctx context.Context, p string) (r *Response, err error) {
+	var stat os.FileInfo
+
+	if p, err = filepath.Abs(p); err != nil {
+		return
+	}
+
+	if stat, err = os.Stat(p); err != nil {
+		return
+	}
+
+	if stat.IsDir() {
+		err = fmt.Errorf(dirScanErr)
+		return
+	}
+
+	if c.visible(p) {
+		r, err = c.ScanFileContext(ctx, p)
+		return
+	}
+
+	r, err = c.ScanStreamContext(ctx, p)
+
+	return
+}
+
+// ScanPath submits the file p for scanning, see Client.ScanPath
+func (p *Pool) ScanPath(f string) (r *Response, err error) {
+	r, err = p.ScanPathContext(context.Background(), f)
+	return
+}
+
+// ScanPathContext submits the file p for scanning, see
+// Client.ScanPathContext
+func (p *Pool) ScanPathContext(ctx context.Context, f string) (r *Response, err error) {
+	err = p.doContext(ctx, func(c *Client) (e error) {
+		r, e = c.ScanPathContext(ctx, f)
+		return
+	})
+
+	return
+}
+
+// ProbePath checks that the server can open the files in the local
+// directory dir using SCANFILE, after applying the path mappings. A
+// small readable sentinel file is written to dir, scanned and removed,
+// a *ProbeError is returned when the server fails to open it, which
+// points at missing mounts or directory permissions rather than at the
+// files being scanned.
+func (c *Client) ProbePath(dir string) (err error) {
+	var f *os.File
+	var stat os.FileInfo
+	var r *Response
+	var de *protocol.DoneError
+
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+
+	if stat, err = os.Stat(dir); err != nil {
+		return
+	}
+
+	if !stat.IsDir() {
+		err = fmt.Errorf(notDirErr, dir)
+		return
+	}
+
+	if f, err = ioutil.TempFile(dir, probePattern); err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.WriteString(probeData); err != nil {
+		f.Close()
+		return
+	}
+
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	// the server usually runs as another user
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return
+	}
+
+	r, err = c.ScanFile(f.Name())
+	if err != nil && !errors.As(err, &de) {
+		return
+	}
+
+	if err != nil || r.ErrorOccured {
+		err = &ProbeError{
+			Dir:  dir,
+			Path: c.serverPath(f.Name()),
+			Code: r.ResultCode(),
+			Text: r.StatusText,
+			err:  err,
+		}
+	}
+
+	return
+}
+
+// ProbePath checks that the server can open the files in the local
+// directory dir, see Client.ProbePath
+func (p *Pool) ProbePath(dir string) (err error) {
+	err = p.do(func(c *Client) error {
+		return c.ProbePath(dir)
+	})
+
+	return
+}
+
+// visible reports whether the server can read the absolute path p
+func (c *Client) visible(p string) bool {
+	c.m.Lock()
+	shared := c.shared
+	c.m.Unlock()
+
+	if _, ok := c.mapPath(p, false); ok {
+		return true
+	}
+
+	if shared == nil {
+		return c.network == "unix"
+	}
+
+	for _, prefix := range shared {
+		if hasPathPrefix(p, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serverPath returns the path the server sees the local path p at
+func (c *Client) serverPath(p string) string {
+	if sp, ok := c.mapPath(p, false); ok {
+		return sp
+	}
+
+	return p
+}
+
+// localPaths rewrites the server paths in r to local paths
+func (c *Client) localPaths(r ...*Response) {
+	for _, rs := range r {
+		if rs == nil {
+			continue
+		}
+		rs.Filename = c.localPath(rs.Filename)
+		rs.ArchiveItem = c.localPath(rs.ArchiveItem)
+		for i := range rs.Detections {
+			rs.Detections[i].Path = c.localPath(rs.Detections[i].Path)
+		}
+	}
+}
+
+func (c *Client) localPath(p string) string {
+	if lp, ok := c.mapPath(p, true); ok {
+		return lp
+	}
+
+	return p
+}
+
+// mapPath rewrites p using the longest matching mapping, from the
+// server directory to the local one when reverse is set
+func (c *Client) mapPath(p string, reverse bool) (mp string, ok bool) {
+	c.m.Lock()
+	pm := c.pathMap
+	c.m.Unlock()
+
+	if p == "" || pm == nil {
+		return
+	}
+
+	mappings := pm.toServer
+	if reverse {
+		mappings = pm.toLocal
+	}
+
+	for _, m := range mappings {
+		from, to := m.local, m.server
+		if reverse {
+			from, to = m.server, m.local
+		}
+		if !hasPathPrefix(p, from) {
+			continue
+		}
+		if from == string(filepath.Separator) {
+			mp = filepath.Join(to, p)
+		} else {
+			mp = to + p[len(from):]
+		}
+		ok = true
+		return
+	}
+
+	return
+}
+
+// hasPathPrefix reports whether p is the directory prefix or is in it
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == string(filepath.Separator) {
+		return true
+	}
+
+	return p == prefix || strings.HasPrefix(p, prefix+string(filepath.Separator))
+}
+
+func cleanPrefixes(prefixes []string) (c []string) {
+	if len(prefixes) == 0 {
+		return
+	}
+
+	c = make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p != "" {
+			c = append(c, filepath.Clean(p))
+		}
+	}
+
+	return
+}
+
+// newPathMap returns the mappings of m, the longest directories are
+// tried first in each direction, nil is returned when m is empty
+func newPathMap(m map[string]string) (pm *pathMap) {
+	var mappings []pathMapping
+
+	for local, server := range m {
+		if local == "" || server == "" {
+			continue
+		}
+		mappings = append(mappings, pathMapping{filepath.Clean(local), filepath.Clean(server)})
+	}
+	if len(mappings) == 0 {
+		return
+	}
+
+	pm = &pathMap{
+		toServer: sortMappings(mappings, func(m pathMapping) string { return m.local }),
+		toLocal:  sortMappings(mappings, func(m pathMapping) string { return m.server }),
+	}
+
+	return
+}
+
+// sortMappings returns a copy of mappings sorted by the longest
+// directory returned by dir
+func sortMappings(mappings []pathMapping, dir func(pathMapping) string) (s []pathMapping) {
+	s = append([]pathMapping(nil), mappings...)
+	sort.Slice(s, func(i, j int) bool {
+		a, b := dir(s[i]), dir(s[j])
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+
+	return
+}
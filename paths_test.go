@@ -0,0 +1,257 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		p      string
+		prefix string
+		want   bool
+	}{
+		{"/srv/mail/a.eml", "/srv/mail", true},
+		{"/srv/mail", "/srv/mail", true},
+		{"/srv/mailbox/a.eml", "/srv/mail", false},
+		{"/srv/a.eml", "/srv/mail", false},
+		{"/srv/a.eml", "/", true},
+	}
+	for _, tt := range tests {
+		if got := hasPathPrefix(tt.p, tt.prefix); got != tt.want {
+			t.Errorf("hasPathPrefix(%q, %q) = %t, want %t", tt.p, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestScanPath(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"shared/eicar.com":  eicarVirus,
+		"private/eicar.com": eicarVirus,
+	})
+	shared := filepath.Join(dir, "shared", "eicar.com")
+	private := filepath.Join(dir, "private", "eicar.com")
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	scan := func(scan func(string) (*Response, error), path, cmd string) {
+		t.Helper()
+		r, err := scan(path)
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if !r.Infected {
+			t.Errorf("Expected an infected result for %s", path)
+		}
+		reqs := ts.Requests()
+		if last := reqs[len(reqs)-1]; last.Command != cmd {
+			t.Errorf("%s should be scanned using %s, got %s", path, cmd, last.Command)
+		}
+	}
+
+	p.SetSharedPrefixes(filepath.Join(dir, "shared") + "/")
+	scan(p.ScanPath, shared, ScanFile.String())
+	scan(p.ScanPath, private, ScanData.String())
+
+	if _, err = p.ScanPath(dir); err == nil || err.Error() != dirScanErr {
+		t.Errorf("An error should be returned for a directory: %v", err)
+	}
+	if _, err = p.ScanPath(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("p.ScanPath() error = %v, want a missing file", err)
+	}
+
+	tc, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer tc.Close()
+	scan(tc.ScanPath, shared, ScanData.String())
+
+	us := sssptest.NewUnixServer(sssptest.DefaultHandler)
+	defer us.Close()
+	ts = us
+
+	c, err := NewClient(context.Background(), us.Network, us.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	scan(c.ScanPath, private, ScanFile.String())
+	c.SetSharedPrefixes(filepath.Join(dir, "shared"))
+	scan(c.ScanPath, private, ScanData.String())
+	c.SetSharedPrefixes()
+	scan(c.ScanPath, private, ScanFile.String())
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(filepath.Join(dir, "private"))
+	scan(c.ScanPath, "eicar.com", ScanFile.String())
+	if reqs := us.Requests(); reqs[len(reqs)-1].Arg != private {
+		t.Errorf("Relative paths should be made absolute, got %s", reqs[len(reqs)-1].Arg)
+	}
+}
+
+func TestPathMap(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"spool/eicar.com":       eicarVirus,
+		"spool/clean.txt":       "clean",
+		"spool/inner/eicar.com": eicarVirus,
+	})
+	local := "/mnt/scanner/spool"
+	server := filepath.Join(dir, "spool")
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetPathMap(map[string]string{
+		"/mnt/scanner":        "/nonexistent",
+		local + "/":           server,
+		"/mnt/scanner/other/": "/srv/other",
+	})
+
+	r, err := p.ScanFile(filepath.Join(local, "eicar.com"))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("Expected an infected result")
+	}
+	if want := filepath.Join(local, "eicar.com"); r.Filename != want {
+		t.Errorf("r.Filename = %q, want %q", r.Filename, want)
+	}
+	for _, d := range r.Detections {
+		if d.Path != "" && !hasPathPrefix(d.Path, local) {
+			t.Errorf("Detection path %q should be mapped back to %s", d.Path, local)
+		}
+	}
+	reqs := ts.Requests()
+	if arg := reqs[len(reqs)-1].Arg; arg != filepath.Join(server, "eicar.com") {
+		t.Errorf("The server path should be sent, got %s", arg)
+	}
+
+	rs, err := p.ScanDir(local, true)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	var infected int
+	for _, r := range rs {
+		if r.Filename != "" && !hasPathPrefix(r.Filename, local) {
+			t.Errorf("r.Filename = %q should be mapped back to %s", r.Filename, local)
+		}
+		if r.Infected {
+			infected++
+		}
+	}
+	if infected != 2 {
+		t.Errorf("Expected 2 infected results, got %d", infected)
+	}
+	reqs = ts.Requests()
+	if arg := reqs[len(reqs)-1].Arg; arg != server {
+		t.Errorf("The server path should be sent, got %s", arg)
+	}
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !c.visible(filepath.Join(local, "a.eml")) {
+		t.Errorf("Mapped paths should be visible to the server")
+	}
+	if got := c.serverPath("/mnt/scannerx/a.eml"); got != "/mnt/scannerx/a.eml" {
+		t.Errorf("Unmapped paths should be unchanged, got %s", got)
+	}
+	if got := c.serverPath("/mnt/scanner/a.eml"); got != "/nonexistent/a.eml" {
+		t.Errorf("c.serverPath() = %s, want /nonexistent/a.eml", got)
+	}
+	// responses are mapped back using the longest server directory
+	c.SetPathMap(map[string]string{"/longlocal": "/s", "/b": "/s/sub"})
+	if got := c.localPath("/s/sub/f"); got != "/b/f" {
+		t.Errorf("c.localPath() = %s, want /b/f", got)
+	}
+	if got := c.localPath("/s/f"); got != "/longlocal/f" {
+		t.Errorf("c.localPath() = %s, want /longlocal/f", got)
+	}
+	c.SetPathMap(nil)
+	if got := c.serverPath(filepath.Join(local, "a.eml")); got != filepath.Join(local, "a.eml") {
+		t.Errorf("Removed mappings should not be applied, got %s", got)
+	}
+	p.Put(c, nil)
+}
+
+func TestProbePath(t *testing.T) {
+	dir := t.TempDir()
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	if err = p.ProbePath(dir); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	reqs := ts.Requests()
+	last := reqs[len(reqs)-1]
+	if last.Command != ScanFile.String() || filepath.Dir(last.Arg) != dir {
+		t.Errorf("The sentinel should be scanned using SCANFILE, got %s %s", last.Command, last.Arg)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("The sentinel file should be removed, found %d entries", len(entries))
+	}
+
+	if err = p.ProbePath(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("p.ProbePath() error = %v, want a missing directory", err)
+	}
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Put(c, nil)
+	c.SetPathMap(map[string]string{dir: "/nonexistent/spool"})
+
+	err = c.ProbePath(dir)
+	var pe *ProbeError
+	if !errors.As(err, &pe) {
+		t.Fatalf("A ProbeError should be returned: %v", err)
+	}
+	if pe.Code != CodeCouldNotOpen {
+		t.Errorf("pe.Code = %s, want %s", pe.Code, CodeCouldNotOpen)
+	}
+	if pe.Dir != dir || !hasPathPrefix(pe.Path, "/nonexistent/spool") {
+		t.Errorf("pe = %+v, want the server path of the sentinel in %s", pe, dir)
+	}
+	if errors.Is(err, ErrTemporary) {
+		t.Errorf("A missing mount should not be a temporary failure")
+	}
+}
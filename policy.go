@@ -0,0 +1,227 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	policyLineErr    = "Invalid policy rule at line %d: %q"
+	policyActionErr  = "Invalid policy action at line %d: %q"
+	policyPatternErr = "Invalid policy pattern at line %d: %q"
+	policyDefault    = "default"
+)
+
+// Policy actions, the stricter actions take precedence when the
+// detections of a response match several rules
+const (
+	// ActionNone is set on responses the policy was not applied to,
+	// such as scans that failed
+	ActionNone PolicyAction = ""
+	// ActionAllow lets the item through
+	ActionAllow PolicyAction = "allow"
+	// ActionInform lets the item through but reports the detection
+	ActionInform PolicyAction = "inform"
+	// ActionBlock rejects the item
+	ActionBlock PolicyAction = "block"
+)
+
+// A PolicyAction is the outcome of applying a Policy to a Response
+type PolicyAction string
+
+// A PolicyRule maps the signatures matching Pattern to Action, the
+// pattern uses the path.Match syntax so Mal/* matches every Mal/
+// signature
+type PolicyRule struct {
+	Pattern string
+	Action  PolicyAction
+}
+
+// A Policy maps signatures to actions, the first matching rule
+// applies and signatures that match no rule get Default, which is
+// ActionBlock when empty
+type Policy struct {
+	Rules   []PolicyRule
+	Default PolicyAction
+}
+
+// SetPolicy sets the policy used to set the Action of the responses,
+// nil leaves it unset which is the default
+func (c *Client) SetPolicy(p *Policy) {
+	c.m.Lock()
+	c.policy = p
+	c.m.Unlock()
+}
+
+// SetPolicy sets the policy used by connections established after
+// the call, see Client.SetPolicy
+func (p *Pool) SetPolicy(pl *Policy) {
+	p.m.Lock()
+	p.policy = pl
+	p.m.Unlock()
+}
+
+// Match returns the action for the signature
+func (p *Policy) Match(signature string) (a PolicyAction) {
+	for _, r := range p.Rules {
+		if ok, _ := path.Match(r.Pattern, signature); ok {
+			a = r.Action
+			return
+		}
+	}
+
+	a = p.Default
+	if a == ActionNone {
+		a = ActionBlock
+	}
+
+	return
+}
+
+// Action returns the action for r, the strictest of the actions of
+// its detections for infected responses, ActionAllow for clean ones
+// and ActionNone for scans that failed
+func (p *Policy) Action(r *Response) (a PolicyAction) {
+	if !r.Infected {
+		if !r.ErrorOccured {
+			a = ActionAllow
+		}
+		return
+	}
+
+	if len(r.Detections) == 0 {
+		a = p.Match(r.Signature)
+		return
+	}
+
+	for _, d := range r.Detections {
+		if m := p.Match(d.Signature); actionRank(m) > actionRank(a) {
+			a = m
+		}
+	}
+
+	return
+}
+
+// applyPolicy sets the Action of the responses in r
+func (c *Client) applyPolicy(r ...*Response) {
+	c.m.Lock()
+	p := c.policy
+	c.m.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	for _, rs := range r {
+		if rs != nil {
+			rs.Action = p.Action(rs)
+		}
+	}
+}
+
+func actionRank(a PolicyAction) int {
+	switch a {
+	case ActionAllow:
+		return 1
+	case ActionInform:
+		return 2
+	case ActionBlock:
+		return 3
+	}
+
+	return 0
+}
+
+func parseAction(s string) (a PolicyAction, ok bool) {
+	a = PolicyAction(strings.ToLower(s))
+	ok = actionRank(a) > 0
+
+	return
+}
+
+// ParsePolicy reads a policy with one rule per line, the action
+// followed by the signature pattern. Blank lines and lines starting
+// with # are skipped and a default line sets the action of the
+// signatures that match no rule:
+//
+//	inform EICAR-AV-Test
+//	block Mal/*
+//	default block
+func ParsePolicy(r io.Reader) (p *Policy, err error) {
+	var n int
+
+	pl := &Policy{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if fields[0] == policyDefault {
+			a, ok := parseAction(strings.TrimSpace(line[len(policyDefault):]))
+			if !ok {
+				err = fmt.Errorf(policyActionErr, n, line)
+				return
+			}
+			pl.Default = a
+			continue
+		}
+
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			err = fmt.Errorf(policyLineErr, n, line)
+			return
+		}
+
+		a, ok := parseAction(fields[0])
+		if !ok {
+			err = fmt.Errorf(policyActionErr, n, line)
+			return
+		}
+
+		pattern := strings.TrimSpace(fields[1])
+		if _, err = path.Match(pattern, ""); err != nil {
+			err = fmt.Errorf(policyPatternErr, n, line)
+			return
+		}
+		pl.Rules = append(pl.Rules, PolicyRule{Pattern: pattern, Action: a})
+	}
+
+	if err = s.Err(); err != nil {
+		return
+	}
+
+	p = pl
+
+	return
+}
+
+// LoadPolicy reads the policy in the file name, see ParsePolicy
+func LoadPolicy(name string) (p *Policy, err error) {
+	var f *os.File
+
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer f.Close()
+
+	p, err = ParsePolicy(f)
+
+	return
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const testPolicy = `# test signatures are only reported
+inform EICAR-AV-Test
+allow  PUA/*
+block Mal/*
+
+default inform
+`
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(p.Rules) != 3 || p.Default != ActionInform {
+		t.Fatalf("p = %+v, want 3 rules and an inform default", p)
+	}
+
+	tests := []struct {
+		signature string
+		want      PolicyAction
+	}{
+		{"EICAR-AV-Test", ActionInform},
+		{"PUA/InstallCore", ActionAllow},
+		{"Mal/Generic-S", ActionBlock},
+		{"Troj/Agent-X", ActionInform},
+	}
+	for _, tt := range tests {
+		if got := p.Match(tt.signature); got != tt.want {
+			t.Errorf("p.Match(%q) = %q, want %q", tt.signature, got, tt.want)
+		}
+	}
+	if got := (&Policy{}).Match("Troj/Agent-X"); got != ActionBlock {
+		t.Errorf("Unmatched signatures should be blocked by default, got %q", got)
+	}
+
+	for _, s := range []string{
+		"block",
+		"quarantine Mal/*",
+		"block Mal/[",
+		"default reject",
+	} {
+		if _, err = ParsePolicy(strings.NewReader(s)); err == nil {
+			t.Errorf("An error should be returned for %q", s)
+		}
+	}
+	_, err = ParsePolicy(strings.NewReader("block Mal/*\nblock Mal/["))
+	if expected := fmt.Sprintf(policyPatternErr, 2, "block Mal/["); err == nil || err.Error() != expected {
+		t.Errorf("Expected %q got %v", expected, err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "policy")
+	if err := os.WriteFile(name, []byte(testPolicy), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p, err := LoadPolicy(name)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(p.Rules) != 3 {
+		t.Errorf("len(p.Rules) = %d, want 3", len(p.Rules))
+	}
+	if _, err = LoadPolicy(name + ".missing"); !os.IsNotExist(err) {
+		t.Errorf("LoadPolicy() error = %v, want a missing file", err)
+	}
+}
+
+func TestPolicyAction(t *testing.T) {
+	p, err := ParsePolicy(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		r    *Response
+		want PolicyAction
+	}{
+		{"clean", &Response{}, ActionAllow},
+		{"failed", &Response{ErrorOccured: true}, ActionNone},
+		{"signature", &Response{Infected: true, Signature: "Mal/Generic-S"}, ActionBlock},
+		{"strictest", &Response{Infected: true, Detections: []Detection{
+			{Signature: "PUA/InstallCore"},
+			{Signature: "EICAR-AV-Test"},
+		}}, ActionInform},
+	}
+	for _, tt := range tests {
+		if got := p.Action(tt.r); got != tt.want {
+			t.Errorf("%s: p.Action() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetPolicy(&Policy{Rules: []PolicyRule{{Pattern: "EICAR-*", Action: ActionInform}}})
+
+	r, err := p.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if r.Action != ActionInform {
+		t.Errorf("r.Action = %q, want %q", r.Action, ActionInform)
+	}
+	if r, err = p.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if r.Action != ActionAllow {
+		t.Errorf("r.Action = %q, want %q", r.Action, ActionAllow)
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolSize = 4
+)
+
+var (
+	// ErrPoolClosed is returned when using a closed Pool
+	ErrPoolClosed = errors.New("The pool is closed")
+)
+
+// A Pool represents a pool of SSSP client connections, it
+// is safe for concurrent use and exposes the same scanning
+// methods as a Client
+type Pool struct {
+	network     string
+	address     string
+	connTimeout time.Duration
+	cmdTimeout  time.Duration
+	connRetries int
+	// clientOptions are passed on to the clients the pool dials
+	clientOptions
+	scanRetry   RetryPolicy
+	staleProbe  time.Duration
+	maxLifetime time.Duration
+	// dirParallelism is the number of connections used by
+	// ScanLocalDir, it defaults to size
+	dirParallelism int
+	// discarded is the number of broken connections that have
+	// not been replaced yet
+	discarded int
+	size      int
+	idle      chan *Client
+	sem       chan struct{}
+	m         sync.Mutex
+	closed    bool
+	// futures completes the async scans
+	futures asyncRunner
+}
+
+// SetConnSleep sets the connection retry sleep used
+// by connections established after the call
+func (p *Pool) SetConnSleep(s time.Duration) {
+	if s > 0 {
+		p.m.Lock()
+		p.connSleep = s
+		p.m.Unlock()
+	}
+}
+
+// SetTLSConfig sets the TLS configuration used by connections
+// established after the call, nil disables TLS
+func (p *Pool) SetTLSConfig(config *tls.Config) {
+	p.m.Lock()
+	p.tlsConfig = config
+	p.m.Unlock()
+}
+
+// SetSpool enables scanning readers whose length is unknown on
+// connections established after the call, see Client.SetSpool
+func (p *Pool) SetSpool(max int64, dir string) {
+	if max >= 0 {
+		p.m.Lock()
+		p.spoolMax, p.spoolDir = max, dir
+		p.m.Unlock()
+	}
+}
+
+// SetDirParallelism sets the number of files ScanLocalDir scans at
+// once, values above the pool size wait for a free connection
+func (p *Pool) SetDirParallelism(n int) {
+	if n > 0 {
+		p.m.Lock()
+		p.dirParallelism = n
+		p.m.Unlock()
+	}
+}
+
+// Size returns the maximum number of connections
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// Get returns a connected Client from the pool, a new
+// connection is established if no idle ones are available,
+// the Client must be returned using Put
+func (p *Pool) Get(ctx context.Context) (c *Client, err error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+
+	p.m.Lock()
+	closed, opts := p.closed, p.clientOptions
+	p.m.Unlock()
+	if closed {
+		<-p.sem
+		err = ErrPoolClosed
+		return
+	}
+
+	select {
+	case c = <-p.idle:
+		reason, cause := p.expired(c, true)
+		if reason == "" {
+			return
+		}
+		c.logEvent(levelInfo, reason)
+		if cause != nil {
+			c.closeConn(cause)
+		} else {
+			c.Close()
+		}
+		p.m.Lock()
+		p.discarded++
+		p.m.Unlock()
+	default:
+	}
+
+	p.m.Lock()
+	reconnect := p.discarded > 0
+	if reconnect {
+		p.discarded--
+	}
+	p.m.Unlock()
+
+	c = &Client{
+		network:       p.network,
+		address:       p.address,
+		connTimeout:   p.connTimeout,
+		cmdTimeout:    p.cmdTimeout,
+		connRetries:   p.connRetries,
+		clientOptions: opts,
+	}
+	if err = c.Dial(ctx); err != nil {
+		if c.tc != nil {
+			c.tc.Close()
+		}
+		c = nil
+		<-p.sem
+		// the discarded connection is still to be replaced
+		if reconnect {
+			p.m.Lock()
+			p.discarded++
+			p.m.Unlock()
+		}
+		return
+	}
+	if reconnect {
+		c.count(MetricReconnects, 1)
+	}
+
+	return
+}
+
+// Warm establishes up to n connections, capped at the pool size,
+// and leaves them idle so that the first requests do not pay the
+// dial and greeting latency, idle connections count towards n.
+// The connections are dialed concurrently and the first error is
+// returned, connections that were established are kept.
+func (p *Pool) Warm(ctx context.Context, n int) (err error) {
+	var wg sync.WaitGroup
+	var once sync.Once
+
+	if n > p.size {
+		n = p.size
+	}
+
+	clients := make([]*Client, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, gerr := p.Get(ctx)
+			if gerr != nil {
+				once.Do(func() { err = gerr })
+				return
+			}
+			clients[i] = c
+		}(i)
+	}
+	wg.Wait()
+
+	for _, c := range clients {
+		if c != nil {
+			p.Put(c, nil)
+		}
+	}
+
+	return
+}
+
+// Put returns a Client to the pool, err is the error returned
+// by the last operation on the Client, clients whose connection
+// has failed are closed rather than reused
+func (p *Pool) Put(c *Client, err error) {
+	defer func() { <-p.sem }()
+
+	if c == nil {
+		return
+	}
+
+	broken := isConnErr(err)
+	p.m.Lock()
+	closed := p.closed
+	if broken && !closed {
+		p.discarded++
+	}
+	p.m.Unlock()
+
+	if broken {
+		c.logEvent(levelWarn, "discarding broken connection", LogKeyError, err)
+	}
+	if closed || broken {
+		c.closeConn(err)
+		return
+	}
+
+	if reason, _ := p.expired(c, false); reason != "" {
+		c.logEvent(levelInfo, reason)
+		p.m.Lock()
+		p.discarded++
+		p.m.Unlock()
+		c.Close()
+		return
+	}
+
+	c.idleSince = time.Now()
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// ScanFile submits a single file for scanning
+func (p *Pool) ScanFile(f string) (r *Response, err error) {
+	r, err = p.ScanFileContext(context.Background(), f)
+	return
+}
+
+// ScanFileContext submits a single file for scanning, ctx bounds the
+// wait for a connection and its labels are attached to the scan
+func (p *Pool) ScanFileContext(ctx context.Context, f string) (r *Response, err error) {
+	err = p.doContext(ctx, func(c *Client) (e error) {
+		r, e = c.ScanFileContext(ctx, f)
+		return
+	})
+
+	return
+}
+
+// ScanDir submits a directory for scanning
+func (p *Pool) ScanDir(d string, recurse bool) (r []*Response, err error) {
+	r, err = p.ScanDirContext(context.Background(), d, recurse)
+	return
+}
+
+// ScanDirContext submits a directory for scanning, ctx bounds the
+// wait for a connection and its labels are attached to the scan
+func (p *Pool) ScanDirContext(ctx context.Context, d string, recurse bool) (r []*Response, err error) {
+	err = p.doContext(ctx, func(c *Client) (e error) {
+		r, e = c.ScanDirContext(ctx, d, recurse)
+		return
+	})
+
+	return
+}
+
+// ScanStream submits a single file via a stream for scanning
+func (p *Pool) ScanStream(f string) (r *Response, err error) {
+	r, err = p.ScanStreamContext(context.Background(), f)
+	return
+}
+
+// ScanStreamContext submits a single file via a stream for scanning,
+// ctx bounds the wait for a connection and its labels are attached
+// to the scan
+func (p *Pool) ScanStreamContext(ctx context.Context, f string) (r *Response, err error) {
+	err = p.doContext(ctx, func(c *Client) (e error) {
+		r, e = c.ScanStreamContext(ctx, f)
+		return
+	})
+
+	return
+}
+
+// ScanReader submits an io reader via a stream for scanning
+func (p *Pool) ScanReader(i io.Reader) (r *Response, err error) {
+	r, err = p.ScanReaderContext(context.Background(), i)
+	return
+}
+
+// ScanReaderContext submits an io reader via a stream for scanning,
+// ctx bounds the wait for a connection and its labels are attached
+// to the scan
+func (p *Pool) ScanReaderContext(ctx context.Context, i io.Reader) (r *Response, err error) {
+	err = p.doRetry(ctx, rewinder(i), func(c *Client) (e error) {
+		r, e = c.ScanReaderContext(ctx, i)
+		return
+	})
+
+	return
+}
+
+// ScanSizedReader submits an io reader whose content length
+// is known to the caller via a stream for scanning
+func (p *Pool) ScanSizedReader(i io.Reader, n int64) (r *Response, err error) {
+	r, err = p.ScanSizedReaderContext(context.Background(), i, n)
+	return
+}
+
+// ScanSizedReaderContext submits an io reader whose content length
+// is known to the caller via a stream for scanning, ctx bounds the
+// wait for a connection and its labels are attached to the scan
+func (p *Pool) ScanSizedReaderContext(ctx context.Context, i io.Reader, n int64) (r *Response, err error) {
+	err = p.doRetry(ctx, rewinder(i), func(c *Client) (e error) {
+		r, e = c.ScanSizedReaderContext(ctx, i, n)
+		return
+	})
+
+	return
+}
+
+// QueryServer returns the server information
+func (p *Pool) QueryServer() (i Info, err error) {
+	err = p.do(func(c *Client) (e error) {
+		i, e = c.QueryServer()
+		return
+	})
+
+	return
+}
+
+// QuerySAVI returns the SAVI and virus data information
+func (p *Pool) QuerySAVI() (i Info, err error) {
+	err = p.do(func(c *Client) (e error) {
+		i, e = c.QuerySAVI()
+		return
+	})
+
+	return
+}
+
+// QueryEngine returns the engine configuration
+func (p *Pool) QueryEngine() (i Info, err error) {
+	err = p.do(func(c *Client) (e error) {
+		i, e = c.QueryEngine()
+		return
+	})
+
+	return
+}
+
+// Close closes all idle connections, connections in use are
+// closed when they are returned to the pool
+func (p *Pool) Close() (err error) {
+	p.m.Lock()
+	if p.closed {
+		p.m.Unlock()
+		return
+	}
+	p.closed = true
+	p.m.Unlock()
+
+	for {
+		select {
+		case c := <-p.idle:
+			c.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (p *Pool) do(fn func(*Client) error) (err error) {
+	err = p.doContext(context.Background(), fn)
+
+	return
+}
+
+func (p *Pool) doContext(ctx context.Context, fn func(*Client) error) (err error) {
+	err = p.doRetry(ctx, noRewind, fn)
+
+	return
+}
+
+func isConnErr(err error) bool {
+	var ne net.Error
+	var pe textproto.ProtocolError
+
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrServerClosed) || errors.Is(err, ErrProtocolDesync) {
+		return true
+	}
+
+	return errors.As(err, &ne) || errors.As(err, &pe)
+}
+
+// NewPool creates and returns a new Pool of up to size
+// connections, connections are established on demand
+func NewPool(network, address string, connTimeOut, ioTimeOut time.Duration, connRetries, size int) (p *Pool, err error) {
+	if network, address, err = checkAddress(network, address); err != nil {
+		return
+	}
+
+	if connTimeOut == 0 {
+		connTimeOut = defaultTimeout
+	}
+
+	if ioTimeOut == 0 {
+		ioTimeOut = defaultCmdTimeout
+	}
+
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+
+	p = &Pool{
+		network:     network,
+		address:     address,
+		connTimeout: connTimeOut,
+		cmdTimeout:  ioTimeOut,
+		connRetries: connRetries,
+		clientOptions: clientOptions{
+			connSleep: defaultSleep,
+		},
+		staleProbe: defaultStaleProbe,
+		size:       size,
+		idle:       make(chan *Client, size),
+		sem:        make(chan struct{}, size),
+	}
+
+	return
+}
@@ -0,0 +1,57 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build go1.18
+// +build go1.18
+
+/*
+Package protocol implements parsing of SSSP server responses
+SSSP - Golang SSSP protocol implementation
+*/
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseEvent(f *testing.F) {
+	for _, s := range []string{
+		"",
+		"ACC 5C8F4D3A/1",
+		"VIRUS EICAR-AV-Test /tmp/eicar.txt",
+		"OK 0203 /tmp/eicar.txt",
+		"FAIL 0210 /tmp/missing",
+		"DONE OK 0000 The function call succeeded",
+		"version: 5.80",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		e, err := ParseEvent(line)
+		if e == nil {
+			t.Fatalf("ParseEvent(%q) returned a nil event", line)
+		}
+		if err == nil && e.Raw != line {
+			t.Errorf("e.Raw = %q, want %q", e.Raw, line)
+		}
+	})
+}
+
+func FuzzParseResponse(f *testing.F) {
+	f.Add("ACC 1/1\nVIRUS EICAR-AV-Test /tmp/x\nOK 0203 /tmp/x\nDONE OK 0203 Virus found during virus scan\n")
+	f.Add("ACC 1/1\nFAIL 0210 /tmp/x\nDONE FAIL 0210 Could not open\n")
+	f.Fuzz(func(t *testing.T, s string) {
+		r, _ := ParseResponse(strings.Split(s, "\n"))
+		if r == nil {
+			t.Fatalf("ParseResponse returned a nil response")
+		}
+		for _, res := range r.Results {
+			if res.Infected && res.Signature == "" {
+				t.Errorf("Infected results must have a signature: %+v", res)
+			}
+		}
+	})
+}
@@ -0,0 +1,320 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package protocol implements parsing of SSSP server responses
+SSSP - Golang SSSP protocol implementation
+
+The functions in this package operate on the lines returned by the
+server and hold no network state, a response is the sequence of lines
+between the ACC line and the terminating blank line.
+*/
+package protocol
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	accResp        = "ACC"
+	rejResp        = "REJ"
+	okResp         = "OK"
+	failResp       = "FAIL"
+	doneResp       = "DONE"
+	virusResp      = "VIRUS"
+	typeResp       = "TYPE"
+	invalidRespErr = "Invalid server response: %s"
+	virusMatchErr  = "Virus match failure: %s"
+	rejectedErr    = "Request rejected: %s"
+)
+
+const (
+	// Unknown is a line that is not recognised
+	Unknown EventType = iota
+	// End is the blank line terminating a response
+	End
+	// Acc is the ACC line acknowledging a request
+	Acc
+	// Rej is the REJ line rejecting a request
+	Rej
+	// Virus is a VIRUS event reporting an infected item
+	Virus
+	// Ok is an OK event reporting a scanned item
+	Ok
+	// Fail is a FAIL event reporting an item that could not be scanned
+	Fail
+	// Done is the DONE line summarising the request
+	Done
+	// Info is a key: value line returned by QUERY
+	Info
+	// FileType is a TYPE event reporting the type the engine
+	// identified for an item
+	FileType
+)
+
+var (
+	virusRe = regexp.MustCompile(`^VIRUS\s(?P<signature>\S+)\s(?P<filename>\S+)?$`)
+)
+
+// An EventType represents the type of a response line
+type EventType int
+
+func (t EventType) String() (s string) {
+	n := [...]string{
+		"UNKNOWN",
+		"END",
+		"ACC",
+		"REJ",
+		"VIRUS",
+		"OK",
+		"FAIL",
+		"DONE",
+		"INFO",
+		"TYPE",
+	}
+	if t < Unknown || t > FileType {
+		return
+	}
+	s = n[t]
+	return
+}
+
+// An Event represents a single response line
+type Event struct {
+	Type EventType
+	// Signature is the virus name of a VIRUS event
+	Signature string
+	// Item is the item a VIRUS, OK, FAIL or TYPE event refers to
+	Item string
+	// Code is the result code of an OK, FAIL or DONE event
+	// or the type code of a TYPE event
+	Code string
+	// Status is OK or FAIL for a DONE event
+	Status string
+	// Text is the text following the code of a DONE event or
+	// the arguments of an ACC or REJ line
+	Text string
+	// Key and Value are set for Info events
+	Key   string
+	Value string
+	Raw   string
+}
+
+// A Result represents the outcome for a single item
+type Result struct {
+	Filename     string
+	ArchiveItem  string
+	Signature    string
+	Infected     bool
+	ErrorOccured bool
+	// Item is the item reported in the VIRUS event
+	Item string
+	Raw  string
+	// Detections holds every VIRUS event reported for the item
+	Detections []*Event
+}
+
+// A Response represents a parsed response
+type Response struct {
+	Results []*Result
+	Info    map[string][]string
+	// Types maps the items reported by TYPE events to their type
+	Types  map[string]string
+	Done   *Event
+	Events []*Event
+}
+
+// A DoneError is returned when the server reports DONE FAIL
+type DoneError struct {
+	Code string
+	Text string
+}
+
+func (e *DoneError) Error() string {
+	return strings.TrimSpace(e.Code + " " + e.Text)
+}
+
+// A RejectError is returned when the server rejects the request
+// with REJ, Line is the REJ line
+type RejectError struct {
+	Line string
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf(rejectedErr, e.Line)
+}
+
+// ParseEvent parses a single response line, lines that are
+// not recognised are returned as Unknown events, an error is
+// returned for recognised lines that are malformed
+func ParseEvent(line string) (e *Event, err error) {
+	e = &Event{Raw: line}
+
+	if line == "" {
+		e.Type = End
+		return
+	}
+
+	word, rest := line, ""
+	if i := strings.IndexByte(line, ' '); i != -1 {
+		word, rest = line[:i], line[i+1:]
+	}
+
+	switch word {
+	case accResp:
+		e.Type = Acc
+		e.Text = rest
+	case rejResp:
+		e.Type = Rej
+		e.Text = rest
+	case virusResp:
+		e.Type = Virus
+		m := virusRe.FindStringSubmatch(line)
+		if m == nil {
+			err = fmt.Errorf(virusMatchErr, line)
+			return
+		}
+		e.Signature, e.Item = m[1], m[2]
+	case okResp, failResp:
+		e.Type = Ok
+		if word == failResp {
+			e.Type = Fail
+		}
+		pts := strings.Split(line, " ")
+		if len(pts) != 3 {
+			err = fmt.Errorf(invalidRespErr, line)
+			return
+		}
+		e.Code, e.Item = pts[1], pts[2]
+	case typeResp:
+		e.Type = FileType
+		pts := strings.SplitN(rest, " ", 2)
+		if pts[0] == "" {
+			err = fmt.Errorf(invalidRespErr, line)
+			return
+		}
+		e.Code = pts[0]
+		if len(pts) > 1 {
+			e.Item = pts[1]
+		}
+	case doneResp:
+		e.Type = Done
+		pts := strings.SplitN(rest, " ", 3)
+		if pts[0] != okResp && pts[0] != failResp {
+			err = fmt.Errorf(invalidRespErr, line)
+			return
+		}
+		e.Status = pts[0]
+		if len(pts) > 1 {
+			e.Code = pts[1]
+		}
+		if len(pts) > 2 {
+			e.Text = pts[2]
+		}
+	default:
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			e.Type = Info
+			e.Key = strings.TrimSpace(line[:i])
+			e.Value = strings.TrimSpace(line[i+1:])
+			return
+		}
+		e.Type = Unknown
+	}
+
+	return
+}
+
+// ParseResponse parses the lines of a response, the ACC line and
+// the terminating blank line are optional. Each VIRUS event is
+// paired with the OK event that follows it, FAIL events produce
+// results with ErrorOccured set. The response parsed so far is
+// returned along with the last error encountered.
+func ParseResponse(lines []string) (r *Response, err error) {
+	var pending *Result
+
+	r = &Response{}
+
+	flush := func() {
+		if pending != nil {
+			r.Results = append(r.Results, pending)
+			pending = nil
+		}
+	}
+
+	for _, line := range lines {
+		e, perr := ParseEvent(line)
+		r.Events = append(r.Events, e)
+		if perr != nil {
+			err = perr
+			switch e.Type {
+			case Ok:
+				flush()
+			case Fail:
+				flush()
+				r.Results = append(r.Results, &Result{ErrorOccured: true, Raw: line})
+			}
+			continue
+		}
+
+		switch e.Type {
+		case Rej:
+			flush()
+			err = &RejectError{Line: line}
+			return
+		case Virus:
+			if pending != nil {
+				// further VIRUS events for the same item
+				pending.Detections = append(pending.Detections, e)
+				continue
+			}
+			pending = &Result{
+				Infected:    true,
+				Signature:   e.Signature,
+				Item:        e.Item,
+				ArchiveItem: e.Item,
+				Raw:         line,
+				Detections:  []*Event{e},
+			}
+		case Ok:
+			if pending != nil {
+				pending.Filename = e.Item
+				if pending.ArchiveItem == pending.Filename {
+					pending.ArchiveItem = ""
+				}
+				flush()
+			}
+		case Fail:
+			flush()
+			r.Results = append(r.Results, &Result{
+				Filename:     e.Item,
+				ErrorOccured: true,
+				Raw:          line,
+			})
+		case Done:
+			flush()
+			r.Done = e
+			if e.Status == failResp {
+				err = &DoneError{Code: e.Code, Text: e.Text}
+			}
+		case FileType:
+			if r.Types == nil {
+				r.Types = make(map[string]string)
+			}
+			r.Types[e.Item] = e.Code
+		case Info:
+			if r.Info == nil {
+				r.Info = make(map[string][]string)
+			}
+			r.Info[e.Key] = append(r.Info[e.Key], e.Value)
+		case End:
+			flush()
+		}
+	}
+	flush()
+
+	return
+}
@@ -0,0 +1,170 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package protocol implements parsing of SSSP server responses
+SSSP - Golang SSSP protocol implementation
+*/
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestEventType(t *testing.T) {
+	tests := []struct {
+		t EventType
+		s string
+	}{
+		{Unknown, "UNKNOWN"},
+		{End, "END"},
+		{Acc, "ACC"},
+		{Virus, "VIRUS"},
+		{Done, "DONE"},
+		{Info, "INFO"},
+		{FileType, "TYPE"},
+		{EventType(100), ""},
+	}
+	for _, tt := range tests {
+		if s := tt.t.String(); s != tt.s {
+			t.Errorf("%d.String() = %q, want %q", tt.t, s, tt.s)
+		}
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		line string
+		want Event
+		err  bool
+	}{
+		{"", Event{Type: End}, false},
+		{"ACC 5C8F4D3A/2", Event{Type: Acc, Text: "5C8F4D3A/2"}, false},
+		{"REJ 2 QUERY FOO", Event{Type: Rej, Text: "2 QUERY FOO"}, false},
+		{"VIRUS EICAR-AV-Test /tmp/eicar.txt", Event{Type: Virus, Signature: "EICAR-AV-Test", Item: "/tmp/eicar.txt"}, false},
+		{"VIRUS EICAR-AV-Test ", Event{Type: Virus, Signature: "EICAR-AV-Test"}, false},
+		{"VIRUS", Event{Type: Virus}, true},
+		{"OK 0203 /tmp/eicar.txt", Event{Type: Ok, Code: "0203", Item: "/tmp/eicar.txt"}, false},
+		{"OK 0203", Event{Type: Ok}, true},
+		{"FAIL 0210 /tmp/missing", Event{Type: Fail, Code: "0210", Item: "/tmp/missing"}, false},
+		{"DONE OK 0000 The function call succeeded", Event{Type: Done, Status: "OK", Code: "0000", Text: "The function call succeeded"}, false},
+		{"DONE FAIL 0210", Event{Type: Done, Status: "FAIL", Code: "0210"}, false},
+		{"DONE MAYBE 0000", Event{Type: Done}, true},
+		{"TYPE 1A /tmp/eicar.zip", Event{Type: FileType, Code: "1A", Item: "/tmp/eicar.zip"}, false},
+		{"TYPE", Event{Type: FileType}, true},
+		{"version: 5.80", Event{Type: Info, Key: "version", Value: "5.80"}, false},
+		{"garbage", Event{Type: Unknown}, false},
+	}
+	for _, tt := range tests {
+		e, err := ParseEvent(tt.line)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseEvent(%q) should return an error", tt.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseEvent(%q) returned error: %s", tt.line, err)
+			continue
+		}
+		tt.want.Raw = tt.line
+		if *e != tt.want {
+			t.Errorf("ParseEvent(%q) = %+v, want %+v", tt.line, *e, tt.want)
+		}
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	var de *DoneError
+
+	r, err := ParseResponse([]string{
+		"ACC 5C8F4D3A/1",
+		"TYPE 1A /tmp/test/eicar.zip",
+		"TYPE 06 /tmp/test/eicar.zip/eicar.com",
+		"VIRUS EICAR-AV-Test /tmp/test/eicar.zip/eicar.com",
+		"VIRUS EICAR-AV-Test /tmp/test/eicar.zip/eicar.txt",
+		"OK 0203 /tmp/test/eicar.zip",
+		"VIRUS EICAR-AV-Test /tmp/test/eicar.txt",
+		"OK 0203 /tmp/test/eicar.txt",
+		"FAIL 0210 /tmp/test/locked",
+		"DONE FAIL 0210 Could not open item passed to SAVI for scanning",
+		"",
+	})
+	if !errors.As(err, &de) || de.Code != "0210" {
+		t.Fatalf("Expected a DoneError got %v", err)
+	}
+	if err.Error() != "0210 Could not open item passed to SAVI for scanning" {
+		t.Errorf("err.Error() = %q", err.Error())
+	}
+	if len(r.Results) != 3 {
+		t.Fatalf("len(r.Results) = %d, want %d", len(r.Results), 3)
+	}
+	if res := r.Results[0]; !res.Infected || res.Filename != "/tmp/test/eicar.zip" || res.ArchiveItem != "/tmp/test/eicar.zip/eicar.com" {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if d := r.Results[0].Detections; len(d) != 2 || d[1].Item != "/tmp/test/eicar.zip/eicar.txt" {
+		t.Errorf("Every VIRUS event should be kept: %+v", d)
+	}
+	if res := r.Results[1]; !res.Infected || res.Filename != "/tmp/test/eicar.txt" || res.ArchiveItem != "" {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if res := r.Results[2]; !res.ErrorOccured || res.Filename != "/tmp/test/locked" {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if r.Done == nil || r.Done.Status != "FAIL" {
+		t.Errorf("Unexpected done event: %+v", r.Done)
+	}
+	if len(r.Events) != 11 {
+		t.Errorf("len(r.Events) = %d, want %d", len(r.Events), 11)
+	}
+	if len(r.Types) != 2 || r.Types["/tmp/test/eicar.zip"] != "1A" || r.Types["/tmp/test/eicar.zip/eicar.com"] != "06" {
+		t.Errorf("Unexpected types: %v", r.Types)
+	}
+
+	r, err = ParseResponse([]string{"VIRUS EICAR-AV-Test ", "DONE OK 0203 Virus found during virus scan"})
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r.Results) != 1 || r.Results[0].Signature != "EICAR-AV-Test" {
+		t.Errorf("Unexpected results: %+v", r.Results)
+	}
+
+	r, err = ParseResponse([]string{"ACC 1/1", "version: 5.80", "method: SCANFILE", "method: SCANDATA", ""})
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r.Info["method"]) != 2 || r.Info["version"][0] != "5.80" {
+		t.Errorf("Unexpected info: %v", r.Info)
+	}
+
+	var re *RejectError
+	if _, err = ParseResponse([]string{"REJ 2 QUERY FOO"}); !errors.As(err, &re) || re.Line != "REJ 2 QUERY FOO" {
+		t.Errorf("A RejectError should be returned: %v", err)
+	}
+	if expected := fmt.Sprintf(rejectedErr, "REJ 2 QUERY FOO"); err == nil || err.Error() != expected {
+		t.Errorf("Expected %q got %v", expected, err)
+	}
+	if _, err = ParseResponse([]string{"VIRUS x"}); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	lines := []string{"ACC 5C8F4D3A/1"}
+	for n := 0; n < 1000; n++ {
+		p := fmt.Sprintf("/srv/mail/%04d/message.eml", n)
+		lines = append(lines, "VIRUS EICAR-AV-Test "+p, "OK 0203 "+p)
+	}
+	lines = append(lines, "DONE OK 0203 Virus found during virus scan", "")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseResponse(lines); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package proxy implements an SSSP aware load balancing proxy
+SSSP - Golang SSSP protocol implementation
+
+Each client connection is assigned to a healthy upstream server in
+round robin order, the upstream greeting is verified before it is
+relayed so a client is never handed a server that is not ready.
+Upstreams are health checked periodically by performing the SSSP
+handshake.
+
+SCANFILE and SCANDIR requests are passed through unchanged so the
+paths must be accessible to every upstream server.
+*/
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	protocolVersion       = "SSSP/1.0"
+	defaultDialTimeout    = 5 * time.Second
+	defaultHealthInterval = 10 * time.Second
+	noUpstreamErr         = "No upstream servers configured"
+	invalidUpstreamErr    = "Invalid upstream: %s"
+	greetingErr           = "Greeting failed: %s"
+	ackErr                = "Ack failed: %s"
+	unavailableResp       = "FAIL No upstream server available"
+)
+
+var (
+	// ErrNoUpstream is returned when no healthy upstream
+	// server is available
+	ErrNoUpstream = errors.New("No upstream server available")
+	// ErrServerClosed is returned by Serve after Close is called
+	ErrServerClosed = errors.New("proxy: Server closed")
+)
+
+// An Upstream represents an upstream SSSP server
+type Upstream struct {
+	Network string
+	Address string
+
+	m       sync.Mutex
+	healthy bool
+	lastErr error
+	active  int
+}
+
+// Healthy reports whether the upstream passed its last health check
+func (u *Upstream) Healthy() bool {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return u.healthy
+}
+
+// Err returns the error from the last failed health check
+func (u *Upstream) Err() error {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return u.lastErr
+}
+
+// Active returns the number of client connections being
+// relayed to the upstream
+func (u *Upstream) Active() int {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return u.active
+}
+
+func (u *Upstream) String() string {
+	return u.Network + ":" + u.Address
+}
+
+func (u *Upstream) setHealth(err error) {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	u.healthy = err == nil
+	u.lastErr = err
+}
+
+// A Proxy relays SSSP client connections to upstream servers
+type Proxy struct {
+	upstreams      []*Upstream
+	dialTimeout    time.Duration
+	healthInterval time.Duration
+	next           int
+	m              sync.Mutex
+	wg             sync.WaitGroup
+	listeners      map[net.Listener]bool
+	conns          map[net.Conn]bool
+	closed         bool
+	stop           chan struct{}
+}
+
+// SetDialTimeout sets the timeout used when connecting to
+// and health checking upstream servers
+func (p *Proxy) SetDialTimeout(t time.Duration) {
+	if t > 0 {
+		p.dialTimeout = t
+	}
+}
+
+// SetHealthInterval sets the interval between health checks
+func (p *Proxy) SetHealthInterval(t time.Duration) {
+	if t > 0 {
+		p.healthInterval = t
+	}
+}
+
+// Upstreams returns the upstream servers
+func (p *Proxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Check health checks all the upstream servers
+func (p *Proxy) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			u.setHealth(p.check(ctx, u))
+		}(u)
+	}
+	wg.Wait()
+}
+
+// Serve accepts client connections on l and relays them to
+// the upstream servers, health checks run until Close is called
+func (p *Proxy) Serve(l net.Listener) (err error) {
+	var c net.Conn
+
+	p.m.Lock()
+	if p.closed {
+		p.m.Unlock()
+		l.Close()
+		err = ErrServerClosed
+		return
+	}
+	start := len(p.listeners) == 0
+	p.listeners[l] = true
+	p.m.Unlock()
+
+	if start {
+		p.Check(context.Background())
+		p.wg.Add(1)
+		go p.healthLoop()
+	}
+
+	for {
+		if c, err = l.Accept(); err != nil {
+			p.m.Lock()
+			if p.closed {
+				err = ErrServerClosed
+			}
+			p.m.Unlock()
+			return
+		}
+
+		p.m.Lock()
+		if p.closed {
+			p.m.Unlock()
+			c.Close()
+			err = ErrServerClosed
+			return
+		}
+		p.conns[c] = true
+		p.wg.Add(1)
+		p.m.Unlock()
+
+		go p.handle(c)
+	}
+}
+
+// Close stops the listeners and health checks, closes all
+// client connections and waits for the relays to finish
+func (p *Proxy) Close() (err error) {
+	p.m.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+	}
+	for l := range p.listeners {
+		l.Close()
+	}
+	for c := range p.conns {
+		c.Close()
+	}
+	p.m.Unlock()
+
+	p.wg.Wait()
+
+	return
+}
+
+func (p *Proxy) healthLoop() {
+	defer p.wg.Done()
+
+	t := time.NewTicker(p.healthInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.Check(context.Background())
+		}
+	}
+}
+
+func (p *Proxy) check(ctx context.Context, u *Upstream) (err error) {
+	var line string
+	var uc net.Conn
+	var br *bufio.Reader
+
+	if uc, br, _, err = p.connect(ctx, u); err != nil {
+		return
+	}
+	defer uc.Close()
+
+	uc.SetDeadline(time.Now().Add(p.dialTimeout))
+	if _, err = fmt.Fprintf(uc, "%s\n", protocolVersion); err != nil {
+		return
+	}
+	if line, err = readLine(br); err != nil {
+		return
+	}
+	if !strings.HasPrefix(line, "ACC") {
+		err = fmt.Errorf(ackErr, line)
+		return
+	}
+	fmt.Fprintf(uc, "BYE\n")
+
+	return
+}
+
+// connect dials the upstream and reads its greeting
+func (p *Proxy) connect(ctx context.Context, u *Upstream) (uc net.Conn, br *bufio.Reader, line string, err error) {
+	d := &net.Dialer{Timeout: p.dialTimeout}
+	if uc, err = d.DialContext(ctx, u.Network, u.Address); err != nil {
+		return
+	}
+
+	br = bufio.NewReader(uc)
+	uc.SetDeadline(time.Now().Add(p.dialTimeout))
+	if line, err = readLine(br); err == nil && !strings.HasPrefix(line, "OK") {
+		err = fmt.Errorf(greetingErr, line)
+	}
+	uc.SetDeadline(time.Time{})
+	if err != nil {
+		uc.Close()
+		uc = nil
+	}
+
+	return
+}
+
+// pick returns the next healthy upstream after those already tried
+func (p *Proxy) pick(tried map[*Upstream]bool) (u *Upstream) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := len(p.upstreams)
+	for i := 0; i < n; i++ {
+		c := p.upstreams[(p.next+i)%n]
+		if !tried[c] && c.Healthy() {
+			p.next = (p.next + i + 1) % n
+			u = c
+			return
+		}
+	}
+
+	return
+}
+
+func (p *Proxy) dialUpstream() (u *Upstream, uc net.Conn, br *bufio.Reader, greeting string, err error) {
+	tried := make(map[*Upstream]bool)
+	for {
+		if u = p.pick(tried); u == nil {
+			err = ErrNoUpstream
+			return
+		}
+		tried[u] = true
+		if uc, br, greeting, err = p.connect(context.Background(), u); err == nil {
+			return
+		}
+		u.setHealth(err)
+	}
+}
+
+func (p *Proxy) handle(c net.Conn) {
+	var u *Upstream
+	var uc net.Conn
+	var br *bufio.Reader
+	var greeting string
+	var err error
+
+	defer func() {
+		c.Close()
+		p.m.Lock()
+		delete(p.conns, c)
+		p.m.Unlock()
+		p.wg.Done()
+	}()
+
+	if u, uc, br, greeting, err = p.dialUpstream(); err != nil {
+		fmt.Fprintf(c, "%s\n", unavailableResp)
+		return
+	}
+
+	p.m.Lock()
+	if p.closed {
+		p.m.Unlock()
+		uc.Close()
+		return
+	}
+	p.conns[uc] = true
+	p.m.Unlock()
+
+	u.m.Lock()
+	u.active++
+	u.m.Unlock()
+
+	defer func() {
+		uc.Close()
+		p.m.Lock()
+		delete(p.conns, uc)
+		p.m.Unlock()
+		u.m.Lock()
+		u.active--
+		u.m.Unlock()
+	}()
+
+	if _, err = io.WriteString(c, greeting+"\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(uc, c)
+		closeWrite(uc)
+		close(done)
+	}()
+	io.Copy(c, br)
+	closeWrite(c)
+	<-done
+}
+
+func closeWrite(c net.Conn) {
+	type closeWriter interface {
+		CloseWrite() error
+	}
+
+	if cw, ok := c.(closeWriter); ok {
+		cw.CloseWrite()
+		return
+	}
+	c.Close()
+}
+
+func readLine(br *bufio.Reader) (line string, err error) {
+	if line, err = br.ReadString('\n'); err != nil {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	return
+}
+
+// ParseUpstream parses an upstream address of the form
+// network:address, addresses without a network are treated
+// as tcp and addresses starting with / as unix sockets
+func ParseUpstream(s string) (u *Upstream, err error) {
+	u = &Upstream{}
+	switch {
+	case strings.HasPrefix(s, "/"):
+		u.Network, u.Address = "unix", s
+	case strings.HasPrefix(s, "unix:"), strings.HasPrefix(s, "tcp:"),
+		strings.HasPrefix(s, "tcp4:"), strings.HasPrefix(s, "tcp6:"):
+		i := strings.IndexByte(s, ':')
+		u.Network, u.Address = s[:i], s[i+1:]
+	default:
+		u.Network, u.Address = "tcp", s
+	}
+
+	if u.Address == "" {
+		err = fmt.Errorf(invalidUpstreamErr, s)
+		u = nil
+	}
+
+	return
+}
+
+// NewProxy creates and returns a new Proxy for the upstreams
+func NewProxy(upstreams ...*Upstream) (p *Proxy, err error) {
+	if len(upstreams) == 0 {
+		err = errors.New(noUpstreamErr)
+		return
+	}
+
+	p = &Proxy{
+		upstreams:      upstreams,
+		dialTimeout:    defaultDialTimeout,
+		healthInterval: defaultHealthInterval,
+		listeners:      make(map[net.Listener]bool),
+		conns:          make(map[net.Conn]bool),
+		stop:           make(chan struct{}),
+	}
+
+	return
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package proxy implements an SSSP aware load balancing proxy
+SSSP - Golang SSSP protocol implementation
+*/
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		in      string
+		network string
+		address string
+		err     bool
+	}{
+		{"/var/lib/savdid/sssp.sock", "unix", "/var/lib/savdid/sssp.sock", false},
+		{"unix:/tmp/sssp.sock", "unix", "/tmp/sssp.sock", false},
+		{"tcp:127.0.0.1:4010", "tcp", "127.0.0.1:4010", false},
+		{"tcp6:[::1]:4010", "tcp6", "[::1]:4010", false},
+		{"192.168.1.1:4010", "tcp", "192.168.1.1:4010", false},
+		{"tcp:", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		u, err := ParseUpstream(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseUpstream(%q) should return an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseUpstream(%q) returned error: %s", tt.in, err)
+			continue
+		}
+		if u.Network != tt.network || u.Address != tt.address {
+			t.Errorf("ParseUpstream(%q) = %s, want %s:%s", tt.in, u, tt.network, tt.address)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	if _, err := NewProxy(); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+
+	ts1 := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts1.Close()
+	ts2 := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts2.Close()
+
+	p, err := NewProxy(
+		&Upstream{Network: ts1.Network, Address: ts1.Addr},
+		&Upstream{Network: ts2.Network, Address: ts2.Addr},
+	)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	p.SetDialTimeout(time.Second)
+	p.SetHealthInterval(time.Hour)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- p.Serve(l) }()
+
+	scan := func() (r *sssp.Response, err error) {
+		var c *sssp.Client
+		if c, err = sssp.NewClient(context.Background(), "tcp", l.Addr().String(), time.Second, 2*time.Second, 0); err != nil {
+			return
+		}
+		defer c.Close()
+		r, err = c.ScanReader(strings.NewReader(eicarVirus))
+		return
+	}
+
+	for i := 0; i < 4; i++ {
+		r, err := scan()
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if !r.Infected || r.Signature != sssptest.EicarSignature {
+			t.Errorf("Unexpected result: %+v", r)
+		}
+	}
+	if n1, n2 := len(ts1.Requests()), len(ts2.Requests()); n1 != 2 || n2 != 2 {
+		t.Errorf("Requests should be balanced got %d and %d", n1, n2)
+	}
+
+	ts1.Close()
+	for i := 0; i < 2; i++ {
+		if _, err = scan(); err != nil {
+			t.Fatalf("The healthy upstream should be used: %s", err)
+		}
+	}
+	if p.Upstreams()[0].Healthy() || p.Upstreams()[0].Err() == nil {
+		t.Errorf("The failed upstream should be marked unhealthy")
+	}
+
+	ts2.Close()
+	p.Check(context.Background())
+	if _, err = scan(); err == nil {
+		t.Errorf("An error should be returned when no upstream is available")
+	}
+
+	p.Close()
+	if err = <-errc; err != ErrServerClosed {
+		t.Errorf("Expected %v got %v", ErrServerClosed, err)
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package quarantine implements quarantining of infected files
+SSSP - Golang SSSP protocol implementation
+
+Infected files are moved or copied into a quarantine directory
+alongside a JSON metadata sidecar, they can later be restored
+or purged once they reach a given age.
+*/
+package quarantine
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	metaExt       = ".json"
+	tmpPrefix     = ".tmp-"
+	notInfected   = "The file: %s is not infected"
+	existsErr     = "The file: %s already exists"
+	invalidIDErr  = "Invalid quarantine id: %s"
+	dirScanErr    = "Quarantining directories is not supported"
+	noFilenameErr = "The response has no filename"
+)
+
+// Metadata represents the information stored alongside a
+// quarantined file
+type Metadata struct {
+	ID            string      `json:"id"`
+	OriginalPath  string      `json:"original_path"`
+	ArchiveItem   string      `json:"archive_item,omitempty"`
+	Signature     string      `json:"signature"`
+	SHA256        string      `json:"sha256"`
+	Size          int64       `json:"size"`
+	Mode          os.FileMode `json:"mode"`
+	ModTime       time.Time   `json:"mod_time"`
+	QuarantinedAt time.Time   `json:"quarantined_at"`
+}
+
+// A Manager manages a quarantine directory
+type Manager struct {
+	dir string
+}
+
+// Dir returns the quarantine directory
+func (m *Manager) Dir() string {
+	return m.dir
+}
+
+// Quarantine moves the infected file referenced by r into the
+// quarantine directory
+func (m *Manager) Quarantine(r *sssp.Response) (md *Metadata, err error) {
+	md, err = m.store(r, newID(), true)
+
+	return
+}
+
+// QuarantineAs moves the infected file referenced by r into the
+// quarantine directory using id as its name, id may be a relative
+// slash separated path which is preserved beneath the directory
+func (m *Manager) QuarantineAs(r *sssp.Response, id string) (md *Metadata, err error) {
+	if err = checkID(id); err != nil {
+		return
+	}
+
+	if _, err = os.Lstat(m.dataPath(id)); err == nil {
+		err = fmt.Errorf(existsErr, m.dataPath(id))
+		return
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(m.dataPath(id)), 0700); err != nil {
+		return
+	}
+
+	md, err = m.store(r, id, true)
+
+	return
+}
+
+// Copy copies the infected file referenced by r into the
+// quarantine directory leaving the original in place
+func (m *Manager) Copy(r *sssp.Response) (md *Metadata, err error) {
+	md, err = m.store(r, newID(), false)
+
+	return
+}
+
+// Get returns the metadata of the quarantined item id
+func (m *Manager) Get(id string) (md *Metadata, err error) {
+	var b []byte
+
+	if err = checkID(id); err != nil {
+		return
+	}
+
+	if b, err = ioutil.ReadFile(m.metaPath(id)); err != nil {
+		return
+	}
+
+	md = &Metadata{}
+	err = json.Unmarshal(b, md)
+
+	return
+}
+
+// List returns the metadata of all quarantined items ordered
+// by the time they were quarantined
+func (m *Manager) List() (r []*Metadata, err error) {
+	err = filepath.Walk(m.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(p, metaExt) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.dir, p)
+		if err != nil {
+			return err
+		}
+		id := filepath.ToSlash(strings.TrimSuffix(rel, metaExt))
+		if _, err = os.Lstat(m.dataPath(id)); err != nil {
+			// a quarantined file that has the metadata extension
+			return nil
+		}
+
+		md, err := m.Get(id)
+		if err != nil {
+			return err
+		}
+		r = append(r, md)
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].QuarantinedAt.Before(r[j].QuarantinedAt)
+	})
+
+	return
+}
+
+// Restore moves the quarantined item id back to its original
+// path, it will not overwrite an existing file
+func (m *Manager) Restore(id string) (err error) {
+	var md *Metadata
+
+	if md, err = m.Get(id); err != nil {
+		return
+	}
+
+	err = m.RestoreTo(id, md.OriginalPath)
+
+	return
+}
+
+// RestoreTo moves the quarantined item id to dest, it will not
+// overwrite an existing file
+func (m *Manager) RestoreTo(id, dest string) (err error) {
+	var md *Metadata
+
+	if md, err = m.Get(id); err != nil {
+		return
+	}
+
+	if _, err = os.Lstat(dest); err == nil {
+		err = fmt.Errorf(existsErr, dest)
+		return
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return
+	}
+
+	if _, err = move(m.dataPath(id), dest, md.Mode); err != nil {
+		return
+	}
+
+	os.Chtimes(dest, md.ModTime, md.ModTime)
+	err = os.Remove(m.metaPath(id))
+
+	return
+}
+
+// Delete permanently removes the quarantined item id
+func (m *Manager) Delete(id string) (err error) {
+	if err = checkID(id); err != nil {
+		return
+	}
+
+	if err = os.Remove(m.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	err = os.Remove(m.metaPath(id))
+
+	return
+}
+
+// Purge permanently removes items that were quarantined more
+// than age ago and returns the number of items removed
+func (m *Manager) Purge(age time.Duration) (n int, err error) {
+	var items []*Metadata
+
+	if items, err = m.List(); err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-age)
+	for _, md := range items {
+		if md.QuarantinedAt.After(cutoff) {
+			continue
+		}
+		if err = m.Delete(md.ID); err != nil {
+			return
+		}
+		n++
+	}
+
+	return
+}
+
+func (m *Manager) store(r *sssp.Response, id string, remove bool) (md *Metadata, err error) {
+	var b []byte
+	var stat os.FileInfo
+
+	if r.Filename == "" {
+		err = fmt.Errorf(noFilenameErr)
+		return
+	}
+
+	if !r.Infected {
+		err = fmt.Errorf(notInfected, r.Filename)
+		return
+	}
+
+	if stat, err = os.Stat(r.Filename); err != nil {
+		return
+	}
+
+	if stat.IsDir() {
+		err = fmt.Errorf(dirScanErr)
+		return
+	}
+
+	md = &Metadata{
+		ID:            id,
+		OriginalPath:  r.Filename,
+		ArchiveItem:   r.ArchiveItem,
+		Signature:     r.Signature,
+		Size:          stat.Size(),
+		Mode:          stat.Mode().Perm(),
+		ModTime:       stat.ModTime(),
+		QuarantinedAt: time.Now(),
+	}
+	if abs, e := filepath.Abs(r.Filename); e == nil {
+		md.OriginalPath = abs
+	}
+
+	if remove {
+		md.SHA256, err = move(r.Filename, m.dataPath(md.ID), 0600)
+	} else {
+		md.SHA256, err = copyFile(r.Filename, m.dataPath(md.ID), 0600)
+	}
+	if err != nil {
+		return
+	}
+
+	if b, err = json.MarshalIndent(md, "", "  "); err != nil {
+		return
+	}
+
+	err = writeFile(m.metaPath(md.ID), b, 0600)
+
+	return
+}
+
+func (m *Manager) dataPath(id string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(id))
+}
+
+func (m *Manager) metaPath(id string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(id)+metaExt)
+}
+
+// move renames src to dst falling back to copy and remove when
+// they reside on different file systems
+func move(src, dst string, mode os.FileMode) (sum string, err error) {
+	var le *os.LinkError
+
+	if sum, err = hashFile(src); err != nil {
+		return
+	}
+
+	if err = os.Rename(src, dst); err == nil {
+		err = os.Chmod(dst, mode)
+		return
+	}
+
+	if !errors.As(err, &le) || le.Err != syscall.EXDEV {
+		return
+	}
+
+	if sum, err = copyFile(src, dst, mode); err != nil {
+		return
+	}
+
+	err = os.Remove(src)
+
+	return
+}
+
+// copyFile copies src to a temporary file in the directory of
+// dst which is synced and then renamed into place
+func copyFile(src, dst string, mode os.FileMode) (sum string, err error) {
+	var in *os.File
+
+	if in, err = os.Open(src); err != nil {
+		return
+	}
+	defer in.Close()
+
+	h := sha256.New()
+	if err = atomicWrite(dst, io.TeeReader(in, h), mode); err != nil {
+		return
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	return
+}
+
+func writeFile(dst string, b []byte, mode os.FileMode) (err error) {
+	err = atomicWrite(dst, bytes.NewReader(b), mode)
+
+	return
+}
+
+func atomicWrite(dst string, i io.Reader, mode os.FileMode) (err error) {
+	var out *os.File
+
+	if out, err = ioutil.TempFile(filepath.Dir(dst), tmpPrefix); err != nil {
+		return
+	}
+	tmp := out.Name()
+
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = io.Copy(out, i); err != nil {
+		return
+	}
+
+	if err = out.Sync(); err != nil {
+		return
+	}
+
+	if err = out.Chmod(mode); err != nil {
+		return
+	}
+
+	if err = out.Close(); err != nil {
+		return
+	}
+
+	err = os.Rename(tmp, dst)
+
+	return
+}
+
+func hashFile(p string) (sum string, err error) {
+	var f *os.File
+
+	if f, err = os.Open(p); err != nil {
+		return
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	return
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// checkID checks that id is a relative slash separated path that
+// does not escape the quarantine directory, hidden elements are
+// rejected as they are used for temporary files
+func checkID(id string) (err error) {
+	if id == "" || strings.ContainsRune(id, '\\') || path.IsAbs(id) || path.Clean(id) != id {
+		err = fmt.Errorf(invalidIDErr, id)
+		return
+	}
+
+	for _, e := range strings.Split(id, "/") {
+		if strings.HasPrefix(e, ".") {
+			err = fmt.Errorf(invalidIDErr, id)
+			return
+		}
+	}
+
+	return
+}
+
+// NewManager creates and returns a new Manager, the quarantine
+// directory is created if it does not exist
+func NewManager(dir string) (m *Manager, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	m = &Manager{dir: dir}
+
+	return
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package quarantine implements quarantining of infected files
+SSSP - Golang SSSP protocol implementation
+*/
+package quarantine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+	eicarHash  = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+)
+
+func setup(t *testing.T) (dir string, m *Manager, fn string) {
+	var err error
+
+	if dir, err = ioutil.TempDir("", "quarantine"); err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %s", err)
+	}
+	if m, err = NewManager(filepath.Join(dir, "quarantine")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	fn = filepath.Join(dir, "spool", "eicar.txt")
+	os.MkdirAll(filepath.Dir(fn), 0755)
+	if err = ioutil.WriteFile(fn, []byte(eicarVirus), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() failed: %s", err)
+	}
+	return
+}
+
+func TestQuarantine(t *testing.T) {
+	dir, m, fn := setup(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := m.Quarantine(&sssp.Response{Filename: fn}); err == nil {
+		t.Errorf("An error should be returned for a clean file")
+	}
+
+	r := &sssp.Response{Filename: fn, Infected: true, Signature: "EICAR-AV-Test"}
+	md, err := m.Quarantine(r)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("The original file should have been removed")
+	}
+	if md.SHA256 != eicarHash {
+		t.Errorf("md.SHA256 = %s, want %s", md.SHA256, eicarHash)
+	}
+	if md.Signature != r.Signature {
+		t.Errorf("md.Signature = %s, want %s", md.Signature, r.Signature)
+	}
+	if md.Mode != 0644 {
+		t.Errorf("md.Mode = %o, want %o", md.Mode, 0644)
+	}
+
+	items, err := m.List()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(items) != 1 || items[0].ID != md.ID {
+		t.Fatalf("m.List() = %v, want [%v]", items, md)
+	}
+
+	if err = m.Restore(md.ID); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("The file should have been restored: %s", err)
+	}
+	if string(b) != eicarVirus {
+		t.Errorf("Restored content = %q, want %q", b, eicarVirus)
+	}
+	if items, _ = m.List(); len(items) != 0 {
+		t.Errorf("len(m.List()) = %d, want %d", len(items), 0)
+	}
+	if _, err = m.Get("../" + md.ID); err == nil {
+		t.Errorf("An error should be returned for an invalid id")
+	}
+}
+
+func TestCopyAndPurge(t *testing.T) {
+	dir, m, fn := setup(t)
+	defer os.RemoveAll(dir)
+
+	r := &sssp.Response{Filename: fn, Infected: true, Signature: "EICAR-AV-Test"}
+	md, err := m.Copy(r)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = os.Stat(fn); err != nil {
+		t.Errorf("The original file should not have been removed")
+	}
+	if err = m.Restore(md.ID); err == nil {
+		t.Errorf("Restore should not overwrite an existing file")
+	}
+	n, err := m.Purge(time.Hour)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if n != 0 {
+		t.Errorf("m.Purge(time.Hour) = %d, want %d", n, 0)
+	}
+	if n, err = m.Purge(0); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if n != 1 {
+		t.Errorf("m.Purge(0) = %d, want %d", n, 1)
+	}
+	if _, err = os.Stat(filepath.Join(m.Dir(), md.ID)); !os.IsNotExist(err) {
+		t.Errorf("The quarantined file should have been purged")
+	}
+}
+
+func TestQuarantineAs(t *testing.T) {
+	dir, m, fn := setup(t)
+	defer os.RemoveAll(dir)
+
+	r := &sssp.Response{Filename: fn, Infected: true, Signature: "EICAR-AV-Test"}
+	for _, id := range []string{"", "/etc/passwd", "../escape", "a/../b", "a/.hidden", `a\b`} {
+		if _, err := m.QuarantineAs(r, id); err == nil {
+			t.Errorf("An error should be returned for the id %q", id)
+		}
+	}
+
+	md, err := m.QuarantineAs(r, "uploads/sub/eicar.txt.json")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(m.Dir(), "uploads", "sub", "eicar.txt.json")); err != nil {
+		t.Errorf("The relative path should be preserved: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(m.Dir(), "uploads", "sub", "eicar.txt.json.json")); err != nil {
+		t.Errorf("The metadata sidecar should be written: %s", err)
+	}
+
+	items, err := m.List()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(items) != 1 || items[0].ID != md.ID {
+		t.Fatalf("m.List() = %v, want [%v]", items, md)
+	}
+
+	if err = ioutil.WriteFile(fn, []byte(eicarVirus), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() failed: %s", err)
+	}
+	if _, err = m.QuarantineAs(r, md.ID); err == nil {
+		t.Errorf("An error should be returned when the id exists")
+	}
+
+	if err = m.Delete(md.ID); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if items, _ = m.List(); len(items) != 0 {
+		t.Errorf("len(m.List()) = %d, want %d", len(items), 0)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueClosed is returned when submitting to a closed Queue
+	ErrQueueClosed = errors.New("The queue is closed")
+	// ErrQueueFull is returned by TrySubmit when the queue is full
+	ErrQueueFull = errors.New("The queue is full")
+)
+
+// A Job describes a scan submitted to a Queue, Path is scanned with
+// ScanFile or, when Dir is set, ScanDir. When Reader is set its
+// content is scanned with ScanReader or, when Size is positive,
+// ScanSizedReader.
+type Job struct {
+	// ID is an opaque identifier copied to the result
+	ID      string
+	Path    string
+	Dir     bool
+	Recurse bool
+	Reader  io.Reader
+	Size    int64
+}
+
+// A JobResult holds the outcome of a Job
+type JobResult struct {
+	Job       *Job
+	Responses []*Response
+	Err       error
+	Duration  time.Duration
+}
+
+// A Queue scans jobs using a fixed number of workers sharing a
+// Pool. The queue holds a bounded number of pending jobs, Submit
+// blocks when it is full so that producers slow down to the pace of
+// the server. It is safe for concurrent use.
+type Queue struct {
+	pool     *Pool
+	jobs     chan queuedJob
+	results  chan *JobResult
+	callback func(*JobResult)
+	done     chan struct{}
+	pending  sync.WaitGroup
+	workers  sync.WaitGroup
+	m        sync.Mutex
+	closed   bool
+}
+
+type queuedJob struct {
+	ctx context.Context
+	job *Job
+}
+
+// SetCallback sets a function called with the result of each job
+// instead of sending it on the Results channel, it is called from
+// the workers and must be safe for concurrent use. It applies to the
+// jobs completed after the call.
+func (q *Queue) SetCallback(fn func(*JobResult)) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.callback = fn
+}
+
+// Submit adds j to the queue, waiting for space when it is full.
+// ctx bounds the wait and is used for the scan, so the labels set
+// with WithLabels are attached to it.
+func (q *Queue) Submit(ctx context.Context, j *Job) (err error) {
+	if err = q.enter(); err != nil {
+		return
+	}
+	defer q.pending.Done()
+
+	select {
+	case q.jobs <- queuedJob{ctx, j}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-q.done:
+		err = ErrQueueClosed
+	}
+
+	return
+}
+
+// TrySubmit adds j to the queue without waiting, ErrQueueFull is
+// returned when the queue is full
+func (q *Queue) TrySubmit(ctx context.Context, j *Job) (err error) {
+	if err = q.enter(); err != nil {
+		return
+	}
+	defer q.pending.Done()
+
+	select {
+	case q.jobs <- queuedJob{ctx, j}:
+	default:
+		err = ErrQueueFull
+	}
+
+	return
+}
+
+// Results returns the channel the results are sent on when no
+// callback is set, it is closed by Close. The channel must be
+// drained, the workers stop when it is full.
+func (q *Queue) Results() <-chan *JobResult {
+	return q.results
+}
+
+// Len returns the number of jobs waiting for a worker
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Close stops accepting jobs and waits for the queued ones to be
+// scanned, the Results channel is then closed
+func (q *Queue) Close() (err error) {
+	q.m.Lock()
+	if q.closed {
+		q.m.Unlock()
+		err = ErrQueueClosed
+		return
+	}
+	q.closed = true
+	close(q.done)
+	q.m.Unlock()
+
+	q.pending.Wait()
+	close(q.jobs)
+	q.workers.Wait()
+	close(q.results)
+
+	return
+}
+
+// enter registers a submission, it fails once the queue is closed
+func (q *Queue) enter() (err error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if q.closed {
+		err = ErrQueueClosed
+		return
+	}
+	q.pending.Add(1)
+
+	return
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for qj := range q.jobs {
+		r := q.run(qj.ctx, qj.job)
+
+		q.m.Lock()
+		fn := q.callback
+		q.m.Unlock()
+
+		if fn != nil {
+			fn(r)
+			continue
+		}
+		q.results <- r
+	}
+}
+
+func (q *Queue) run(ctx context.Context, j *Job) (r *JobResult) {
+	var rs *Response
+
+	r = &JobResult{Job: j}
+	start := time.Now()
+
+	switch {
+	case j.Reader != nil && j.Size > 0:
+		rs, r.Err = q.pool.ScanSizedReaderContext(ctx, j.Reader, j.Size)
+	case j.Reader != nil:
+		rs, r.Err = q.pool.ScanReaderContext(ctx, j.Reader)
+	case j.Dir:
+		r.Responses, r.Err = q.pool.ScanDirContext(ctx, j.Path, j.Recurse)
+	default:
+		rs, r.Err = q.pool.ScanFileContext(ctx, j.Path)
+	}
+
+	if rs != nil {
+		r.Responses = []*Response{rs}
+	}
+	r.Duration = time.Since(start)
+
+	return
+}
+
+// NewQueue creates and returns a new Queue holding up to capacity
+// pending jobs scanned by workers goroutines using p, workers
+// defaults to the size of the pool and capacity to workers
+func NewQueue(p *Pool, capacity, workers int) (q *Queue) {
+	if workers <= 0 {
+		workers = p.Size()
+	}
+
+	if capacity <= 0 {
+		capacity = workers
+	}
+
+	q = &Queue{
+		pool:    p,
+		jobs:    make(chan queuedJob, capacity),
+		results: make(chan *JobResult, capacity),
+		done:    make(chan struct{}),
+	}
+
+	q.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestQueue(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	q := NewQueue(p, 4, 0)
+	results := make(map[string]*JobResult)
+	done := make(chan struct{})
+	go func() {
+		for r := range q.Results() {
+			results[r.Job.ID] = r
+		}
+		close(done)
+	}()
+
+	ctx := WithLabels(context.Background(), Labels{"tenant": "acme"})
+	for i := 0; i < 10; i++ {
+		j := &Job{ID: fmt.Sprintf("%d", i), Reader: strings.NewReader("clean")}
+		if i%2 == 0 {
+			j.Reader = strings.NewReader(eicarVirus)
+		}
+		if err = q.Submit(ctx, j); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+	if err = q.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	<-done
+
+	if len(results) != 10 {
+		t.Fatalf("len(results) = %d, want 10", len(results))
+	}
+	for id, r := range results {
+		if r.Err != nil {
+			t.Errorf("An error should not be returned: %s", r.Err)
+			continue
+		}
+		if len(r.Responses) != 1 || r.Responses[0].Infected != ((id[0]-'0')%2 == 0) {
+			t.Errorf("Unexpected result for job %s: %+v", id, r.Responses)
+			continue
+		}
+		if r.Responses[0].Labels["tenant"] != "acme" {
+			t.Errorf("The labels should be set on the responses: %v", r.Responses[0].Labels)
+		}
+	}
+
+	if err = q.Submit(ctx, &Job{}); err != ErrQueueClosed {
+		t.Errorf("q.Submit() error = %v, want %v", err, ErrQueueClosed)
+	}
+	if err = q.Close(); err != ErrQueueClosed {
+		t.Errorf("q.Close() error = %v, want %v", err, ErrQueueClosed)
+	}
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if r.Command == "SCANDATA" {
+			<-release
+		}
+		return sssptest.DefaultHandler(r)
+	})
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	var m sync.Mutex
+	var ids []string
+	q := NewQueue(p, 1, 1)
+	q.SetCallback(func(r *JobResult) {
+		m.Lock()
+		ids = append(ids, r.Job.ID)
+		m.Unlock()
+	})
+
+	bg := context.Background()
+	if err = q.Submit(bg, &Job{ID: "a", Reader: strings.NewReader("clean")}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	// wait for the worker to pick up the first job
+	for i := 0; i < 100 && q.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = q.TrySubmit(bg, &Job{ID: "b", Reader: strings.NewReader("clean")}); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if err = q.TrySubmit(bg, &Job{ID: "c", Reader: strings.NewReader("clean")}); err != ErrQueueFull {
+		t.Errorf("q.TrySubmit() error = %v, want %v", err, ErrQueueFull)
+	}
+
+	ctx, cancel := context.WithTimeout(bg, 50*time.Millisecond)
+	defer cancel()
+	if err = q.Submit(ctx, &Job{ID: "c", Reader: strings.NewReader("clean")}); err != context.DeadlineExceeded {
+		t.Errorf("q.Submit() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err = q.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("ids = %q, want [a b]", ids)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package record implements recording and replaying of SSSP sessions
+SSSP - Golang SSSP protocol implementation
+
+A Conn wraps a connection to a server and writes every chunk of data
+sent and received to a transcript as JSON lines. A transcript can be
+loaded into a Session and replayed against the client parser or
+served by an sssptest server, which makes it possible to reproduce
+parsing problems with server versions that are not available locally.
+
+	conn, _ := net.Dial("unix", "/var/lib/savdid/sssp.sock")
+	c, _ := sssp.NewClientConn(record.NewConn(conn, f), 0)
+*/
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	// FromClient marks data sent by the client
+	FromClient = "C"
+	// FromServer marks data sent by the server
+	FromServer    = "S"
+	invalidCmdErr = "Invalid command in transcript: %s"
+	shortDataErr  = "Short SCANDATA payload in transcript: %s"
+	noGreetingErr = "The transcript does not contain a handshake"
+	invalidDirErr = "Invalid direction in transcript: %s"
+)
+
+// An Event represents a chunk of data sent over a connection
+type Event struct {
+	Time time.Time `json:"t"`
+	Dir  string    `json:"dir"`
+	Data []byte    `json:"data"`
+}
+
+// A Conn is a net.Conn that records the data sent and received
+type Conn struct {
+	net.Conn
+	m   sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// Read reads from the connection and records the data received
+func (c *Conn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	c.record(FromServer, b[:n])
+
+	return
+}
+
+// Write writes to the connection and records the data sent
+func (c *Conn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	c.record(FromClient, b[:n])
+
+	return
+}
+
+// Err returns the first error encountered writing the transcript
+func (c *Conn) Err() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.err
+}
+
+func (c *Conn) record(dir string, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	d := make([]byte, len(b))
+	copy(d, b)
+	c.err = c.enc.Encode(&Event{Time: time.Now().UTC(), Dir: dir, Data: d})
+}
+
+// NewConn returns a Conn that records the traffic on conn to w
+func NewConn(conn net.Conn, w io.Writer) *Conn {
+	return &Conn{Conn: conn, enc: json.NewEncoder(w)}
+}
+
+// A Session represents a recorded session
+type Session struct {
+	Events []Event
+}
+
+// A Result represents the outcome of replaying a command
+type Result struct {
+	Command   string
+	Responses []*sssp.Response
+	Info      sssp.Info
+	Err       error
+}
+
+// Client returns the data sent by the client
+func (s *Session) Client() []byte {
+	return s.data(FromClient)
+}
+
+// Server returns the data sent by the server
+func (s *Session) Server() []byte {
+	return s.data(FromServer)
+}
+
+func (s *Session) data(dir string) []byte {
+	var b bytes.Buffer
+
+	for _, e := range s.Events {
+		if e.Dir == dir {
+			b.Write(e.Data)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// Requests returns the commands sent by the client after the
+// protocol negotiation, SCANDATA payloads are included in Data
+func (s *Session) Requests() (r []*sssptest.Request, err error) {
+	var line string
+
+	br := bufio.NewReader(bytes.NewReader(s.Client()))
+	if _, err = readLine(br); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf(noGreetingErr)
+		}
+		return
+	}
+
+	for {
+		if line, err = readLine(br); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		req := &sssptest.Request{Command: line}
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			req.Command, req.Arg = line[:i], line[i+1:]
+		}
+
+		if req.Command == "SCANDATA" {
+			var n int64
+			if n, err = strconv.ParseInt(req.Arg, 10, 64); err != nil || n < 0 {
+				err = fmt.Errorf(invalidCmdErr, line)
+				return
+			}
+			req.Data = make([]byte, n)
+			if _, err = io.ReadFull(br, req.Data); err != nil {
+				err = fmt.Errorf(shortDataErr, line)
+				return
+			}
+		}
+
+		r = append(r, req)
+	}
+}
+
+// Replies returns the replies sent by the server after the protocol
+// negotiation, each reply contains the lines sent as is
+func (s *Session) Replies() (r []*sssptest.Reply, err error) {
+	var line string
+
+	br := bufio.NewReader(bytes.NewReader(s.Server()))
+	for i := 0; i < 2; i++ {
+		if _, err = readLine(br); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf(noGreetingErr)
+			}
+			return
+		}
+	}
+
+	var cur *sssptest.Reply
+	for {
+		if line, err = readLine(br); err != nil {
+			if err == io.EOF {
+				err = nil
+				if cur != nil {
+					r = append(r, cur)
+				}
+			}
+			return
+		}
+
+		if cur == nil {
+			if line == "BYE" {
+				// sssptest replies to BYE itself
+				return
+			}
+			cur = &sssptest.Reply{Raw: true}
+			cur.Lines = append(cur.Lines, line)
+			if !strings.HasPrefix(line, "ACC") {
+				// REJ is a single line reply
+				r = append(r, cur)
+				cur = nil
+			}
+			continue
+		}
+
+		cur.Lines = append(cur.Lines, line)
+		if line == "" {
+			r = append(r, cur)
+			cur = nil
+		}
+	}
+}
+
+// Handler returns an sssptest.Handler that sends the recorded
+// replies in order, requests beyond the recording are rejected
+func (s *Session) Handler() (h sssptest.Handler, err error) {
+	var m sync.Mutex
+	var replies []*sssptest.Reply
+
+	if replies, err = s.Replies(); err != nil {
+		return
+	}
+
+	h = func(r *sssptest.Request) *sssptest.Reply {
+		m.Lock()
+		defer m.Unlock()
+
+		if len(replies) == 0 {
+			return &sssptest.Reply{Lines: []string{"REJ 2 " + r.Command}, Raw: true}
+		}
+		rep := replies[0]
+		replies = replies[1:]
+
+		return rep
+	}
+
+	return
+}
+
+// Conn returns a net.Conn that plays back the data sent by the
+// server, data written to it is discarded
+func (s *Session) Conn() net.Conn {
+	return &replayConn{r: bytes.NewReader(s.Server())}
+}
+
+// Replay replays the recorded commands against the client parser
+// using the recorded server data, the BYE command is not replayed
+func (s *Session) Replay() (r []*Result, err error) {
+	var c *sssp.Client
+	var reqs []*sssptest.Request
+
+	if reqs, err = s.Requests(); err != nil {
+		return
+	}
+
+	if c, err = sssp.NewClientConn(s.Conn(), time.Second); err != nil {
+		return
+	}
+
+	for _, req := range reqs {
+		var rs *sssp.Response
+
+		res := &Result{Command: req.Command}
+		switch req.Command {
+		case "SCANFILE":
+			rs, res.Err = c.ScanFile(req.Arg)
+		case "SCANDIR", "SCANDIRR":
+			res.Responses, res.Err = c.ScanDir(req.Arg, req.Command == "SCANDIRR")
+		case "SCANDATA":
+			rs, res.Err = c.ScanSizedReader(bytes.NewReader(req.Data), int64(len(req.Data)))
+		case "QUERY":
+			switch req.Arg {
+			case "SERVER":
+				res.Info, res.Err = c.QueryServer()
+			case "SAVI":
+				res.Info, res.Err = c.QuerySAVI()
+			case "ENGINE":
+				res.Info, res.Err = c.QueryEngine()
+			default:
+				res.Err = fmt.Errorf(invalidCmdErr, req.Command+" "+req.Arg)
+			}
+		case "BYE":
+			return
+		default:
+			res.Err = fmt.Errorf(invalidCmdErr, req.Command)
+		}
+		if rs != nil {
+			res.Responses = []*sssp.Response{rs}
+		}
+		r = append(r, res)
+	}
+
+	return
+}
+
+// Load reads a transcript written by a Conn
+func Load(r io.Reader) (s *Session, err error) {
+	s = &Session{}
+	dec := json.NewDecoder(r)
+	for {
+		var e Event
+		if err = dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if e.Dir != FromClient && e.Dir != FromServer {
+			err = fmt.Errorf(invalidDirErr, e.Dir)
+			return
+		}
+		s.Events = append(s.Events, e)
+	}
+}
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
+
+type replayConn struct {
+	r *bytes.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *replayConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *replayConn) Close() error                       { return nil }
+func (c *replayConn) LocalAddr() net.Addr                { return replayAddr{} }
+func (c *replayConn) RemoteAddr() net.Addr               { return replayAddr{} }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func readLine(br *bufio.Reader) (line string, err error) {
+	if line, err = br.ReadString('\n'); err != nil {
+		if err == io.EOF && line != "" {
+			err = nil
+		} else {
+			return
+		}
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	return
+}
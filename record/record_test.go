@@ -0,0 +1,152 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package record implements recording and replaying of SSSP sessions
+SSSP - Golang SSSP protocol implementation
+*/
+package record
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+func recordSession(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	conn, err := net.Dial(ts.Network, ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	rc := NewConn(conn, &buf)
+	c, err := sssp.NewClientConn(rc, 2*time.Second)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = c.ScanReader(strings.NewReader(eicarVirus)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = c.ScanFile("/nonexistent/file"); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if _, err = c.QuerySAVI(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c.Close()
+	if err = rc.Err(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return &buf
+}
+
+func check(t *testing.T, c string, r []*sssp.Response, info sssp.Info, err error) {
+	if c == "SCANFILE" {
+		if err == nil || len(r) != 1 || r[0].Infected {
+			t.Errorf("Unexpected SCANFILE result: %+v %v", r, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+
+	switch c {
+	case "SCANDATA":
+		if len(r) != 1 || !r[0].Infected || r[0].Signature != sssptest.EicarSignature {
+			t.Errorf("Unexpected SCANDATA result: %+v", r)
+		}
+	case "QUERY":
+		if info.Get("version") != "5.80" {
+			t.Errorf("Unexpected QUERY result: %v", info)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	buf := recordSession(t)
+
+	s, err := Load(buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !bytes.HasPrefix(s.Client(), []byte("SSSP/1.0")) || !bytes.HasPrefix(s.Server(), []byte("OK SSSP/1.0")) {
+		t.Fatalf("The handshake should be recorded")
+	}
+
+	reqs, err := s.Requests()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(reqs) != 4 || reqs[0].Command != "SCANDATA" || string(reqs[0].Data) != eicarVirus || reqs[3].Command != "BYE" {
+		t.Fatalf("Unexpected requests: %+v", reqs)
+	}
+
+	res, err := s.Replay()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("len(res) = %d, want %d", len(res), 3)
+	}
+	for _, r := range res {
+		check(t, r.Command, r.Responses, r.Info, r.Err)
+	}
+
+	if _, err = Load(strings.NewReader(`{"dir":"X","data":""}`)); err == nil {
+		t.Errorf("An error should be returned")
+	}
+	if _, err = (&Session{}).Replay(); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s, err := Load(recordSession(t))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	h, err := s.Handler()
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	ts := sssptest.NewServer(h)
+	defer ts.Close()
+
+	c, err := sssp.NewClient(context.Background(), ts.Network, ts.Addr, time.Second, 2*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	r, err := c.ScanReader(strings.NewReader("data is ignored"))
+	check(t, "SCANDATA", []*sssp.Response{r}, nil, err)
+
+	r, err = c.ScanFile("/ignored")
+	check(t, "SCANFILE", []*sssp.Response{r}, nil, err)
+
+	info, err := c.QuerySAVI()
+	check(t, "QUERY", nil, info, err)
+
+	if _, err = c.QueryServer(); err == nil {
+		t.Errorf("Requests beyond the recording should be rejected")
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+)
+
+const (
+	// reportTopSignatures is the number of signatures written by
+	// the text renderer
+	reportTopSignatures = 10
+)
+
+// A Report accumulates the responses of scans and summarises them,
+// the zero value is ready to use and it is safe for concurrent use
+type Report struct {
+	m          sync.Mutex
+	scans      int
+	responses  int
+	infected   int
+	errors     int
+	signatures map[string]int
+	codes      map[ResultCode]int
+	durations  DurationStats
+}
+
+// A ReportSummary holds the totals of a Report, Errors counts the
+// failed requests and the items that could not be scanned, those
+// with a result code are broken down in ErrorCodes
+type ReportSummary struct {
+	Scans     int `json:"scans"`
+	Responses int `json:"responses"`
+	Infected  int `json:"infected"`
+	Errors    int `json:"errors"`
+	// Signatures holds the detections per signature, the most
+	// frequent first
+	Signatures []SignatureCount `json:"signatures,omitempty"`
+	// ErrorCodes holds the errors per result code, the most
+	// frequent first
+	ErrorCodes []CodeCount `json:"error_codes,omitempty"`
+	// Durations is nil when no duration was recorded
+	Durations *DurationStats `json:"durations,omitempty"`
+}
+
+// A SignatureCount is the number of detections of a signature
+type SignatureCount struct {
+	Signature string `json:"signature"`
+	Count     int    `json:"count"`
+}
+
+// A CodeCount is the number of errors with a result code
+type CodeCount struct {
+	Code  ResultCode `json:"code"`
+	Name  string     `json:"name,omitempty"`
+	Count int        `json:"count"`
+}
+
+// DurationStats holds the statistics of the scan durations, they
+// are encoded in nanoseconds in JSON
+type DurationStats struct {
+	Count int           `json:"count"`
+	Total time.Duration `json:"total"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+}
+
+// Add records a scan request that took d and returned r and err,
+// the responses of any of the scan methods may be added and a zero
+// d is not counted in the durations
+func (rp *Report) Add(d time.Duration, err error, r ...*Response) {
+	rp.m.Lock()
+	defer rp.m.Unlock()
+
+	if rp.signatures == nil {
+		rp.signatures = make(map[string]int)
+		rp.codes = make(map[ResultCode]int)
+	}
+
+	rp.scans++
+	if d > 0 {
+		s := &rp.durations
+		if s.Count == 0 || d < s.Min {
+			s.Min = d
+		}
+		if d > s.Max {
+			s.Max = d
+		}
+		s.Count++
+		s.Total += d
+	}
+
+	if err != nil {
+		rp.errors++
+		if code, ok := errorCode(err, r); ok {
+			rp.codes[code]++
+		}
+	}
+
+	for _, rs := range r {
+		if rs == nil {
+			continue
+		}
+		rp.responses++
+		if rs.Infected {
+			rp.infected++
+			if len(rs.Detections) == 0 {
+				rp.signatures[rs.Signature]++
+			}
+			for _, dt := range rs.Detections {
+				rp.signatures[dt.Signature]++
+			}
+		}
+		if rs.ErrorOccured && err == nil {
+			rp.errors++
+			if rs.Code != 0 {
+				rp.codes[ResultCode(rs.Code)]++
+			}
+		}
+	}
+}
+
+// ScanEnd records a scan, it has the signature of Hooks.OnScanEnd so
+// that a Report can collect the scans of a Client or Pool
+func (rp *Report) ScanEnd(cmd Command, item string, labels Labels, r []*Response, d time.Duration, err error) {
+	rp.Add(d, err, r...)
+}
+
+// Summary returns the totals of the report
+func (rp *Report) Summary() (s ReportSummary) {
+	rp.m.Lock()
+	defer rp.m.Unlock()
+
+	s.Scans = rp.scans
+	s.Responses = rp.responses
+	s.Infected = rp.infected
+	s.Errors = rp.errors
+	if rp.durations.Count > 0 {
+		d := rp.durations
+		d.Mean = d.Total / time.Duration(d.Count)
+		s.Durations = &d
+	}
+
+	for sig, n := range rp.signatures {
+		s.Signatures = append(s.Signatures, SignatureCount{sig, n})
+	}
+	sort.Slice(s.Signatures, func(i, j int) bool {
+		if s.Signatures[i].Count != s.Signatures[j].Count {
+			return s.Signatures[i].Count > s.Signatures[j].Count
+		}
+		return s.Signatures[i].Signature < s.Signatures[j].Signature
+	})
+
+	for code, n := range rp.codes {
+		s.ErrorCodes = append(s.ErrorCodes, CodeCount{code, code.Name(), n})
+	}
+	sort.Slice(s.ErrorCodes, func(i, j int) bool {
+		if s.ErrorCodes[i].Count != s.ErrorCodes[j].Count {
+			return s.ErrorCodes[i].Count > s.ErrorCodes[j].Count
+		}
+		return s.ErrorCodes[i].Code < s.ErrorCodes[j].Code
+	})
+
+	return
+}
+
+// MarshalJSON encodes the summary of the report
+func (rp *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rp.Summary())
+}
+
+// WriteTo writes the summary as a block of text
+func (s ReportSummary) WriteTo(w io.Writer) (n int64, err error) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Scans:\t\t%d\n", s.Scans)
+	fmt.Fprintf(&b, "Responses:\t%d\n", s.Responses)
+	fmt.Fprintf(&b, "Infected:\t%d\n", s.Infected)
+	fmt.Fprintf(&b, "Errors:\t\t%d\n", s.Errors)
+
+	m, err := io.WriteString(w, b.String())
+	n = int64(m)
+	if err != nil {
+		return
+	}
+
+	d, err := s.WriteDetails(w)
+	n += d
+
+	return
+}
+
+// WriteDetails writes the durations, the top signatures and the
+// error codes of the summary as text, the sections with no data are
+// omitted
+func (s ReportSummary) WriteDetails(w io.Writer) (n int64, err error) {
+	var b strings.Builder
+
+	if d := s.Durations; d != nil {
+		fmt.Fprintf(&b, "Scan time:\tmin %s, mean %s, max %s\n", d.Min, d.Mean, d.Max)
+	}
+
+	if len(s.Signatures) > 0 {
+		fmt.Fprintf(&b, "Top signatures:\n")
+		for i, sc := range s.Signatures {
+			if i == reportTopSignatures {
+				break
+			}
+			fmt.Fprintf(&b, "\t%d\t%s\n", sc.Count, sc.Signature)
+		}
+	}
+
+	other := s.Errors
+	if len(s.ErrorCodes) > 0 {
+		fmt.Fprintf(&b, "Error codes:\n")
+		for _, cc := range s.ErrorCodes {
+			fmt.Fprintf(&b, "\t%d\t%s %s\n", cc.Count, cc.Code, cc.Name)
+			other -= cc.Count
+		}
+		if other > 0 {
+			fmt.Fprintf(&b, "\t%d\tother\n", other)
+		}
+	}
+
+	m, err := io.WriteString(w, b.String())
+	n = int64(m)
+
+	return
+}
+
+// errorCode returns the result code of a failed request
+func errorCode(err error, r []*Response) (c ResultCode, ok bool) {
+	var de *protocol.DoneError
+
+	if errors.As(err, &de) {
+		if n, perr := strconv.ParseInt(de.Code, 16, 32); perr == nil {
+			c, ok = ResultCode(n), true
+			return
+		}
+	}
+
+	for _, rs := range r {
+		if rs != nil && rs.Code != 0 {
+			c, ok = ResultCode(rs.Code), true
+			return
+		}
+	}
+
+	return
+}
+
+// NewReport returns an empty report
+func NewReport() *Report {
+	return &Report{
+		signatures: make(map[string]int),
+		codes:      make(map[ResultCode]int),
+	}
+}
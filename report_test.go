@@ -0,0 +1,124 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestReport(t *testing.T) {
+	var rp Report
+
+	rp.Add(2*time.Millisecond, nil, &Response{Infected: true, Signature: "EICAR-AV-Test"})
+	rp.Add(4*time.Millisecond, nil, &Response{Infected: true, Detections: []Detection{
+		{Signature: "Troj/Agent-X"},
+		{Signature: "EICAR-AV-Test"},
+	}})
+	rp.Add(0, nil, &Response{})
+	rp.Add(0, nil,
+		&Response{ErrorOccured: true, Code: int(CodeEncrypted)},
+		&Response{ErrorOccured: true, Code: int(CodeEncrypted)},
+	)
+	rp.Add(0, &protocol.DoneError{Code: "0210", Text: "Could not open item"}, &Response{ErrorOccured: true, Code: int(CodeCouldNotOpen)})
+	rp.Add(6*time.Millisecond, errors.New("connection reset"))
+
+	s := rp.Summary()
+	if s.Scans != 6 || s.Responses != 6 || s.Infected != 2 || s.Errors != 4 {
+		t.Errorf("Unexpected totals: %+v", s)
+	}
+	expected := []SignatureCount{{"EICAR-AV-Test", 2}, {"Troj/Agent-X", 1}}
+	if len(s.Signatures) != len(expected) || s.Signatures[0] != expected[0] || s.Signatures[1] != expected[1] {
+		t.Errorf("s.Signatures = %+v, want %+v", s.Signatures, expected)
+	}
+	codes := []CodeCount{{CodeEncrypted, "FILE_ENCRYPTED", 2}, {CodeCouldNotOpen, "COULD_NOT_OPEN", 1}}
+	if len(s.ErrorCodes) != len(codes) || s.ErrorCodes[0] != codes[0] || s.ErrorCodes[1] != codes[1] {
+		t.Errorf("s.ErrorCodes = %+v, want %+v", s.ErrorCodes, codes)
+	}
+	d := s.Durations
+	if d == nil || d.Count != 3 || d.Min != 2*time.Millisecond || d.Max != 6*time.Millisecond || d.Mean != 4*time.Millisecond {
+		t.Errorf("Unexpected durations: %+v", d)
+	}
+
+	var buf bytes.Buffer
+	n, err := s.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("n = %d, want %d", n, buf.Len())
+	}
+	for _, l := range []string{
+		"Scans:\t\t6\n",
+		"Errors:\t\t4\n",
+		"Scan time:\tmin 2ms, mean 4ms, max 6ms\n",
+		"Top signatures:\n\t2\tEICAR-AV-Test\n\t1\tTroj/Agent-X\n",
+		"Error codes:\n\t2\t0212 FILE_ENCRYPTED\n\t1\t0210 COULD_NOT_OPEN\n\t1\tother\n",
+	} {
+		if !strings.Contains(buf.String(), l) {
+			t.Errorf("The report should contain %q: %q", l, buf.String())
+		}
+	}
+
+	b, err := json.Marshal(&rp)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	var js ReportSummary
+	if err = json.Unmarshal(b, &js); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if js.Errors != 4 || len(js.Signatures) != 2 || js.ErrorCodes[0].Code != CodeEncrypted || js.Durations.Max != d.Max {
+		t.Errorf("Unexpected JSON summary: %s", b)
+	}
+
+	if s = NewReport().Summary(); s.Durations != nil || s.Signatures != nil {
+		t.Errorf("An empty report should have no details: %+v", s)
+	}
+	buf.Reset()
+	if s.WriteDetails(&buf); buf.Len() != 0 {
+		t.Errorf("An empty report should have no details: %q", buf.String())
+	}
+}
+
+func TestReportHooks(t *testing.T) {
+	rp := NewReport()
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetHooks(&Hooks{OnScanEnd: rp.ScanEnd})
+
+	for _, s := range []string{eicarVirus, "clean", eicarVirus} {
+		if _, err = p.ScanReader(strings.NewReader(s)); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	s := rp.Summary()
+	if s.Scans != 3 || s.Infected != 2 || s.Durations == nil || s.Durations.Count != 3 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+	if len(s.Signatures) != 1 || s.Signatures[0].Count != 2 {
+		t.Errorf("s.Signatures = %+v, want 2 detections of one signature", s.Signatures)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	noAddrsErr = "No %s addresses found for %s"
+)
+
+// A LookupFunc returns the addresses of host, it is used to resolve
+// the host name of the server instead of the system resolver
+type LookupFunc func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// A resolveCache holds the addresses of the server host names for a
+// TTL, it is shared by the clients of a Pool
+type resolveCache struct {
+	ttl     time.Duration
+	m       sync.Mutex
+	entries map[string]resolved
+}
+
+type resolved struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+// SetResolveCache caches the addresses a host name resolves to for
+// ttl, connections then dial the cached addresses in turn instead of
+// resolving the name each time. When none of them can be reached the
+// name is resolved again, so that the client follows the records to
+// a new server. A ttl of 0, the default, disables the cache.
+func (c *Client) SetResolveCache(ttl time.Duration) {
+	c.m.Lock()
+	c.resolver = newResolveCache(ttl)
+	c.m.Unlock()
+}
+
+// SetResolveCache sets the resolve cache shared by the connections
+// established after the call, see Client.SetResolveCache
+func (p *Pool) SetResolveCache(ttl time.Duration) {
+	p.m.Lock()
+	p.resolver = newResolveCache(ttl)
+	p.m.Unlock()
+}
+
+// SetResolver sets the resolver used for the host name of the server
+// by connections established after the call, for split-horizon DNS
+// or a service discovery agent, nil restores the system resolver
+func (c *Client) SetResolver(r *net.Resolver) {
+	c.SetLookup(resolverLookup(r))
+}
+
+// SetResolver sets the resolver used by connections established
+// after the call, see Client.SetResolver
+func (p *Pool) SetResolver(r *net.Resolver) {
+	p.SetLookup(resolverLookup(r))
+}
+
+// SetLookup sets the function used to resolve the host name of the
+// server by connections established after the call, the addresses
+// it returns are dialed in turn. nil restores the system resolver.
+func (c *Client) SetLookup(fn LookupFunc) {
+	c.m.Lock()
+	c.lookupFn = fn
+	c.m.Unlock()
+}
+
+// SetLookup sets the lookup function used by connections established
+// after the call, see Client.SetLookup
+func (p *Pool) SetLookup(fn LookupFunc) {
+	p.m.Lock()
+	p.lookupFn = fn
+	p.m.Unlock()
+}
+
+// lookup returns the addresses of host using fn, cached reports
+// whether they were read from the cache
+func (rc *resolveCache) lookup(ctx context.Context, host string, fn LookupFunc) (addrs []net.IPAddr, cached bool, err error) {
+	rc.m.Lock()
+	e, ok := rc.entries[host]
+	rc.m.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		addrs, cached = e.addrs, true
+		return
+	}
+
+	if addrs, err = fn(ctx, host); err != nil {
+		return
+	}
+
+	rc.m.Lock()
+	rc.entries[host] = resolved{addrs: addrs, expires: time.Now().Add(rc.ttl)}
+	rc.m.Unlock()
+
+	return
+}
+
+// forget removes the addresses of host from the cache
+func (rc *resolveCache) forget(host string) {
+	rc.m.Lock()
+	delete(rc.entries, host)
+	rc.m.Unlock()
+}
+
+// dialAddress connects to the server using d, the host name of the
+// address is resolved using the lookup function and the cache when
+// they are set
+func (c *Client) dialAddress(ctx context.Context, d *net.Dialer) (conn net.Conn, err error) {
+	var addrs []net.IPAddr
+	var cached bool
+
+	host, port, serr := net.SplitHostPort(c.address)
+	if (c.resolver == nil && c.lookupFn == nil) || serr != nil || !strings.HasPrefix(c.network, "tcp") || net.ParseIP(host) != nil {
+		conn, err = d.DialContext(ctx, c.network, c.address)
+		return
+	}
+
+	fn := c.lookupFn
+	if fn == nil {
+		fn = net.DefaultResolver.LookupIPAddr
+	}
+
+	if c.resolver == nil {
+		if addrs, err = fn(ctx, host); err == nil {
+			conn, err = c.dialAddrs(ctx, d, host, port, addrs)
+		}
+		return
+	}
+
+	if addrs, cached, err = c.resolver.lookup(ctx, host, fn); err != nil {
+		return
+	}
+
+	if conn, err = c.dialAddrs(ctx, d, host, port, addrs); err == nil || !cached || ctx.Err() != nil {
+		return
+	}
+
+	// the server may have moved, resolve the name again
+	c.resolver.forget(host)
+	if addrs, _, err = c.resolver.lookup(ctx, host, fn); err != nil {
+		return
+	}
+	conn, err = c.dialAddrs(ctx, d, host, port, addrs)
+
+	return
+}
+
+// dialAddrs dials the addresses of host that match the network in
+// turn and returns the first connection established
+func (c *Client) dialAddrs(ctx context.Context, d *net.Dialer, host, port string, addrs []net.IPAddr) (conn net.Conn, err error) {
+	for _, a := range addrs {
+		if (c.network == "tcp4" && a.IP.To4() == nil) || (c.network == "tcp6" && a.IP.To4() != nil) {
+			continue
+		}
+		ip := a.IP.String()
+		if a.Zone != "" {
+			ip += "%" + a.Zone
+		}
+		if conn, err = d.DialContext(ctx, c.network, net.JoinHostPort(ip, port)); err == nil || ctx.Err() != nil {
+			return
+		}
+	}
+
+	if err == nil {
+		err = &net.OpError{Op: "dial", Net: c.network, Err: fmt.Errorf(noAddrsErr, c.network, host)}
+	}
+
+	return
+}
+
+// newResolveCache returns a cache with ttl, nil is returned when ttl
+// disables it
+func newResolveCache(ttl time.Duration) *resolveCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &resolveCache{ttl: ttl, entries: make(map[string]resolved)}
+}
+
+// resolverLookup returns the lookup function of r, nil is returned
+// for a nil r
+func resolverLookup(r *net.Resolver) LookupFunc {
+	if r == nil {
+		return nil
+	}
+
+	return r.LookupIPAddr
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestResolveCache(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if addrs, lerr := net.LookupHost("localhost"); lerr != nil || len(addrs) == 0 {
+		t.Skipf("localhost cannot be resolved: %v", lerr)
+	}
+
+	p, err := NewPool("tcp4", net.JoinHostPort("localhost", port), 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetResolveCache(time.Minute)
+
+	rc := p.resolver
+	if _, err = p.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	e, ok := rc.entries["localhost"]
+	if !ok || len(e.addrs) == 0 {
+		t.Fatalf("The addresses of localhost should be cached: %+v", rc.entries)
+	}
+
+	// cached addresses are used until they cannot be reached
+	stale := []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}}
+	rc.entries["localhost"] = resolved{addrs: stale, expires: time.Now().Add(time.Minute)}
+	addrs, cached, err := rc.lookup(context.Background(), "localhost", net.DefaultResolver.LookupIPAddr)
+	if err != nil || !cached || !addrs[0].IP.Equal(stale[0].IP) {
+		t.Errorf("The cached addresses should be returned: %v %t %v", addrs, cached, err)
+	}
+
+	c := &Client{network: "tcp4", address: net.JoinHostPort("localhost", port), connTimeout: time.Second}
+	c.resolver = rc
+	conn, err := c.dialConn(context.Background(), c.netDialer())
+	if err != nil {
+		t.Fatalf("The name should be resolved again: %s", err)
+	}
+	conn.Close()
+	if e = rc.entries["localhost"]; e.addrs[0].IP.Equal(stale[0].IP) {
+		t.Errorf("The stale addresses should be replaced: %v", e.addrs)
+	}
+
+	// expired entries are resolved again
+	rc.entries["localhost"] = resolved{addrs: stale, expires: time.Now().Add(-time.Second)}
+	if addrs, cached, err = rc.lookup(context.Background(), "localhost", net.DefaultResolver.LookupIPAddr); err != nil || cached {
+		t.Errorf("An expired entry should be resolved again: %v %t %v", addrs, cached, err)
+	}
+
+	// only the addresses of the network are dialed
+	c.network = "tcp6"
+	_, err = c.dialAddrs(context.Background(), c.netDialer(), "localhost", port, stale)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf(noAddrsErr, "tcp6", "localhost")) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if newResolveCache(0) != nil {
+		t.Errorf("A zero ttl should disable the cache")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var calls int32
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	p, err := NewPool("tcp", net.JoinHostPort("savdi.service.consul", port), 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetLookup(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		atomic.AddInt32(&calls, 1)
+		if host != "savdi.service.consul" {
+			return nil, fmt.Errorf("unexpected host %s", host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	})
+
+	// each connection resolves the name without a cache
+	c1, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r, err := c2.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("The file should be infected: %+v", r)
+	}
+	p.Put(c1, ErrServerClosed)
+	p.Put(c2, ErrServerClosed)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("The lookup function was called %d times, want 2", n)
+	}
+
+	p.SetResolveCache(time.Minute)
+	for i := 0; i < 2; i++ {
+		c, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		p.Put(c, ErrServerClosed)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("The lookup function was called %d times, want 3", n)
+	}
+
+	c := &Client{}
+	c.SetResolver(&net.Resolver{PreferGo: true})
+	if c.lookupFn == nil {
+		t.Errorf("The resolver should be used")
+	}
+	c.SetResolver(nil)
+	if c.lookupFn != nil {
+		t.Errorf("A nil resolver should restore the system resolver")
+	}
+}
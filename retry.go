@@ -0,0 +1,185 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// A RetryPolicy decides whether a failed operation is attempted
+// again and how long to wait before doing so, attempt counts the
+// attempts made so far from 1. Implementations must be safe for
+// concurrent use.
+type RetryPolicy interface {
+	// ShouldRetry reports whether the operation that failed with
+	// err on attempt should be retried
+	ShouldRetry(attempt int, err error) bool
+	// Backoff returns the delay before the attempt following attempt
+	Backoff(attempt int) time.Duration
+}
+
+// TimeoutRetry retries operations that timed out up to Retries
+// times waiting Delay between attempts, it is the dial policy used
+// when none is set, built from the connRetries argument of the
+// constructors and SetConnSleep
+type TimeoutRetry struct {
+	Retries int
+	Delay   time.Duration
+}
+
+// ShouldRetry reports whether err is a timeout and attempt is
+// within the number of retries
+func (t TimeoutRetry) ShouldRetry(attempt int, err error) bool {
+	var ne net.Error
+
+	return attempt <= t.Retries && errors.As(err, &ne) && ne.Timeout()
+}
+
+// Backoff returns Delay
+func (t TimeoutRetry) Backoff(attempt int) time.Duration {
+	return t.Delay
+}
+
+// ExponentialRetry retries operations that failed with a temporary
+// error, see ErrTemporary, up to Retries times. The delay starts at
+// Initial and doubles after each attempt up to Max, a zero Max does
+// not cap it.
+type ExponentialRetry struct {
+	Retries int
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// ShouldRetry reports whether err is temporary and attempt is
+// within the number of retries
+func (e ExponentialRetry) ShouldRetry(attempt int, err error) bool {
+	return attempt <= e.Retries && err != nil && (errors.Is(err, ErrTemporary) || isTemporary(err))
+}
+
+// Backoff returns Initial doubled attempt-1 times, capped at Max
+func (e ExponentialRetry) Backoff(attempt int) (d time.Duration) {
+	d = e.Initial
+	for i := 1; i < attempt; i++ {
+		if e.Max > 0 && d >= e.Max {
+			break
+		}
+		d *= 2
+	}
+	if e.Max > 0 && d > e.Max {
+		d = e.Max
+	}
+
+	return
+}
+
+// SetDialRetry sets the policy used to retry failed connection
+// attempts, nil restores the TimeoutRetry built from the connection
+// retries and SetConnSleep
+func (c *Client) SetDialRetry(r RetryPolicy) {
+	c.m.Lock()
+	c.dialRetry = r
+	c.m.Unlock()
+}
+
+// SetDialRetry sets the dial policy used by connections established
+// after the call, see Client.SetDialRetry
+func (p *Pool) SetDialRetry(r RetryPolicy) {
+	p.m.Lock()
+	p.dialRetry = r
+	p.m.Unlock()
+}
+
+// SetScanRetry sets the policy used to retry failed requests, each
+// attempt uses a connection from the pool so that broken connections
+// are replaced. Readers are only retried when they implement
+// io.Seeker, they are rewound before each attempt. nil, the default,
+// disables the retries.
+func (p *Pool) SetScanRetry(r RetryPolicy) {
+	p.m.Lock()
+	p.scanRetry = r
+	p.m.Unlock()
+}
+
+// dialPolicy returns the policy used to retry connection attempts,
+// it is called with c.m held
+func (c *Client) dialPolicy() (r RetryPolicy) {
+	if r = c.dialRetry; r == nil {
+		r = TimeoutRetry{Retries: c.connRetries, Delay: c.connSleep}
+	}
+
+	return
+}
+
+// doRetry runs fn with clients from the pool, retrying it as set by
+// the scan policy, rewind is called before each retry and nil
+// disables the retries
+func (p *Pool) doRetry(ctx context.Context, rewind func() error, fn func(*Client) error) (err error) {
+	var c *Client
+
+	p.m.Lock()
+	policy := p.scanRetry
+	p.m.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		if c, err = p.Get(ctx); err != nil {
+			// Get returns the dial error as is like NewClient
+			err = classify(err)
+			return
+		}
+
+		err = fn(c)
+		retry := err != nil && policy != nil && rewind != nil && ctx.Err() == nil && policy.ShouldRetry(attempt, err)
+		if retry {
+			c.logEvent(levelWarn, "request failed, retrying", LogKeyAttempt, attempt, LogKeyError, err)
+			c.retrying(attempt, err)
+		}
+		p.Put(c, err)
+		if !retry || rewind() != nil {
+			return
+		}
+
+		t := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			err = ctx.Err()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// rewinder returns a function that seeks i back to its current
+// offset, nil is returned when i cannot be rewound
+func rewinder(i io.Reader) func() error {
+	s, ok := i.(io.Seeker)
+	if !ok {
+		return nil
+	}
+
+	off, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+
+	return func() (err error) {
+		_, err = s.Seek(off, io.SeekStart)
+		return
+	}
+}
+
+// noRewind is the rewind function of requests that can be sent again
+func noRewind() error {
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+type countingRetry struct {
+	retries int
+}
+
+func (r countingRetry) ShouldRetry(attempt int, err error) bool {
+	return attempt <= r.retries
+}
+
+func (r countingRetry) Backoff(attempt int) time.Duration {
+	return time.Millisecond
+}
+
+func TestRetryPolicies(t *testing.T) {
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tr := TimeoutRetry{Retries: 2, Delay: time.Second}
+	if !tr.ShouldRetry(2, timeout) || tr.ShouldRetry(3, timeout) || tr.ShouldRetry(1, refused) {
+		t.Errorf("TimeoutRetry should only retry timeouts up to Retries times")
+	}
+	if d := tr.Backoff(2); d != time.Second {
+		t.Errorf("tr.Backoff(2) = %s, want %s", d, time.Second)
+	}
+
+	er := ExponentialRetry{Retries: 3, Initial: 100 * time.Millisecond, Max: 300 * time.Millisecond}
+	if !er.ShouldRetry(1, ErrServerClosed) || !er.ShouldRetry(3, timeout) || er.ShouldRetry(4, ErrServerClosed) {
+		t.Errorf("ExponentialRetry should retry temporary errors up to Retries times")
+	}
+	if er.ShouldRetry(1, errors.New("no such file")) || er.ShouldRetry(1, nil) {
+		t.Errorf("ExponentialRetry should not retry permanent errors")
+	}
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 300 * time.Millisecond,
+		9: 300 * time.Millisecond,
+	} {
+		if d := er.Backoff(attempt); d != want {
+			t.Errorf("er.Backoff(%d) = %s, want %s", attempt, d, want)
+		}
+	}
+}
+
+func TestDialRetry(t *testing.T) {
+	h := &hookRecorder{}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	c := &Client{
+		network:     "tcp",
+		address:     address,
+		connTimeout: time.Second,
+		connRetries: 5,
+		clientOptions: clientOptions{
+			hooks: h.hooks(),
+		},
+	}
+	// the default policy only retries timeouts
+	if err = c.Dial(context.Background()); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if len(h.events) != 0 {
+		t.Errorf("A refused connection should not be retried: %q", h.events)
+	}
+
+	c.SetDialRetry(countingRetry{2})
+	if err = c.Dial(context.Background()); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if strings.Join(h.events, ",") != "retry 1,retry 2" {
+		t.Errorf("events = %q, want two retries", h.events)
+	}
+}
+
+func TestScanRetry(t *testing.T) {
+	var m sync.Mutex
+	var data []string
+
+	h := &hookRecorder{}
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if r.Command != "SCANDATA" {
+			return sssptest.DefaultHandler(r)
+		}
+		m.Lock()
+		defer m.Unlock()
+		data = append(data, string(r.Data))
+		// only the retry of the second scan succeeds
+		if len(data) != 3 {
+			return sssptest.Bye()
+		}
+		return sssptest.DefaultHandler(r)
+	})
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetHooks(h.hooks())
+
+	// retries are disabled by default
+	if _, err = p.ScanReader(strings.NewReader(eicarVirus)); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+
+	p.SetScanRetry(ExponentialRetry{Retries: 2, Initial: time.Millisecond})
+	r, err := p.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("The rewound reader should be scanned: %+v", r)
+	}
+	if len(data) != 3 || data[2] != eicarVirus {
+		t.Errorf("data = %q, want the payload sent again", data)
+	}
+
+	// readers that cannot be rewound are sent once
+	if _, err = p.ScanSizedReader(io.MultiReader(strings.NewReader(eicarVirus)), int64(len(eicarVirus))); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if len(data) != 4 {
+		t.Errorf("len(data) = %d, want 4", len(data))
+	}
+	if strings.Count(strings.Join(h.events, ","), "retry") != 1 {
+		t.Errorf("events = %q, want one retry", h.events)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package scheduler implements recurring scans
+SSSP - Golang SSSP protocol implementation
+
+Jobs scan the configured files and directories through the
+client on a cron like schedule, a job is skipped if its previous
+run has not completed.
+*/
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	noNameErr    = "The job name is required"
+	noPathsErr   = "The job %s has no paths"
+	duplicateErr = "The job %s already exists"
+)
+
+var (
+	// ErrOverlap is reported when a job is skipped because
+	// its previous run is still in progress
+	ErrOverlap = errors.New("Previous run still in progress")
+)
+
+// Scanner is the interface used to run the scans
+type Scanner interface {
+	ScanFile(string) (*sssp.Response, error)
+	ScanDir(string, bool) ([]*sssp.Response, error)
+}
+
+// A Job represents a recurring scan
+type Job struct {
+	Name      string
+	Spec      string
+	Paths     []string
+	Recursive bool
+	Timeout   time.Duration
+}
+
+// A Result represents the outcome of a job run
+type Result struct {
+	Job       string
+	Started   time.Time
+	Finished  time.Time
+	Responses []*sssp.Response
+	Err       error
+}
+
+// A Callback is called with the result of every job run
+type Callback func(*Result)
+
+type entry struct {
+	job      *Job
+	schedule Schedule
+	next     time.Time
+	running  bool
+}
+
+// A Scheduler runs recurring scan jobs
+type Scheduler struct {
+	scanner  Scanner
+	callback Callback
+	m        sync.Mutex
+	entries  []*entry
+	wg       sync.WaitGroup
+	wake     chan struct{}
+}
+
+// SetCallback sets the function called with the result
+// of every job run
+func (s *Scheduler) SetCallback(cb Callback) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.callback = cb
+}
+
+// Add adds a job to the scheduler
+func (s *Scheduler) Add(j *Job) (err error) {
+	var sc Schedule
+
+	if j.Name == "" {
+		err = fmt.Errorf(noNameErr)
+		return
+	}
+
+	if len(j.Paths) == 0 {
+		err = fmt.Errorf(noPathsErr, j.Name)
+		return
+	}
+
+	if sc, err = Parse(j.Spec); err != nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, e := range s.entries {
+		if e.job.Name == j.Name {
+			err = fmt.Errorf(duplicateErr, j.Name)
+			return
+		}
+	}
+
+	s.entries = append(s.entries, &entry{
+		job:      j,
+		schedule: sc,
+		next:     sc.Next(time.Now()),
+	})
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return
+}
+
+// Remove removes the named job from the scheduler
+func (s *Scheduler) Remove(name string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for i, e := range s.entries {
+		if e.job.Name == name {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Run runs the scheduled jobs until the context is cancelled,
+// it waits for running jobs to complete before returning
+func (s *Scheduler) Run(ctx context.Context) (err error) {
+	defer s.wg.Wait()
+
+	for {
+		now := time.Now()
+		wait := time.Hour
+
+		s.m.Lock()
+		for _, e := range s.entries {
+			if e.next.IsZero() {
+				continue
+			}
+			if !e.next.After(now) {
+				s.start(ctx, e)
+				e.next = e.schedule.Next(now)
+			}
+			if d := e.next.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		s.m.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			err = ctx.Err()
+			return
+		case <-s.wake:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Scheduler) start(ctx context.Context, e *entry) {
+	cb := s.callback
+
+	if e.running {
+		if cb != nil {
+			now := time.Now()
+			go cb(&Result{Job: e.job.Name, Started: now, Finished: now, Err: ErrOverlap})
+		}
+		return
+	}
+
+	e.running = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		r := s.runJob(ctx, e.job)
+		if cb != nil {
+			cb(r)
+		}
+	}()
+}
+
+func (s *Scheduler) runJob(ctx context.Context, j *Job) (r *Result) {
+	var cancel context.CancelFunc
+
+	r = &Result{
+		Job:     j.Name,
+		Started: time.Now(),
+	}
+
+	if j.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan *Result, 1)
+	go func() {
+		rs, err := s.scanPaths(j)
+		done <- &Result{Responses: rs, Err: err}
+		s.m.Lock()
+		for _, e := range s.entries {
+			if e.job == j {
+				e.running = false
+			}
+		}
+		s.m.Unlock()
+	}()
+
+	select {
+	case <-ctx.Done():
+		r.Err = ctx.Err()
+	case d := <-done:
+		r.Responses = d.Responses
+		r.Err = d.Err
+	}
+	r.Finished = time.Now()
+
+	return
+}
+
+func (s *Scheduler) scanPaths(j *Job) (r []*sssp.Response, err error) {
+	var stat os.FileInfo
+	var rs *sssp.Response
+	var rd []*sssp.Response
+
+	for _, p := range j.Paths {
+		if stat, err = os.Stat(p); err == nil && stat.IsDir() {
+			if rd, err = s.scanner.ScanDir(p, j.Recursive); err != nil {
+				return
+			}
+			r = append(r, rd...)
+			continue
+		}
+
+		if rs, err = s.scanner.ScanFile(p); err != nil {
+			if rs == nil {
+				return
+			}
+			rs.ErrorOccured = true
+			rs.Raw = err.Error()
+			err = nil
+		}
+		r = append(r, rs)
+	}
+
+	return
+}
+
+// NewScheduler creates and returns a new Scheduler that uses
+// s to run the scans
+func NewScheduler(s Scanner) (sc *Scheduler) {
+	sc = &Scheduler{
+		scanner: s,
+		wake:    make(chan struct{}, 1),
+	}
+
+	return
+}
@@ -0,0 +1,151 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package scheduler implements recurring scans
+SSSP - Golang SSSP protocol implementation
+*/
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+type fakeScanner struct {
+	m     sync.Mutex
+	delay time.Duration
+	calls int
+}
+
+func (f *fakeScanner) ScanFile(p string) (r *sssp.Response, err error) {
+	f.m.Lock()
+	f.calls++
+	f.m.Unlock()
+	time.Sleep(f.delay)
+	r = &sssp.Response{Filename: p}
+	return
+}
+
+func (f *fakeScanner) ScanDir(p string, recurse bool) (r []*sssp.Response, err error) {
+	f.m.Lock()
+	f.calls++
+	f.m.Unlock()
+	r = []*sssp.Response{{Filename: p + "/eicar.txt", Infected: true}}
+	return
+}
+
+type SpecTestKey struct {
+	spec string
+	from time.Time
+	next time.Time
+}
+
+var (
+	base          = time.Date(2021, time.March, 10, 10, 30, 15, 0, time.UTC)
+	TestSpecTimes = []SpecTestKey{
+		{"* * * * *", base, time.Date(2021, time.March, 10, 10, 31, 0, 0, time.UTC)},
+		{"0 * * * *", base, time.Date(2021, time.March, 10, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", base, time.Date(2021, time.March, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", base, time.Date(2021, time.March, 11, 2, 0, 0, 0, time.UTC)},
+		{"30 1 1 * *", base, time.Date(2021, time.April, 1, 1, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", base, time.Date(2021, time.March, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", base, time.Date(2021, time.March, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", base, time.Date(2021, time.March, 11, 0, 0, 0, 0, time.UTC)},
+		{"@every 1h", base, base.Add(time.Hour)},
+	}
+	TestBadSpecs = []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"@every x",
+		"@every -1s",
+	}
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range TestSpecTimes {
+		s, e := Parse(tt.spec)
+		if e != nil {
+			t.Fatalf("Parse(%q) returned an error: %s", tt.spec, e)
+		}
+		if n := s.Next(tt.from); !n.Equal(tt.next) {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.spec, tt.from, n, tt.next)
+		}
+	}
+	for _, spec := range TestBadSpecs {
+		if _, e := Parse(spec); e == nil {
+			t.Errorf("Parse(%q) should return an error", spec)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	s := NewScheduler(&fakeScanner{})
+	if e := s.Add(&Job{Spec: "@hourly", Paths: []string{"/tmp"}}); e == nil {
+		t.Errorf("An error should be returned for a job without a name")
+	}
+	if e := s.Add(&Job{Name: "x", Spec: "@hourly"}); e == nil {
+		t.Errorf("An error should be returned for a job without paths")
+	}
+	if e := s.Add(&Job{Name: "x", Spec: "bogus", Paths: []string{"/tmp"}}); e == nil {
+		t.Errorf("An error should be returned for a bad spec")
+	}
+	if e := s.Add(&Job{Name: "x", Spec: "@hourly", Paths: []string{"/tmp"}}); e != nil {
+		t.Errorf("An error should not be returned: %s", e)
+	}
+	if e := s.Add(&Job{Name: "x", Spec: "@hourly", Paths: []string{"/tmp"}}); e == nil {
+		t.Errorf("An error should be returned for a duplicate job")
+	}
+}
+
+func TestRun(t *testing.T) {
+	var m sync.Mutex
+	var results []*Result
+
+	f := &fakeScanner{delay: 120 * time.Millisecond}
+	s := NewScheduler(f)
+	s.SetCallback(func(r *Result) {
+		m.Lock()
+		results = append(results, r)
+		m.Unlock()
+	})
+	if e := s.Add(&Job{Name: "files", Spec: "@every 50ms", Paths: []string{"/var/spool/testfiles/eicar.txt"}}); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if e := s.Add(&Job{Name: "timeout", Spec: "@every 1h", Paths: []string{"/nonexistent"}, Timeout: time.Nanosecond}); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+	var ok, overlap int
+	for _, r := range results {
+		if r.Job != "files" {
+			continue
+		}
+		if r.Err == ErrOverlap {
+			overlap++
+		} else if r.Err == nil && len(r.Responses) == 1 {
+			ok++
+		}
+	}
+	if ok == 0 {
+		t.Errorf("Expected successful runs of the files job")
+	}
+	if overlap == 0 {
+		t.Errorf("Expected overlapping runs to be skipped")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package scheduler implements recurring scans
+SSSP - Golang SSSP protocol implementation
+*/
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	invalidSpecErr  = "Invalid schedule spec: %s"
+	invalidFieldErr = "Invalid schedule field: %s"
+	maxSearchYears  = 5
+)
+
+// A Schedule returns the next activation time after a given time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+type every struct {
+	d time.Duration
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.d)
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type bounds struct {
+	min, max int
+}
+
+var (
+	fieldBounds = []bounds{
+		{0, 59},
+		{0, 23},
+		{1, 31},
+		{1, 12},
+		{0, 6},
+	}
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse parses a cron like schedule spec, the standard five
+// field format (minute hour day-of-month month day-of-week)
+// is supported as are the @hourly, @daily, @weekly, @monthly,
+// @yearly descriptors and @every <duration>
+func Parse(spec string) (s Schedule, err error) {
+	var d time.Duration
+
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		if d, err = time.ParseDuration(strings.TrimSpace(spec[7:])); err != nil {
+			return
+		}
+		if d <= 0 {
+			err = fmt.Errorf(invalidSpecErr, spec)
+			return
+		}
+		s = every{d: d}
+		return
+	}
+
+	if v, ok := descriptors[spec]; ok {
+		spec = v
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		err = fmt.Errorf(invalidSpecErr, spec)
+		return
+	}
+
+	c := &cronSchedule{}
+	vals := make([]uint64, 5)
+	for i, f := range fields {
+		if vals[i], err = parseField(f, fieldBounds[i]); err != nil {
+			return
+		}
+	}
+	c.minute, c.hour, c.dom, c.month, c.dow = vals[0], vals[1], vals[2], vals[3], vals[4]
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	s = c
+
+	return
+}
+
+func parseField(f string, b bounds) (bits uint64, err error) {
+	for _, part := range strings.Split(f, ",") {
+		var lo, hi, step int
+
+		step = 1
+		rng := part
+		if i := strings.Index(part, "/"); i != -1 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				err = fmt.Errorf(invalidFieldErr, f)
+				return
+			}
+		}
+
+		switch {
+		case rng == "*":
+			lo, hi = b.min, b.max
+		case strings.Contains(rng, "-"):
+			pts := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(pts[0]); err != nil {
+				err = fmt.Errorf(invalidFieldErr, f)
+				return
+			}
+			if hi, err = strconv.Atoi(pts[1]); err != nil {
+				err = fmt.Errorf(invalidFieldErr, f)
+				return
+			}
+		default:
+			if lo, err = strconv.Atoi(rng); err != nil {
+				err = fmt.Errorf(invalidFieldErr, f)
+				return
+			}
+			hi = lo
+			if step > 1 {
+				hi = b.max
+			}
+		}
+
+		if lo < b.min || hi > b.max || lo > hi {
+			err = fmt.Errorf(invalidFieldErr, f)
+			return
+		}
+
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	d := has(c.dom, t.Day())
+	w := has(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return d && w
+	}
+	return d || w
+}
+
+// Next returns the first time after t that matches the schedule,
+// the zero time is returned if no match is found
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
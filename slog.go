@@ -0,0 +1,58 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build go1.21
+// +build go1.21
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"log/slog"
+)
+
+var slogLevels = [...]slog.Level{
+	levelDebug: slog.LevelDebug,
+	levelInfo:  slog.LevelInfo,
+	levelWarn:  slog.LevelWarn,
+	levelError: slog.LevelError,
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) logEvent(level logLevel, msg string, args ...interface{}) {
+	s.l.Log(context.Background(), slogLevels[level], msg, args...)
+}
+
+// SetLogger sets the logger that receives records for dials, retries,
+// reconnects, scan results and protocol anomalies, nil disables
+// logging which is the default
+func (c *Client) SetLogger(l *slog.Logger) {
+	c.m.Lock()
+	c.logger = newEventLogger(l)
+	c.m.Unlock()
+}
+
+// SetLogger sets the logger used by connections established after
+// the call, see Client.SetLogger
+func (p *Pool) SetLogger(l *slog.Logger) {
+	p.m.Lock()
+	p.logger = newEventLogger(l)
+	p.m.Unlock()
+}
+
+func newEventLogger(l *slog.Logger) eventLogger {
+	if l == nil {
+		return nil
+	}
+
+	return slogLogger{l}
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build go1.21
+// +build go1.21
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func decodeRecords(t *testing.T, b *bytes.Buffer) (recs []map[string]interface{}) {
+	dec := json.NewDecoder(b)
+	for {
+		rec := make(map[string]interface{})
+		if err := dec.Decode(&rec); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func findRecord(recs []map[string]interface{}, msg string) map[string]interface{} {
+	for _, rec := range recs {
+		if rec[slog.MessageKey] == msg {
+			return rec
+		}
+	}
+
+	return nil
+}
+
+func TestSetLogger(t *testing.T) {
+	var b bytes.Buffer
+
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if string(r.Data) == "bye" {
+			return sssptest.Bye()
+		}
+		return sssptest.DefaultHandler(r)
+	})
+	defer ts.Close()
+
+	logger := slog.New(slog.NewJSONHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	ctx := WithLabels(context.Background(), Labels{"tenant": "acme"})
+	if _, err = p.ScanReaderContext(ctx, strings.NewReader(eicarVirus)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = p.ScanReader(strings.NewReader("bye")); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if _, err = p.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	recs := decodeRecords(t, &b)
+	rec := findRecord(recs, "connected")
+	if rec == nil || rec[LogKeyNetwork] != ts.Network || rec[LogKeyAddress] != ts.Addr {
+		t.Errorf("Dials should be logged with the address: %v", rec)
+	}
+	if rec = findRecord(recs, "scan completed"); rec == nil || rec[LogKeyInfected] != true ||
+		rec[LogKeySignature] != sssptest.EicarSignature || rec[slog.LevelKey] != "INFO" {
+		t.Errorf("Infected results should be logged at the info level: %v", rec)
+	}
+	if l, ok := rec[LogKeyLabels].(map[string]interface{}); !ok || l["tenant"] != "acme" {
+		t.Errorf("The labels of the scan should be logged: %v", rec)
+	}
+	if rec = findRecord(recs, "server closed the connection"); rec == nil || rec[LogKeyLine] != "BYE" {
+		t.Errorf("BYE should be logged: %v", rec)
+	}
+	if rec = findRecord(recs, "scan failed"); rec == nil || rec[LogKeyError] == nil {
+		t.Errorf("Failed scans should be logged: %v", rec)
+	}
+	if rec = findRecord(recs, "discarding broken connection"); rec == nil {
+		t.Errorf("Discarded connections should be logged")
+	}
+
+	b.Reset()
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	c.SetLogger(logger)
+	if err = c.Dial(context.Background()); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if findRecord(decodeRecords(t, &b), "reconnecting") == nil {
+		t.Errorf("Reconnects should be logged")
+	}
+
+	b.Reset()
+	c.SetLogger(nil)
+	if _, err = c.ScanReader(strings.NewReader("clean")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Nothing should be logged without a logger: %s", b.String())
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	spoolPrefix = "sssp-spool-"
+)
+
+// A spooled holds the data read from a reader of unknown length
+type spooled struct {
+	r    io.Reader
+	n    int64
+	file *os.File
+}
+
+// Close removes the temporary file if the data was spilled to one
+func (s *spooled) Close() (err error) {
+	if s.file == nil {
+		return
+	}
+
+	err = s.file.Close()
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+
+	return
+}
+
+// spool reads i into memory up to max bytes, larger payloads are
+// spilled to a temporary file in dir, the default temporary directory
+// is used when dir is empty
+func spool(i io.Reader, max int64, dir string) (s *spooled, err error) {
+	var buf bytes.Buffer
+	var n int64
+	var f *os.File
+
+	if n, err = io.CopyN(&buf, i, max+1); err == io.EOF {
+		s = &spooled{r: bytes.NewReader(buf.Bytes()), n: n}
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	if f, err = ioutil.TempFile(dir, spoolPrefix); err != nil {
+		return
+	}
+	s = &spooled{file: f}
+	defer func() {
+		if err != nil {
+			s.Close()
+			s = nil
+		}
+	}()
+
+	if _, err = buf.WriteTo(f); err != nil {
+		return
+	}
+	if n, err = io.Copy(f, i); err != nil {
+		return
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	s.r = f
+	s.n = max + 1 + n
+
+	return
+}
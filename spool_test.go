@@ -0,0 +1,130 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+// unsized hides the Len method of the wrapped reader
+type unsized struct {
+	io.Reader
+}
+
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) { return 0, errTestRead }
+
+var errTestRead = errors.New("read failed")
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := spool(unsized{strings.NewReader("small")}, 5, dir)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if s.file != nil || s.n != 5 {
+		t.Errorf("Payloads up to max should be kept in memory: %+v", s)
+	}
+	if b, _ := ioutil.ReadAll(s.r); string(b) != "small" {
+		t.Errorf("Unexpected data %q", b)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	data := strings.Repeat("x", 100)
+	if s, err = spool(unsized{strings.NewReader(data)}, 10, dir); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if s.file == nil || s.n != int64(len(data)) {
+		t.Fatalf("Larger payloads should be spilled to a file: %+v", s)
+	}
+	if b, _ := ioutil.ReadAll(s.r); string(b) != data {
+		t.Errorf("Unexpected data %q", b)
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 1 || !strings.HasPrefix(fs[0].Name(), spoolPrefix) {
+		t.Errorf("The file should be created in %s", dir)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 0 {
+		t.Errorf("The file should be removed on Close")
+	}
+
+	if _, err = spool(io.MultiReader(strings.NewReader(data), failReader{}), 10, dir); err != errTestRead {
+		t.Errorf("spool() error = %v, want %v", err, errTestRead)
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 0 {
+		t.Errorf("The file should be removed on failure")
+	}
+	if _, err = spool(failReader{}, 10, dir); err != errTestRead {
+		t.Errorf("spool() error = %v, want %v", err, errTestRead)
+	}
+	if _, err = spool(unsized{strings.NewReader(data)}, 10, dir+"/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("spool() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestMockSpool(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	if _, e = c.ScanReader(unsized{strings.NewReader(eicarVirus)}); e == nil || e.Error() != noSizeErr {
+		t.Errorf("Spooling should be disabled by default: %v", e)
+	}
+
+	dir := t.TempDir()
+	c.SetSpool(16, dir)
+	for _, data := range []string{"clean", eicarVirus + strings.Repeat(" ", 100)} {
+		r, err := c.ScanReader(unsized{strings.NewReader(data)})
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if r.Infected != strings.HasPrefix(data, eicarVirus) {
+			t.Errorf("Unexpected result for %q: %+v", data, r)
+		}
+	}
+	reqs := ts.Requests()
+	if len(reqs) != 2 || string(reqs[1].Data) != eicarVirus+strings.Repeat(" ", 100) {
+		t.Errorf("Unexpected requests: %v", reqs)
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 0 {
+		t.Errorf("Spooled files should be removed")
+	}
+
+	p, e := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer p.Close()
+	p.SetSpool(16, dir)
+	if r, err := p.ScanReader(unsized{strings.NewReader(eicarVirus)}); err != nil || !r.Infected {
+		t.Errorf("Unexpected result %+v %v", r, err)
+	}
+}
@@ -11,15 +11,19 @@ package sssp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/textproto"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
 )
 
 const (
@@ -30,19 +34,37 @@ const (
 	protocolVersion     = "SSSP/1.0"
 	okResp              = "OK"
 	ackResp             = "ACC"
-	failResp            = "FAIL"
-	doneResp            = "DONE"
-	doneOk              = "DONE OK"
-	doneFail            = "DONE FAIL"
-	virusResp           = "VIRUS"
+	rejResp             = "REJ"
+	byeResp             = "BYE"
 	unixSockErr         = "The unix socket: %s does not exist"
 	unsupportedProtoErr = "Protocol: %s is not supported"
 	noSizeErr           = "The content length could not be determined"
 	dirScanErr          = "Scanning directories is not supported"
-	invalidRespErr      = "Invalid server response: %s"
-	virusMatchErr       = "Virus match failure: %s"
+	queryErr            = "Query failed: %s"
+	invalidDateErr      = "Invalid date in %s: %q"
 	greetingErr         = "Greeting failed: %s"
 	ackErr              = "Ack failed: %s"
+	doneResp            = "DONE"
+	envErr              = "Invalid value for %s: %q"
+	itemMismatchErr     = "Response for %s does not match the request for %s"
+	invalidAddrErr      = "Invalid address %q: %s"
+	bracketsErr         = "Invalid address %q: IPv6 addresses must be enclosed in brackets, as in [%s]:4020"
+	zoneErr             = "Invalid address %q: zones are only valid on IPv6 addresses"
+)
+
+// Environment variables read by NewClientFromEnv
+const (
+	// EnvNetwork is the network, it defaults to unix for addresses
+	// that are paths and tcp otherwise
+	EnvNetwork = "SSSP_NETWORK"
+	// EnvAddress is the server address
+	EnvAddress = "SSSP_ADDRESS"
+	// EnvConnTimeout is the connection timeout
+	EnvConnTimeout = "SSSP_CONN_TIMEOUT"
+	// EnvTimeout is the command timeout
+	EnvTimeout = "SSSP_TIMEOUT"
+	// EnvConnRetries is the number of connection retries
+	EnvConnRetries = "SSSP_CONN_RETRIES"
 )
 
 const (
@@ -56,12 +78,30 @@ const (
 	ScanData
 	// Quit reprsents the BYE command
 	Quit
+	// Query represents the QUERY command
+	Query
 )
 
 var (
 	// ZeroTime holds the zero value of time
-	ZeroTime   time.Time
-	responseRe = regexp.MustCompile(`^VIRUS\s(?P<signature>\S+)\s(?P<filename>\S+)?$`)
+	ZeroTime time.Time
+	// ErrNoResult is returned when a scan response holds neither
+	// an OK, FAIL or DONE line so the outcome is unknown
+	ErrNoResult = errors.New("The server did not report a result")
+	// ErrServerClosed is returned when the server has ended the
+	// session with BYE, Dial must be called to reconnect
+	ErrServerClosed = errors.New("The server closed the connection")
+	// ErrProtocolDesync is returned when a response line is not the
+	// one expected for the request, such as data left over from a
+	// timed out scan, Dial must be called to reconnect
+	ErrProtocolDesync = errors.New("The server response is out of sequence")
+
+	dateLayouts = []string{
+		"20060102",
+		"2006-01-02",
+		"Mon Jan _2 15:04:05 2006",
+		time.RFC3339,
+	}
 )
 
 type readerWithLen interface {
@@ -79,8 +119,9 @@ func (c Command) String() (s string) {
 		"SCANDIRR",
 		"SCANDATA",
 		"BYE",
+		"QUERY",
 	}
-	if c < ScanFile || c > Quit {
+	if c < ScanFile || c > Query {
 		s = ""
 		return
 	}
@@ -90,13 +131,107 @@ func (c Command) String() (s string) {
 
 // Response represents the response from the server
 type Response struct {
-	Filename     string
-	ArchiveItem  string
-	Signature    string
-	Status       string
-	Infected     bool
-	ErrorOccured bool
-	Raw          string
+	Filename    string `json:"filename"`
+	ArchiveItem string `json:"archive_item"`
+	Signature   string `json:"signature"`
+	// Status is OK or FAIL as reported by the DONE line
+	Status string `json:"status"`
+	// Code is the result code of the DONE line, the codes are
+	// hexadecimal so 0x0212 is returned for DONE FAIL 0212
+	Code int `json:"code"`
+	// StatusText is the text following the code of the DONE line
+	StatusText   string `json:"status_text"`
+	Infected     bool   `json:"infected"`
+	ErrorOccured bool   `json:"error_occured"`
+	Raw          string `json:"raw"`
+	// Detections holds every threat reported, Signature and
+	// ArchiveItem are those of the first one
+	Detections []Detection `json:"detections,omitempty"`
+	// FileType is the type the engine identified for the item, it
+	// is only set when the server is configured to report types
+	FileType string `json:"file_type,omitempty"`
+	// Action is the action of the policy set by SetPolicy
+	Action PolicyAction `json:"action,omitempty"`
+	// Fallback is set when the server rejected the directory scan
+	// and the file was scanned by a client side walk, see
+	// SetDirFallback
+	Fallback bool `json:"fallback,omitempty"`
+	// Labels holds the labels of the context of the scan, see
+	// WithLabels
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// A Detection represents a threat reported by a VIRUS line, a scan
+// may report several distinct threats
+type Detection struct {
+	Signature string `json:"signature"`
+	// Path is the item reported by the server
+	Path string `json:"path"`
+	// IsArchiveItem is set when Path refers to a member of the
+	// item that was scanned
+	IsArchiveItem bool   `json:"is_archive_item"`
+	Raw           string `json:"raw"`
+	// FileType is the type reported for Path by a TYPE line
+	FileType string `json:"file_type,omitempty"`
+	// Category is the kind of threat, it is only set when a
+	// classifier is configured, see SetClassifier
+	Category Category `json:"category,omitempty"`
+}
+
+// addDetections appends a Detection for each VIRUS event of res,
+// items other than p are archive items and types holds the types
+// reported by TYPE events
+func (r *Response) addDetections(res *protocol.Result, p string, types map[string]string) {
+	for _, e := range res.Detections {
+		r.Detections = append(r.Detections, Detection{
+			Signature:     e.Signature,
+			Path:          e.Item,
+			IsArchiveItem: e.Item != "" && e.Item != p,
+			Raw:           e.Raw,
+			FileType:      types[e.Item],
+		})
+	}
+}
+
+// setDone sets the status fields from the DONE event e
+func (r *Response) setDone(e *protocol.Event) {
+	if e == nil {
+		return
+	}
+
+	r.Status = e.Status
+	r.StatusText = e.Text
+	if n, err := strconv.ParseInt(e.Code, 16, 32); err == nil {
+		r.Code = int(n)
+	}
+}
+
+// Info represents the information returned by a QUERY command,
+// keys may be repeated so all the values are retained
+type Info map[string][]string
+
+// Get returns the first value associated with key
+func (i Info) Get(key string) (s string) {
+	if v := i[key]; len(v) > 0 {
+		s = v[0]
+	}
+
+	return
+}
+
+// Time returns the first value associated with key parsed as a
+// date, the date formats used by the SAVDI versions are supported
+func (i Info) Time(key string) (t time.Time, err error) {
+	v := strings.TrimSpace(i.Get(key))
+	for _, l := range dateLayouts {
+		if t, err = time.Parse(l, v); err == nil {
+			return
+		}
+	}
+	t = time.Time{}
+	err = fmt.Errorf(invalidDateErr, key, v)
+
+	return
 }
 
 // A Client represents an SSSP client.
@@ -105,11 +240,64 @@ type Client struct {
 	address     string
 	connTimeout time.Duration
 	connRetries int
-	connSleep   time.Duration
 	cmdTimeout  time.Duration
 	tc          *textproto.Conn
 	m           sync.Mutex
 	conn        net.Conn
+	// broken is the error that made the connection unusable,
+	// it is returned by every command until Dial reconnects
+	broken error
+	// window limits the number of requests in flight
+	window chan struct{}
+	connID uint64
+	// closed is set once the connection has been closed
+	closed bool
+	// idleSince is when a Pool last put the client back
+	idleSince time.Time
+	// connectedAt is when the connection was established
+	connectedAt time.Time
+	// futures completes the async scans
+	futures asyncRunner
+	clientOptions
+}
+
+// clientOptions holds the settings of a Client that a Pool passes
+// on to the clients it dials, they are set using the Set methods of
+// either type and are guarded by its lock
+type clientOptions struct {
+	connSleep time.Duration
+	tlsConfig *tls.Config
+	// readers of unknown length are spooled when spoolMax is set
+	spoolMax int64
+	spoolDir string
+	// logger receives structured records when set
+	logger eventLogger
+	// debug receives the protocol lines when set
+	debug *debugLog
+	// sink receives the metrics when set
+	sink  MetricsSink
+	hooks *Hooks
+	// shared holds the directories visible to the server
+	shared []string
+	// pathMap holds the local directories the server mounts elsewhere
+	pathMap *pathMap
+	// classifier sets the category of detections when set
+	classifier Classifier
+	// policy sets the action of responses when set
+	policy *Policy
+	// dirFallback walks the directories the server refuses to scan
+	dirFallback bool
+	walkLimits  WalkLimits
+	walkOptions WalkOptions
+	// dialRetry overrides the retries of connection attempts
+	dialRetry RetryPolicy
+	// keepAlive is the TCP keepalive interval, negative disables it
+	keepAlive time.Duration
+	sockOpts  SocketOptions
+	localAddr *net.TCPAddr
+	// resolver caches the addresses of the server when set
+	resolver *resolveCache
+	lookupFn LookupFunc
 }
 
 // SetCmdTimeout sets the cmd timeout
@@ -127,14 +315,45 @@ func (c *Client) SetConnSleep(s time.Duration) {
 	}
 }
 
+// SetSpool enables scanning readers whose length is unknown, they
+// are read into memory up to max bytes and larger payloads are
+// spilled to a temporary file in dir, the default temporary directory
+// is used when dir is empty. A max of 0 disables spooling.
+func (c *Client) SetSpool(max int64, dir string) {
+	if max >= 0 {
+		c.spoolMax = max
+		c.spoolDir = dir
+	}
+}
+
+// SetPipeline sets the number of requests that may be in flight on
+// the connection, requests from concurrent goroutines are written
+// without waiting for the responses to earlier ones which are read
+// in order. The default of 1 serializes requests, a client falls
+// back to it when the server does not handle pipelined requests.
+func (c *Client) SetPipeline(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	c.m.Lock()
+	c.window = make(chan struct{}, n)
+	c.m.Unlock()
+}
+
 // Close closes the connection to the server gracefully
 // and frees up resources used by the connection
 func (c *Client) Close() (err error) {
+	if cause := c.usable(); cause != nil {
+		c.closeConn(cause)
+		return
+	}
+
 	_, err = c.basicCmd(Quit)
 	if err != nil {
-		c.tc.Close()
+		c.closeConn(err)
 	} else {
-		err = c.tc.Close()
+		err = c.closeConn(nil)
 	}
 
 	return
@@ -142,21 +361,71 @@ func (c *Client) Close() (err error) {
 
 // ScanFile submits a single file for scanning
 func (c *Client) ScanFile(p string) (r *Response, err error) {
-	r, err = c.fileCmd(p)
+	r, err = c.ScanFileContext(context.Background(), p)
+	return
+}
+
+// ScanFileContext submits a single file for scanning, the labels of
+// ctx are attached to the scan
+func (c *Client) ScanFileContext(ctx context.Context, p string) (r *Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	l := LabelsFromContext(ctx)
+	start := c.startScan(ScanFile, p, l)
+	r, err = c.fileCmd(c.serverPath(p))
+	c.localPaths(r)
+	err = classify(err)
+	c.endScan(ScanFile, p, l, start, err, r)
 	return
 }
 
 // ScanDir submits a directory for scanning
 func (c *Client) ScanDir(p string, recurse bool) (r []*Response, err error) {
-	r, err = c.dirCmd(p, recurse)
+	r, err = c.ScanDirContext(context.Background(), p, recurse)
+	return
+}
+
+// ScanDirContext submits a directory for scanning, the labels of ctx
+// are attached to the scan
+func (c *Client) ScanDirContext(ctx context.Context, p string, recurse bool) (r []*Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	cmd := ScanDir
+	if recurse {
+		cmd = ScanDirr
+	}
+	l := LabelsFromContext(ctx)
+	start := c.startScan(cmd, p, l)
+	r, err = c.dirCmd(c.serverPath(p), recurse)
+	c.localPaths(r...)
+	err = classify(err)
+	c.endScan(cmd, p, l, start, err, r...)
+	if c.fallback(err) {
+		r, err = c.walkDir(ctx, p, recurse)
+	}
 	return
 }
 
 // ScanStream submits a single file via a stream for scanning
 func (c *Client) ScanStream(p string) (r *Response, err error) {
+	r, err = c.ScanStreamContext(context.Background(), p)
+	return
+}
+
+// ScanStreamContext submits a single file via a stream for scanning,
+// the labels of ctx are attached to the scan
+func (c *Client) ScanStreamContext(ctx context.Context, p string) (r *Response, err error) {
 	var f *os.File
 	var stat os.FileInfo
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	if stat, err = os.Stat(p); os.IsNotExist(err) {
 		return
 	}
@@ -171,76 +440,216 @@ func (c *Client) ScanStream(p string) (r *Response, err error) {
 	}
 	defer f.Close()
 
+	l := LabelsFromContext(ctx)
+	start := c.startScan(ScanData, p, l)
 	r, err = c.readerCmd(f)
+	err = classify(err)
+	c.endScan(ScanData, p, l, start, err, r)
 
 	return
 }
 
 // ScanReader submits an io reader via a stream for scanning
 func (c *Client) ScanReader(i io.Reader) (r *Response, err error) {
+	r, err = c.ScanReaderContext(context.Background(), i)
+	return
+}
+
+// ScanReaderContext submits an io reader via a stream for scanning,
+// the labels of ctx are attached to the scan
+func (c *Client) ScanReaderContext(ctx context.Context, i io.Reader) (r *Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	l := LabelsFromContext(ctx)
+	start := c.startScan(ScanData, "", l)
 	r, err = c.readerCmd(i)
+	err = classify(err)
+	c.endScan(ScanData, "", l, start, err, r)
 
 	return
 }
 
-func (c *Client) dial(ctx context.Context) (conn net.Conn, err error) {
-	d := &net.Dialer{
-		Timeout: c.connTimeout,
+// ScanSizedReader submits an io reader whose content length
+// is known to the caller via a stream for scanning
+func (c *Client) ScanSizedReader(i io.Reader, n int64) (r *Response, err error) {
+	r, err = c.ScanSizedReaderContext(context.Background(), i, n)
+	return
+}
+
+// ScanSizedReaderContext submits an io reader whose content length
+// is known to the caller via a stream for scanning, the labels of
+// ctx are attached to the scan
+func (c *Client) ScanSizedReaderContext(ctx context.Context, i io.Reader, n int64) (r *Response, err error) {
+	if n < 0 {
+		err = fmt.Errorf(noSizeErr)
+		return
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
 	}
 
-	for i := 0; i <= c.connRetries; i++ {
-		conn, err = d.DialContext(ctx, c.network, c.address)
-		if e, ok := err.(net.Error); ok && e.Timeout() {
-			time.Sleep(c.connSleep)
-			continue
+	l := LabelsFromContext(ctx)
+	start := c.startScan(ScanData, "", l)
+	r, err = c.streamCmd(i, n)
+	err = classify(err)
+	c.endScan(ScanData, "", l, start, err, r)
+
+	return
+}
+
+// QueryServer returns the server information
+func (c *Client) QueryServer() (i Info, err error) {
+	i, err = c.queryCmd("SERVER")
+	err = classify(err)
+
+	return
+}
+
+// QuerySAVI returns the SAVI and virus data information
+func (c *Client) QuerySAVI() (i Info, err error) {
+	i, err = c.queryCmd("SAVI")
+	err = classify(err)
+
+	return
+}
+
+// QueryEngine returns the engine configuration
+func (c *Client) QueryEngine() (i Info, err error) {
+	i, err = c.queryCmd("ENGINE")
+	err = classify(err)
+
+	return
+}
+
+func (c *Client) dial(ctx context.Context) (conn net.Conn, retries []retryEvent, err error) {
+	d := c.netDialer()
+	policy := c.dialPolicy()
+	for attempt := 1; ; attempt++ {
+		conn, err = c.dialConn(ctx, d)
+		if err == nil || !policy.ShouldRetry(attempt, err) {
+			break
 		}
-		break
+		c.logEvent(levelWarn, "dial failed, retrying", LogKeyAttempt, attempt, LogKeyError, err)
+		retries = append(retries, retryEvent{attempt, err})
+		time.Sleep(policy.Backoff(attempt))
 	}
 
 	return
 }
 
-func (c *Client) basicCmd(cmd Command) (s string, err error) {
-	var id uint
+// roundTrip sends a request using write and reads its response using
+// read, up to the window size requests are in flight at once and the
+// textproto pipeline keeps the writes and the responses in order.
+// The deadlines are only changed while a request holds its half of
+// the connection, a failed write marks the connection broken.
+func (c *Client) roundTrip(write func(id uint) error, read func(id uint) error) (err error) {
+	w := c.acquire()
+	defer func() { <-w }()
 
-	c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-	if id, err = c.tc.Cmd("%s", cmd); err != nil {
-		return
+	id := c.tc.Next()
+
+	c.tc.StartRequest(id)
+	if err = c.usable(); err == nil {
+		c.conn.SetWriteDeadline(time.Now().Add(c.cmdTimeout))
+		if err = write(id); err != nil {
+			// the server may hold part of the request
+			c.fail(ErrProtocolDesync)
+		}
+		c.conn.SetWriteDeadline(ZeroTime)
 	}
+	c.tc.EndRequest(id)
 
-	defer c.conn.SetDeadline(ZeroTime)
 	c.tc.StartResponse(id)
 	defer c.tc.EndResponse(id)
 
-	s, err = c.tc.ReadLine()
+	if err != nil {
+		return
+	}
+	if err = c.usable(); err != nil {
+		// an earlier request broke the connection
+		return
+	}
+
+	err = read(id)
+	c.conn.SetReadDeadline(ZeroTime)
 
 	return
 }
 
-func (c *Client) fileCmd(p string) (r *Response, err error) {
-	var id uint
+// acquire takes a slot in the request window and returns the window
+// to release it to
+func (c *Client) acquire() (w chan struct{}) {
+	c.m.Lock()
+	if c.window == nil {
+		c.window = make(chan struct{}, 1)
+	}
+	w = c.window
+	c.m.Unlock()
 
-	c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-	if id, err = c.tc.Cmd("%s %s", ScanFile, p); err != nil {
-		return
+	w <- struct{}{}
+
+	return
+}
+
+// usable returns the error that broke the connection
+func (c *Client) usable() (err error) {
+	c.m.Lock()
+	err = c.broken
+	c.m.Unlock()
+
+	return
+}
+
+// fail marks the connection broken with err and returns it
+func (c *Client) fail(err error) error {
+	c.m.Lock()
+	c.broken = err
+	c.m.Unlock()
+
+	return err
+}
+
+// serialize stops pipelining once a response is out of sequence
+// while several requests are in flight, the server is assumed not
+// to handle pipelined requests
+func (c *Client) serialize() {
+	c.m.Lock()
+	if c.window != nil && cap(c.window) > 1 && len(c.window) > 1 {
+		c.window = make(chan struct{}, 1)
 	}
+	c.m.Unlock()
+}
 
-	defer c.conn.SetDeadline(ZeroTime)
-	c.tc.StartResponse(id)
-	defer c.tc.EndResponse(id)
+func (c *Client) basicCmd(cmd Command) (s string, err error) {
+	err = c.roundTrip(func(id uint) error {
+		return c.printfLine(id, "%s", cmd)
+	}, func(id uint) (e error) {
+		c.conn.SetReadDeadline(time.Now().Add(c.cmdTimeout))
+		s, e = c.readLine(id)
+		return
+	})
 
-	r, err = c.processResponse(p)
+	return
+}
+
+func (c *Client) fileCmd(p string) (r *Response, err error) {
+	err = c.roundTrip(func(id uint) error {
+		return c.printfLine(id, "%s %s", ScanFile, p)
+	}, func(id uint) (e error) {
+		r, e = c.processResponse(id, ScanFile, p)
+		return
+	})
 
 	return
 }
 
 func (c *Client) readerCmd(i io.Reader) (r *Response, err error) {
-	var id uint
 	var clen int64
 	var stat os.FileInfo
 
-	defer c.conn.SetDeadline(ZeroTime)
-
 	switch v := i.(type) {
 	case readerWithLen:
 		clen = int64(v.Len())
@@ -251,195 +660,287 @@ func (c *Client) readerCmd(i io.Reader) (r *Response, err error) {
 		}
 		clen = stat.Size()
 	default:
-		err = fmt.Errorf(noSizeErr)
-		return
+		if c.spoolMax <= 0 {
+			err = fmt.Errorf(noSizeErr)
+			return
+		}
+		var sp *spooled
+		if sp, err = spool(i, c.spoolMax, c.spoolDir); err != nil {
+			return
+		}
+		defer sp.Close()
+		i, clen = sp.r, sp.n
 	}
 
-	id = c.tc.Next()
-	c.tc.StartRequest(id)
+	r, err = c.streamCmd(i, clen)
 
-	c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-	if err = c.tc.PrintfLine("%s %d", ScanData, clen); err != nil {
-		c.tc.EndRequest(id)
+	return
+}
+
+// streamCmd sends clen bytes of i using SCANDATA, concurrent calls
+// have their uploads in flight together when pipelining is enabled
+func (c *Client) streamCmd(i io.Reader, clen int64) (r *Response, err error) {
+	err = c.roundTrip(func(id uint) (e error) {
+		if e = c.printfLine(id, "%s %d", ScanData, clen); e != nil {
+			return
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(c.cmdTimeout))
+		c.debugPayload(id, clen)
+		e = c.sendData(i, clen)
 		return
-	}
+	}, func(id uint) (e error) {
+		r, e = c.processResponse(id, ScanData, "stream")
+		return
+	})
 
-	c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-	if _, err = io.Copy(c.tc.Writer.W, i); err != nil {
-		c.tc.EndRequest(id)
+	return
+}
+
+// sendData writes n bytes of i after the SCANDATA line, when the
+// connection implements io.ReaderFrom the command is flushed and the
+// payload is handed to it rather than copied through the buffered
+// writer, TCP and unix connections then use sendfile or splice for
+// files. Other connections, such as TLS, use the buffered writer.
+func (c *Client) sendData(i io.Reader, n int64) (err error) {
+	var written int64
+
+	defer func() { c.count(MetricBytes, written) }()
+
+	rf, ok := c.conn.(io.ReaderFrom)
+	if !ok {
+		if written, err = copyN(c.tc.W, i, n); err != nil {
+			return
+		}
+		err = c.tc.W.Flush()
 		return
 	}
+
 	if err = c.tc.W.Flush(); err != nil {
-		c.tc.EndRequest(id)
 		return
 	}
-
-	c.tc.EndRequest(id)
-	c.tc.StartResponse(id)
-	defer c.tc.EndResponse(id)
-
-	r, err = c.processResponse("stream")
+	if written, err = rf.ReadFrom(io.LimitReader(i, n)); err == nil && written < n {
+		err = io.EOF
+	}
 
 	return
 }
 
 func (c *Client) dirCmd(p string, rc bool) (r []*Response, err error) {
-	var id uint
-
 	cmd := ScanDir
 	if rc {
 		cmd = ScanDirr
 	}
 
-	c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-	if id, err = c.tc.Cmd("%s %s", cmd, p); err != nil {
+	err = c.roundTrip(func(id uint) error {
+		return c.printfLine(id, "%s %s", cmd, p)
+	}, func(id uint) (e error) {
+		r, e = c.processResponses(id)
 		return
-	}
+	})
 
-	defer c.conn.SetDeadline(ZeroTime)
-	c.tc.StartResponse(id)
-	defer c.tc.EndResponse(id)
+	return
+}
 
-	r, err = c.processResponses()
+func (c *Client) queryCmd(item string) (i Info, err error) {
+	err = c.roundTrip(func(id uint) error {
+		return c.printfLine(id, "%s %s", Query, item)
+	}, func(id uint) (e error) {
+		i, e = c.processQuery(id)
+		return
+	})
 
 	return
 }
 
-func (c *Client) processResponse(p string) (r *Response, err error) {
-	var ierr error
-	var line string
+func (c *Client) processQuery(id uint) (i Info, err error) {
+	var lines []string
+	var pr *protocol.Response
 
-	r = &Response{
-		Filename: p,
+	buf := getLines()
+	defer putLines(buf)
+	if err = c.readResponse(id, buf); err != nil {
+		return
 	}
+	lines = *buf
 
-	for {
-		c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-		if line, err = c.tc.ReadLine(); err != nil {
-			return
+	if pr, err = protocol.ParseResponse(lines); err != nil {
+		c.logEvent(levelWarn, "malformed response", LogKeyRequestID, id, LogKeyError, err)
+	}
+	if i = Info(pr.Info); i == nil {
+		i = make(Info)
+	}
+	if err != nil {
+		line := lines[len(lines)-1]
+		if pr.Done != nil {
+			line = pr.Done.Raw
 		}
+		err = fmt.Errorf(queryErr, line)
+	}
 
-		if strings.HasPrefix(line, ackResp) {
-			continue
-		}
+	return
+}
 
-		if strings.HasPrefix(line, doneResp) {
-			if strings.HasPrefix(line, doneFail) {
-				ierr = fmt.Errorf("%s", strings.TrimLeft(strings.TrimLeft(line, doneFail), " "))
-			}
-		}
+// readResponse appends the lines of the response to request id up
+// to and including the terminating blank line to lines, a REJ line
+// is not terminated. A BYE line sent by the server or a line that is
+// out of sequence marks the connection broken.
+func (c *Client) readResponse(id uint, lines *[]string) (err error) {
+	var line string
+	var done bool
 
-		if line == "" {
-			break
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.cmdTimeout))
+		if line, err = c.readLine(id); err != nil {
+			return
 		}
 
-		if r.Signature != "" {
-			continue
+		if line == byeResp || strings.HasPrefix(line, byeResp+" ") {
+			c.logEvent(levelWarn, "server closed the connection", LogKeyRequestID, id, LogKeyLine, line)
+			err = c.fail(ErrServerClosed)
+			return
 		}
 
-		if m := responseRe.FindStringSubmatch(line); m != nil {
-			if r.Filename != m[2] {
-				r.ArchiveItem = m[2]
-			}
-			r.Infected = true
-			r.Signature = m[1]
-			r.Raw = line
-			continue
+		if !inSequence(line, id, len(*lines) == 0, done) {
+			c.logEvent(levelError, "response out of sequence", LogKeyRequestID, id, LogKeyLine, line)
+			c.serialize()
+			err = c.fail(ErrProtocolDesync)
+			return
 		}
 
-		if strings.HasPrefix(line, virusResp) {
-			ierr = fmt.Errorf(virusMatchErr, line)
-			continue
+		*lines = append(*lines, line)
+		if line == "" || strings.HasPrefix(line, rejResp) {
+			return
 		}
+		done = strings.HasPrefix(line, doneResp)
 	}
+}
 
-	if err == nil && ierr != nil {
-		err = ierr
+// inSequence reports whether line may follow the lines read so far
+// for request id, a response starts with ACC or REJ, the ACC request
+// number counts from 1 and nothing but the blank line follows DONE
+func inSequence(line string, id uint, first, done bool) bool {
+	ack := strings.HasPrefix(line, ackResp)
+	rej := strings.HasPrefix(line, rejResp)
+
+	if !first {
+		return !ack && !rej && (!done || line == "")
 	}
 
-	return
+	if rej {
+		return true
+	}
+	if !ack {
+		return false
+	}
+	if i := strings.LastIndexByte(line, '/'); i != -1 {
+		if n, err := strconv.ParseUint(line[i+1:], 10, 32); err == nil && n != uint64(id)+1 {
+			return false
+		}
+	}
+
+	return true
 }
 
-func (c *Client) processResponses() (r []*Response, err error) {
-	var ierr error
-	var line string
+// processResponse processes the response to a single item scan,
+// the OK or FAIL event confirms which item completed, for SCANFILE
+// it must refer to the requested path
+func (c *Client) processResponse(id uint, cmd Command, p string) (r *Response, err error) {
+	var lines []string
+	var pr *protocol.Response
+	var completed bool
 
-	for {
-		c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-		if line, err = c.tc.ReadLine(); err != nil {
-			return
-		}
+	r = &Response{
+		Filename: p,
+	}
 
-		if strings.HasPrefix(line, ackResp) {
-			continue
-		}
+	buf := getLines()
+	defer putLines(buf)
+	if err = c.readResponse(id, buf); err != nil {
+		return
+	}
+	lines = *buf
 
-		if strings.HasPrefix(line, doneResp) {
-			if strings.HasPrefix(line, doneFail) {
-				ierr = fmt.Errorf("%s", strings.TrimLeft(strings.TrimLeft(line, doneFail), " "))
-			}
+	if pr, err = protocol.ParseResponse(lines); err != nil {
+		c.logEvent(levelWarn, "malformed response", LogKeyRequestID, id, LogKeyError, err)
+	}
+	r.setDone(pr.Done)
+	r.FileType = pr.Types[p]
+	for _, e := range pr.Events {
+		if r.FileType == "" && cmd == ScanData && e.Type == protocol.FileType {
+			// the first TYPE event refers to the stream itself
+			r.FileType = e.Code
 		}
-
-		if line == "" {
-			break
+	}
+	for _, res := range pr.Results {
+		if !res.Infected {
+			continue
 		}
-
-		if strings.HasPrefix(line, failResp) {
-			rs := &Response{}
-			rs.ErrorOccured = true
-			rs.Raw = line
-			pts := strings.Split(line, " ")
-			if len(pts) != 3 {
-				ierr = fmt.Errorf(invalidRespErr, line)
-			} else {
-				rs.Filename = pts[2]
-			}
-
-			r = append(r, rs)
+		r.addDetections(res, p, pr.Types)
+		if r.Infected {
 			continue
 		}
-
-		if m := responseRe.FindStringSubmatch(line); m != nil {
-			rs := &Response{}
-			rs.Infected = true
-			rs.Signature = m[1]
-			rs.Raw = line
-			rs.ArchiveItem = m[2]
-			for {
-				c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
-				if line, err = c.tc.ReadLine(); err != nil {
-					return
-				}
-				if strings.HasPrefix(line, virusResp) {
-					continue
-				}
-				if strings.HasPrefix(line, okResp) {
-					pts := strings.Split(line, " ")
-					if len(pts) != 3 {
-						ierr = fmt.Errorf(invalidRespErr, line)
-					} else {
-						rs.Filename = pts[2]
-						if rs.ArchiveItem == rs.Filename {
-							rs.ArchiveItem = ""
-						}
-					}
-					break
-				}
-			}
-
-			r = append(r, rs)
+		if res.Item != p {
+			r.ArchiveItem = res.Item
 		}
+		r.Infected = true
+		r.Signature = res.Signature
+		r.Raw = res.Raw
+	}
 
-		if strings.HasPrefix(line, virusResp) {
-			ierr = fmt.Errorf(virusMatchErr, line)
+	for _, e := range pr.Events {
+		if e.Type != protocol.Ok && e.Type != protocol.Fail {
 			continue
 		}
+		completed = true
+		if e.Type == protocol.Fail {
+			r.ErrorOccured = true
+		}
+		if err == nil && cmd == ScanFile && e.Item != p {
+			err = fmt.Errorf(itemMismatchErr, e.Item, p)
+			c.logEvent(levelError, "response item mismatch", LogKeyRequestID, id, LogKeyFile, p, LogKeyLine, e.Raw)
+		}
+	}
+
+	if err == nil && !completed && pr.Done == nil {
+		err = ErrNoResult
+		c.logEvent(levelWarn, "response without a result", LogKeyRequestID, id, LogKeyCommand, cmd.String())
+	}
+	c.categorize(r)
+	c.applyPolicy(r)
+
+	return
+}
+
+func (c *Client) processResponses(id uint) (r []*Response, err error) {
+	var lines []string
+	var pr *protocol.Response
 
+	buf := getLines()
+	defer putLines(buf)
+	if err = c.readResponse(id, buf); err != nil {
+		return
 	}
+	lines = *buf
 
-	if err == nil && ierr != nil {
-		err = ierr
+	if pr, err = protocol.ParseResponse(lines); err != nil {
+		c.logEvent(levelWarn, "malformed response", LogKeyRequestID, id, LogKeyError, err)
+	}
+	for _, res := range pr.Results {
+		rs := &Response{
+			Filename:     res.Filename,
+			ArchiveItem:  res.ArchiveItem,
+			Signature:    res.Signature,
+			Infected:     res.Infected,
+			ErrorOccured: res.ErrorOccured,
+			Raw:          res.Raw,
+		}
+		rs.setDone(pr.Done)
+		rs.FileType = pr.Types[res.Filename]
+		rs.addDetections(res, res.Filename, pr.Types)
+		r = append(r, rs)
 	}
+	c.categorize(r...)
+	c.applyPolicy(r...)
 
 	return
 }
@@ -453,6 +954,7 @@ func (c *Client) greeting() (err error) {
 	if line, err = c.tc.ReadLine(); err != nil {
 		return
 	}
+	c.debugHandshake(debugReceived, line)
 
 	if !strings.HasPrefix(line, okResp) {
 		err = fmt.Errorf(greetingErr, line)
@@ -468,6 +970,7 @@ func (c *Client) proto() (err error) {
 	defer c.conn.SetDeadline(ZeroTime)
 
 	c.conn.SetDeadline(time.Now().Add(c.cmdTimeout))
+	c.debugHandshake(debugSent, protocolVersion)
 	if err = c.tc.PrintfLine("%s", protocolVersion); err != nil {
 		return
 	}
@@ -476,6 +979,7 @@ func (c *Client) proto() (err error) {
 	if line, err = c.tc.ReadLine(); err != nil {
 		return
 	}
+	c.debugHandshake(debugReceived, line)
 
 	if !strings.HasPrefix(line, ackResp) {
 		err = fmt.Errorf(ackErr, line)
@@ -490,13 +994,48 @@ func (c *Client) proto() (err error) {
 // It is provided to allow for reconnection if the underlying
 // connection is dropped due to inactivity.
 func (c *Client) Dial(ctx context.Context) (err error) {
+	var conn net.Conn
+	var retries []retryEvent
+
+	// the hooks run once the lock is released
+	defer c.connected(&err)
+	defer c.retried(&retries)
+
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	if c.conn, err = c.dial(ctx); err != nil {
+	if c.tc != nil {
+		c.count(MetricReconnects, 1)
+		c.logEvent(levelInfo, "reconnecting")
+		// the old connection is replaced, it is not left open
+		c.tc.Close()
+	}
+
+	start := time.Now()
+	if conn, retries, err = c.dial(ctx); err != nil {
+		// commands fail with the dial error until a dial succeeds
+		c.broken = err
+		c.logEvent(levelError, "dial failed", LogKeyError, err)
+		return
+	}
+
+	c.conn = conn
+	c.broken = nil
+	c.closed = false
+	c.connID = nextConnID()
+	c.connectedAt = time.Now()
+	if err = c.handshake(); err != nil {
+		c.broken = err
+		c.logEvent(levelError, "handshake failed", LogKeyError, err)
 		return
 	}
+	c.observe(MetricDialDuration, start)
+	c.logEvent(levelDebug, "connected", LogKeyDuration, time.Since(start))
 
+	return
+}
+
+func (c *Client) handshake() (err error) {
 	defer c.conn.SetDeadline(ZeroTime)
 
 	c.tc = textproto.NewConn(c.conn)
@@ -514,23 +1053,117 @@ func (c *Client) Dial(ctx context.Context) (err error) {
 	return
 }
 
-// NewClient creates and returns a new instance of Client
-func NewClient(ctx context.Context, network, address string, connTimeOut, ioTimeOut time.Duration, connRetries int) (c *Client, err error) {
-	if network == "" && address == "" {
-		network = "unix"
-		address = defaultSock
+func checkAddress(network, address string) (n, a string, err error) {
+	n, a = network, address
+	if n == "" && a == "" {
+		n = "unix"
+		a = defaultSock
 	}
 
-	if network != "unix" && network != "unixpacket" && network != "tcp" && network != "tcp4" && network != "tcp6" {
-		err = fmt.Errorf(unsupportedProtoErr, network)
+	if n != "unix" && n != "unixpacket" && n != "tcp" && n != "tcp4" && n != "tcp6" {
+		err = fmt.Errorf(unsupportedProtoErr, n)
 		return
 	}
 
-	if network == "unix" || network == "unixpacket" {
-		if _, err = os.Stat(address); os.IsNotExist(err) {
-			err = fmt.Errorf(unixSockErr, address)
+	if n == "unix" || n == "unixpacket" {
+		if _, err = os.Stat(a); os.IsNotExist(err) {
+			err = fmt.Errorf(unixSockErr, a)
 			return
 		}
+		err = nil
+		return
+	}
+
+	a, err = checkHostPort(a)
+
+	return
+}
+
+// checkHostPort validates a TCP address, IPv6 literals must be in
+// brackets and may have a zone, such as [fe80::1%eth0]:4020. The
+// %25 encoding of the zone separator used in URLs is accepted.
+func checkHostPort(address string) (a string, err error) {
+	if strings.HasPrefix(address, "[") {
+		address = strings.Replace(address, "%25", "%", 1)
+	}
+
+	host, port, serr := net.SplitHostPort(address)
+	if serr != nil {
+		if ip, _ := splitZone(address); strings.Contains(address, ":") && net.ParseIP(ip) != nil {
+			err = fmt.Errorf(bracketsErr, address, address)
+			return
+		}
+		msg := serr.Error()
+		if ae, ok := serr.(*net.AddrError); ok {
+			msg = ae.Err
+		}
+		err = fmt.Errorf(invalidAddrErr, address, msg)
+		return
+	}
+
+	if port == "" {
+		err = fmt.Errorf(invalidAddrErr, address, "missing port")
+		return
+	}
+
+	if ip, zone := splitZone(host); strings.Contains(host, "%") {
+		if p := net.ParseIP(ip); p == nil || p.To4() != nil || zone == "" {
+			err = fmt.Errorf(zoneErr, address)
+			return
+		}
+	}
+
+	a = net.JoinHostPort(host, port)
+
+	return
+}
+
+// splitZone splits the zone from an IPv6 literal
+func splitZone(host string) (ip, zone string) {
+	ip = host
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		ip, zone = host[:i], host[i+1:]
+	}
+
+	return
+}
+
+// NewClient creates and returns a new instance of Client
+func NewClient(ctx context.Context, network, address string, connTimeOut, ioTimeOut time.Duration, connRetries int) (c *Client, err error) {
+	if network, address, err = checkAddress(network, address); err != nil {
+		return
+	}
+
+	if connTimeOut == 0 {
+		connTimeOut = defaultTimeout
+	}
+
+	if ioTimeOut == 0 {
+		ioTimeOut = defaultCmdTimeout
+	}
+
+	c = &Client{
+		network:     network,
+		address:     address,
+		connTimeout: connTimeOut,
+		cmdTimeout:  ioTimeOut,
+		connRetries: connRetries,
+		clientOptions: clientOptions{
+			connSleep: defaultSleep,
+		},
+	}
+
+	err = c.Dial(ctx)
+
+	return
+}
+
+// NewTLSClient creates and returns a new instance of Client
+// connected using TLS, config is used as is so the ServerName is
+// taken from the address when it is not set
+func NewTLSClient(ctx context.Context, network, address string, config *tls.Config, connTimeOut, ioTimeOut time.Duration, connRetries int) (c *Client, err error) {
+	if network, address, err = checkAddress(network, address); err != nil {
+		return
 	}
 
 	if connTimeOut == 0 {
@@ -541,16 +1174,92 @@ func NewClient(ctx context.Context, network, address string, connTimeOut, ioTime
 		ioTimeOut = defaultCmdTimeout
 	}
 
+	if config == nil {
+		config = &tls.Config{}
+	}
+
 	c = &Client{
 		network:     network,
 		address:     address,
 		connTimeout: connTimeOut,
-		connSleep:   defaultSleep,
 		cmdTimeout:  ioTimeOut,
 		connRetries: connRetries,
+		clientOptions: clientOptions{
+			connSleep: defaultSleep,
+			tlsConfig: config,
+		},
 	}
 
 	err = c.Dial(ctx)
 
 	return
 }
+
+// NewClientFromEnv creates and returns a new instance of Client
+// configured using the SSSP_* environment variables, unset variables
+// use the same defaults as NewClient
+func NewClientFromEnv(ctx context.Context) (c *Client, err error) {
+	var connTimeOut, ioTimeOut time.Duration
+	var connRetries int
+
+	network := os.Getenv(EnvNetwork)
+	address := os.Getenv(EnvAddress)
+	if network == "" && address != "" {
+		network = "tcp"
+		if strings.HasPrefix(address, "/") {
+			network = "unix"
+		}
+	}
+
+	if v := os.Getenv(EnvConnTimeout); v != "" {
+		if connTimeOut, err = time.ParseDuration(v); err != nil {
+			err = fmt.Errorf(envErr, EnvConnTimeout, v)
+			return
+		}
+	}
+
+	if v := os.Getenv(EnvTimeout); v != "" {
+		if ioTimeOut, err = time.ParseDuration(v); err != nil {
+			err = fmt.Errorf(envErr, EnvTimeout, v)
+			return
+		}
+	}
+
+	if v := os.Getenv(EnvConnRetries); v != "" {
+		if connRetries, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf(envErr, EnvConnRetries, v)
+			return
+		}
+	}
+
+	c, err = NewClient(ctx, network, address, connTimeOut, ioTimeOut, connRetries)
+
+	return
+}
+
+// NewClientConn returns a new Client using an existing connection,
+// the greeting and protocol negotiation are performed on conn
+func NewClientConn(conn net.Conn, ioTimeOut time.Duration) (c *Client, err error) {
+	if ioTimeOut == 0 {
+		ioTimeOut = defaultCmdTimeout
+	}
+
+	c = &Client{
+		network:     conn.RemoteAddr().Network(),
+		address:     conn.RemoteAddr().String(),
+		connTimeout: defaultTimeout,
+		cmdTimeout:  ioTimeOut,
+		conn:        conn,
+		connID:      nextConnID(),
+		clientOptions: clientOptions{
+			connSleep: defaultSleep,
+		},
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	err = c.handshake()
+
+	return
+}
@@ -13,14 +13,23 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"go/build"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
 )
 
 const (
@@ -39,6 +48,7 @@ var TestCommands = []CommandTestKey{
 	{ScanDirr, "SCANDIRR"},
 	{ScanData, "SCANDATA"},
 	{Quit, "BYE"},
+	{Query, "QUERY"},
 	{Command(100), ""},
 }
 
@@ -96,6 +106,50 @@ func TestBasics(t *testing.T) {
 	}
 }
 
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err string
+	}{
+		{"127.0.0.1:4020", "127.0.0.1:4020", ""},
+		{"savdi.example.com:4020", "savdi.example.com:4020", ""},
+		{"[::1]:4020", "[::1]:4020", ""},
+		{"[fe80::1%eth0]:4020", "[fe80::1%eth0]:4020", ""},
+		{"[fe80::1%25eth0]:4020", "[fe80::1%eth0]:4020", ""},
+		{"fe80::1%eth0", "", fmt.Sprintf(bracketsErr, "fe80::1%eth0", "fe80::1%eth0")},
+		{"::1:4020", "", fmt.Sprintf(bracketsErr, "::1:4020", "::1:4020")},
+		{"[127.0.0.1%eth0]:4020", "", fmt.Sprintf(zoneErr, "[127.0.0.1%eth0]:4020")},
+		{"[fe80::1%]:4020", "", fmt.Sprintf(zoneErr, "[fe80::1%]:4020")},
+		{"savdi.example.com", "", fmt.Sprintf(invalidAddrErr, "savdi.example.com", "missing port in address")},
+		{"savdi.example.com:", "", fmt.Sprintf(invalidAddrErr, "savdi.example.com:", "missing port")},
+	}
+	for _, tt := range tests {
+		_, a, err := checkAddress("tcp", tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("checkAddress(%q) error = %v, want %s", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("An error should not be returned: %s", err)
+			continue
+		}
+		if a != tt.out {
+			t.Errorf("checkAddress(%q) = %q, want %q", tt.in, a, tt.out)
+		}
+	}
+
+	p, err := NewPool("tcp6", "[fe80::1%25eth0]:4020", time.Second, time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if p.address != "[fe80::1%eth0]:4020" {
+		t.Errorf("p.address = %q, want %q", p.address, "[fe80::1%eth0]:4020")
+	}
+}
+
 func TestSettings(t *testing.T) {
 	var e error
 	var c *Client
@@ -612,3 +666,905 @@ func TestTCPScanReaderString(t *testing.T) {
 		t.Skip("skipping test; $SSSP_TCP_ADDRESS not set")
 	}
 }
+
+func TestMockScanFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sssp")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "eicar.txt")
+	ioutil.WriteFile(fn, []byte(eicarVirus), 0644)
+	cn := filepath.Join(dir, "clean.txt")
+	ioutil.WriteFile(cn, []byte("clean"), 0644)
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	s, e := c.ScanFile(fn)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Filename != fn {
+		t.Errorf("c.ScanFile(%q).Filename = %q, want %q", fn, s.Filename, fn)
+	}
+	if s.ArchiveItem != "" {
+		t.Errorf("c.ScanFile(%q).ArchiveItem = %q, want %q", fn, s.ArchiveItem, "")
+	}
+	if !s.Infected {
+		t.Errorf("c.ScanFile(%q).Infected = %t, want %t", fn, s.Infected, true)
+	}
+	if s.Signature != sssptest.EicarSignature {
+		t.Errorf("c.ScanFile(%q).Signature = %s, want %s", fn, s.Signature, sssptest.EicarSignature)
+	}
+	if s, e = c.ScanFile(cn); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Infected {
+		t.Errorf("c.ScanFile(%q).Infected = %t, want %t", cn, s.Infected, false)
+	}
+	if s.Status != "OK" || s.Code != 0 {
+		t.Errorf("c.ScanFile(%q) status = %s %04X, want OK 0000", cn, s.Status, s.Code)
+	}
+	xn := filepath.Join(dir, "missing.eml")
+	if s, e = c.ScanFile(xn); e == nil {
+		t.Fatalf("An error should be returned")
+	}
+	exp := "0210 Could not open item passed to SAVI for scanning"
+	if e.Error() != exp {
+		t.Errorf("e.Error() = %s, want %s", e, exp)
+	}
+	if s.Status != "FAIL" || s.Code != 0x0210 || s.StatusText != "Could not open item passed to SAVI for scanning" {
+		t.Errorf("c.ScanFile(%q) status = %s %04X %s, want FAIL 0210", xn, s.Status, s.Code, s.StatusText)
+	}
+}
+
+func TestMockScanDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sssp")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn1 := filepath.Join(dir, "eicar.txt")
+	ioutil.WriteFile(fn1, []byte(eicarVirus), 0644)
+	fn2 := filepath.Join(dir, "sub", "eicar.com")
+	os.Mkdir(filepath.Dir(fn2), 0755)
+	ioutil.WriteFile(fn2, []byte(eicarVirus), 0644)
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	s, e := c.ScanDir(dir, false)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if len(s) != 1 || s[0].Filename != fn1 || !s[0].Infected {
+		t.Errorf("c.ScanDir(%q, false) = %v, want 1 infected result", dir, s)
+	}
+	if s, e = c.ScanDir(dir, true); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if len(s) != 2 {
+		t.Errorf("len(c.ScanDir(%q, true)) = %d, want %d", dir, len(s), 2)
+	}
+}
+
+func TestMockScanReader(t *testing.T) {
+	ts := sssptest.NewUnixServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	s, e := c.ScanReader(strings.NewReader(eicarVirus))
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Filename != "stream" {
+		t.Errorf("c.ScanReader().Filename = %q, want %q", s.Filename, "stream")
+	}
+	if !s.Infected {
+		t.Errorf("c.ScanReader().Infected = %t, want %t", s.Infected, true)
+	}
+	if s, e = c.ScanSizedReader(strings.NewReader("clean data"), 10); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Infected {
+		t.Errorf("c.ScanSizedReader().Infected = %t, want %t", s.Infected, false)
+	}
+	reqs := ts.Requests()
+	if len(reqs) != 2 || string(reqs[1].Data) != "clean data" {
+		t.Errorf("Unexpected requests: %v", reqs)
+	}
+}
+
+func TestMockScripted(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		return sssptest.Lines(
+			"VIRUS Troj/Agent-X stream/Zip/payload.exe",
+			"OK 0203 stream",
+			"DONE OK 0203 Virus found during virus scan",
+		)
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	s, e := c.ScanReader(bytes.NewReader([]byte("data")))
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Signature != "Troj/Agent-X" || s.ArchiveItem != "stream/Zip/payload.exe" {
+		t.Errorf("Unexpected response: %+v", s)
+	}
+	if s.Status != "OK" || s.Code != 0x0203 || s.StatusText != "Virus found during virus scan" {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+	if len(s.Detections) != 1 || !s.Detections[0].IsArchiveItem || s.Detections[0].Path != s.ArchiveItem {
+		t.Errorf("Unexpected detections: %+v", s.Detections)
+	}
+
+	fs := sssptest.NewUnstartedServer("tcp", "127.0.0.1:0", nil)
+	fs.Greeting = "FAIL busy"
+	fs.Start()
+	defer fs.Close()
+	if _, e = NewClient(ctx, fs.Network, fs.Addr, 2*time.Second, 5*time.Second, 0); e == nil {
+		t.Errorf("An error should be returned when the greeting fails")
+	}
+}
+
+func TestMockCompletion(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		switch r.Arg {
+		case "/srv/truncated":
+			return sssptest.Lines()
+		case "/srv/other":
+			return sssptest.Lines("OK 0000 /srv/elsewhere")
+		case "/srv/locked":
+			return sssptest.Lines("FAIL 0210 /srv/locked")
+		}
+		return sssptest.Lines("OK 0000 " + r.Arg)
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	s, e := c.ScanFile("/srv/clean")
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Infected || s.ErrorOccured {
+		t.Errorf("Unexpected response: %+v", s)
+	}
+	if _, e = c.ScanFile("/srv/truncated"); !errors.Is(e, ErrNoResult) {
+		t.Errorf("c.ScanFile() error = %v, want %v", e, ErrNoResult)
+	}
+	if _, e = c.ScanFile("/srv/other"); e == nil {
+		t.Errorf("An error should be returned when the item does not match")
+	}
+	if s, e = c.ScanFile("/srv/locked"); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if !s.ErrorOccured {
+		t.Errorf("s.ErrorOccured = %t, want %t", s.ErrorOccured, true)
+	}
+	if s, e = c.ScanReader(strings.NewReader("clean data")); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Infected {
+		t.Errorf("s.Infected = %t, want %t", s.Infected, false)
+	}
+}
+
+func TestMockServerBye(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if r.Arg == "/srv/bye" {
+			return sssptest.Bye()
+		}
+		return sssptest.Clean()
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	if _, e = c.ScanFile("/srv/bye"); !errors.Is(e, ErrServerClosed) {
+		t.Fatalf("c.ScanFile() error = %v, want %v", e, ErrServerClosed)
+	}
+	if _, e = c.ScanFile("/srv/clean"); !errors.Is(e, ErrServerClosed) {
+		t.Errorf("c.ScanFile() error = %v, want %v", e, ErrServerClosed)
+	}
+	if _, e = c.QueryServer(); !errors.Is(e, ErrServerClosed) {
+		t.Errorf("c.QueryServer() error = %v, want %v", e, ErrServerClosed)
+	}
+	if n := len(ts.Requests()); n != 1 {
+		t.Errorf("No requests should be sent once closed, got %d", n)
+	}
+	if e = c.Dial(ctx); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if _, e = c.ScanFile("/srv/clean"); e != nil {
+		t.Errorf("An error should not be returned after reconnecting: %s", e)
+	}
+
+	p, e := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer p.Close()
+	if _, e = p.ScanFile("/srv/bye"); !errors.Is(e, ErrServerClosed) {
+		t.Errorf("p.ScanFile() error = %v, want %v", e, ErrServerClosed)
+	}
+	if _, e = p.ScanFile("/srv/clean"); e != nil {
+		t.Errorf("The pool should reconnect after BYE: %s", e)
+	}
+}
+
+func TestMockReconnect(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	old := c.conn
+	if e = c.Dial(ctx); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	old.SetReadDeadline(time.Now().Add(time.Second))
+	if _, e = old.Read(make([]byte, 1)); !errors.Is(e, net.ErrClosed) {
+		t.Errorf("The replaced connection should be closed: %v", e)
+	}
+	if _, e = c.ScanReader(strings.NewReader("clean")); e != nil {
+		t.Fatalf("An error should not be returned after reconnecting: %s", e)
+	}
+
+	// a failed dial leaves the client unusable until a dial succeeds
+	cur := c.conn
+	ts.Close()
+	if e = c.Dial(ctx); e == nil {
+		t.Fatalf("An error should be returned")
+	}
+	if c.conn != cur {
+		t.Errorf("The connection should not be replaced by a failed dial")
+	}
+	if _, err := c.ScanReader(strings.NewReader("clean")); err == nil || err.Error() != e.Error() {
+		t.Errorf("The dial error should be returned: %v", err)
+	}
+}
+
+func TestMockProtocolDesync(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		switch r.Arg {
+		case "/srv/slow":
+			return &sssptest.Reply{Lines: []string{"VIRUS EICAR-AV-Test /srv/slow", "OK 0203 /srv/slow"}, Delay: 300 * time.Millisecond}
+		case "/srv/after-done":
+			return sssptest.Lines("DONE OK 0000 The function call succeeded", "VIRUS EICAR-AV-Test /srv/after-done")
+		case "/srv/twice":
+			return sssptest.Lines("ACC 0/1", "DONE OK 0000 The function call succeeded")
+		}
+		return sssptest.Clean()
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 100*time.Millisecond, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	if _, e = c.ScanFile("/srv/slow"); e == nil {
+		t.Fatalf("An error should be returned when the scan times out")
+	}
+	time.Sleep(400 * time.Millisecond)
+	if _, e = c.ScanFile("/srv/clean"); !errors.Is(e, ErrProtocolDesync) {
+		t.Fatalf("The stale response should not be attributed to the next scan: %v", e)
+	}
+	if _, e = c.QueryServer(); !errors.Is(e, ErrProtocolDesync) {
+		t.Errorf("c.QueryServer() error = %v, want %v", e, ErrProtocolDesync)
+	}
+
+	for _, p := range []string{"/srv/after-done", "/srv/twice"} {
+		if e = c.Dial(ctx); e != nil {
+			t.Fatalf("An error should not be returned: %s", e)
+		}
+		if _, e = c.ScanFile("/srv/clean"); e != nil {
+			t.Fatalf("An error should not be returned after reconnecting: %s", e)
+		}
+		if _, e = c.ScanFile(p); !errors.Is(e, ErrProtocolDesync) {
+			t.Errorf("c.ScanFile(%q) error = %v, want %v", p, e, ErrProtocolDesync)
+		}
+	}
+}
+
+func TestInSequence(t *testing.T) {
+	tests := []struct {
+		line  string
+		id    uint
+		first bool
+		done  bool
+		ok    bool
+	}{
+		{"ACC 5C8F4D3A/1", 0, true, false, true},
+		{"ACC 5C8F4D3A/2", 0, true, false, false},
+		{"ACC 5C8F4D3A", 3, true, false, true},
+		{"REJ 2 SCANFILE", 0, true, false, true},
+		{"VIRUS EICAR-AV-Test /tmp/eicar.com", 0, true, false, false},
+		{"", 0, true, false, false},
+		{"VIRUS EICAR-AV-Test /tmp/eicar.com", 0, false, false, true},
+		{"ACC 5C8F4D3A/1", 0, false, false, false},
+		{"REJ 2 SCANFILE", 0, false, false, false},
+		{"", 0, false, true, true},
+		{"OK 0203 /tmp/eicar.com", 0, false, true, false},
+	}
+	for _, tt := range tests {
+		if ok := inSequence(tt.line, tt.id, tt.first, tt.done); ok != tt.ok {
+			t.Errorf("inSequence(%q, %d, %t, %t) = %t, want %t", tt.line, tt.id, tt.first, tt.done, ok, tt.ok)
+		}
+	}
+}
+
+func TestMockPipeline(t *testing.T) {
+	var wg sync.WaitGroup
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+	c.SetPipeline(4)
+
+	errs := make([]error, 16)
+	infected := make([]bool, len(errs))
+	for n := range errs {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			data := fmt.Sprintf("clean data %d", n)
+			if n%2 == 1 {
+				data = eicarVirus
+			}
+			r, err := c.ScanReader(strings.NewReader(data))
+			if errs[n] = err; err == nil {
+				infected[n] = r.Infected
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	for n, err := range errs {
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if infected[n] != (n%2 == 1) {
+			t.Errorf("Response %d was attributed to the wrong request", n)
+		}
+	}
+	if reqs := ts.Requests(); len(reqs) != len(errs) {
+		t.Errorf("len(ts.Requests()) = %d, want %d", len(reqs), len(errs))
+	}
+}
+
+func TestMockPipelineFallback(t *testing.T) {
+	var wg sync.WaitGroup
+
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if string(r.Data) == "first" {
+			// a server that does not handle pipelining
+			return &sssptest.Reply{Lines: []string{"ACC 0/9", "DONE OK 0000 The function call succeeded"}, Delay: 200 * time.Millisecond}
+		}
+		return sssptest.Clean()
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+	c.SetPipeline(4)
+
+	if _, e = c.ScanReader(strings.NewReader("clean")); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := c.ScanReader(strings.NewReader("first")); !errors.Is(err, ErrProtocolDesync) {
+			t.Errorf("c.ScanReader() error = %v, want %v", err, ErrProtocolDesync)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	for n := 0; n < 2; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ScanReader(strings.NewReader("second")); !errors.Is(err, ErrProtocolDesync) {
+				t.Errorf("c.ScanReader() error = %v, want %v", err, ErrProtocolDesync)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := cap(c.window); n != 1 {
+		t.Errorf("The client should fall back to serialized requests, window = %d", n)
+	}
+	if e = c.Dial(ctx); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if _, e = c.ScanReader(strings.NewReader("clean")); e != nil {
+		t.Errorf("An error should not be returned after reconnecting: %s", e)
+	}
+}
+
+func TestMockQuery(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	i, e := c.QueryServer()
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if i.Get("version") != "SAV Dynamic Interface 2.6.0" {
+		t.Errorf("i.Get(%q) = %q, want %q", "version", i.Get("version"), "SAV Dynamic Interface 2.6.0")
+	}
+	if len(i["method"]) < 2 {
+		t.Errorf("Repeated keys should be retained: %v", i["method"])
+	}
+	if i, e = c.QuerySAVI(); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if i.Get("virusdatadate") == "" {
+		t.Errorf("i.Get(%q) should not be empty", "virusdatadate")
+	}
+	if i.Get("missing") != "" {
+		t.Errorf("i.Get(%q) should be empty", "missing")
+	}
+}
+
+func TestPool(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	if _, e := NewPool("udp", "127.0.0.1:4020", time.Second, time.Second, 0, 2); e == nil {
+		t.Fatalf("An error should be returned")
+	}
+
+	p, e := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if p.Size() != 2 {
+		t.Errorf("p.Size() = %d, want %d", p.Size(), 2)
+	}
+	if p.connSleep != defaultSleep {
+		t.Errorf("The default pool connSleep should be %v", defaultSleep)
+	}
+	p.SetConnSleep(2 * time.Second)
+	if c, err := p.Get(context.Background()); err != nil || c.connSleep != 2*time.Second {
+		t.Errorf("Calling p.SetConnSleep() failed: %v", err)
+	} else {
+		p.Put(c, nil)
+	}
+
+	// the settings of the pool are passed on to new connections
+	if c, err := p.Get(context.Background()); err == nil {
+		p.Put(c, io.EOF)
+	}
+	p.SetSharedPrefixes("/srv/mail")
+	p.SetPathMap(map[string]string{"/mnt/mail": "/srv/mail"})
+	p.SetKeepAlive(time.Minute)
+	p.SetResolveCache(time.Minute)
+	p.SetDialRetry(TimeoutRetry{Retries: 2})
+	p.SetHooks(&Hooks{})
+	if c, err := p.Get(context.Background()); err != nil || !reflect.DeepEqual(c.clientOptions, p.clientOptions) {
+		t.Errorf("The pool options should be copied: %v", err)
+	} else {
+		p.Put(c, io.EOF)
+	}
+
+	done := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func() {
+			s, err := p.ScanReader(strings.NewReader(eicarVirus))
+			if err == nil && !s.Infected {
+				err = fmt.Errorf("Expected an infected result")
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if e = <-done; e != nil {
+			t.Errorf("An error should not be returned: %s", e)
+		}
+	}
+
+	ts.CloseClientConnections()
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < p.Size(); i++ {
+		if _, e = p.ScanReader(strings.NewReader("clean")); e == nil {
+			break
+		}
+	}
+	if _, e = p.QueryServer(); e != nil {
+		t.Errorf("Broken connections should be discarded: %s", e)
+	}
+
+	p.Close()
+	if _, e = p.ScanReader(strings.NewReader("clean")); !errors.Is(e, ErrPoolClosed) {
+		t.Errorf("Expected %v got %v", ErrPoolClosed, e)
+	}
+}
+
+func TestPoolWarm(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, e := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 3)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer p.Close()
+
+	if e = p.Warm(context.Background(), 2); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if n := len(p.idle); n != 2 {
+		t.Errorf("len(p.idle) = %d, want %d", n, 2)
+	}
+	if e = p.Warm(context.Background(), 5); e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if n := len(p.idle); n != p.Size() {
+		t.Errorf("Warm should be capped at the pool size, got %d idle", n)
+	}
+	if r, err := p.ScanReader(strings.NewReader(eicarVirus)); err != nil || !r.Infected {
+		t.Errorf("Unexpected result %+v %v", r, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c, _ := p.Get(context.Background())
+	if e = p.Warm(ctx, 3); !errors.Is(e, context.Canceled) {
+		t.Errorf("p.Warm() error = %v, want %v", e, context.Canceled)
+	}
+	p.Put(c, nil)
+
+	ts.Close()
+	fp, e := NewPool(ts.Network, ts.Addr, time.Second, time.Second, 0, 2)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer fp.Close()
+	if e = fp.Warm(context.Background(), 2); e == nil {
+		t.Errorf("An error should be returned")
+	}
+	if n := len(fp.idle); n != 0 {
+		t.Errorf("len(fp.idle) = %d, want %d", n, 0)
+	}
+}
+
+type readFromConn struct {
+	net.Conn
+	calls int
+}
+
+func (c *readFromConn) ReadFrom(r io.Reader) (int64, error) {
+	c.calls++
+	return io.Copy(c.Conn, r)
+}
+
+func TestStreamReadFrom(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "eicar.com")
+	if err := ioutil.WriteFile(fn, []byte(eicarVirus), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	conn, err := net.Dial(ts.Network, ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	rc := &readFromConn{Conn: conn}
+	c, err := NewClientConn(rc, 2*time.Second)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	r, err := c.ScanStream(fn)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("Expected an infected result")
+	}
+	if rc.calls != 1 {
+		t.Errorf("Files should be sent using ReadFrom, got %d calls", rc.calls)
+	}
+	if r, err = c.ScanReader(strings.NewReader("clean data")); err != nil || r.Infected {
+		t.Errorf("Unexpected result %+v %v", r, err)
+	}
+	if rc.calls != 2 {
+		t.Errorf("Other readers should be sent using ReadFrom, got %d calls", rc.calls)
+	}
+	reqs := ts.Requests()
+	if len(reqs) != 2 || string(reqs[0].Data) != eicarVirus || string(reqs[1].Data) != "clean data" {
+		t.Errorf("Unexpected requests: %v", reqs)
+	}
+	if _, err = c.ScanSizedReader(strings.NewReader("short"), 10); !errors.Is(err, io.EOF) {
+		t.Errorf("c.ScanSizedReader() error = %v, want %v", err, io.EOF)
+	}
+	if _, err = c.ScanReader(strings.NewReader("clean data")); !errors.Is(err, ErrProtocolDesync) {
+		t.Errorf("A partial upload should break the connection: %v", err)
+	}
+
+	tc, err := net.Dial(ts.Network, ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	bc, err := NewClientConn(struct{ net.Conn }{tc}, 2*time.Second)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer bc.Close()
+	if r, err = bc.ScanStream(fn); err != nil || !r.Infected {
+		t.Errorf("Connections without ReadFrom should be buffered: %+v %v", r, err)
+	}
+}
+
+func TestNewClientConn(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	conn, err := net.Dial(ts.Network, ts.Addr)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c, err := NewClientConn(conn, 2*time.Second)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	r, err := c.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("Expected an infected result")
+	}
+
+	fs := sssptest.NewUnstartedServer("tcp", "127.0.0.1:0", nil)
+	fs.Greeting = "FAIL busy"
+	fs.Start()
+	defer fs.Close()
+	if conn, err = net.Dial(fs.Network, fs.Addr); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if _, err = NewClientConn(conn, time.Second); err == nil {
+		t.Errorf("An error should be returned")
+	}
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+	us := sssptest.NewUnixServer(sssptest.DefaultHandler)
+	defer us.Close()
+
+	t.Setenv(EnvAddress, ts.Addr)
+	t.Setenv(EnvTimeout, "2s")
+	t.Setenv(EnvConnRetries, "1")
+	c, err := NewClientFromEnv(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if c.network != "tcp" || c.address != ts.Addr || c.cmdTimeout != 2*time.Second || c.connRetries != 1 {
+		t.Errorf("Unexpected client settings: %s %s %s %d", c.network, c.address, c.cmdTimeout, c.connRetries)
+	}
+	c.Close()
+
+	t.Setenv(EnvAddress, us.Addr)
+	c, err = NewClientFromEnv(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if c.network != "unix" {
+		t.Errorf("c.network = %s, want %s", c.network, "unix")
+	}
+	c.Close()
+
+	for _, k := range []string{EnvConnTimeout, EnvTimeout, EnvConnRetries} {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv(k, "invalid")
+			if _, err := NewClientFromEnv(context.Background()); err == nil {
+				t.Errorf("An error should be returned")
+			}
+		})
+	}
+}
+
+func TestInfoTime(t *testing.T) {
+	tests := []struct {
+		in  string
+		out time.Time
+		err bool
+	}{
+		{"20210301", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2021-03-01", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"Mon Mar  1 10:00:00 2021", time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC), false},
+		{"garbage", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		i := Info{"virusdatadate": []string{tt.in}}
+		d, err := i.Time("virusdatadate")
+		if tt.err {
+			if err == nil {
+				t.Errorf("Time(%q) should return an error", tt.in)
+			}
+			continue
+		}
+		if err != nil || !d.Equal(tt.out) {
+			t.Errorf("Time(%q) = %s, %v, want %s", tt.in, d, err, tt.out)
+		}
+	}
+}
+
+func TestNewTLSClient(t *testing.T) {
+	ts := sssptest.NewTLSServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	if _, err := NewTLSClient(context.Background(), ts.Network, ts.Addr, nil, time.Second, 2*time.Second, 0); err == nil {
+		t.Fatalf("An error should be returned for an untrusted certificate")
+	}
+
+	c, err := NewTLSClient(context.Background(), ts.Network, ts.Addr, ts.ClientTLSConfig(), time.Second, 2*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	if _, ok := c.conn.(*tls.Conn); !ok {
+		t.Errorf("The connection should use TLS")
+	}
+	r, err := c.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("Expected an infected result")
+	}
+
+	p, err := NewPool(ts.Network, ts.Addr, time.Second, 2*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetTLSConfig(ts.ClientTLSConfig())
+	if r, err = p.ScanReader(strings.NewReader(eicarVirus)); err != nil || !r.Infected {
+		t.Errorf("Unexpected result %+v %v", r, err)
+	}
+}
+
+func TestMockDetections(t *testing.T) {
+	ts := sssptest.NewServer(func(r *sssptest.Request) *sssptest.Reply {
+		if r.Command == "SCANDIRR" {
+			return sssptest.Lines(
+				"VIRUS Troj/Agent-X /srv/a.zip/payload.exe",
+				"VIRUS Mal/Generic-S /srv/a.zip/dropper.js",
+				"OK 0203 /srv/a.zip",
+				"TYPE 06 /srv/eicar.com",
+				"VIRUS EICAR-AV-Test /srv/eicar.com",
+				"OK 0203 /srv/eicar.com",
+				"DONE OK 0203 Virus found during virus scan",
+			)
+		}
+		return sssptest.Lines(
+			"TYPE 1A /srv/a.zip",
+			"TYPE 09 /srv/a.zip/payload.exe",
+			"VIRUS Troj/Agent-X /srv/a.zip/payload.exe",
+			"VIRUS Mal/Generic-S /srv/a.zip/dropper.js",
+			"OK 0203 /srv/a.zip",
+			"DONE OK 0203 Virus found during virus scan",
+		)
+	})
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, e := NewClient(ctx, ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	defer c.Close()
+
+	s, e := c.ScanFile("/srv/a.zip")
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if s.Signature != "Troj/Agent-X" || s.ArchiveItem != "/srv/a.zip/payload.exe" {
+		t.Errorf("Signature and ArchiveItem should be those of the first detection: %+v", s)
+	}
+	if s.FileType != "1A" {
+		t.Errorf("s.FileType = %q, want %q", s.FileType, "1A")
+	}
+	expected := []Detection{
+		{"Troj/Agent-X", "/srv/a.zip/payload.exe", true, "VIRUS Troj/Agent-X /srv/a.zip/payload.exe", "09", CategoryUnknown},
+		{"Mal/Generic-S", "/srv/a.zip/dropper.js", true, "VIRUS Mal/Generic-S /srv/a.zip/dropper.js", "", CategoryUnknown},
+	}
+	if len(s.Detections) != len(expected) {
+		t.Fatalf("len(s.Detections) = %d, want %d", len(s.Detections), len(expected))
+	}
+	for i, d := range expected {
+		if s.Detections[i] != d {
+			t.Errorf("s.Detections[%d] = %+v, want %+v", i, s.Detections[i], d)
+		}
+	}
+
+	rs, e := c.ScanDir("/srv", true)
+	if e != nil {
+		t.Fatalf("An error should not be returned: %s", e)
+	}
+	if len(rs) != 2 || len(rs[0].Detections) != 2 || len(rs[1].Detections) != 1 {
+		t.Fatalf("Unexpected responses: %+v", rs)
+	}
+	if d := rs[1].Detections[0]; d.IsArchiveItem || d.Signature != "EICAR-AV-Test" || d.FileType != "06" {
+		t.Errorf("Unexpected detection: %+v", d)
+	}
+	if rs[0].FileType != "" || rs[1].FileType != "06" {
+		t.Errorf("Unexpected file types %q %q", rs[0].FileType, rs[1].FileType)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package savdi starts SAVDI containers for integration tests
+SSSP - Golang SSSP protocol implementation
+
+The container is managed using the docker command line client, the
+image must run savdid with an SSSP listener on a TCP port. Start waits
+until the server completes the SSSP handshake before returning.
+
+	func TestScan(t *testing.T) {
+		_, c := savdi.Run(t, nil)
+		r, err := c.ScanReader(strings.NewReader("..."))
+		...
+	}
+*/
+package savdi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	// ImageEnv overrides the default image
+	ImageEnv = "SSSP_SAVDI_IMAGE"
+	// DefaultImage is the image used when none is configured
+	DefaultImage          = "baruwa/savdi"
+	defaultTag            = "latest"
+	defaultPort           = 4010
+	defaultStartupTimeout = 2 * time.Minute
+	dockerErr             = "docker %s failed: %s: %s"
+	noPortErr             = "Could not determine the published port: %q"
+	startupErr            = "The server did not become ready within %s: %v"
+)
+
+var (
+	// ErrNoDocker is returned when the docker client is not available
+	ErrNoDocker = errors.New("The docker client is not available")
+)
+
+// Options holds the container configuration
+type Options struct {
+	// Image is the image name, defaults to $SSSP_SAVDI_IMAGE
+	// or DefaultImage
+	Image string
+	// Tag is the image tag, defaults to latest
+	Tag string
+	// Port is the SSSP port inside the container
+	Port int
+	// Env holds additional environment variables
+	Env map[string]string
+	// Args are additional arguments passed to docker run
+	Args []string
+	// StartupTimeout is how long to wait for the server
+	StartupTimeout time.Duration
+	// Docker is the docker client binary
+	Docker string
+}
+
+// A Container represents a running SAVDI container
+type Container struct {
+	ID      string
+	Network string
+	Address string
+	docker  string
+}
+
+// Client returns a new Client connected to the container
+func (c *Container) Client(ctx context.Context) (*sssp.Client, error) {
+	return sssp.NewClient(ctx, c.Network, c.Address, 5*time.Second, time.Minute, 0)
+}
+
+// Terminate stops and removes the container
+func (c *Container) Terminate(ctx context.Context) (err error) {
+	_, err = docker(ctx, c.docker, "rm", "-f", "-v", c.ID)
+
+	return
+}
+
+func (o *Options) withDefaults() (n Options) {
+	if o != nil {
+		n = *o
+	}
+	if n.Image == "" {
+		if n.Image = os.Getenv(ImageEnv); n.Image == "" {
+			n.Image = DefaultImage
+		}
+	}
+	if n.Tag == "" && !strings.Contains(n.Image, ":") {
+		n.Tag = defaultTag
+	}
+	if n.Port <= 0 {
+		n.Port = defaultPort
+	}
+	if n.StartupTimeout <= 0 {
+		n.StartupTimeout = defaultStartupTimeout
+	}
+	if n.Docker == "" {
+		n.Docker = "docker"
+	}
+
+	return
+}
+
+// Start starts a container and waits for the server to be ready
+func Start(ctx context.Context, opts *Options) (c *Container, err error) {
+	var out string
+
+	o := opts.withDefaults()
+	if _, err = exec.LookPath(o.Docker); err != nil {
+		err = ErrNoDocker
+		return
+	}
+
+	image := o.Image
+	if o.Tag != "" {
+		image += ":" + o.Tag
+	}
+
+	args := []string{"run", "-d", "-p", fmt.Sprintf("127.0.0.1::%d", o.Port)}
+	for k, v := range o.Env {
+		args = append(args, "-e", k+"="+v)
+	}
+	args = append(args, o.Args...)
+	args = append(args, image)
+
+	if out, err = docker(ctx, o.Docker, args...); err != nil {
+		return
+	}
+
+	c = &Container{ID: out, Network: "tcp", docker: o.Docker}
+
+	if out, err = docker(ctx, o.Docker, "port", c.ID, fmt.Sprintf("%d/tcp", o.Port)); err != nil {
+		c.Terminate(context.Background())
+		c = nil
+		return
+	}
+
+	if c.Address, err = parsePort(out); err != nil {
+		c.Terminate(context.Background())
+		c = nil
+		return
+	}
+
+	if err = c.wait(ctx, o.StartupTimeout); err != nil {
+		c.Terminate(context.Background())
+		c = nil
+	}
+
+	return
+}
+
+// Run starts a container for the duration of a test, the test is
+// skipped if docker is not available, the container is removed
+// when the test completes
+func Run(t testing.TB, opts *Options) (c *Container, cl *sssp.Client) {
+	var err error
+
+	t.Helper()
+
+	ctx := context.Background()
+	if c, err = Start(ctx, opts); err != nil {
+		if err == ErrNoDocker {
+			t.Skip(err)
+		}
+		t.Fatalf("Failed to start the SAVDI container: %s", err)
+	}
+	t.Cleanup(func() { c.Terminate(context.Background()) })
+
+	if cl, err = c.Client(ctx); err != nil {
+		t.Fatalf("Failed to connect to the SAVDI container: %s", err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	return
+}
+
+func (c *Container) wait(ctx context.Context, timeout time.Duration) (err error) {
+	var cl *sssp.Client
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		if cl, err = sssp.NewClient(ctx, c.Network, c.Address, time.Second, 5*time.Second, 0); err == nil {
+			cl.Close()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf(startupErr, timeout, err)
+			return
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func parsePort(out string) (addr string, err error) {
+	// docker port may list several bindings, use the first
+	line := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	host, port, e := net.SplitHostPort(line)
+	if e != nil || port == "" {
+		err = fmt.Errorf(noPortErr, out)
+		return
+	}
+	if host == "0.0.0.0" || host == "" {
+		host = "127.0.0.1"
+	} else if host == "::" {
+		host = "::1"
+	}
+	addr = net.JoinHostPort(host, port)
+
+	return
+}
+
+func docker(ctx context.Context, bin string, args ...string) (out string, err error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf(dockerErr, args[0], err, strings.TrimSpace(stderr.String()))
+		return
+	}
+	out = strings.TrimSpace(stdout.String())
+
+	return
+}
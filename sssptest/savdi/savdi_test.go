@@ -0,0 +1,158 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package savdi starts SAVDI containers for integration tests
+SSSP - Golang SSSP protocol implementation
+*/
+package savdi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+// fakeDocker writes a docker replacement that publishes addr
+// and logs its arguments
+func fakeDocker(t *testing.T, addr string) (bin, log string) {
+	dir, err := ioutil.TempDir("", "savdi")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	bin = filepath.Join(dir, "docker")
+	log = filepath.Join(dir, "log")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %s
+case "$1" in
+run) echo abc123 ;;
+port) echo %s ;;
+esac
+`, log, addr)
+	if err = ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	return
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"127.0.0.1:49153", "127.0.0.1:49153", false},
+		{"0.0.0.0:49153\n[::]:49153", "127.0.0.1:49153", false},
+		{"[::]:49153", "[::1]:49153", false},
+		{"", "", true},
+		{"garbage", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parsePort(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parsePort(%q) should return an error", tt.in)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parsePort(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	os.Setenv(ImageEnv, "example/savdi:5.80")
+	defer os.Unsetenv(ImageEnv)
+
+	o := (*Options)(nil).withDefaults()
+	if o.Image != "example/savdi:5.80" || o.Tag != "" || o.Port != defaultPort || o.Docker != "docker" {
+		t.Errorf("Unexpected defaults: %+v", o)
+	}
+
+	o = (&Options{Image: "example/savdi", Port: 4020}).withDefaults()
+	if o.Tag != defaultTag || o.Port != 4020 {
+		t.Errorf("Unexpected options: %+v", o)
+	}
+}
+
+func TestStart(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	bin, log := fakeDocker(t, ts.Addr)
+	c, err := Start(context.Background(), &Options{
+		Image:          "example/savdi",
+		Tag:            "5.80",
+		Env:            map[string]string{"SAVDI_THREADS": "4"},
+		Docker:         bin,
+		StartupTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if c.ID != "abc123" || c.Address != ts.Addr {
+		t.Errorf("Unexpected container: %+v", c)
+	}
+
+	cl, err := c.Client(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r, err := cl.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil || !r.Infected {
+		t.Errorf("Unexpected result: %+v %v", r, err)
+	}
+	cl.Close()
+
+	if err = c.Terminate(context.Background()); err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+
+	b, _ := ioutil.ReadFile(log)
+	calls := string(b)
+	for _, want := range []string{
+		"run -d -p 127.0.0.1::4010 -e SAVDI_THREADS=4 example/savdi:5.80",
+		"port abc123 4010/tcp",
+		"rm -f -v abc123",
+	} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("Expected docker to be called with %q:\n%s", want, calls)
+		}
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	addr := ts.Addr
+	ts.Close()
+
+	bin, log := fakeDocker(t, addr)
+	if _, err := Start(context.Background(), &Options{Docker: bin, StartupTimeout: 500 * time.Millisecond}); err == nil {
+		t.Fatalf("An error should be returned")
+	}
+	b, _ := ioutil.ReadFile(log)
+	if !strings.Contains(string(b), "rm -f -v abc123") {
+		t.Errorf("The container should be removed on failure:\n%s", b)
+	}
+
+	if _, err := Start(context.Background(), &Options{Docker: "/nonexistent/docker"}); err != ErrNoDocker {
+		t.Errorf("Expected %v got %v", ErrNoDocker, err)
+	}
+}
@@ -0,0 +1,455 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssptest implements a scriptable SSSP server for testing
+SSSP - Golang SSSP protocol implementation
+
+The server speaks enough of the SSSP protocol to exercise a client,
+the replies to each request are produced by a Handler so greeting,
+ACC, VIRUS, FAIL and DONE sequences as well as delays and dropped
+connections can be scripted.
+*/
+package sssptest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ProtocolVersion is the protocol version spoken by the server
+	ProtocolVersion = "SSSP/1.0"
+	// DefaultGreeting is the greeting sent to new connections
+	DefaultGreeting = "OK SSSP/1.0"
+	// EicarSignature is the signature reported for the EICAR test file
+	EicarSignature = "EICAR-AV-Test"
+	eicarMarker    = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"
+	doneOk         = "DONE OK 0000 The function call succeeded"
+	doneVirus      = "DONE OK 0203 Virus found during virus scan"
+	openFailCode   = "0210"
+	openFailText   = "Could not open item passed to SAVI for scanning"
+)
+
+// A Request represents a command received by the server
+type Request struct {
+	Command string
+	Arg     string
+	Data    []byte
+}
+
+// A Reply represents the response to a request
+type Reply struct {
+	// Lines are the event lines sent between the ACC line
+	// and the terminating blank line
+	Lines []string
+	// Delay is the time to wait before replying
+	Delay time.Duration
+	// Raw sends Lines as is without the ACC and blank lines
+	Raw bool
+	// Close closes the connection after replying
+	Close bool
+}
+
+// A Handler returns the reply to a request, a nil reply is
+// treated as a clean result
+type Handler func(*Request) *Reply
+
+// A Server is an SSSP server listening on a local address
+type Server struct {
+	// Network is the network the server is listening on
+	Network string
+	// Addr is the address the server is listening on
+	Addr string
+	// Greeting is sent to new connections
+	Greeting string
+	// Handler produces the replies to requests
+	Handler Handler
+	// Delay is applied before every reply
+	Delay time.Duration
+	// TLS is the TLS configuration used by StartTLS
+	TLS *tls.Config
+
+	listener    net.Listener
+	certificate *x509.Certificate
+	dir         string
+	m           sync.Mutex
+	wg          sync.WaitGroup
+	conns       map[net.Conn]bool
+	requests    []*Request
+	closed      bool
+}
+
+// Clean returns a reply for a clean item
+func Clean() *Reply {
+	return &Reply{Lines: []string{doneOk}}
+}
+
+// Infected returns a reply for an item infected with sig,
+// item is the path reported in the VIRUS and OK events
+func Infected(sig, item string) *Reply {
+	return &Reply{
+		Lines: []string{
+			fmt.Sprintf("VIRUS %s %s", sig, item),
+			fmt.Sprintf("OK 0203 %s", item),
+			doneVirus,
+		},
+	}
+}
+
+// Fail returns a reply for an item that could not be scanned
+func Fail(code, text, item string) *Reply {
+	return &Reply{
+		Lines: []string{
+			fmt.Sprintf("FAIL %s %s", code, item),
+			fmt.Sprintf("DONE FAIL %s %s", code, text),
+		},
+	}
+}
+
+// Reject returns a reply rejecting the request with REJ, as SAVDI
+// does for the commands its configuration does not allow
+func Reject(code string) *Reply {
+	return &Reply{Lines: []string{fmt.Sprintf("REJ %s", code)}, Raw: true}
+}
+
+// Bye returns a reply that ends the session with BYE as SAVDI
+// does on shutdown or once maxscans is reached
+func Bye() *Reply {
+	return &Reply{Lines: []string{"BYE"}, Raw: true, Close: true}
+}
+
+// Lines returns a reply made up of the given event lines
+func Lines(l ...string) *Reply {
+	return &Reply{Lines: l}
+}
+
+// DefaultHandler scans the files and data it receives for the
+// EICAR test string, SCANFILE and SCANDIR requests refer to the
+// local file system
+func DefaultHandler(r *Request) *Reply {
+	switch r.Command {
+	case "SCANDATA":
+		if bytes.Contains(r.Data, []byte(eicarMarker)) {
+			return Infected(EicarSignature, "")
+		}
+		return Clean()
+	case "SCANFILE":
+		b, err := ioutil.ReadFile(r.Arg)
+		if err != nil {
+			return Fail(openFailCode, openFailText, r.Arg)
+		}
+		if bytes.Contains(b, []byte(eicarMarker)) {
+			return Infected(EicarSignature, r.Arg)
+		}
+		return Clean()
+	case "SCANDIR", "SCANDIRR":
+		return scanDir(r.Arg, r.Command == "SCANDIRR")
+	case "QUERY":
+		return query(r.Arg)
+	}
+
+	return Lines(fmt.Sprintf("DONE FAIL 0201 Unsupported command: %s", r.Command))
+}
+
+func query(item string) *Reply {
+	switch item {
+	case "SERVER":
+		return Lines(
+			"version: SAV Dynamic Interface 2.6.0",
+			"method: QUERY SERVER",
+			"method: QUERY SAVI",
+			"method: QUERY ENGINE",
+			"method: SCANDATA",
+			"method: SCANFILE",
+			"method: SCANDIR",
+			"method: SCANDIRR",
+			"maxscandata: 0",
+			"maxmemorysize: 250000",
+			"maxclassificationsize: 4096",
+		)
+	case "SAVI":
+		return Lines(
+			"version: 5.80",
+			"versionex: 5.80.0",
+			"virusengine: 3.80.1",
+			"virusdataname: vdl.dat",
+			"virusdatadate: "+time.Now().UTC().Format("20060102"),
+			"virusdatachecksum: 00000000",
+			"virusdatanumber: 0",
+		)
+	case "ENGINE":
+		return Lines(
+			"GrpArchiveUnpack: 1",
+			"GrpInternet: 1",
+			"GrpSuper: 1",
+			"MaxRecursionDepth: 16",
+		)
+	}
+
+	return &Reply{Lines: []string{fmt.Sprintf("REJ 2 %s", item)}, Raw: true}
+}
+
+func scanDir(dir string, recurse bool) *Reply {
+	var lines []string
+
+	failed := false
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("FAIL %s %s", openFailCode, p))
+			failed = true
+			return nil
+		}
+		if info.IsDir() {
+			if p != dir && !recurse {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("FAIL %s %s", openFailCode, p))
+			failed = true
+			return nil
+		}
+		if bytes.Contains(b, []byte(eicarMarker)) {
+			lines = append(lines, fmt.Sprintf("VIRUS %s %s", EicarSignature, p), fmt.Sprintf("OK 0203 %s", p))
+		}
+		return nil
+	})
+
+	if failed {
+		lines = append(lines, fmt.Sprintf("DONE FAIL %s %s", openFailCode, openFailText))
+	} else {
+		lines = append(lines, doneOk)
+	}
+
+	return Lines(lines...)
+}
+
+// Requests returns the requests received by the server
+func (s *Server) Requests() []*Request {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := make([]*Request, len(s.requests))
+	copy(r, s.requests)
+
+	return r
+}
+
+// CloseClientConnections closes all the open client connections
+func (s *Server) CloseClientConnections() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close shuts down the server and waits for all connections
+// to be closed
+func (s *Server) Close() {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return
+	}
+	s.closed = true
+	s.listener.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.m.Unlock()
+
+	s.wg.Wait()
+
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// Start starts a server created with NewUnstartedServer
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go s.serve()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.m.Lock()
+		if s.closed {
+			s.m.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.m.Unlock()
+
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	var line string
+	var err error
+
+	defer func() {
+		c.Close()
+		s.m.Lock()
+		delete(s.conns, c)
+		s.m.Unlock()
+		s.wg.Done()
+	}()
+
+	br := bufio.NewReader(c)
+	tr := textproto.NewReader(br)
+	w := textproto.NewWriter(bufio.NewWriter(c))
+
+	if err = w.PrintfLine("%s", s.Greeting); err != nil {
+		return
+	}
+
+	if line, err = tr.ReadLine(); err != nil {
+		return
+	}
+
+	if line != ProtocolVersion {
+		w.PrintfLine("REJ %s", line)
+		return
+	}
+
+	session := fmt.Sprintf("%08X", time.Now().UnixNano()&0xFFFFFFFF)
+	if err = w.PrintfLine("ACC %s", session); err != nil {
+		return
+	}
+
+	for n := 1; ; n++ {
+		if line, err = tr.ReadLine(); err != nil {
+			return
+		}
+
+		req := &Request{Command: line}
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			req.Command, req.Arg = line[:i], line[i+1:]
+		}
+
+		if req.Command == "BYE" {
+			w.PrintfLine("BYE")
+			return
+		}
+
+		if req.Command == "SCANDATA" {
+			var size int64
+			if size, err = strconv.ParseInt(req.Arg, 10, 64); err != nil || size < 0 {
+				w.PrintfLine("REJ %s", line)
+				return
+			}
+			req.Data = make([]byte, size)
+			if _, err = io.ReadFull(br, req.Data); err != nil {
+				return
+			}
+		}
+
+		s.m.Lock()
+		s.requests = append(s.requests, req)
+		h := s.Handler
+		s.m.Unlock()
+
+		var rep *Reply
+		if h != nil {
+			rep = h(req)
+		}
+		if rep == nil {
+			rep = Clean()
+		}
+
+		time.Sleep(s.Delay + rep.Delay)
+
+		if !rep.Raw {
+			if err = w.PrintfLine("ACC %s/%d", session, n); err != nil {
+				return
+			}
+		}
+		for _, l := range rep.Lines {
+			if err = w.PrintfLine("%s", l); err != nil {
+				return
+			}
+		}
+		if !rep.Raw {
+			if err = w.PrintfLine(""); err != nil {
+				return
+			}
+		}
+
+		if rep.Close {
+			return
+		}
+	}
+}
+
+// NewUnstartedServer returns a new Server listening on network
+// and address that has not been started
+func NewUnstartedServer(network, address string, h Handler) *Server {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		panic(fmt.Sprintf("sssptest: failed to listen on %s %s: %v", network, address, err))
+	}
+
+	return &Server{
+		Network:  network,
+		Addr:     l.Addr().String(),
+		Greeting: DefaultGreeting,
+		Handler:  h,
+		listener: l,
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// NewServer starts and returns a new Server listening on a
+// TCP loopback address
+func NewServer(h Handler) (s *Server) {
+	s = NewUnstartedServer("tcp", "127.0.0.1:0", h)
+	s.Start()
+
+	return
+}
+
+// NewUnixServer starts and returns a new Server listening on
+// a unix socket in a temporary directory
+func NewUnixServer(h Handler) (s *Server) {
+	dir, err := ioutil.TempDir("", "sssptest")
+	if err != nil {
+		panic(fmt.Sprintf("sssptest: failed to create temp dir: %v", err))
+	}
+
+	s = NewUnstartedServer("unix", filepath.Join(dir, "sssp.sock"), h)
+	s.dir = dir
+	s.Start()
+
+	return
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssptest implements a scriptable SSSP server for testing
+SSSP - Golang SSSP protocol implementation
+*/
+package sssptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// StartTLS starts a server created with NewUnstartedServer using
+// TLS, a self signed certificate for the loopback addresses is
+// generated when TLS holds no certificate
+func (s *Server) StartTLS() {
+	if s.TLS == nil {
+		s.TLS = &tls.Config{}
+	}
+	if len(s.TLS.Certificates) == 0 {
+		s.TLS.Certificates = []tls.Certificate{selfSigned()}
+	}
+
+	cert, err := x509.ParseCertificate(s.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		panic(fmt.Sprintf("sssptest: failed to parse certificate: %v", err))
+	}
+	s.certificate = cert
+	s.listener = tls.NewListener(s.listener, s.TLS)
+	s.Start()
+}
+
+// Certificate returns the certificate used by a TLS server or nil
+func (s *Server) Certificate() *x509.Certificate {
+	return s.certificate
+}
+
+// ClientTLSConfig returns a client TLS configuration that trusts
+// the certificate of the server
+func (s *Server) ClientTLSConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	if s.certificate != nil {
+		pool.AddCert(s.certificate)
+	}
+
+	return &tls.Config{RootCAs: pool}
+}
+
+// NewTLSServer starts and returns a new Server using TLS
+// listening on a TCP loopback address
+func NewTLSServer(h Handler) (s *Server) {
+	s = NewUnstartedServer("tcp", "127.0.0.1:0", h)
+	s.StartTLS()
+
+	return
+}
+
+func selfSigned() tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("sssptest: failed to generate key: %v", err))
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"sssptest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("sssptest: failed to create certificate: %v", err))
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	defaultStaleProbe = 1 * time.Second
+	// staleProbeTimeout is how long a probe waits for the connection
+	// to report that it was closed
+	staleProbeTimeout = 1 * time.Millisecond
+)
+
+// SetStaleProbe sets how long a connection stays idle in the pool
+// before it is probed when reused, connections closed by the server,
+// on shutdown or after its idle timeout, are then replaced before the
+// scan is sent. A duration of 0 probes every reused connection and a
+// negative one disables the probe. The default is one second.
+func (p *Pool) SetStaleProbe(d time.Duration) {
+	p.m.Lock()
+	p.staleProbe = d
+	p.m.Unlock()
+}
+
+// SetConnMaxLifetime sets the maximum time a connection is used
+// for, older connections are closed when they are returned to the
+// pool or taken from it and a new one is established on next use.
+// This keeps connections from outliving SAVDI restarts and the flow
+// timeouts of firewalls that drop long-lived connections silently.
+// A duration of 0, the default, does not limit the lifetime.
+func (p *Pool) SetConnMaxLifetime(d time.Duration) {
+	if d >= 0 {
+		p.m.Lock()
+		p.maxLifetime = d
+		p.m.Unlock()
+	}
+}
+
+// expired returns why an idle connection must not be reused and
+// the error that made it unusable, reason is empty when it can be
+// reused. The connection is only probed when probe is set.
+func (p *Pool) expired(c *Client, probe bool) (reason string, cause error) {
+	p.m.Lock()
+	after, lifetime := p.staleProbe, p.maxLifetime
+	p.m.Unlock()
+
+	switch {
+	case lifetime > 0 && time.Since(c.connectedAt) >= lifetime:
+		reason = "closing connection past its max lifetime"
+	case probe && after >= 0 && time.Since(c.idleSince) >= after && c.stale():
+		reason, cause = "discarding stale connection", ErrServerClosed
+	}
+
+	return
+}
+
+// stale reports whether the idle connection has been closed by the
+// server, it attempts a read that returns at once on a closed
+// connection and times out on a live one. Any data received while
+// the connection was idle, such as a BYE line, also makes it stale.
+func (c *Client) stale() bool {
+	var b [1]byte
+	var ne net.Error
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed || c.broken != nil || c.conn == nil {
+		return true
+	}
+	if c.tc.R.Buffered() > 0 {
+		return true
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(staleProbeTimeout))
+	_, err := c.conn.Read(b[:])
+	c.conn.SetReadDeadline(ZeroTime)
+
+	return !errors.As(err, &ne) || !ne.Timeout()
+}
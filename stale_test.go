@@ -0,0 +1,109 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func TestStaleProbe(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	// idle drops the server side of the pooled connection
+	idle := func() {
+		if err := p.Warm(context.Background(), 1); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		ts.CloseClientConnections()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	p.SetStaleProbe(-1)
+	idle()
+	if _, err = p.ScanReader(strings.NewReader("clean")); err == nil {
+		t.Fatalf("An error should be returned when the probe is disabled")
+	}
+
+	p.SetStaleProbe(0)
+	idle()
+	r, err := p.ScanReader(strings.NewReader(eicarVirus))
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !r.Infected {
+		t.Errorf("The scan should be sent on a new connection: %+v", r)
+	}
+
+	// live connections are reused
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	id := c.connID
+	p.Put(c, nil)
+	if c, err = p.Get(context.Background()); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if c.connID != id {
+		t.Errorf("A live connection should be reused: %d != %d", c.connID, id)
+	}
+	p.Put(c, nil)
+}
+
+func TestConnMaxLifetime(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	get := func() (id uint64) {
+		c, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		id = c.connID
+		p.Put(c, nil)
+		return
+	}
+
+	first := get()
+	if id := get(); id != first {
+		t.Errorf("The connection should be reused without a lifetime: %d != %d", id, first)
+	}
+
+	p.SetConnMaxLifetime(50 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	second := get()
+	if second == first {
+		t.Errorf("A connection past its lifetime should be replaced")
+	}
+	if id := get(); id != second {
+		t.Errorf("A connection within its lifetime should be reused: %d != %d", id, second)
+	}
+	if _, err = p.ScanReader(strings.NewReader(eicarVirus)); err != nil {
+		t.Errorf("An error should not be returned: %s", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package store implements persistent storage of scan results
+SSSP - Golang SSSP protocol implementation
+*/
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	recordsBucket = []byte("records")
+	hashBucket    = []byte("hash")
+	pathBucket    = []byte("path")
+	historyBucket = []byte("history")
+	openTimeout   = 5 * time.Second
+)
+
+// A BoltStore is a Store backed by a BoltDB database
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var _ Store = (*BoltStore)(nil)
+
+// Put records a scan
+func (b *BoltStore) Put(r *Record) (err error) {
+	err = b.db.Update(func(tx *bolt.Tx) (err error) {
+		var v []byte
+		var seq uint64
+		var hb *bolt.Bucket
+
+		rb := tx.Bucket(recordsBucket)
+		if seq, err = rb.NextSequence(); err != nil {
+			return
+		}
+		if v, err = json.Marshal(r); err != nil {
+			return
+		}
+
+		k := itob(seq)
+		if err = rb.Put(k, v); err != nil {
+			return
+		}
+
+		if r.SHA256 != "" {
+			if err = tx.Bucket(hashBucket).Put([]byte(r.SHA256), k); err != nil {
+				return
+			}
+			if hb, err = tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(r.SHA256)); err != nil {
+				return
+			}
+			if err = hb.Put(k, nil); err != nil {
+				return
+			}
+		}
+
+		if r.Path != "" {
+			err = tx.Bucket(pathBucket).Put([]byte(r.Path), k)
+		}
+
+		return
+	})
+
+	return
+}
+
+// LastByHash returns the most recent scan of the data with
+// the given SHA256 hash
+func (b *BoltStore) LastByHash(sum string) (r *Record, err error) {
+	r, err = b.lookup(hashBucket, sum)
+
+	return
+}
+
+// LastByPath returns the most recent scan of the given path
+func (b *BoltStore) LastByPath(p string) (r *Record, err error) {
+	r, err = b.lookup(pathBucket, p)
+
+	return
+}
+
+// History returns all the scans of the data with the given
+// SHA256 hash, oldest first
+func (b *BoltStore) History(sum string) (r []*Record, err error) {
+	err = b.db.View(func(tx *bolt.Tx) (err error) {
+		hb := tx.Bucket(historyBucket).Bucket([]byte(sum))
+		if hb == nil {
+			err = ErrNotFound
+			return
+		}
+
+		rb := tx.Bucket(recordsBucket)
+		err = hb.ForEach(func(k, _ []byte) (err error) {
+			rc := &Record{}
+			if err = json.Unmarshal(rb.Get(k), rc); err != nil {
+				return
+			}
+			r = append(r, rc)
+			return
+		})
+
+		return
+	})
+
+	return
+}
+
+// Close closes the database
+func (b *BoltStore) Close() (err error) {
+	err = b.db.Close()
+
+	return
+}
+
+func (b *BoltStore) lookup(bucket []byte, key string) (r *Record, err error) {
+	err = b.db.View(func(tx *bolt.Tx) (err error) {
+		k := tx.Bucket(bucket).Get([]byte(key))
+		if k == nil {
+			err = ErrNotFound
+			return
+		}
+
+		r = &Record{}
+		err = json.Unmarshal(tx.Bucket(recordsBucket).Get(k), r)
+
+		return
+	})
+
+	return
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// OpenBolt opens or creates the BoltDB database at p and returns
+// a Store that uses it
+func OpenBolt(p string) (b *BoltStore, err error) {
+	var db *bolt.DB
+
+	if db, err = bolt.Open(p, 0600, &bolt.Options{Timeout: openTimeout}); err != nil {
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) (err error) {
+		for _, n := range [][]byte{recordsBucket, hashBucket, pathBucket, historyBucket} {
+			if _, err = tx.CreateBucketIfNotExists(n); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		db.Close()
+		return
+	}
+
+	b = &BoltStore{db: db}
+
+	return
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package store implements persistent storage of scan results
+SSSP - Golang SSSP protocol implementation
+*/
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	eicarHash = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+)
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "results.db")
+	s, err := OpenBolt(p)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	if _, err = s.LastByHash(eicarHash); err != ErrNotFound {
+		t.Errorf("Expected %v got %v", ErrNotFound, err)
+	}
+
+	r := &sssp.Response{Filename: "/tmp/eicar.txt", Infected: true, Signature: "EICAR-AV-Test"}
+	if err = s.Put(NewRecord(r, eicarHash, "5.80", time.Millisecond)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	r = &sssp.Response{Filename: "/tmp/copy.txt", Infected: true, Signature: "EICAR-AV-Test"}
+	if err = s.Put(NewRecord(r, eicarHash, "5.81", time.Millisecond)); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	s.Close()
+
+	if s, err = OpenBolt(p); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer s.Close()
+
+	rc, err := s.LastByHash(eicarHash)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if rc.Path != "/tmp/copy.txt" || rc.EngineVersion != "5.81" {
+		t.Errorf("Unexpected record: %+v", rc)
+	}
+	if rc, err = s.LastByPath("/tmp/eicar.txt"); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if !rc.Infected || rc.Signature != "EICAR-AV-Test" || rc.EngineVersion != "5.80" {
+		t.Errorf("Unexpected record: %+v", rc)
+	}
+	h, err := s.History(eicarHash)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(h) != 2 || h[0].EngineVersion != "5.80" || h[1].EngineVersion != "5.81" {
+		t.Errorf("Unexpected history: %+v", h)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package store implements persistent storage of scan results
+SSSP - Golang SSSP protocol implementation
+
+Every scan can be recorded along with the hash of the scanned
+data and the engine version used, allowing applications to find
+out when an item was last scanned and by which definitions.
+*/
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+var (
+	// ErrNotFound is returned when no record matches a lookup
+	ErrNotFound = errors.New("Record not found")
+)
+
+// A Record represents a single recorded scan
+type Record struct {
+	SHA256        string        `json:"sha256"`
+	Path          string        `json:"path"`
+	ArchiveItem   string        `json:"archive_item,omitempty"`
+	Infected      bool          `json:"infected"`
+	Signature     string        `json:"signature,omitempty"`
+	ErrorOccured  bool          `json:"error_occured"`
+	EngineVersion string        `json:"engine_version,omitempty"`
+	Duration      time.Duration `json:"duration"`
+	ScannedAt     time.Time     `json:"scanned_at"`
+}
+
+// Store is the interface implemented by result stores
+type Store interface {
+	// Put records a scan
+	Put(*Record) error
+	// LastByHash returns the most recent scan of the data with
+	// the given SHA256 hash
+	LastByHash(string) (*Record, error)
+	// LastByPath returns the most recent scan of the given path
+	LastByPath(string) (*Record, error)
+	// History returns all the scans of the data with the given
+	// SHA256 hash, oldest first
+	History(string) ([]*Record, error)
+	// Close closes the store
+	Close() error
+}
+
+// NewRecord creates a Record from a scan response
+func NewRecord(r *sssp.Response, sum, engine string, d time.Duration) (rc *Record) {
+	rc = &Record{
+		SHA256:        sum,
+		Path:          r.Filename,
+		ArchiveItem:   r.ArchiveItem,
+		Infected:      r.Infected,
+		Signature:     r.Signature,
+		ErrorOccured:  r.ErrorOccured,
+		EngineVersion: engine,
+		Duration:      d,
+		ScannedAt:     time.Now().UTC(),
+	}
+
+	return
+}
@@ -0,0 +1,519 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+)
+
+const (
+	notDirErr   = "Not a directory: %s"
+	linkLoopErr = "Symbolic link %s loops to %s"
+	linkSeenErr = "Symbolic link %s points to %s which was already walked"
+)
+
+var (
+	// ErrWalkLimit is returned with the responses of the files
+	// scanned so far when a client side walk reaches a limit set by
+	// SetWalkLimits
+	ErrWalkLimit = errors.New("The walk limit was reached")
+
+	errWalkStopped = errors.New("walk stopped")
+)
+
+// WalkLimits bounds the client side walks of ScanLocalDir and of the
+// ScanDir fallback, zero fields are unlimited. Reaching MaxFiles or
+// MaxBytes stops the walk while the directories deeper than MaxDepth
+// levels below the root are skipped, in both cases the responses of
+// the files scanned are returned with ErrWalkLimit.
+type WalkLimits struct {
+	// MaxDepth is the number of directory levels below the root
+	// that are walked
+	MaxDepth int
+	// MaxFiles is the number of files scanned
+	MaxFiles int
+	// MaxBytes is the total size of the files scanned
+	MaxBytes int64
+}
+
+// WalkOptions customise the client side walks of ScanLocalDir and of
+// the ScanDir fallback
+type WalkOptions struct {
+	// Exclude and ExcludeDirs hold glob patterns of the files and the
+	// directories below the root that are not walked, patterns
+	// without a separator are matched against the base name and the
+	// others against the whole path
+	Exclude     []string
+	ExcludeDirs []string
+	// FollowSymlinks walks the directories and scans the files that
+	// symbolic links point to, links that would loop or that point
+	// to a directory already walked are reported with a *LinkError
+	FollowSymlinks bool
+	// Scan replaces the request sent for each file, for callers that
+	// skip files, cache results or unpack archives themselves
+	Scan func(path string) (*Response, error)
+	// OnFile is called with the outcome of each file as it completes,
+	// clean files included, the calls are serialized. An error
+	// stops the walk and is returned.
+	OnFile func(path string, r *Response, err error) error
+}
+
+// A LinkError is reported for a symbolic link that a walk does not
+// follow
+type LinkError struct {
+	Path string
+	// Target is the real path of the directory the link points to
+	Target string
+	// Loop is set when Target contains the link, otherwise Target
+	// was already walked
+	Loop bool
+}
+
+func (e *LinkError) Error() string {
+	if e.Loop {
+		return fmt.Sprintf(linkLoopErr, e.Path, e.Target)
+	}
+
+	return fmt.Sprintf(linkSeenErr, e.Path, e.Target)
+}
+
+type walkJob struct {
+	n int
+	p string
+	// err is set for entries that could not be read
+	err error
+}
+
+type walkResult struct {
+	n int
+	r *Response
+}
+
+// ScanLocalDir walks the local directory p and submits each regular
+// file via a stream, requests are pipelined up to the window set by
+// SetPipeline. Like ScanDir only the infected files and those that
+// could not be scanned are returned.
+func (c *Client) ScanLocalDir(p string, recurse bool) (r []*Response, err error) {
+	l, o := c.walkOpts()
+	r, err = scanLocalDir(p, recurse, c.walkers(), l, o, c.ScanStream)
+
+	return
+}
+
+// SetWalkLimits sets the limits of the client side walks
+func (c *Client) SetWalkLimits(l WalkLimits) {
+	c.m.Lock()
+	c.walkLimits = l
+	c.m.Unlock()
+}
+
+// SetWalkLimits sets the limits of the client side walks of the pool
+// and of the connections established after the call
+func (p *Pool) SetWalkLimits(l WalkLimits) {
+	p.m.Lock()
+	p.walkLimits = l
+	p.m.Unlock()
+}
+
+// SetWalkOptions sets the options of the client side walks
+func (c *Client) SetWalkOptions(o WalkOptions) {
+	c.m.Lock()
+	c.walkOptions = o
+	c.m.Unlock()
+}
+
+// SetWalkOptions sets the options of the client side walks of the
+// pool and of the connections established after the call
+func (p *Pool) SetWalkOptions(o WalkOptions) {
+	p.m.Lock()
+	p.walkOptions = o
+	p.m.Unlock()
+}
+
+// SetDirFallback sets whether ScanDir walks the directory itself when
+// the server rejects SCANDIR and SCANDIRR, as SAVDI does when its
+// configuration does not allow them. Each file is then submitted
+// using ScanPath and the responses have Fallback set, the rejected
+// request is still reported to the hooks and metrics.
+func (c *Client) SetDirFallback(enable bool) {
+	c.m.Lock()
+	c.dirFallback = enable
+	c.m.Unlock()
+}
+
+// SetDirFallback sets whether connections established after the call
+// walk the directories the server refuses to scan, see
+// Client.SetDirFallback
+func (p *Pool) SetDirFallback(enable bool) {
+	p.m.Lock()
+	p.dirFallback = enable
+	p.m.Unlock()
+}
+
+// fallback reports whether the directory scan that failed with err
+// should be walked by the client
+func (c *Client) fallback(err error) bool {
+	var re *protocol.RejectError
+
+	c.m.Lock()
+	enabled := c.dirFallback
+	c.m.Unlock()
+
+	return enabled && errors.As(err, &re)
+}
+
+// walkDir scans the files of the local directory p using ScanPath
+func (c *Client) walkDir(ctx context.Context, p string, recurse bool) (r []*Response, err error) {
+	l, o := c.walkOpts()
+	r, err = scanLocalDir(p, recurse, c.walkers(), l, o, func(f string) (*Response, error) {
+		return c.ScanPathContext(ctx, f)
+	})
+	for _, rs := range r {
+		rs.Fallback = true
+	}
+
+	return
+}
+
+func (c *Client) walkOpts() (l WalkLimits, o WalkOptions) {
+	c.m.Lock()
+	l, o = c.walkLimits, c.walkOptions
+	c.m.Unlock()
+
+	return
+}
+
+// walkers returns the number of files scanned concurrently by a
+// walk, the pipeline window
+func (c *Client) walkers() (n int) {
+	c.m.Lock()
+	n = 1
+	if c.window != nil {
+		n = cap(c.window)
+	}
+	c.m.Unlock()
+
+	return
+}
+
+// ScanLocalDir walks the local directory p and submits each regular
+// file via a stream, the files are split across up to the number of
+// connections set by SetDirParallelism. Like ScanDir only the
+// infected files and those that could not be scanned are returned.
+func (p *Pool) ScanLocalDir(d string, recurse bool) (r []*Response, err error) {
+	p.m.Lock()
+	n, limits, opts := p.dirParallelism, p.walkLimits, p.walkOptions
+	p.m.Unlock()
+	if n <= 0 {
+		n = p.size
+	}
+
+	r, err = scanLocalDir(d, recurse, n, limits, opts, p.ScanStream)
+
+	return
+}
+
+// scanLocalDir walks root and scans its regular files using scan from
+// n goroutines, the responses are returned in walk order. Temporary
+// errors, a closed pool and errors returned by opts.OnFile stop the
+// walk, other errors are reported as responses with ErrorOccured set.
+// The walk is bounded by limits.
+func scanLocalDir(root string, recurse bool, n int, limits WalkLimits, opts WalkOptions, scan func(string) (*Response, error)) (r []*Response, err error) {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var fm sync.Mutex
+	var fatal error
+	var info os.FileInfo
+
+	if info, err = os.Stat(root); err != nil {
+		return
+	}
+	if !info.IsDir() {
+		err = fmt.Errorf(notDirErr, root)
+		return
+	}
+
+	if n < 1 {
+		n = 1
+	}
+	if opts.Scan != nil {
+		scan = opts.Scan
+	}
+
+	jobs := make(chan walkJob)
+	results := make(chan walkResult)
+	stop := make(chan struct{})
+	halt := func(e error) {
+		once.Do(func() {
+			fatal = e
+			close(stop)
+		})
+	}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var rs *Response
+				serr := j.err
+				if serr == nil {
+					rs, serr = scan(j.p)
+					if serr != nil && (errors.Is(serr, ErrTemporary) || errors.Is(serr, ErrPoolClosed)) {
+						halt(serr)
+						continue
+					}
+				}
+				if opts.OnFile != nil {
+					fm.Lock()
+					ferr := opts.OnFile(j.p, rs, serr)
+					fm.Unlock()
+					if ferr != nil {
+						halt(ferr)
+						continue
+					}
+				}
+				if rs = localResult(j.p, rs, serr); rs != nil {
+					results <- walkResult{j.n, rs}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	w := &walker{
+		root:    root,
+		recurse: recurse,
+		limits:  limits,
+		opts:    opts,
+		jobs:    jobs,
+		stop:    stop,
+	}
+	if opts.FollowSymlinks {
+		w.seen = make(map[string]bool)
+		if real, rerr := filepath.EvalSymlinks(root); rerr == nil {
+			w.seen[real] = true
+		}
+	}
+
+	var werr error
+	go func() {
+		defer close(jobs)
+		werr = w.walk(root, 0)
+	}()
+
+	byIndex := make(map[int]*Response)
+	for res := range results {
+		byIndex[res.n] = res.r
+	}
+
+	if fatal != nil {
+		err = fatal
+		return
+	}
+	if werr != nil && werr != errWalkStopped {
+		err = werr
+		return
+	}
+
+	for i := 0; len(byIndex) > 0; i++ {
+		if rs, ok := byIndex[i]; ok {
+			r = append(r, rs)
+			delete(byIndex, i)
+		}
+	}
+
+	if w.limited {
+		err = ErrWalkLimit
+	}
+
+	return
+}
+
+// A walker queues the files of a client side walk
+type walker struct {
+	root    string
+	recurse bool
+	limits  WalkLimits
+	opts    WalkOptions
+	jobs    chan<- walkJob
+	stop    <-chan struct{}
+	// seen holds the real paths of the directories walked when
+	// symbolic links are followed
+	seen    map[string]bool
+	count   int
+	files   int
+	size    int64
+	limited bool
+}
+
+// walk walks dir which is depth levels below the root
+func (w *walker) walk(dir string, depth int) error {
+	return filepath.Walk(dir, func(fp string, fi os.FileInfo, ferr error) error {
+		if ferr != nil {
+			if fp == w.root {
+				return ferr
+			}
+			// unreadable entries are reported like files that
+			// could not be scanned
+			return w.send(fp, ferr)
+		}
+		if fi.IsDir() {
+			if fp == dir {
+				return nil
+			}
+			if !w.recurse || matchAny(w.opts.ExcludeDirs, fp) {
+				return filepath.SkipDir
+			}
+			if w.tooDeep(depth + walkDepth(dir, fp)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if w.opts.FollowSymlinks && fi.Mode()&os.ModeSymlink != 0 {
+			return w.link(fp, depth+walkDepth(dir, fp))
+		}
+
+		return w.file(fp, fi)
+	})
+}
+
+// link walks the directory or queues the file the symbolic link p
+// points to, directories containing the link and directories that
+// were already walked are reported with a *LinkError
+func (w *walker) link(p string, depth int) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return w.send(p, err)
+	}
+	if !fi.IsDir() {
+		return w.file(p, fi)
+	}
+	if !w.recurse || matchAny(w.opts.ExcludeDirs, p) || w.tooDeep(depth) {
+		return nil
+	}
+
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return w.send(p, err)
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(p))
+	if err != nil {
+		return w.send(p, err)
+	}
+	switch {
+	case parent == real || strings.HasPrefix(parent, real+string(filepath.Separator)):
+		return w.send(p, &LinkError{Path: p, Target: real, Loop: true})
+	case w.seen[real]:
+		return w.send(p, &LinkError{Path: p, Target: real})
+	}
+	w.seen[real] = true
+
+	// the trailing separator makes Walk descend into the link
+	return w.walk(p+string(filepath.Separator), depth)
+}
+
+// file queues the regular file p unless it is excluded, a limit
+// reached stops the walk
+func (w *walker) file(p string, fi os.FileInfo) error {
+	if !fi.Mode().IsRegular() || matchAny(w.opts.Exclude, p) {
+		return nil
+	}
+	if (w.limits.MaxFiles > 0 && w.files >= w.limits.MaxFiles) ||
+		(w.limits.MaxBytes > 0 && w.size+fi.Size() > w.limits.MaxBytes) {
+		w.limited = true
+		return errWalkStopped
+	}
+	w.files++
+	w.size += fi.Size()
+
+	return w.send(p, nil)
+}
+
+// tooDeep reports whether a directory depth levels below the root is
+// beyond MaxDepth
+func (w *walker) tooDeep(depth int) bool {
+	if w.limits.MaxDepth > 0 && depth > w.limits.MaxDepth {
+		w.limited = true
+		return true
+	}
+
+	return false
+}
+
+// send queues p unless the walk was stopped
+func (w *walker) send(p string, err error) error {
+	select {
+	case w.jobs <- walkJob{w.count, p, err}:
+		w.count++
+		return nil
+	case <-w.stop:
+		return errWalkStopped
+	}
+}
+
+// walkDepth returns the number of directory levels between root and
+// the directory p
+func walkDepth(root, p string) int {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." {
+		return 0
+	}
+
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// matchAny reports whether p matches any of the glob patterns,
+// patterns without a separator are matched against the base name
+// and the others against the whole path
+func matchAny(patterns []string, p string) bool {
+	for _, pat := range patterns {
+		name := filepath.Base(p)
+		if strings.ContainsRune(pat, filepath.Separator) {
+			name = p
+		}
+		if ok, _ := filepath.Match(pat, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localResult returns the response to report for the file p, clean
+// files are not reported and errors are recorded on the response
+func localResult(p string, r *Response, err error) *Response {
+	if err != nil {
+		return &Response{
+			Filename:     p,
+			ErrorOccured: true,
+			Raw:          err.Error(),
+		}
+	}
+	if r == nil || (!r.Infected && !r.ErrorOccured) {
+		return nil
+	}
+
+	r.Filename = p
+
+	return r
+}
@@ -0,0 +1,392 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package sssp implements the SSSP protocol
+SSSP - Golang SSSP protocol implementation
+*/
+package sssp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp/protocol"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+func writeTree(t *testing.T, files map[string]string) (dir string) {
+	dir = t.TempDir()
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatalf("An error should not be returned: %s", err)
+		}
+	}
+
+	return
+}
+
+func TestScanLocalDir(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	dir := writeTree(t, map[string]string{
+		"a.txt":          "clean",
+		"eicar.com":      eicarVirus,
+		"sub/b.txt":      "clean",
+		"sub/eicar2.com": eicarVirus,
+	})
+	if err := os.Symlink(filepath.Join(dir, "eicar.com"), filepath.Join(dir, "link.com")); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	rs, err := p.ScanLocalDir(dir, true)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	expected := []string{filepath.Join(dir, "eicar.com"), filepath.Join(dir, "sub", "eicar2.com")}
+	if len(rs) != len(expected) {
+		t.Fatalf("len(rs) = %d, want %d", len(rs), len(expected))
+	}
+	for i, fn := range expected {
+		if rs[i].Filename != fn || !rs[i].Infected {
+			t.Errorf("rs[%d] = %+v, want an infected result for %s", i, rs[i], fn)
+		}
+	}
+	if n := len(ts.Requests()); n != 4 {
+		t.Errorf("Only regular files should be scanned, got %d requests", n)
+	}
+
+	if rs, err = p.ScanLocalDir(dir, false); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(rs) != 1 || rs[0].Filename != expected[0] {
+		t.Errorf("Subdirectories should not be walked: %+v", rs)
+	}
+
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	c.SetPipeline(2)
+	if rs, err = c.ScanLocalDir(dir, true); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(rs) != 2 || rs[1].Filename != expected[1] {
+		t.Errorf("Unexpected responses: %+v", rs)
+	}
+
+	if _, err = p.ScanLocalDir(filepath.Join(dir, "a.txt"), true); err == nil || err.Error() != fmt.Sprintf(notDirErr, filepath.Join(dir, "a.txt")) {
+		t.Errorf("An error should be returned for a file: %v", err)
+	}
+	if _, err = p.ScanLocalDir(filepath.Join(dir, "missing"), true); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("p.ScanLocalDir() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestScanLocalDirParallel(t *testing.T) {
+	files := make(map[string]string)
+	for n := 0; n < 8; n++ {
+		files[fmt.Sprintf("%d.txt", n)] = "clean"
+	}
+	dir := writeTree(t, files)
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	ts.Delay = 100 * time.Millisecond
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 4)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+	p.SetDirParallelism(4)
+
+	start := time.Now()
+	rs, err := p.ScanLocalDir(dir, false)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(rs) != 0 {
+		t.Errorf("Clean files should not be returned: %+v", rs)
+	}
+	if d := time.Since(start); d >= 700*time.Millisecond {
+		t.Errorf("The files should be scanned in parallel, took %s", d)
+	}
+}
+
+func TestScanLocalDirFatal(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "clean", "b.txt": "clean"})
+
+	ts := sssptest.NewServer(nil)
+	network, address := ts.Network, ts.Addr
+	ts.Close()
+
+	p, err := NewPool(network, address, time.Second, time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	if _, err = p.ScanLocalDir(dir, true); !errors.Is(err, ErrTemporary) {
+		t.Errorf("Connection failures should stop the walk: %v", err)
+	}
+
+	p.Close()
+	if _, err = p.ScanLocalDir(dir, true); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("p.ScanLocalDir() error = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestScanDirFallback(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"eicar.com":       eicarVirus,
+		"clean.txt":       "clean",
+		"inner/eicar.com": eicarVirus,
+	})
+
+	noDirs := func(r *sssptest.Request) *sssptest.Reply {
+		if r.Command == ScanDir.String() || r.Command == ScanDirr.String() {
+			return sssptest.Reject("4")
+		}
+		return sssptest.DefaultHandler(r)
+	}
+
+	ts := sssptest.NewServer(noDirs)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 1)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	var re *protocol.RejectError
+	if _, err = p.ScanDir(dir, true); !errors.As(err, &re) {
+		t.Fatalf("A RejectError should be returned without the fallback: %v", err)
+	}
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	c.SetDirFallback(true)
+	p.Put(c, nil)
+
+	r, err := p.ScanDir(dir, true)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 2 {
+		t.Fatalf("len(r) = %d, want 2", len(r))
+	}
+	for _, rs := range r {
+		if !rs.Infected || !rs.Fallback {
+			t.Errorf("Expected an infected fallback result: %+v", rs)
+		}
+	}
+	if r[0].Filename != filepath.Join(dir, "eicar.com") || r[1].Filename != filepath.Join(dir, "inner", "eicar.com") {
+		t.Errorf("The files should be reported in walk order: %s, %s", r[0].Filename, r[1].Filename)
+	}
+	reqs := ts.Requests()
+	if last := reqs[len(reqs)-1]; last.Command != ScanData.String() {
+		t.Errorf("Files should be streamed over tcp, got %s", last.Command)
+	}
+
+	if r, err = p.ScanDir(dir, false); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 1 {
+		t.Errorf("Only the top directory should be walked, got %d results", len(r))
+	}
+
+	us := sssptest.NewUnixServer(noDirs)
+	defer us.Close()
+
+	uc, err := NewClient(context.Background(), us.Network, us.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer uc.Close()
+	uc.SetDirFallback(true)
+
+	if r, err = uc.ScanDir(dir, true); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if len(r) != 2 {
+		t.Errorf("len(r) = %d, want 2", len(r))
+	}
+	reqs = us.Requests()
+	if last := reqs[len(reqs)-1]; last.Command != ScanFile.String() {
+		t.Errorf("Files should be scanned using SCANFILE over a unix socket, got %s", last.Command)
+	}
+}
+
+func TestScanLocalDirLimits(t *testing.T) {
+	files := map[string]string{
+		"a.com":       eicarVirus,
+		"b.com":       eicarVirus,
+		"c.com":       eicarVirus,
+		"d1/a.com":    eicarVirus,
+		"d1/d2/a.com": eicarVirus,
+	}
+	for i := 0; i < 27; i++ {
+		files[fmt.Sprintf("d1/d2/d3/%02d.com", i)] = eicarVirus
+	}
+	dir := writeTree(t, files)
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	tests := []struct {
+		name   string
+		limits WalkLimits
+		want   int
+		err    error
+	}{
+		{"unlimited", WalkLimits{}, 32, nil},
+		{"depth", WalkLimits{MaxDepth: 2}, 5, ErrWalkLimit},
+		{"depth not reached", WalkLimits{MaxDepth: 3}, 32, nil},
+		{"files", WalkLimits{MaxFiles: 4}, 4, ErrWalkLimit},
+		{"bytes", WalkLimits{MaxBytes: int64(len(eicarVirus)) * 3}, 3, ErrWalkLimit},
+		{"files not reached", WalkLimits{MaxFiles: 32}, 32, nil},
+	}
+	for _, tt := range tests {
+		p.SetWalkLimits(tt.limits)
+		r, err := p.ScanLocalDir(dir, true)
+		if err != tt.err {
+			t.Errorf("%s: p.ScanLocalDir() error = %v, want %v", tt.name, err, tt.err)
+		}
+		if len(r) != tt.want {
+			t.Errorf("%s: len(r) = %d, want %d", tt.name, len(r), tt.want)
+		}
+	}
+
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+	c.SetWalkLimits(WalkLimits{MaxFiles: 2})
+	r, err := c.ScanLocalDir(dir, true)
+	if err != ErrWalkLimit || len(r) != 2 || r[0].Filename != filepath.Join(dir, "a.com") {
+		t.Errorf("Expected the first 2 files with ErrWalkLimit, got %d results: %v", len(r), err)
+	}
+}
+
+func TestScanLocalDirOptions(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.com":         eicarVirus,
+		"b.txt":         "clean",
+		"skip.iso":      eicarVirus,
+		".git/a.com":    eicarVirus,
+		"sub/c.com":     eicarVirus,
+		"other/d.txt":   "clean",
+		"other/big.bin": "not scanned",
+	})
+	for name, target := range map[string]string{
+		"sub/loop":  "..",
+		"sub/other": "../other",
+		"again":     "other",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("Symbolic links are not supported: %s", err)
+		}
+	}
+
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	c, err := NewClient(context.Background(), ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer c.Close()
+
+	errSkipped := errors.New("skipped")
+	outcome := make(map[string]string)
+	c.SetWalkOptions(WalkOptions{
+		Exclude:        []string{"*.iso"},
+		ExcludeDirs:    []string{".git"},
+		FollowSymlinks: true,
+		Scan: func(p string) (*Response, error) {
+			if filepath.Ext(p) == ".bin" {
+				return nil, errSkipped
+			}
+			return c.ScanStream(p)
+		},
+		OnFile: func(p string, r *Response, err error) error {
+			var le *LinkError
+			rel, _ := filepath.Rel(dir, p)
+			switch {
+			case errors.As(err, &le) && le.Loop:
+				outcome[rel] = "loop"
+			case errors.As(err, &le):
+				outcome[rel] = "seen"
+			case err != nil:
+				outcome[rel] = err.Error()
+			case r.Infected:
+				outcome[rel] = "infected"
+			default:
+				outcome[rel] = "clean"
+			}
+			return nil
+		},
+	})
+
+	r, err := c.ScanLocalDir(dir, true)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	// the link from sub is skipped as again already walked other
+	want := map[string]string{
+		"a.com":                           "infected",
+		"b.txt":                           "clean",
+		filepath.Join("again", "d.txt"):   "clean",
+		filepath.Join("again", "big.bin"): "skipped",
+		filepath.Join("other", "d.txt"):   "clean",
+		filepath.Join("other", "big.bin"): "skipped",
+		filepath.Join("sub", "c.com"):     "infected",
+		filepath.Join("sub", "loop"):      "loop",
+		filepath.Join("sub", "other"):     "seen",
+	}
+	if fmt.Sprint(outcome) != fmt.Sprint(want) {
+		t.Errorf("Got outcomes %v, want %v", outcome, want)
+	}
+	// the link errors and the skipped files are returned like the
+	// files that could not be scanned
+	if len(r) != 6 {
+		t.Errorf("len(r) = %d, want 6", len(r))
+	}
+
+	stop := errors.New("stop")
+	c.SetWalkOptions(WalkOptions{OnFile: func(string, *Response, error) error { return stop }})
+	if _, err = c.ScanLocalDir(dir, true); err != stop {
+		t.Errorf("c.ScanLocalDir() error = %v, want %v", err, stop)
+	}
+}
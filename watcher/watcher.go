@@ -0,0 +1,274 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package watcher implements real time directory monitoring
+SSSP - Golang SSSP protocol implementation
+
+New and changed files in the monitored directories are scanned
+once writes to them have settled and the results are emitted on
+a channel.
+*/
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultDebounce = 500 * time.Millisecond
+	queueSize       = 256
+)
+
+// Scanner is the interface used to scan the changed files
+type Scanner interface {
+	ScanStream(string) (*sssp.Response, error)
+}
+
+// A Result represents the outcome of scanning a changed file
+type Result struct {
+	Path     string
+	Response *sssp.Response
+	Err      error
+}
+
+// A Watcher monitors directories and scans files as they change
+type Watcher struct {
+	scanner   Scanner
+	debounce  time.Duration
+	recursive bool
+	fw        *fsnotify.Watcher
+	results   chan *Result
+	queue     chan string
+	done      chan struct{}
+	m         sync.Mutex
+	pending   map[string]*time.Timer
+	closeOnce sync.Once
+}
+
+// SetDebounce sets the duration a file has to remain unchanged
+// before it is scanned
+func (w *Watcher) SetDebounce(d time.Duration) {
+	if d > 0 {
+		w.debounce = d
+	}
+}
+
+// SetRecursive sets whether sub directories, including ones
+// created after the watch starts, are monitored
+func (w *Watcher) SetRecursive(r bool) {
+	w.recursive = r
+}
+
+// Add starts monitoring the directory p
+func (w *Watcher) Add(p string) (err error) {
+	if !w.recursive {
+		err = w.fw.Add(p)
+		return
+	}
+
+	err = filepath.Walk(p, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return w.fw.Add(fp)
+		}
+		return nil
+	})
+
+	return
+}
+
+// Remove stops monitoring the directory p
+func (w *Watcher) Remove(p string) (err error) {
+	err = w.fw.Remove(p)
+
+	return
+}
+
+// Results returns the channel on which scan results are emitted,
+// it is closed when Run returns
+func (w *Watcher) Results() <-chan *Result {
+	return w.results
+}
+
+// Run processes file system events until the context is
+// cancelled or the watcher is closed
+func (w *Watcher) Run(ctx context.Context) (err error) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.scanLoop()
+	}()
+
+	defer func() {
+		w.Close()
+		wg.Wait()
+		close(w.results)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-w.done:
+			return
+		case ev, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			w.handle(ev)
+		case e, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			w.emit(&Result{Err: e})
+		}
+	}
+}
+
+// Close stops monitoring all directories and frees up
+// the resources used by the watcher
+func (w *Watcher) Close() (err error) {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.m.Lock()
+		for p, t := range w.pending {
+			t.Stop()
+			delete(w.pending, p)
+		}
+		w.m.Unlock()
+		err = w.fw.Close()
+	})
+
+	return
+}
+
+func (w *Watcher) handle(ev fsnotify.Event) {
+	if ev.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+		return
+	}
+
+	info, err := os.Stat(ev.Name)
+	if err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		if w.recursive && ev.Op&fsnotify.Create != 0 {
+			if err = w.Add(ev.Name); err != nil {
+				w.emit(&Result{Path: ev.Name, Err: err})
+				return
+			}
+			w.addFiles(ev.Name)
+		}
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		return
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.schedule(ev.Name)
+}
+
+// addFiles schedules the files already in the new directory p, they
+// may have been created or moved in before it was monitored
+func (w *Watcher) addFiles(p string) {
+	filepath.Walk(p, func(fp string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			w.m.Lock()
+			w.schedule(fp)
+			w.m.Unlock()
+		}
+		return nil
+	})
+}
+
+// schedule queues p for scanning once it has not changed for the
+// debounce duration, it is called with w.m held
+func (w *Watcher) schedule(p string) {
+	var t *time.Timer
+
+	if pt, ok := w.pending[p]; ok && pt.Stop() {
+		pt.Reset(w.debounce)
+		return
+	}
+
+	// a timer that could not be stopped has fired, its callback
+	// finds it was replaced and does nothing
+	t = time.AfterFunc(w.debounce, func() {
+		w.m.Lock()
+		if w.pending[p] != t {
+			w.m.Unlock()
+			return
+		}
+		delete(w.pending, p)
+		w.m.Unlock()
+		select {
+		case w.queue <- p:
+		case <-w.done:
+		}
+	})
+	w.pending[p] = t
+}
+
+func (w *Watcher) scanLoop() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case p := <-w.queue:
+			r, err := w.scanner.ScanStream(p)
+			if r != nil {
+				r.Filename = p
+			}
+			w.emit(&Result{Path: p, Response: r, Err: err})
+		}
+	}
+}
+
+func (w *Watcher) emit(r *Result) {
+	select {
+	case w.results <- r:
+	case <-w.done:
+	}
+}
+
+// NewWatcher creates and returns a new Watcher that uses s
+// to scan the changed files
+func NewWatcher(s Scanner) (w *Watcher, err error) {
+	var fw *fsnotify.Watcher
+
+	if fw, err = fsnotify.NewWatcher(); err != nil {
+		return
+	}
+
+	w = &Watcher{
+		scanner:  s,
+		debounce: defaultDebounce,
+		fw:       fw,
+		results:  make(chan *Result, queueSize),
+		queue:    make(chan string, queueSize),
+		done:     make(chan struct{}),
+		pending:  make(map[string]*time.Timer),
+	}
+
+	return
+}
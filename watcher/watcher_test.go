@@ -0,0 +1,194 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package watcher implements real time directory monitoring
+SSSP - Golang SSSP protocol implementation
+*/
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+type fakeScanner struct {
+	m     sync.Mutex
+	calls int
+}
+
+func (f *fakeScanner) ScanStream(p string) (r *sssp.Response, err error) {
+	var b []byte
+
+	f.m.Lock()
+	f.calls++
+	f.m.Unlock()
+	if b, err = ioutil.ReadFile(p); err != nil {
+		return
+	}
+	r = &sssp.Response{Filename: "stream"}
+	if bytes.Contains(b, []byte("EICAR")) {
+		r.Infected = true
+		r.Signature = "EICAR-AV-Test"
+	}
+	return
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &fakeScanner{}
+	w, err := NewWatcher(s)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	w.SetDebounce(50 * time.Millisecond)
+	w.SetRecursive(true)
+	if err = w.Add(dir); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go w.Run(ctx)
+
+	sub := filepath.Join(dir, "sub")
+	if err = os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("os.Mkdir() failed: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	fn := filepath.Join(sub, "eicar.txt")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatalf("os.Create() failed: %s", err)
+	}
+	for i := 0; i < len(eicarVirus); i += 8 {
+		end := i + 8
+		if end > len(eicarVirus) {
+			end = len(eicarVirus)
+		}
+		f.WriteString(eicarVirus[i:end])
+	}
+	f.Close()
+
+	select {
+	case r := <-w.Results():
+		if r.Err != nil {
+			t.Fatalf("An error should not be returned: %s", r.Err)
+		}
+		if r.Path != fn {
+			t.Errorf("r.Path = %q, want %q", r.Path, fn)
+		}
+		if r.Response.Filename != fn {
+			t.Errorf("r.Response.Filename = %q, want %q", r.Response.Filename, fn)
+		}
+		if !r.Response.Infected {
+			t.Errorf("r.Response.Infected = %t, want %t", r.Response.Infected, true)
+		}
+	case <-ctx.Done():
+		t.Fatalf("Timed out waiting for a result")
+	}
+
+	w.Close()
+	for range w.Results() {
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.calls != 1 {
+		t.Errorf("s.calls = %d, want %d", s.calls, 1)
+	}
+}
+
+func TestWatcherNewDir(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "new")
+	if err := os.MkdirAll(filepath.Join(src, "deeper"), 0755); err != nil {
+		t.Fatalf("os.MkdirAll() failed: %s", err)
+	}
+	for _, name := range []string{"eicar.txt", filepath.Join("deeper", "eicar.txt")} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(eicarVirus), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() failed: %s", err)
+		}
+	}
+
+	s := &fakeScanner{}
+	w, err := NewWatcher(s)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	w.SetDebounce(50 * time.Millisecond)
+	w.SetRecursive(true)
+	if err = w.Add(dir); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go w.Run(ctx)
+
+	// a directory moved in is not followed by events for its files
+	if err = os.Rename(src, filepath.Join(dir, "new")); err != nil {
+		t.Fatalf("os.Rename() failed: %s", err)
+	}
+
+	got := make(map[string]bool)
+	for len(got) < 2 {
+		select {
+		case r := <-w.Results():
+			if r.Err != nil {
+				t.Fatalf("An error should not be returned: %s", r.Err)
+			}
+			got[r.Path] = r.Response.Infected
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the files of the new directory, got %v", got)
+		}
+	}
+	for _, name := range []string{"eicar.txt", filepath.Join("deeper", "eicar.txt")} {
+		if p := filepath.Join(dir, "new", name); !got[p] {
+			t.Errorf("%s should be scanned and infected, got %v", p, got)
+		}
+	}
+	w.Close()
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	s := &fakeScanner{}
+	w, err := NewWatcher(s)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer w.Close()
+	w.SetDebounce(10 * time.Millisecond)
+
+	w.m.Lock()
+	w.schedule("/tmp/file")
+	// the timer fires and its callback waits for the lock while the
+	// next change arrives
+	time.Sleep(50 * time.Millisecond)
+	w.schedule("/tmp/file")
+	w.m.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := len(w.queue); n != 1 {
+		t.Errorf("len(w.queue) = %d, want 1", n)
+	}
+}
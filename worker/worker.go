@@ -0,0 +1,344 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package worker implements a scan job worker fed by a message queue
+SSSP - Golang SSSP protocol implementation
+
+Jobs are JSON encoded references to a local path or an object in an
+object store, they are consumed from a queue, scanned and the results
+are published to a result topic. Jobs that cannot be scanned after the
+configured number of retries are published to a dead letter topic.
+
+The queue is accessed via the Consumer and Producer interfaces so
+that Kafka, AMQP or any other broker client can be used.
+*/
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+)
+
+const (
+	defaultConcurrency = 4
+	defaultRetries     = 3
+	defaultBackoff     = 1 * time.Second
+	defaultResultTopic = "sssp.results"
+	defaultDLQTopic    = "sssp.deadletter"
+	// ErrorHeader is the header set on dead lettered messages
+	ErrorHeader = "x-sssp-error"
+	// AttemptsHeader is the header holding the number of attempts
+	AttemptsHeader = "x-sssp-attempts"
+	invalidJobErr  = "Invalid job: %s"
+	noObjectErr    = "Object jobs are not supported without an ObjectScanner"
+	noTargetErr    = "The job has neither a path nor an object reference"
+)
+
+// A Message represents a message consumed from or published
+// to a queue
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+	// Opaque can be used by Consumer implementations to
+	// track the broker specific delivery
+	Opaque interface{}
+}
+
+// Consumer is the interface implemented by queue consumers,
+// Commit acknowledges that the message has been handled,
+// implementations must be safe for concurrent use
+type Consumer interface {
+	Consume(ctx context.Context) (*Message, error)
+	Commit(ctx context.Context, m *Message) error
+}
+
+// Producer is the interface implemented by queue producers,
+// implementations must be safe for concurrent use
+type Producer interface {
+	Publish(ctx context.Context, m *Message) error
+}
+
+// Scanner is the interface used to scan local paths, it
+// is implemented by sssp.Pool
+type Scanner interface {
+	ScanFile(string) (*sssp.Response, error)
+	ScanDir(string, bool) ([]*sssp.Response, error)
+}
+
+// ObjectScanner is the interface used to scan object references,
+// it is implemented by objectstore.ObjectScanner
+type ObjectScanner interface {
+	Scan(ctx context.Context, bucket, key string) (*sssp.Response, error)
+}
+
+// A Job represents a scan job
+type Job struct {
+	ID        string `json:"id"`
+	Path      string `json:"path,omitempty"`
+	Dir       bool   `json:"dir,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// A Result represents the result of a scan job
+type Result struct {
+	Job       *Job             `json:"job"`
+	Infected  bool             `json:"infected"`
+	Responses []*sssp.Response `json:"responses"`
+	Attempts  int              `json:"attempts"`
+	Error     string           `json:"error,omitempty"`
+	Start     time.Time        `json:"start"`
+	End       time.Time        `json:"end"`
+}
+
+// A Worker consumes scan jobs and publishes their results
+type Worker struct {
+	consumer    Consumer
+	producer    Producer
+	scanner     Scanner
+	objects     ObjectScanner
+	concurrency int
+	retries     int
+	backoff     time.Duration
+	resultTopic string
+	dlqTopic    string
+}
+
+// SetObjectScanner sets the scanner used for object references
+func (w *Worker) SetObjectScanner(s ObjectScanner) {
+	w.objects = s
+}
+
+// SetConcurrency sets the number of jobs processed concurrently
+func (w *Worker) SetConcurrency(n int) {
+	if n > 0 {
+		w.concurrency = n
+	}
+}
+
+// SetRetries sets the number of times a failed scan is retried
+func (w *Worker) SetRetries(r int) {
+	if r >= 0 {
+		w.retries = r
+	}
+}
+
+// SetBackoff sets the initial delay between retries, the delay
+// doubles after each attempt
+func (w *Worker) SetBackoff(d time.Duration) {
+	if d > 0 {
+		w.backoff = d
+	}
+}
+
+// SetResultTopic sets the topic results are published to
+func (w *Worker) SetResultTopic(t string) {
+	if t != "" {
+		w.resultTopic = t
+	}
+}
+
+// SetDeadLetterTopic sets the topic failed jobs are published to
+func (w *Worker) SetDeadLetterTopic(t string) {
+	if t != "" {
+		w.dlqTopic = t
+	}
+}
+
+// Run consumes and processes jobs until ctx is cancelled or
+// the consumer returns an error, jobs being processed are
+// allowed to complete before returning
+func (w *Worker) Run(ctx context.Context) (err error) {
+	var wg sync.WaitGroup
+	var m sync.Mutex
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, e := w.consumer.Consume(ctx)
+				if e == nil {
+					e = w.Process(ctx, msg)
+				}
+				if e != nil {
+					m.Lock()
+					if err == nil && ctx.Err() == nil {
+						err = e
+					}
+					m.Unlock()
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// Process handles a single message, the result or dead letter
+// is published before the message is committed
+func (w *Worker) Process(ctx context.Context, msg *Message) (err error) {
+	var b []byte
+	var r *Result
+	var out *Message
+
+	j := &Job{}
+	if err = json.Unmarshal(msg.Value, j); err != nil {
+		r = &Result{Error: fmt.Sprintf(invalidJobErr, err)}
+	} else {
+		r = w.scan(ctx, j)
+	}
+
+	if r.Error != "" && len(r.Responses) == 0 {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		out = &Message{
+			Topic: w.dlqTopic,
+			Key:   msg.Key,
+			Value: msg.Value,
+			Headers: map[string]string{
+				ErrorHeader:    r.Error,
+				AttemptsHeader: fmt.Sprintf("%d", r.Attempts),
+			},
+		}
+	} else {
+		if b, err = json.Marshal(r); err != nil {
+			return
+		}
+		out = &Message{Topic: w.resultTopic, Key: msg.Key, Value: b}
+	}
+
+	if err = w.producer.Publish(ctx, out); err != nil {
+		return
+	}
+
+	err = w.consumer.Commit(ctx, msg)
+
+	return
+}
+
+func (w *Worker) scan(ctx context.Context, j *Job) (r *Result) {
+	var err error
+
+	r = &Result{Job: j, Start: time.Now()}
+	backoff := w.backoff
+
+	for r.Attempts = 1; ; r.Attempts++ {
+		if r.Responses, err = w.scanJob(ctx, j); err == nil || !retryable(err) || r.Attempts > w.retries {
+			break
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			err = ctx.Err()
+		case <-t.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, rs := range r.Responses {
+		if rs != nil && rs.Infected {
+			r.Infected = true
+		}
+	}
+	r.End = time.Now()
+
+	return
+}
+
+func (w *Worker) scanJob(ctx context.Context, j *Job) (r []*sssp.Response, err error) {
+	var rs *sssp.Response
+
+	switch {
+	case j.Path != "" && j.Dir:
+		r, err = w.scanner.ScanDir(j.Path, j.Recursive)
+		return
+	case j.Path != "":
+		rs, err = w.scanner.ScanFile(j.Path)
+	case j.Bucket != "" && j.Key != "":
+		if w.objects == nil {
+			err = errPermanent(noObjectErr)
+			return
+		}
+		rs, err = w.objects.Scan(ctx, j.Bucket, j.Key)
+	default:
+		err = errPermanent(noTargetErr)
+		return
+	}
+
+	if rs != nil {
+		r = []*sssp.Response{rs}
+	}
+
+	return
+}
+
+type permanentError struct {
+	msg string
+}
+
+func (e *permanentError) Error() string {
+	return e.msg
+}
+
+func errPermanent(m string) error {
+	return &permanentError{msg: m}
+}
+
+func retryable(err error) bool {
+	var p *permanentError
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	return !errors.As(err, &p)
+}
+
+// NewWorker creates and returns a new Worker
+func NewWorker(c Consumer, p Producer, s Scanner) (w *Worker) {
+	w = &Worker{
+		consumer:    c,
+		producer:    p,
+		scanner:     s,
+		concurrency: defaultConcurrency,
+		retries:     defaultRetries,
+		backoff:     defaultBackoff,
+		resultTopic: defaultResultTopic,
+		dlqTopic:    defaultDLQTopic,
+	}
+
+	return
+}
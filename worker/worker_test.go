@@ -0,0 +1,209 @@
+// Copyright (C) 2018-2021 Andrew Colin Kissa <andrew@datopdog.io>
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Package worker implements a scan job worker fed by a message queue
+SSSP - Golang SSSP protocol implementation
+*/
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baruwa-enterprise/sssp"
+	"github.com/baruwa-enterprise/sssp/sssptest"
+)
+
+const (
+	eicarVirus = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+)
+
+type queue struct {
+	in        chan *Message
+	m         sync.Mutex
+	published []*Message
+	committed int
+	done      chan struct{}
+	want      int
+}
+
+func (q *queue) Consume(ctx context.Context) (m *Message, err error) {
+	select {
+	case m = <-q.in:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+func (q *queue) Commit(ctx context.Context, m *Message) (err error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.committed++
+	if q.committed == q.want {
+		close(q.done)
+	}
+	return
+}
+
+func (q *queue) Publish(ctx context.Context, m *Message) (err error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.published = append(q.published, m)
+	return
+}
+
+type flakyScanner struct {
+	failures int
+	calls    int
+}
+
+func (f *flakyScanner) ScanFile(p string) (r *sssp.Response, err error) {
+	f.calls++
+	if f.calls <= f.failures {
+		err = errors.New("connection refused")
+		return
+	}
+	r = &sssp.Response{Filename: p}
+	return
+}
+
+func (f *flakyScanner) ScanDir(p string, recurse bool) (r []*sssp.Response, err error) {
+	return
+}
+
+type objects struct{}
+
+func (o *objects) Scan(ctx context.Context, bucket, key string) (r *sssp.Response, err error) {
+	r = &sssp.Response{Filename: bucket + "/" + key, Infected: true, Signature: sssptest.EicarSignature}
+	return
+}
+
+func message(t *testing.T, j *Job) *Message {
+	b, err := json.Marshal(j)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	return &Message{Key: []byte(j.ID), Value: b}
+}
+
+func TestRun(t *testing.T) {
+	ts := sssptest.NewServer(sssptest.DefaultHandler)
+	defer ts.Close()
+
+	p, err := sssp.NewPool(ts.Network, ts.Addr, 2*time.Second, 5*time.Second, 0, 2)
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer p.Close()
+
+	dir, err := ioutil.TempDir("", "worker")
+	if err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "eicar.txt")
+	if err = ioutil.WriteFile(fn, []byte(eicarVirus), 0644); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+
+	q := &queue{in: make(chan *Message, 4), done: make(chan struct{}), want: 4}
+	q.in <- message(t, &Job{ID: "1", Path: fn})
+	q.in <- message(t, &Job{ID: "2", Path: dir, Dir: true})
+	q.in <- message(t, &Job{ID: "3", Bucket: "bucket", Key: "key"})
+	q.in <- &Message{Key: []byte("4"), Value: []byte("{")}
+
+	w := NewWorker(q, q, p)
+	w.SetConcurrency(2)
+	w.SetObjectScanner(&objects{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	select {
+	case <-q.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The jobs were not processed")
+	}
+	cancel()
+	if err = <-errc; err != context.Canceled {
+		t.Errorf("Expected %v got %v", context.Canceled, err)
+	}
+
+	if len(q.published) != 4 {
+		t.Fatalf("len(q.published) = %d, want %d", len(q.published), 4)
+	}
+	for _, m := range q.published {
+		switch string(m.Key) {
+		case "4":
+			if m.Topic != defaultDLQTopic || m.Headers[ErrorHeader] == "" {
+				t.Errorf("Invalid jobs should be dead lettered: %+v", m)
+			}
+		default:
+			var r Result
+			if m.Topic != defaultResultTopic {
+				t.Errorf("m.Topic = %q, want %q", m.Topic, defaultResultTopic)
+			}
+			if err = json.Unmarshal(m.Value, &r); err != nil {
+				t.Fatalf("An error should not be returned: %s", err)
+			}
+			if !r.Infected {
+				t.Errorf("Job %s should be infected: %+v", m.Key, r)
+			}
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	q := &queue{done: make(chan struct{}), want: 2}
+
+	s := &flakyScanner{failures: 2}
+	w := NewWorker(q, q, s)
+	w.SetBackoff(time.Millisecond)
+	w.SetRetries(2)
+	if err := w.Process(context.Background(), message(t, &Job{ID: "1", Path: "/tmp/file"})); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if q.published[0].Topic != defaultResultTopic {
+		t.Errorf("The job should succeed after retrying: %+v", q.published[0])
+	}
+
+	s = &flakyScanner{failures: 5}
+	w = NewWorker(q, q, s)
+	w.SetBackoff(time.Millisecond)
+	w.SetRetries(2)
+	w.SetDeadLetterTopic("dlq")
+	if err := w.Process(context.Background(), message(t, &Job{ID: "2", Path: "/tmp/file"})); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if s.calls != 3 {
+		t.Errorf("s.calls = %d, want %d", s.calls, 3)
+	}
+	m := q.published[1]
+	if m.Topic != "dlq" || m.Headers[AttemptsHeader] != "3" {
+		t.Errorf("The job should be dead lettered: %+v", m)
+	}
+	if q.committed != 2 {
+		t.Errorf("q.committed = %d, want %d", q.committed, 2)
+	}
+
+	s = &flakyScanner{}
+	w = NewWorker(q, q, s)
+	if err := w.Process(context.Background(), message(t, &Job{ID: "3", Bucket: "b", Key: "k"})); err != nil {
+		t.Fatalf("An error should not be returned: %s", err)
+	}
+	if m = q.published[2]; m.Topic != defaultDLQTopic || m.Headers[AttemptsHeader] != "1" {
+		t.Errorf("Permanent errors should not be retried: %+v", m)
+	}
+}